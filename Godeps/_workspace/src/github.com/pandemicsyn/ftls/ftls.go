@@ -29,6 +29,9 @@ type Config struct {
 	CertFile           string
 	KeyFile            string
 	CAFile             string
+	// ServerName overrides the host name used to verify the server's
+	// certificate; useful when connecting by IP or through a proxy.
+	ServerName string
 }
 
 // DefaultServerFTLSConf returns a ftls config with the most commonly used config set.
@@ -73,15 +76,17 @@ func NewClientTLSConfig(c *Config) (*tls.Config, error) {
 			return &tls.Config{}, fmt.Errorf("Unable to load cert %s %s: %s", c.CertFile, c.KeyFile, err.Error())
 		}
 		tlsConf := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			RootCAs:      clientCertPool,
-			CipherSuites: c.CipherSet,
-			MinVersion:   DefaultMinVersion,
+			Certificates:       []tls.Certificate{cert},
+			RootCAs:            clientCertPool,
+			CipherSuites:       c.CipherSet,
+			MinVersion:         DefaultMinVersion,
+			ServerName:         c.ServerName,
+			InsecureSkipVerify: c.InsecureSkipVerify,
 		}
 		tlsConf.BuildNameToCertificate()
 		return tlsConf, nil
 	}
-	return &tls.Config{RootCAs: clientCertPool, InsecureSkipVerify: c.InsecureSkipVerify}, nil
+	return &tls.Config{RootCAs: clientCertPool, ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}, nil
 }
 
 // NewServerTLSConfig constructs a server tls.Conf from the provided ftls Config.
@@ -120,8 +125,8 @@ func NewServerTLSConfig(c *Config) (*tls.Config, error) {
 
 func NewGRPCClientDialOpt(c *Config) (grpc.DialOption, error) {
 	var opt grpc.DialOption
-	if c.InsecureSkipVerify {
-		return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})), nil
+	if c.InsecureSkipVerify && !c.MutualTLS {
+		return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{ServerName: c.ServerName, InsecureSkipVerify: true})), nil
 	}
 	tlsConf, err := NewClientTLSConfig(c)
 	if err != nil {
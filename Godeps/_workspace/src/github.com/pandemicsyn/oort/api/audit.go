@@ -0,0 +1,116 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes one mutation made through a Repl store, given to the
+// AuditSink config setting. Records are made for each Write and Delete,
+// including those made by CompareAndWrite, Create, and the like, for each
+// item of a WriteBatch, and for each Purge, whether they succeed, fail, or
+// are denied by the Authorizer.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Principal is who made the request, as set on its ctx with
+	// WithPrincipal, if at all.
+	Principal string `json:"principal,omitempty"`
+	// Store is "value" or "group".
+	Store string `json:"store"`
+	// Op is the operation, as in the Requests metric.
+	Op        string `json:"op"`
+	KeyA      uint64 `json:"keyA"`
+	KeyB      uint64 `json:"keyB"`
+	ChildKeyA uint64 `json:"childKeyA,omitempty"`
+	ChildKeyB uint64 `json:"childKeyB,omitempty"`
+	// TimestampMicro is that given with the request.
+	TimestampMicro int64 `json:"timestampMicro"`
+	// Length is that of the value written, before any encoding.
+	Length int `json:"length,omitempty"`
+	// Result is "ok", "denied", or "error", with Error giving the error.
+	Result  string        `json:"result"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"`
+	// Signature, with the AuditSigningKey config setting, is the hex
+	// HMAC-SHA256 of the record's JSON without the Signature, so altered
+	// records can be detected with VerifyAuditRecord.
+	Signature string `json:"signature,omitempty"`
+}
+
+func (rec *AuditRecord) sign(key []byte) error {
+	rec.Signature = ""
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	rec.Signature = hex.EncodeToString(mac.Sum(nil))
+	return nil
+}
+
+// VerifyAuditRecord reports whether the record's Signature is that the
+// AuditSigningKey given would make for it.
+func VerifyAuditRecord(rec *AuditRecord, key []byte) bool {
+	unsigned := *rec
+	if err := unsigned.sign(key); err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(unsigned.Signature), []byte(rec.Signature))
+}
+
+// AuditSink receives the AuditRecords of a Repl store. Audit is called once
+// the mutation is done, before it returns to the caller, so it should be
+// quick, such as by buffering; errors are logged with LogError.
+type AuditSink interface {
+	Audit(rec *AuditRecord) error
+}
+
+type auditWriterSink struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewAuditWriterSink returns an AuditSink writing each record to w as a line
+// of JSON, such as to an *os.File opened with os.O_APPEND. Writes are
+// serialized, so w need not be safe for concurrent use.
+func NewAuditWriterSink(w io.Writer) AuditSink {
+	return &auditWriterSink{enc: json.NewEncoder(w)}
+}
+
+func (s *auditWriterSink) Audit(rec *AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.enc.Encode(rec)
+}
+
+// AuditMessageWriter is a message queue producer, such as an adapter for a
+// Kafka writer, for NewAuditMessageSink.
+type AuditMessageWriter interface {
+	WriteMessage(key, value []byte) error
+}
+
+type auditMessageSink struct {
+	w AuditMessageWriter
+}
+
+// NewAuditMessageSink returns an AuditSink writing each record to w as JSON.
+// The message key is the record's KeyA and KeyB in hex, so the records for a
+// key, or for a group, stay in order on partitioned queues.
+func NewAuditMessageSink(w AuditMessageWriter) AuditSink {
+	return &auditMessageSink{w: w}
+}
+
+func (s *auditMessageSink) Audit(rec *AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.w.WriteMessage([]byte(fmt.Sprintf("%016x%016x", rec.KeyA, rec.KeyB)), b)
+}
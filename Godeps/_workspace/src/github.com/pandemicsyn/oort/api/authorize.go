@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// Authorizer is an optional hook, set with the Authorizer config setting,
+// called before each Lookup, Read, Write, Delete, and Purge, and each
+// LookupGroup and ReadGroup of a group store, so an embedding application
+// can enforce its access rules in one place, such as by the principal set on
+// the ctx with WithPrincipal. The op is the name of the operation, as in the
+// Requests metric, and keyA and keyB are the key, or the parent key for
+// group stores. Returning an error denies the operation, which then fails
+// with an error matching ErrPermissionDenied and wrapping the one returned.
+//
+// Operations built on those, such as CompareAndWrite or ReadMulti, are
+// authorized as the operations they make; WriteBatch authorizes each item as
+// a Write.
+type Authorizer func(ctx context.Context, op string, keyA, keyB uint64) error
+
+type permissionDeniedError struct {
+	op  string
+	err error
+}
+
+func (e *permissionDeniedError) Error() string {
+	return fmt.Sprintf("%s denied: %s", e.op, e.err)
+}
+
+func (e *permissionDeniedError) Is(target error) bool {
+	return target == ErrPermissionDenied
+}
+
+func (e *permissionDeniedError) Unwrap() error {
+	return e.err
+}
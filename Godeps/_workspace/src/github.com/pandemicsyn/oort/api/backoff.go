@@ -0,0 +1,82 @@
+package api
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ReplStoreBackoff is the reconnect backoff state of a backend store address,
+// as reported in ReplStoreStats.
+type ReplStoreBackoff struct {
+	// Failures is the number of consecutive connection failures.
+	Failures int
+	// Delay is how long the client is waiting before reconnecting.
+	Delay time.Duration
+	// RetryAt is when the client will next try to connect.
+	RetryAt time.Time
+}
+
+// reconnectBackoff tracks the exponential backoff, with jitter, of each
+// backend store address whose connection has failed.
+type reconnectBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	lock    sync.Mutex
+	addrs   map[string]*ReplStoreBackoff
+}
+
+func newReconnectBackoff(initial, max time.Duration) *reconnectBackoff {
+	return &reconnectBackoff{initial: initial, max: max, addrs: make(map[string]*ReplStoreBackoff)}
+}
+
+// fail records a connection failure for the addr and returns how long to wait
+// before reconnecting: doubling with each consecutive failure up to the max,
+// less up to a fifth at random so many clients don't reconnect in lockstep.
+func (b *reconnectBackoff) fail(addr string) time.Duration {
+	b.lock.Lock()
+	s := b.addrs[addr]
+	if s == nil {
+		s = &ReplStoreBackoff{}
+		b.addrs[addr] = s
+	}
+	s.Failures++
+	d := b.initial
+	for i := 1; i < s.Failures && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	d -= time.Duration(rand.Int63n(int64(d)/5 + 1))
+	s.Delay = d
+	s.RetryAt = time.Now().Add(d)
+	b.lock.Unlock()
+	return d
+}
+
+// reset forgets the failures of the addr, once it has connected.
+func (b *reconnectBackoff) reset(addr string) {
+	b.lock.Lock()
+	delete(b.addrs, addr)
+	b.lock.Unlock()
+}
+
+func (b *reconnectBackoff) snapshot() map[string]ReplStoreBackoff {
+	b.lock.Lock()
+	m := make(map[string]ReplStoreBackoff, len(b.addrs))
+	for addr, s := range b.addrs {
+		m[addr] = *s
+	}
+	b.lock.Unlock()
+	return m
+}
+
+// isConnectionError returns true for errors indicating the connection to a
+// backend store is unusable, rather than the request itself failing.
+func isConnectionError(err error) bool {
+	return grpc.Code(err) == codes.Unavailable
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	b := newReconnectBackoff(10*time.Millisecond, 35*time.Millisecond)
+	for _, want := range []time.Duration{10, 20, 35, 35} {
+		want *= time.Millisecond
+		// Up to a fifth is taken off at random.
+		if d := b.fail("a"); d > want || d < want-want/5 {
+			t.Fatalf("expected about %s, got %s", want, d)
+		}
+	}
+	b.fail("b")
+	if s := b.snapshot(); len(s) != 2 || s["a"].Failures != 4 || s["b"].Failures != 1 || s["b"].RetryAt.Before(time.Now()) {
+		t.Fatalf("unexpected state %+v", s)
+	}
+	b.reset("a")
+	if d := b.fail("a"); d > 10*time.Millisecond {
+		t.Fatalf("expected the backoff to start over, got %s", d)
+	}
+}
+
+func TestReconnectBackoffStore(t *testing.T) {
+	r, addrs := localRing(3, 0)
+	rs := NewReplValueStore(&ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{
+		RingSource:              &StaticRingSource{Ring: r},
+		ReconnectBackoffInitial: 50 * time.Millisecond,
+		ReconnectBackoffMax:     time.Second,
+	}})
+	var lock sync.Mutex
+	failing := true
+	attempts := 0
+	ms := map[string]*MemValueStore{}
+	for _, addr := range addrs {
+		ms[addr] = &MemValueStore{}
+	}
+	down := addrs[2]
+	rs.newBackendStore = func(addr string) (store.ValueStore, error) {
+		if addr != down {
+			return ms[addr], nil
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if failing {
+			return nil, errors.New("down")
+		}
+		return ms[addr], nil
+	}
+	rs.SetRing(r)
+	ctx := context.Background()
+	write := func(timestampMicro int64) {
+		if _, err := rs.Write(ctx, 1, 2, timestampMicro, []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(wantAttempts, wantFailures int, wantDelay time.Duration) {
+		lock.Lock()
+		n := attempts
+		lock.Unlock()
+		if n != wantAttempts {
+			t.Fatalf("expected %d connection attempts, got %d", wantAttempts, n)
+		}
+		stats, err := rs.Stats(ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, ok := stats.(*ReplStoreStats).Backoffs[down]
+		if wantFailures == 0 {
+			if ok {
+				t.Fatalf("expected no backoff, got %+v", b)
+			}
+			return
+		}
+		if b.Failures != wantFailures || b.Delay > wantDelay || b.Delay < wantDelay-wantDelay/5 {
+			t.Fatalf("expected %d failures and about %s, got %+v", wantFailures, wantDelay, b)
+		}
+	}
+	write(5)
+	check(1, 1, 50*time.Millisecond)
+	// Requests fail fast until the backoff has passed.
+	write(6)
+	check(1, 1, 50*time.Millisecond)
+	time.Sleep(80 * time.Millisecond)
+	write(7)
+	check(2, 2, 100*time.Millisecond)
+	// Once connected again, the backoff is reset.
+	lock.Lock()
+	failing = false
+	lock.Unlock()
+	time.Sleep(150 * time.Millisecond)
+	write(8)
+	check(3, 0, 0)
+	if ts, _, err := ms[down].Lookup(ctx, 1, 2); err != nil || ts != 8 {
+		t.Fatalf("expected the reconnected store written to, got %d %v", ts, err)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWriteBatchSplits(t *testing.T) {
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ValueCap: 64, SplitLargeValues: true}})
+	ctx := context.Background()
+	large := bytes.Repeat([]byte("0123456789"), 50)
+	results := rs.WriteBatch(ctx, []ValueWriteItem{
+		{KeyA: 1, KeyB: 2, TimestampMicro: 5, Value: []byte("small")},
+		{KeyA: 3, KeyB: 4, TimestampMicro: 5, Value: large},
+	})
+	for i, res := range results {
+		if res.Err != nil {
+			t.Fatalf("item %d: %s", i, res.Err)
+		}
+	}
+	_, raw, err := ms[0].Read(ctx, 3, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, _, err := parseFrame(raw); err != nil || h.flags&frameSplitManifest == 0 {
+		t.Fatalf("expected a split manifest stored, got %q %v", raw, err)
+	}
+	if _, v, err := rs.Read(ctx, 3, 4, nil); err != nil || !bytes.Equal(v, large) {
+		t.Fatalf("expected %q, got %q %v", large, v, err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "small" {
+		t.Fatalf("expected small, got %q %v", v, err)
+	}
+}
+
+func TestWriteBatchWakesWatchers(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, nil)
+	ctx := context.Background()
+	wake, unwatch := rs.watchers.add(1, 2)
+	defer unwatch()
+	if res := rs.WriteBatch(ctx, []ValueWriteItem{{KeyA: 1, KeyB: 2, TimestampMicro: 5, Value: []byte("a")}}); res[0].Err != nil {
+		t.Fatal(res[0].Err)
+	}
+	select {
+	case <-wake:
+	case <-time.After(time.Second):
+		t.Fatal("expected the watcher woken")
+	}
+}
+
+func TestWriteBatchRetries(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}}})
+	ctx := context.Background()
+	// Every replica fails the first attempt.
+	failure := ScriptedResponse{Err: errors.New("unavailable")}
+	for _, ss := range sss {
+		ss.Push("Write", failure)
+	}
+	if res := rs.WriteBatch(ctx, []ValueWriteItem{{KeyA: 1, KeyB: 2, TimestampMicro: 5, Value: []byte("a")}}); res[0].Err != nil {
+		t.Fatalf("expected a retry to succeed, got %s", res[0].Err)
+	}
+	for i, ss := range sss {
+		writes := 0
+		for _, call := range ss.Calls() {
+			if call.Op == "Write" {
+				writes++
+			}
+		}
+		if writes != 2 {
+			t.Fatalf("expected replica %d written to twice, got %d", i, writes)
+		}
+	}
+	// Without retries the failures are returned.
+	rs, sss = NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{MaxAttempts: 1}}})
+	for _, ss := range sss {
+		ss.Push("Write", failure)
+	}
+	if res := rs.WriteBatch(ctx, []ValueWriteItem{{KeyA: 1, KeyB: 2, TimestampMicro: 5, Value: []byte("a")}}); res[0].Err == nil {
+		t.Fatal("expected the write to fail")
+	}
+}
+
+// denyKeyA returns a middleware failing Writes to keyA with
+// ErrPermissionDenied, recording the keyAs of the Writes it sees.
+func denyKeyA(keyA uint64, lock *sync.Mutex, seen *[]uint64) ValueMiddleware {
+	return func(next ValueHandler) ValueHandler {
+		return func(ctx context.Context, req ValueRequest) ValueResponse {
+			if req.Op != "Write" {
+				return next(ctx, req)
+			}
+			lock.Lock()
+			*seen = append(*seen, req.KeyA)
+			lock.Unlock()
+			if req.KeyA == keyA {
+				return ValueResponse{Err: ErrPermissionDenied}
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+func TestWriteBatchMiddleware(t *testing.T) {
+	var lock sync.Mutex
+	var seen []uint64
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{Middleware: []ValueMiddleware{denyKeyA(3, &lock, &seen)}})
+	ctx := context.Background()
+	results := rs.WriteBatch(ctx, []ValueWriteItem{
+		{KeyA: 1, KeyB: 2, TimestampMicro: 5, Value: []byte("a")},
+		{KeyA: 3, KeyB: 4, TimestampMicro: 5, Value: []byte("b")},
+	})
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrPermissionDenied) {
+		t.Fatalf("expected just the second item denied, got %+v", results)
+	}
+	if _, _, err := ms[0].Lookup(ctx, 3, 4); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the denied item not written, got %v", err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(seen) != 2 {
+		t.Fatalf("expected the middleware to see both items, got %v", seen)
+	}
+}
+
+func TestWriteAllMiddleware(t *testing.T) {
+	var lock sync.Mutex
+	var seen []uint64
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{Middleware: []ValueMiddleware{denyKeyA(3, &lock, &seen)}})
+	ctx := context.Background()
+	err := rs.WriteAll(ctx, []ValueWriteItem{
+		{KeyA: 1, KeyB: 2, TimestampMicro: 5, Value: []byte("a")},
+		{KeyA: 3, KeyB: 4, TimestampMicro: 5, Value: []byte("b")},
+	})
+	var werr *ValueWriteAllError
+	if !errors.As(err, &werr) || !werr.RolledBack() || !errors.Is(werr.Results[1].Err, ErrPermissionDenied) {
+		t.Fatalf("expected the denied item to roll back the others, got %v", err)
+	}
+	if _, _, err := ms[0].Lookup(ctx, 1, 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the first item rolled back, got %v", err)
+	}
+}
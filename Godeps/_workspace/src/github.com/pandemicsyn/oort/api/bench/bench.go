@@ -0,0 +1,383 @@
+// Package bench generates load against oort value and group stores and
+// reports throughput and latency percentiles, for capacity planning and
+// regression testing. It works with any store.ValueStore or
+// store.GroupStore, such as the api package's replicated clients:
+//
+//	res, err := bench.Run(ctx, bench.ValueTarget(vs), &bench.Config{
+//	    Duration:    time.Minute,
+//	    Concurrency: 64,
+//	    ReadRatio:   0.9,
+//	})
+//	fmt.Print(res)
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// Op is a kind of request made by Run.
+type Op int
+
+const (
+	OpRead Op = iota
+	OpWrite
+	OpDelete
+	opCount
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("op%d", int(op))
+}
+
+// Distribution is how Run picks the key for each request.
+type Distribution int
+
+const (
+	// Uniform picks keys uniformly at random.
+	Uniform Distribution = iota
+	// Zipf picks keys with a Zipf distribution, so a few keys are hot; see
+	// Config.ZipfS.
+	Zipf
+	// Sequential cycles through the keys in order.
+	Sequential
+)
+
+// Config sets the load Run generates. The zero value of each field gives
+// the default noted.
+type Config struct {
+	// Duration is how long to run for; if zero, Requests must be set.
+	Duration time.Duration
+	// Requests is how many requests to make, if Duration is zero.
+	Requests int
+	// Concurrency is how many requests are kept in flight; default 16.
+	Concurrency int
+	// Keys is how many distinct keys are used; default 10000.
+	Keys int
+	// Distribution is how keys are picked; default Uniform.
+	Distribution Distribution
+	// ZipfS is the s parameter of the Zipf distribution, above 1; the
+	// larger it is the hotter the hottest keys. Default 1.1.
+	ZipfS float64
+	// ValueSize is the size of values written; default 128.
+	ValueSize int
+	// ValueSizeMax, if above ValueSize, has each write pick its size
+	// uniformly between ValueSize and ValueSizeMax.
+	ValueSizeMax int
+	// ReadRatio and DeleteRatio are the fractions of requests that are
+	// reads and deletes; the rest are writes. Both zero means all writes.
+	ReadRatio   float64
+	DeleteRatio float64
+	// Prefill writes every key once before the run, untimed, so reads find
+	// values.
+	Prefill bool
+	// Seed seeds the random choices; zero uses the time.
+	Seed int64
+}
+
+// Target is what Run sends requests to; ValueTarget and GroupTarget give
+// Targets for the store types. Key is in [0, Config.Keys).
+type Target interface {
+	Read(ctx context.Context, key uint64, value []byte) ([]byte, error)
+	Write(ctx context.Context, key uint64, timestampMicro int64, value []byte) error
+	Delete(ctx context.Context, key uint64, timestampMicro int64) error
+}
+
+// ValueTarget returns a Target for vs, using the keys (keyA, key) for a keyA
+// chosen at random, so separate runs do not share keys.
+func ValueTarget(vs store.ValueStore) Target {
+	return &valueTarget{vs: vs, keyA: uint64(rand.Int63())}
+}
+
+type valueTarget struct {
+	vs   store.ValueStore
+	keyA uint64
+}
+
+func (t *valueTarget) Read(ctx context.Context, key uint64, value []byte) ([]byte, error) {
+	_, value, err := t.vs.Read(ctx, t.keyA, key, value)
+	return value, err
+}
+
+func (t *valueTarget) Write(ctx context.Context, key uint64, timestampMicro int64, value []byte) error {
+	_, err := t.vs.Write(ctx, t.keyA, key, timestampMicro, value)
+	return err
+}
+
+func (t *valueTarget) Delete(ctx context.Context, key uint64, timestampMicro int64) error {
+	_, err := t.vs.Delete(ctx, t.keyA, key, timestampMicro)
+	return err
+}
+
+// GroupTarget returns a Target for gs spreading the keys across the number
+// of groups given, each key a child of group key%groups. The group keys are
+// chosen at random, so separate runs do not share keys.
+func GroupTarget(gs store.GroupStore, groups int) Target {
+	if groups < 1 {
+		groups = 1
+	}
+	return &groupTarget{gs: gs, keyA: uint64(rand.Int63()), groups: uint64(groups)}
+}
+
+type groupTarget struct {
+	gs     store.GroupStore
+	keyA   uint64
+	groups uint64
+}
+
+func (t *groupTarget) Read(ctx context.Context, key uint64, value []byte) ([]byte, error) {
+	_, value, err := t.gs.Read(ctx, t.keyA, key%t.groups, key, 0, value)
+	return value, err
+}
+
+func (t *groupTarget) Write(ctx context.Context, key uint64, timestampMicro int64, value []byte) error {
+	_, err := t.gs.Write(ctx, t.keyA, key%t.groups, key, 0, timestampMicro, value)
+	return err
+}
+
+func (t *groupTarget) Delete(ctx context.Context, key uint64, timestampMicro int64) error {
+	_, err := t.gs.Delete(ctx, t.keyA, key%t.groups, key, 0, timestampMicro)
+	return err
+}
+
+// OpResult reports on the requests of one Op in a run.
+type OpResult struct {
+	Requests int64
+	// Errors counts failed requests; reads not finding a value are
+	// counted in NotFound instead.
+	Errors   int64
+	NotFound int64
+	// Latency gives percentiles of request latency, errors included.
+	Latency *Histogram
+}
+
+// Result reports on a run.
+type Result struct {
+	Elapsed time.Duration
+	Ops     map[Op]*OpResult
+}
+
+// Requests returns the total requests made.
+func (r *Result) Requests() int64 {
+	var n int64
+	for _, o := range r.Ops {
+		n += o.Requests
+	}
+	return n
+}
+
+// Throughput returns requests per second over the run.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests()) / r.Elapsed.Seconds()
+}
+
+// String gives a table of the result, one line per op.
+func (r *Result) String() string {
+	s := fmt.Sprintf("%d requests in %s, %.0f/s\n", r.Requests(), r.Elapsed, r.Throughput())
+	s += fmt.Sprintf("%-6s %10s %8s %8s %10s %10s %10s %10s %10s\n", "op", "requests", "errors", "notfound", "mean", "p50", "p90", "p99", "max")
+	for op := Op(0); op < opCount; op++ {
+		o := r.Ops[op]
+		if o == nil || o.Requests == 0 {
+			continue
+		}
+		h := o.Latency
+		s += fmt.Sprintf("%-6s %10d %8d %8d %10s %10s %10s %10s %10s\n", op, o.Requests, o.Errors, o.NotFound, h.Mean(), h.Percentile(50), h.Percentile(90), h.Percentile(99), h.Max())
+	}
+	return s
+}
+
+// Run generates load against t as cfg sets until the duration or request
+// count is reached or ctx is done.
+func Run(ctx context.Context, t Target, cfg *Config) (*Result, error) {
+	c := *cfg
+	if c.Duration <= 0 && c.Requests <= 0 {
+		return nil, errors.New("bench: one of Duration or Requests must be set")
+	}
+	if c.ReadRatio < 0 || c.DeleteRatio < 0 || c.ReadRatio+c.DeleteRatio > 1 {
+		return nil, errors.New("bench: ReadRatio and DeleteRatio must be at least 0 and add up to at most 1")
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 16
+	}
+	if c.Keys <= 0 {
+		c.Keys = 10000
+	}
+	if c.ZipfS <= 1 {
+		c.ZipfS = 1.1
+	}
+	if c.ValueSize <= 0 {
+		c.ValueSize = 128
+	}
+	if c.ValueSizeMax < c.ValueSize {
+		c.ValueSizeMax = c.ValueSize
+	}
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	value := make([]byte, c.ValueSizeMax)
+	rand.New(rand.NewSource(c.Seed)).Read(value)
+	clock := &clock{}
+	if c.Prefill {
+		if err := prefill(ctx, t, &c, value, clock); err != nil {
+			return nil, err
+		}
+	}
+	if c.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Duration)
+		defer cancel()
+	}
+	var issued, sequential int64
+	results := make([]map[Op]*OpResult, c.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < c.Concurrency; w++ {
+		results[w] = newOpResults()
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(c.Seed + int64(w) + 1))
+			var zipf *rand.Zipf
+			if c.Distribution == Zipf {
+				zipf = rand.NewZipf(rnd, c.ZipfS, 1, uint64(c.Keys-1))
+			}
+			buf := make([]byte, 0, c.ValueSizeMax)
+			for ctx.Err() == nil {
+				if c.Duration <= 0 && atomic.AddInt64(&issued, 1) > int64(c.Requests) {
+					return
+				}
+				var key uint64
+				switch c.Distribution {
+				case Zipf:
+					key = zipf.Uint64()
+				case Sequential:
+					key = uint64(atomic.AddInt64(&sequential, 1)-1) % uint64(c.Keys)
+				default:
+					key = uint64(rnd.Intn(c.Keys))
+				}
+				op := OpWrite
+				if p := rnd.Float64(); p < c.ReadRatio {
+					op = OpRead
+				} else if p < c.ReadRatio+c.DeleteRatio {
+					op = OpDelete
+				}
+				reqStart := time.Now()
+				var err error
+				switch op {
+				case OpRead:
+					_, err = t.Read(ctx, key, buf[:0])
+				case OpWrite:
+					size := c.ValueSize
+					if c.ValueSizeMax > c.ValueSize {
+						size += rnd.Intn(c.ValueSizeMax - c.ValueSize + 1)
+					}
+					err = t.Write(ctx, key, clock.next(), value[:size])
+				case OpDelete:
+					err = t.Delete(ctx, key, clock.next())
+				}
+				if err != nil && ctx.Err() != nil {
+					// Requests cut short by the end of the run are not
+					// counted.
+					return
+				}
+				o := results[w][op]
+				o.Requests++
+				o.Latency.Record(time.Since(reqStart))
+				if store.IsNotFound(err) {
+					o.NotFound++
+				} else if err != nil {
+					o.Errors++
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	res := &Result{Elapsed: time.Since(start), Ops: newOpResults()}
+	for _, r := range results {
+		for op, o := range r {
+			ro := res.Ops[op]
+			ro.Requests += o.Requests
+			ro.Errors += o.Errors
+			ro.NotFound += o.NotFound
+			ro.Latency.Merge(o.Latency)
+		}
+	}
+	return res, nil
+}
+
+func newOpResults() map[Op]*OpResult {
+	m := make(map[Op]*OpResult, opCount)
+	for op := Op(0); op < opCount; op++ {
+		m[op] = &OpResult{Latency: &Histogram{}}
+	}
+	return m
+}
+
+func prefill(ctx context.Context, t Target, c *Config, value []byte, clock *clock) error {
+	var next int64
+	var firstErr error
+	var errLock sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < c.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key := atomic.AddInt64(&next, 1) - 1
+				if key >= int64(c.Keys) || ctx.Err() != nil {
+					return
+				}
+				if err := t.Write(ctx, uint64(key), clock.next(), value[:c.ValueSize]); err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("bench: prefill: %s", err)
+					}
+					errLock.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// clock hands out increasing timestamps, so each write or delete of a key
+// supersedes the last.
+type clock struct {
+	last int64
+}
+
+func (c *clock) next() int64 {
+	for {
+		last := atomic.LoadInt64(&c.last)
+		t := time.Now().UnixNano() / 1000
+		if t <= last {
+			t = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&c.last, last, t) {
+			return t
+		}
+	}
+}
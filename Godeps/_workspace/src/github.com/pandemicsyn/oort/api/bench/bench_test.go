@@ -0,0 +1,75 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &Histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	for _, c := range []struct {
+		p      float64
+		expect time.Duration
+	}{
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{100, 1000 * time.Millisecond},
+	} {
+		got := h.Percentile(c.p)
+		if got < c.expect || got > c.expect+c.expect/histogramSubBuckets {
+			t.Errorf("p%v: expected about %s; got %s", c.p, c.expect, got)
+		}
+	}
+	if h.Max() != time.Second || h.Mean() != 500500*time.Microsecond {
+		t.Errorf("unexpected max %s mean %s", h.Max(), h.Mean())
+	}
+	for i := 0; i < 200; i++ {
+		if d := histogramBucketMax(i); histogramBucket(d) != i || histogramBucket(d+time.Microsecond) != i+1 {
+			t.Fatalf("bucket %d max %s is not the bucket's last microsecond", i, d)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	vs, _ := api.NewMemReplValueStore(3, nil)
+	gs, _ := api.NewMemReplGroupStore(3, nil)
+	for _, target := range []Target{ValueTarget(vs), GroupTarget(gs, 10)} {
+		res, err := Run(context.Background(), target, &Config{
+			Requests:     2000,
+			Concurrency:  8,
+			Keys:         100,
+			Distribution: Zipf,
+			ValueSize:    10,
+			ValueSizeMax: 20,
+			ReadRatio:    0.7,
+			DeleteRatio:  0.1,
+			Prefill:      true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Requests() != 2000 {
+			t.Fatalf("expected 2000 requests; got %d\n%s", res.Requests(), res)
+		}
+		for op, o := range res.Ops {
+			if o.Requests == 0 || o.Errors != 0 || o.Latency.Count() != o.Requests {
+				t.Fatalf("unexpected %s result\n%s", op, res)
+			}
+		}
+	}
+	if _, err := Run(context.Background(), ValueTarget(vs), &Config{}); err == nil {
+		t.Fatal("expected an error with no Duration or Requests")
+	}
+	res, err := Run(context.Background(), ValueTarget(vs), &Config{Duration: 50 * time.Millisecond, Distribution: Sequential})
+	if err != nil || res.Requests() == 0 || res.Ops[OpWrite].Requests != res.Requests() {
+		t.Fatalf("unexpected timed run %v\n%s", err, res)
+	}
+}
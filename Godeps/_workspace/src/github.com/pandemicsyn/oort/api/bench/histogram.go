@@ -0,0 +1,125 @@
+package bench
+
+import (
+	"time"
+)
+
+// histogramSubBuckets is how many linear buckets each power of two range of
+// durations is split into, bounding the error of a percentile to about
+// 1/histogramSubBuckets.
+const histogramSubBuckets = 32
+
+// Histogram records durations in log linear buckets, keeping memory fixed
+// however many are recorded. The zero value is ready to use; it is not safe
+// for concurrent use.
+type Histogram struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func histogramBucket(d time.Duration) int {
+	n := uint64(d / time.Microsecond)
+	if n < histogramSubBuckets {
+		return int(n)
+	}
+	exp := 0
+	for n >= 2*histogramSubBuckets {
+		n >>= 1
+		exp++
+	}
+	return (exp+1)*histogramSubBuckets + int(n) - histogramSubBuckets
+}
+
+// histogramBucketMax returns the largest duration, in whole microseconds,
+// that falls in the bucket.
+func histogramBucketMax(i int) time.Duration {
+	if i < histogramSubBuckets {
+		return time.Duration(i) * time.Microsecond
+	}
+	exp := uint(i/histogramSubBuckets - 1)
+	n := uint64(i%histogramSubBuckets + histogramSubBuckets)
+	return time.Duration(((n+1)<<exp)-1) * time.Microsecond
+}
+
+// Record adds a duration.
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := histogramBucket(d)
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Merge adds the durations recorded in o.
+func (h *Histogram) Merge(o *Histogram) {
+	if len(o.counts) > len(h.counts) {
+		counts := make([]int64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.count += o.count
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// Count returns how many durations were recorded.
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Mean returns the mean duration recorded.
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Max returns the largest duration recorded.
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the duration that p percent of those recorded are at
+// or below, such as 99 for the 99th percentile, to the precision of the
+// buckets.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	want := int64(p / 100 * float64(h.count))
+	if float64(want) < p/100*float64(h.count) {
+		want++
+	}
+	if want < 1 {
+		want = 1
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= want {
+			if d := histogramBucketMax(i); d < h.max {
+				return d
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
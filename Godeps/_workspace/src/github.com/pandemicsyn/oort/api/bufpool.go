@@ -0,0 +1,32 @@
+package api
+
+import "sync"
+
+// maxPooledBuffer is the largest buffer kept for reuse; larger ones, from
+// the occasional huge value, are left to the garbage collector rather than
+// pinning that memory in the pool.
+const maxPooledBuffer = 4 * 1024 * 1024
+
+// readBuffers holds the buffers replica reads are received into. With
+// several replicas read for each Read only one value is kept, so reusing the
+// others' buffers saves most of the per call allocations.
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+func getReadBuffer() []byte {
+	return (*readBuffers.Get().(*[]byte))[:0]
+}
+
+// putReadBuffer returns b to the pool; b must not be used afterwards. It is
+// fine to pass a nil b.
+func putReadBuffer(b []byte) {
+	if cap(b) == 0 || cap(b) > maxPooledBuffer {
+		return
+	}
+	b = b[:0]
+	readBuffers.Put(&b)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestReadCache(t *testing.T) {
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadCacheSize: 10, ReadCacheTTL: time.Hour}})
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	// Changes made behind this client's back are not seen while cached.
+	for _, m := range ms {
+		m.Write(ctx, 1, 2, 6, []byte("b"))
+	}
+	ts, v, err := rs.Read(ctx, 1, 2, []byte("x"))
+	if err != nil || ts != 5 || string(v) != "xa" {
+		t.Fatalf("expected the cached a at 5 appended, got %q at %d %v", v, ts, err)
+	}
+	// Changing what was returned must not change what is cached.
+	v[1] = 'z'
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	// A Write through this client removes the entry.
+	if _, err := rs.Write(ctx, 1, 2, 7, []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 7 || string(v) != "c" {
+		t.Fatalf("expected c at 7, got %q at %d %v", v, ts, err)
+	}
+	// So does a Delete.
+	if _, err := rs.Delete(ctx, 1, 2, 8); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %q %v", v, err)
+	}
+}
+
+func TestReadCacheTTL(t *testing.T) {
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadCacheSize: 10, ReadCacheTTL: 10 * time.Millisecond}})
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	for _, m := range ms {
+		m.Write(ctx, 1, 2, 6, []byte("b"))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 6 || string(v) != "b" {
+		t.Fatalf("expected b at 6 once expired, got %q at %d %v", v, ts, err)
+	}
+}
+
+func TestReadCacheEvicts(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadCacheSize: 2, ReadCacheTTL: time.Hour}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	}
+	for _, keyA := range []uint64{1, 2, 1, 3, 1, 2} {
+		if _, _, err := rs.Read(ctx, keyA, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Key 1, the most recently used each time, stays cached; key 2 is
+	// evicted by key 3 and read again.
+	reads := map[uint64]int{}
+	for _, call := range sss[0].Calls() {
+		reads[call.KeyA]++
+	}
+	if reads[1] != 1 || reads[2] != 2 || reads[3] != 1 {
+		t.Fatalf("unexpected reads per key %v", reads)
+	}
+}
+
+func TestNotFoundCache(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{NotFoundCacheSize: 10, NotFoundCacheTTL: time.Hour}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: ErrNotFound})
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := rs.Lookup(ctx, 1, 2); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+		if _, _, err := rs.Read(ctx, 1, 2, nil); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+	if n := countCalls(sss[0], "Lookup") + countCalls(sss[0], "Read"); n != 1 {
+		t.Fatalf("expected one request to the backend, got %d", n)
+	}
+	// A Write through this client removes the entry.
+	for _, ss := range sss {
+		ss.Push("Write", ScriptedResponse{})
+		ss.Push("Read", ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	}
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// These context helpers override the Repl stores' configured behavior for
+// the requests made with the ctx returned, so one store can serve mixed
+// workloads; see also WithPriority and WithWriteAck. For example, a latency
+// sensitive read might use:
+//
+//  ctx = WithReadStrategy(ctx, ReadFastest)
+//  ctx = WithRetryPolicy(ctx, nil)
+//  _, value, err := rs.Read(ctx, keyA, keyB, nil)
+
+type readStrategyKey struct{}
+
+type retryPolicyKey struct{}
+
+type requestTimeoutKey struct{}
+
+type replicaKey struct{}
+
+type principalKey struct{}
+
+// WithReadStrategy returns a copy of the ctx that will cause Lookups and
+// Reads made with it to use the ReadStrategy given.
+func WithReadStrategy(ctx context.Context, s ReadStrategy) context.Context {
+	return context.WithValue(ctx, readStrategyKey{}, s)
+}
+
+// ReadStrategyFrom returns the ReadStrategy set on the ctx with
+// WithReadStrategy, or def if none was set.
+func ReadStrategyFrom(ctx context.Context, def ReadStrategy) ReadStrategy {
+	if s, ok := ctx.Value(readStrategyKey{}).(ReadStrategy); ok {
+		return s
+	}
+	return def
+}
+
+// WithRetryPolicy returns a copy of the ctx that will cause requests made
+// with it to use the RetryPolicy given; a nil p disables retries.
+func WithRetryPolicy(ctx context.Context, p *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, resolveRetryPolicy(p))
+}
+
+// RetryPolicyFrom returns the RetryPolicy set on the ctx with
+// WithRetryPolicy, or def if none was set.
+func RetryPolicyFrom(ctx context.Context, def *RetryPolicy) *RetryPolicy {
+	if p, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		return p
+	}
+	return def
+}
+
+// WithRequestTimeout returns a copy of the ctx that will cause each request
+// made with it to a backend store to be limited to d, in place of
+// DefaultRequestTimeout, when the ctx has no deadline; 0 means no limit.
+func WithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, d)
+}
+
+// WithReplica returns a copy of the ctx that will cause Lookups and Reads,
+// including LookupGroup and ReadGroup, made with it to go to the backend
+// store at addr alone rather than to the replicas the ring gives, and to
+// bypass the read caches; for looking into replica divergence and for admin
+// tooling. The addr need not be in the ring. Writes and deletes ignore it.
+func WithReplica(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, replicaKey{}, addr)
+}
+
+// ReplicaFrom returns the address set on the ctx with WithReplica, or "" if
+// none was set.
+func ReplicaFrom(ctx context.Context) string {
+	addr, _ := ctx.Value(replicaKey{}).(string)
+	return addr
+}
+
+// WithPrincipal returns a copy of the ctx identifying who its requests are
+// made for, such as a user or service name, for the AuditRecords of those
+// requests and for an Authorizer to check with PrincipalFrom.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal set on the ctx with WithPrincipal, or
+// "" if none was set.
+func PrincipalFrom(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// RequestTimeoutFrom returns the timeout set on the ctx with
+// WithRequestTimeout, or def if none was set.
+func RequestTimeoutFrom(ctx context.Context, def time.Duration) time.Duration {
+	if d, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok {
+		return d
+	}
+	return def
+}
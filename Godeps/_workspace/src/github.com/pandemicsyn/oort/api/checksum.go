@@ -0,0 +1,49 @@
+package api
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// Checksum selects the checksum added to values as they are written and
+// verified as they are read, protecting against corruption anywhere between
+// this client and the backend stores' disks.
+type Checksum int
+
+const (
+	// ChecksumNone adds no checksum.
+	ChecksumNone Checksum = iota
+	// ChecksumCRC32C adds a 4 byte CRC-32C (Castagnoli) checksum.
+	ChecksumCRC32C
+)
+
+func (c Checksum) String() string {
+	switch c {
+	case ChecksumNone:
+		return "ChecksumNone"
+	case ChecksumCRC32C:
+		return "ChecksumCRC32C"
+	}
+	return "Checksum?"
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// sum returns the checksum of a frame header and the value it frames.
+func (c Checksum) sum(header, value []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header, crc32cTable), crc32cTable, value)
+}
+
+type checksumMismatchError struct {
+	checksum Checksum
+	expected uint32
+	actual   uint32
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %08x, got %08x", e.checksum, e.expected, e.actual)
+}
+
+func (e *checksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestChecksumRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []*valueCodec{
+		newValueCodec(nil, nil, nil, 0, nil, ChecksumCRC32C, false, false),
+		newValueCodec(nil, nil, &FlateCompressor{}, 1, nil, ChecksumCRC32C, false, false),
+	} {
+		for _, value := range codecTestValues {
+			encoded, err := c.encode(ctx, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = c.verify(encoded); err != nil {
+				t.Fatalf("verifying %q: %s", value, err)
+			}
+			decoded, _, err := c.decode(ctx, encoded)
+			if err != nil || !bytes.Equal(decoded, value) {
+				t.Fatalf("expected %q, got %q %v", value, decoded, err)
+			}
+		}
+	}
+}
+
+func TestChecksumCorrupted(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, nil, 0, nil, ChecksumCRC32C, false, false)
+	encoded, err := c.encode(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range encoded {
+		corrupted := append([]byte(nil), encoded...)
+		corrupted[i] ^= 0x10
+		if err := c.verify(corrupted); err == nil {
+			t.Fatalf("expected byte %d corrupted to fail verification", i)
+		}
+		if _, _, err := c.decode(ctx, corrupted); err == nil {
+			t.Fatalf("expected byte %d corrupted to fail decoding", i)
+		}
+	}
+	// A corrupted body in particular is reported as a mismatch.
+	corrupted := append([]byte(nil), encoded...)
+	corrupted[len(corrupted)-1] ^= 1
+	if err := c.verify(corrupted); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestChecksumTruncated(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, nil, 0, nil, ChecksumCRC32C, false, false)
+	encoded, err := c.encode(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < checksumFrameOverhead; n++ {
+		if _, _, err := c.decode(ctx, encoded[:n]); !errors.Is(err, ErrCorruptValue) {
+			t.Fatalf("expected a header truncated to %d bytes to be corrupt, got %v", n, err)
+		}
+	}
+	if _, _, err := c.decode(ctx, encoded[:len(encoded)-1]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a truncated value to mismatch, got %v", err)
+	}
+}
+
+func TestChecksumValueLooksChecksummed(t *testing.T) {
+	ctx := context.Background()
+	// Without Checksum set, a value starting with what was once the checksum
+	// header is still stored and read as is.
+	c := newValueCodec(nil, nil, &FlateCompressor{}, 1024, nil, ChecksumNone, false, false)
+	value := []byte("\xffoc\x01\x00\x00\x00\x00hello")
+	encoded, err := c.encode(ctx, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _, err := c.decode(ctx, encoded); err != nil || !bytes.Equal(decoded, value) {
+		t.Fatalf("expected %q, got %q %v", value, decoded, err)
+	}
+}
+
+func TestChecksumFrame(t *testing.T) {
+	value := []byte("chunk")
+	framed := checksumFrame(value)
+	if len(framed) != checksumFrameOverhead+len(value) {
+		t.Fatalf("expected %d bytes, got %d", checksumFrameOverhead+len(value), len(framed))
+	}
+	if _, _, v, err := parseFrame(framed); err != nil || !bytes.Equal(v, value) {
+		t.Fatalf("expected %q, got %q %v", value, v, err)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// concurrentReads makes n Reads of the key at once, each with its own prefix
+// value, returning the values and errors.
+func concurrentReads(rs *ReplValueStore, n int) ([]string, []error) {
+	values := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			_, v, err := rs.Read(context.Background(), 1, 2, []byte(fmt.Sprint(i)))
+			values[i], errs[i] = string(v), err
+		}(i)
+	}
+	wg.Wait()
+	return values, errs
+}
+
+func TestCoalesceReads(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{CoalesceReads: true}})
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a"), Delay: 100 * time.Millisecond})
+	}
+	values, errs := concurrentReads(rs, 10)
+	for i := range values {
+		// Each caller gets its own copy, after its own prefix.
+		if errs[i] != nil || values[i] != fmt.Sprint(i)+"a" {
+			t.Fatalf("read %d: expected %q, got %q %v", i, fmt.Sprint(i)+"a", values[i], errs[i])
+		}
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Read"); n != 1 {
+			t.Fatalf("expected replica %d read once, got %d", i, n)
+		}
+	}
+	// Once finished, the result is not kept.
+	if _, _, err := rs.Read(context.Background(), 1, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCalls(sss[0], "Read"); n != 2 {
+		t.Fatalf("expected a later read to go to the replicas, got %d reads", n)
+	}
+	// Reads pinned to a replica are not shared.
+	if _, _, err := rs.Read(WithReplica(context.Background(), "local0"), 1, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCalls(sss[0], "Read"); n != 3 {
+		t.Fatalf("expected the pinned read to go to the replica, got %d reads", n)
+	}
+}
+
+func TestCoalesceReadsErrors(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{CoalesceReads: true}})
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: ErrNotFound, Delay: 100 * time.Millisecond})
+	}
+	_, errs := concurrentReads(rs, 10)
+	for i, err := range errs {
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("read %d: expected not found, got %v", i, err)
+		}
+	}
+	if n := countCalls(sss[0], "Read"); n != 1 {
+		t.Fatalf("expected one read, got %d", n)
+	}
+}
+
+func TestCoalesceReadsDisabled(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, nil)
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a"), Delay: 10 * time.Millisecond})
+	}
+	concurrentReads(rs, 10)
+	if n := countCalls(sss[0], "Read"); n != 10 {
+		t.Fatalf("expected every read sent, got %d", n)
+	}
+}
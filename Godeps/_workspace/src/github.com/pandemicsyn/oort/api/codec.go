@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/net/context"
+)
+
+// Compressor compresses values before they are written to the backend
+// stores and decompresses them as they are read back. FlateCompressor is
+// provided; other formats, such as snappy or zstd, can be used by
+// implementing this interface.
+type Compressor interface {
+	// ID identifies the format in the header of compressed values so Read
+	// can detect and decompress them. It must be unique among the
+	// Compressors in use and must never change once values have been
+	// written with it; IDs below 16 are reserved for this package.
+	ID() byte
+	Compress(value []byte) ([]byte, error)
+	Decompress(value []byte) ([]byte, error)
+}
+
+// FlateCompressor is a Compressor using compress/flate at the Level given,
+// or flate.DefaultCompression if Level is 0.
+type FlateCompressor struct {
+	Level int
+}
+
+func (c *FlateCompressor) ID() byte {
+	return 1
+}
+
+func (c *FlateCompressor) Compress(value []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(value); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *FlateCompressor) Decompress(value []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(value))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// ValueTransform transforms a value as it is written or read; see the
+// EncodeValue and DecodeValue config settings. It must not modify the value
+// given in place.
+type ValueTransform func(ctx context.Context, value []byte) ([]byte, error)
+
+// valueCodec encodes values as they are written and decodes them as they are
+// read: with the EncodeValue hook, framing and compressing, encrypting, and
+// then checksumming, and the reverse. A nil *valueCodec leaves values as they
+// are; otherwise every value written is framed, see frameVersion, and every
+// value read must be, unless legacyRaw is set, when values are marked as
+// framed, see frameMagic, and those read without the mark are returned as
+// they are.
+type valueCodec struct {
+	encodeValue     ValueTransform
+	decodeValue     ValueTransform
+	compressor      Compressor
+	compressMinSize int
+	keyProvider     KeyProvider
+	checksum        Checksum
+	legacyRaw       bool
+}
+
+// newValueCodec returns nil if there is nothing for the codec to do, unless
+// framed is true, as values need framing to carry their expiries or to mark
+// split values.
+func newValueCodec(encodeValue, decodeValue ValueTransform, compressor Compressor, compressMinSize int, keyProvider KeyProvider, checksum Checksum, framed, legacyRaw bool) *valueCodec {
+	if encodeValue == nil && decodeValue == nil && compressor == nil && keyProvider == nil && checksum == ChecksumNone && !framed {
+		return nil
+	}
+	return &valueCodec{encodeValue: encodeValue, decodeValue: decodeValue, compressor: compressor, compressMinSize: compressMinSize, keyProvider: keyProvider, checksum: checksum, legacyRaw: legacyRaw}
+}
+
+// isLegacy returns true if the value is one written raw, before values were
+// framed, as told by it lacking the frameMagic legacyRaw codecs write.
+func (c *valueCodec) isLegacy(value []byte) bool {
+	return c.legacyRaw && !bytes.HasPrefix(value, []byte(frameMagic))
+}
+
+func (c *valueCodec) encode(ctx context.Context, value []byte) ([]byte, error) {
+	if c == nil {
+		return value, nil
+	}
+	if c.encodeValue != nil {
+		var err error
+		if value, err = c.encodeValue(ctx, value); err != nil {
+			return nil, err
+		}
+	}
+	h := frameHeader{flags: frameFlagsFrom(ctx)}
+	if c.compressor != nil && len(value) >= c.compressMinSize {
+		cvalue, err := c.compressor.Compress(value)
+		if err != nil {
+			return nil, err
+		}
+		// Only worth it if the compressor ID is covered too.
+		if len(cvalue)+1 < len(value) {
+			h.flags |= frameCompressed
+			h.compressorID = c.compressor.ID()
+			value = cvalue
+		}
+	}
+	var dataKey []byte
+	if c.keyProvider != nil {
+		var err error
+		if dataKey, h.wrappedKey, err = newDataKey(ctx, c.keyProvider); err != nil {
+			return nil, err
+		}
+		if len(h.wrappedKey) > 0xffff {
+			return nil, fmt.Errorf("wrapped data key of %d bytes is too long", len(h.wrappedKey))
+		}
+		h.flags |= frameEncrypted
+	}
+	if h.expiresMicro = expiryFrom(ctx); h.expiresMicro != 0 {
+		h.flags |= frameExpiring
+	}
+	if c.checksum != ChecksumNone {
+		h.flags |= frameChecksummed
+		h.checksum = c.checksum
+	}
+	header := h.appendTo(nil)
+	if dataKey != nil {
+		// The header, wrapped key included, is authenticated with the value
+		// so neither can be swapped or altered undetected.
+		var err error
+		if value, err = sealGCM(dataKey, value, header); err != nil {
+			return nil, err
+		}
+	}
+	if c.legacyRaw {
+		return append([]byte(frameMagic), h.frame(header, value)...), nil
+	}
+	return h.frame(header, value), nil
+}
+
+// verify checks the value's frame and checksum, if it has one, without
+// decoding it further; it is used on each replica's response so a corrupt
+// replica can be treated as failed and another replica used instead.
+func (c *valueCodec) verify(value []byte) error {
+	if c == nil || c.isLegacy(value) {
+		return nil
+	}
+	_, _, _, err := c.parseFrame(value)
+	return err
+}
+
+// parseFrame is parseFrame but, with Checksum set, rejects values without a
+// checksum, so one lost to a corrupted flag is still caught.
+func (c *valueCodec) parseFrame(value []byte) (frameHeader, []byte, []byte, error) {
+	h, header, value, err := parseFrame(value)
+	if err == nil && c.checksum != ChecksumNone && h.flags&frameChecksummed == 0 {
+		err = &corruptValueError{reason: "value not checksummed"}
+	}
+	return h, header, value, err
+}
+
+// decode returns the value decoded and the header it was framed with, which
+// is left zero if the codec is nil or the value is a legacy raw one.
+func (c *valueCodec) decode(ctx context.Context, value []byte) ([]byte, frameHeader, error) {
+	if c == nil || c.isLegacy(value) {
+		return value, frameHeader{}, nil
+	}
+	h, header, value, err := c.parseFrame(value)
+	if err != nil {
+		return nil, h, err
+	}
+	if h.flags&frameEncrypted != 0 {
+		if c.keyProvider == nil {
+			return nil, h, &corruptValueError{reason: "encrypted value but no KeyProvider configured"}
+		}
+		dataKey, err := c.keyProvider.UnwrapKey(ctx, h.wrappedKey)
+		if err != nil {
+			return nil, h, err
+		}
+		if value, err = openGCM(dataKey, value, header); err != nil {
+			return nil, h, &corruptValueError{reason: err.Error()}
+		}
+	} else if c.keyProvider != nil {
+		// Otherwise anyone able to write to the backend stores could have
+		// plaintext values of their choosing accepted.
+		return nil, h, &corruptValueError{reason: "value not encrypted"}
+	}
+	if h.flags&frameCompressed != 0 {
+		if c.compressor == nil || c.compressor.ID() != h.compressorID {
+			return nil, h, &corruptValueError{reason: fmt.Sprintf("unknown compressor id %d", h.compressorID)}
+		}
+		dvalue, err := c.compressor.Decompress(value)
+		if err != nil {
+			return nil, h, &corruptValueError{reason: err.Error()}
+		}
+		value = dvalue
+	}
+	if c.decodeValue != nil {
+		value, err = c.decodeValue(ctx, value)
+	}
+	return value, h, err
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// codecTestValues includes values that look like headers, which must come
+// back as they were written.
+var codecTestValues = [][]byte{
+	{},
+	[]byte("hello"),
+	[]byte("\xffoz\x01hello"),
+	[]byte("\xffoc\x01\x00\x00\x00\x00hello"),
+	[]byte("\xffoe\x00\x01xhello"),
+	[]byte("\xffox\x00\x00\x00\x00\x00\x00\x00\x01hello"),
+	{frameVersion, 0},
+	{frameVersion, frameCompressed, 1, 'h', 'i'},
+	[]byte("OORTSPLT\x00\x00\x00\x40\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x80"),
+	bytes.Repeat([]byte("\xffoz\x01"), 1000),
+}
+
+func TestValueCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []*valueCodec{
+		newValueCodec(nil, nil, &FlateCompressor{}, 1, nil, ChecksumNone, false, false),
+		newValueCodec(nil, nil, &FlateCompressor{}, 1024, nil, ChecksumNone, false, false),
+	} {
+		for _, value := range codecTestValues {
+			encoded, err := c.encode(ctx, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoded[0] != frameVersion {
+				t.Fatalf("expected %q framed, got %q", value, encoded)
+			}
+			decoded, _, err := c.decode(ctx, encoded)
+			if err != nil {
+				t.Fatalf("decoding %q: %s", value, err)
+			}
+			if !bytes.Equal(decoded, value) {
+				t.Fatalf("expected %q, got %q", value, decoded)
+			}
+		}
+	}
+}
+
+func TestValueCodecRawMarker(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, &FlateCompressor{}, 1024, nil, ChecksumNone, false, false)
+	// Too small to compress, so stored raw, yet starting with what was once
+	// the compressed header.
+	value := []byte("\xffoz\x01hello")
+	encoded, err := c.encode(ctx, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, append([]byte{frameVersion, 0}, value...)) {
+		t.Fatalf("expected a raw frame, got %q", encoded)
+	}
+	compressed, err := c.encode(ctx, bytes.Repeat([]byte("abc"), 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, _, err := parseFrame(compressed); err != nil || h.flags != frameCompressed || h.compressorID != 1 {
+		t.Fatalf("expected a compressed frame, got %+v %v", h, err)
+	}
+}
+
+func TestValueCodecRejectsUnframed(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, &FlateCompressor{}, 1, nil, ChecksumNone, false, false)
+	for _, value := range [][]byte{
+		nil,
+		{frameVersion},
+		[]byte("hello"),
+		{frameVersion, 0x80, 'h', 'i'},
+		{frameVersion, frameCompressed},
+		{frameVersion, frameCompressed, 99, 'h', 'i'},
+	} {
+		if _, _, err := c.decode(ctx, value); !errors.Is(err, ErrCorruptValue) {
+			t.Fatalf("expected %q to be rejected, got %v", value, err)
+		}
+	}
+}
+
+func TestValueCodecNil(t *testing.T) {
+	ctx := context.Background()
+	var c *valueCodec
+	for _, value := range codecTestValues {
+		encoded, err := c.encode(ctx, value)
+		if err != nil || !bytes.Equal(encoded, value) {
+			t.Fatalf("expected %q as is, got %q %v", value, encoded, err)
+		}
+		decoded, _, err := c.decode(ctx, value)
+		if err != nil || !bytes.Equal(decoded, value) {
+			t.Fatalf("expected %q as is, got %q %v", value, decoded, err)
+		}
+	}
+}
+
+func TestValueCodecLegacyRaw(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, &FlateCompressor{}, 1, nil, ChecksumCRC32C, false, true)
+	for _, value := range codecTestValues {
+		// Raw values, even those that look framed, come back as they are.
+		decoded, _, err := c.decode(ctx, value)
+		if err != nil || !bytes.Equal(decoded, value) {
+			t.Fatalf("expected %q as is, got %q %v", value, decoded, err)
+		}
+		encoded, err := c.encode(ctx, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(encoded, []byte(frameMagic)) {
+			t.Fatalf("expected %q marked, got %q", value, encoded)
+		}
+		if decoded, _, err = c.decode(ctx, encoded); err != nil || !bytes.Equal(decoded, value) {
+			t.Fatalf("expected %q, got %q %v", value, decoded, err)
+		}
+		// Marked values can still be read once LegacyRawValues is unset.
+		c2 := newValueCodec(nil, nil, &FlateCompressor{}, 1, nil, ChecksumCRC32C, false, false)
+		if decoded, _, err = c2.decode(ctx, encoded); err != nil || !bytes.Equal(decoded, value) {
+			t.Fatalf("expected %q, got %q %v", value, decoded, err)
+		}
+	}
+	encoded, err := c.encode(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded[len(encoded)-1] ^= 1
+	if _, _, err := c.decode(ctx, encoded); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestReplValueStoreLegacyRaw(t *testing.T) {
+	ctx := context.Background()
+	ms := &MemValueStore{}
+	// Written before framing was enabled, so stored raw.
+	raw := []byte{frameVersion, 0, 'h', 'i'}
+	if _, err := ms.Write(ctx, 1, 2, 3, raw); err != nil {
+		t.Fatal(err)
+	}
+	rs := newLocalReplValueStore([]store.ValueStore{ms}, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{Compressor: &FlateCompressor{}, Checksum: ChecksumCRC32C, LegacyRawValues: true}})
+	if ts, value, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 3 || !bytes.Equal(value, raw) {
+		t.Fatalf("expected %q at 3, got %q at %d %v", raw, value, ts, err)
+	}
+	if _, err := rs.Write(ctx, 1, 2, 4, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, stored, err := ms.Read(ctx, 1, 2, nil); err != nil || !bytes.HasPrefix(stored, []byte(frameMagic)) {
+		t.Fatalf("expected the value marked as framed, got %q %v", stored, err)
+	}
+	if ts, value, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 4 || string(value) != "hello" {
+		t.Fatalf("expected hello at 4, got %q at %d %v", value, ts, err)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrExists is returned by Create when the key already has a value.
+var ErrExists = errors.New("already exists")
+
+// updateRetryPolicy is how Update starts over each time it finds another
+// write got there first, backing off so callers contending for a key, such
+// as a busy counter, spread out rather than collide again.
+var updateRetryPolicy = resolveRetryPolicy(&RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     100 * time.Millisecond,
+	Jitter:         1,
+	Retryable: func(err error) bool {
+		_, ok := err.(*ConflictError)
+		return ok
+	},
+})
+
+// ConflictError is returned by CompareAndWrite when a reachable replica has a
+// value newer than the one the caller expected, by Create when the key was
+// deleted at or after the timestamp given, and by Move when the source has a
+// timestamp at or after the one given or the destination a newer one.
+type ConflictError struct {
+	// ExpectedTimestampMicro is the timestamp the caller gave.
+	ExpectedTimestampMicro int64
+	// TimestampMicro is the newest timestamp found among the replicas.
+	TimestampMicro int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict: expected timestamp %d but found %d", e.ExpectedTimestampMicro, e.TimestampMicro)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestCompareAndWriteStaleTimestamp(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, nil)
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.CompareAndWrite(ctx, 1, 2, 5, 6, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	// Expecting 5 again is now stale.
+	ts, err := rs.CompareAndWrite(ctx, 1, 2, 5, 7, []byte("c"))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.ExpectedTimestampMicro != 5 || conflict.TimestampMicro != 6 || ts != 6 {
+		t.Fatalf("expected a conflict with 6, got %d %v", ts, err)
+	}
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 6 || string(v) != "b" {
+		t.Fatalf("expected b at 6 left in place, got %q at %d %v", v, ts, err)
+	}
+	if _, err := rs.CompareAndWrite(ctx, 1, 2, 6, 6, []byte("c")); err == nil {
+		t.Fatal("expected a new timestamp no newer than expected to be refused")
+	}
+	// Expecting 0 means expecting no value.
+	if _, err := rs.CompareAndWrite(ctx, 3, 4, 0, 5, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.CompareAndWrite(ctx, 3, 4, 0, 6, []byte("again")); !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+}
+
+func TestCreateExists(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, nil)
+	ctx := context.Background()
+	if _, err := rs.Create(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if ts, err := rs.Create(ctx, 1, 2, 6, []byte("b")); !errors.Is(err, ErrExists) || ts != 5 {
+		t.Fatalf("expected ErrExists at 5, got %d %v", ts, err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a left in place, got %q %v", v, err)
+	}
+}
+
+func TestConditionalTombstone(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, nil)
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Delete(ctx, 1, 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	// The deletion marker is newer than the value expected.
+	var conflict *ConflictError
+	if _, err := rs.CompareAndWrite(ctx, 1, 2, 5, 11, []byte("b")); !errors.As(err, &conflict) || conflict.TimestampMicro != 10 {
+		t.Fatalf("expected a conflict with the deletion at 10, got %v", err)
+	}
+	if _, err := rs.CompareAndWrite(ctx, 1, 2, 10, 11, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Delete(ctx, 1, 2, 20); err != nil {
+		t.Fatal(err)
+	}
+	// A deleted key can be created again, but only after the deletion.
+	if _, err := rs.Create(ctx, 1, 2, 20, []byte("c")); !errors.As(err, &conflict) || conflict.TimestampMicro != 20 {
+		t.Fatalf("expected a conflict with the deletion at 20, got %v", err)
+	}
+	if _, err := rs.Create(ctx, 1, 2, 21, []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 21 || string(v) != "c" {
+		t.Fatalf("expected c at 21, got %q at %d %v", v, ts, err)
+	}
+}
+
+func TestUpdateConflicts(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, nil)
+	ctx := context.Background()
+	// Another write lands between every read and write, so every attempt
+	// conflicts until the retries run out.
+	calls := 0
+	other := int64(100)
+	_, err := rs.Update(ctx, 1, 2, 5, func(value []byte) ([]byte, error) {
+		calls++
+		other++
+		if _, err := rs.Write(ctx, 1, 2, other, []byte("other")); err != nil {
+			t.Fatal(err)
+		}
+		return []byte("mine"), nil
+	})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.TimestampMicro != other {
+		t.Fatalf("expected a conflict with %d, got %v", other, err)
+	}
+	if calls != updateRetryPolicy.MaxAttempts {
+		t.Fatalf("expected %d attempts, got %d", updateRetryPolicy.MaxAttempts, calls)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "other" {
+		t.Fatalf("expected the other writes to win, got %q %v", v, err)
+	}
+	// With fewer conflicts than attempts the update gets through.
+	calls = 0
+	ts, err := rs.Update(ctx, 1, 2, 5, func(value []byte) ([]byte, error) {
+		calls++
+		if calls <= 3 {
+			other++
+			if _, err := rs.Write(ctx, 1, 2, other, []byte("other")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return append(value, '!'), nil
+	})
+	if err != nil || calls != 4 || ts != other+1 {
+		t.Fatalf("expected the update at %d after 4 attempts, got %d %v after %d", other+1, ts, err, calls)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "other!" {
+		t.Fatalf("expected other!, got %q %v", v, err)
+	}
+}
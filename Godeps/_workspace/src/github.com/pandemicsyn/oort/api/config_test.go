@@ -0,0 +1,39 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gholt/store"
+)
+
+func TestConfigParity(t *testing.T) {
+	// Besides the shared ReplStoreConfig, each config should have only the
+	// settings whose types are specific to its kind of store.
+	for typ, want := range map[reflect.Type][]string{
+		reflect.TypeOf(ReplValueStoreConfig{}): {"ReplStoreConfig", "WrapStore", "Middleware", "ShadowStore"},
+		reflect.TypeOf(ReplGroupStoreConfig{}): {"ReplStoreConfig", "WrapStore", "Middleware", "GroupMergePolicy", "ShadowStore"},
+	} {
+		var got []string
+		for i := 0; i < typ.NumField(); i++ {
+			got = append(got, typ.Field(i).Name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %s to have fields %v, got %v", typ.Name(), want, got)
+		}
+	}
+}
+
+func TestConfigConversion(t *testing.T) {
+	vc := &ReplValueStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{AddressIndex: 2, ConcurrentRequestsPerStore: 7, RingClientID: "c"},
+		WrapStore:       func(addr string, s store.ValueStore) store.ValueStore { return s },
+	}
+	gc := vc.GroupConfig()
+	if !reflect.DeepEqual(gc.ReplStoreConfig, vc.ReplStoreConfig) || gc.WrapStore != nil {
+		t.Fatalf("expected only the shared settings copied, got %#v", gc)
+	}
+	if back := gc.ValueConfig(); !reflect.DeepEqual(back.ReplStoreConfig, vc.ReplStoreConfig) || back.WrapStore != nil {
+		t.Fatalf("expected only the shared settings copied, got %#v", back)
+	}
+}
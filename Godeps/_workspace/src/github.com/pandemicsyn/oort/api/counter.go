@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Counters, as kept by Increment, are stored as 8 byte big endian int64
+// values, so any client can read them with a plain Read.
+const counterLen = 8
+
+func encodeCounter(count int64) []byte {
+	value := make([]byte, counterLen)
+	binary.BigEndian.PutUint64(value, uint64(count))
+	return value
+}
+
+func decodeCounter(value []byte) (int64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	if len(value) != counterLen {
+		return 0, fmt.Errorf("value of length %d is not a counter", len(value))
+	}
+	return int64(binary.BigEndian.Uint64(value)), nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+)
+
+// PerRPCCredentialsFunc is a credentials.Credentials calling the func for the
+// metadata to send with each request, such as headers an authenticating proxy
+// in front of the cluster expects; see the PerRPCCredentials config setting.
+// The ctx is that of the request.
+type PerRPCCredentialsFunc func(ctx context.Context) (map[string]string, error)
+
+func (f PerRPCCredentialsFunc) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return f(ctx)
+}
+
+// RequireTransportSecurity returns false, as the connection may well be
+// secured by other means, such as a mesh sidecar; whether tokens may be sent
+// in plaintext is left to the caller.
+func (f PerRPCCredentialsFunc) RequireTransportSecurity() bool {
+	return false
+}
+
+// BearerToken returns credentials sending the static token given as an
+// "authorization: Bearer" header with each request.
+func BearerToken(token string) credentials.Credentials {
+	md := map[string]string{"authorization": "Bearer " + token}
+	return PerRPCCredentialsFunc(func(ctx context.Context) (map[string]string, error) {
+		return md, nil
+	})
+}
+
+// TokenSourceCredentials returns credentials sending the token the func
+// returns as an "authorization: Bearer" header with each request. The func is
+// called for every request, so it should cache the token until it needs
+// refreshing, as an oauth2.TokenSource does; one can be given as:
+//
+//	api.TokenSourceCredentials(func() (string, error) {
+//		t, err := ts.Token()
+//		if err != nil {
+//			return "", err
+//		}
+//		return t.AccessToken, nil
+//	})
+func TokenSourceCredentials(token func() (string, error)) credentials.Credentials {
+	return PerRPCCredentialsFunc(func(ctx context.Context) (map[string]string, error) {
+		t, err := token()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"authorization": "Bearer " + t}, nil
+	})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	synpb "github.com/pandemicsyn/syndicate/api/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPerRPCCredentials(t *testing.T) {
+	r, _ := localRing(1, 0)
+	var buf bytes.Buffer
+	if err := r.Persist(&buf); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer()
+	syn := &fakeSyndicate{ring: buf.Bytes(), subscribed: make(chan string, 10), metadata: make(chan metadata.MD, 10)}
+	synpb.RegisterSyndicateServer(g, syn)
+	go g.Serve(l)
+	defer g.Stop()
+	rs := NewReplGroupStore(&ReplGroupStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{
+			RingServer:         l.Addr().String(),
+			RingServerGRPCOpts: []grpc.DialOption{grpc.WithInsecure()},
+			PerRPCCredentials:  BearerToken("secret"),
+			LogError:           func(string, ...interface{}) {},
+		},
+	})
+	ctx := context.Background()
+	rs.Startup(ctx)
+	defer rs.Shutdown(ctx)
+	select {
+	case md := <-syn.metadata:
+		if v := md["authorization"]; len(v) != 1 || v[0] != "Bearer secret" {
+			t.Fatalf("expected the bearer token, got %v", md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no subscription to the ring server")
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// keepAliveDialer returns a grpc.DialOption dialing TCP with keep alive probes
+// sent at the period given, so idle connections through NATs and load
+// balancers are neither dropped silently nor left dead for long.
+func keepAliveDialer(keepAlive time.Duration) grpc.DialOption {
+	return grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		d := &net.Dialer{Timeout: timeout, KeepAlive: keepAlive}
+		return d.Dial("tcp", addr)
+	})
+}
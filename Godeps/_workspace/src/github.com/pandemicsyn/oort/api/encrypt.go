@@ -0,0 +1,82 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// KeyProvider protects the data keys used to encrypt values with
+// envelope encryption: each value is encrypted with AES-GCM under a new
+// random data key, and that data key is stored with the value only after
+// being wrapped by the KeyProvider. Implementations can wrap locally, as
+// StaticKeyProvider does, or call out to a KMS or Vault; in the latter case
+// caching unwrapped keys is advisable as every Read needs one.
+type KeyProvider interface {
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider wrapping data keys with AES-GCM under a
+// single fixed key, which must be 16, 24, or 32 bytes long.
+type StaticKeyProvider struct {
+	Key []byte
+}
+
+func (p *StaticKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return sealGCM(p.Key, dataKey, nil)
+}
+
+func (p *StaticKeyProvider) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	return openGCM(p.Key, wrappedKey, nil)
+}
+
+// newDataKey returns a new random data key to encrypt a value with, and the
+// key wrapped by the KeyProvider to store with it.
+func newDataKey(ctx context.Context, kp KeyProvider) ([]byte, []byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrappedKey, err := kp.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, wrappedKey, nil
+}
+
+// sealGCM returns a random nonce followed by the plaintext sealed with
+// AES-GCM under the key, authenticating the additional data given too.
+func sealGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openGCM(key, sealed, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
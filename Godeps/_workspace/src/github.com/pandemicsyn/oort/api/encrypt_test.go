@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	encryptTestKey  = bytes.Repeat([]byte{1}, 32)
+	encryptTestKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	kp := &StaticKeyProvider{Key: encryptTestKey}
+	for _, c := range []*valueCodec{
+		newValueCodec(nil, nil, nil, 0, kp, ChecksumNone, false, false),
+		newValueCodec(nil, nil, &FlateCompressor{}, 1, kp, ChecksumCRC32C, false, false),
+	} {
+		for _, value := range codecTestValues {
+			encoded, err := c.encode(ctx, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(value) > 4 && bytes.Contains(encoded, value) {
+				t.Fatalf("expected %q not to be stored in plaintext", value)
+			}
+			decoded, _, err := c.decode(ctx, encoded)
+			if err != nil || !bytes.Equal(decoded, value) {
+				t.Fatalf("expected %q, got %q %v", value, decoded, err)
+			}
+		}
+	}
+}
+
+func TestEncryptWrongKey(t *testing.T) {
+	ctx := context.Background()
+	encoded, err := newValueCodec(nil, nil, nil, 0, &StaticKeyProvider{Key: encryptTestKey}, ChecksumNone, false, false).encode(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = newValueCodec(nil, nil, nil, 0, &StaticKeyProvider{Key: encryptTestKey2}, ChecksumNone, false, false).decode(ctx, encoded); err == nil {
+		t.Fatal("expected decoding with the wrong key to fail")
+	}
+	if _, _, err = newValueCodec(nil, nil, nil, 0, nil, ChecksumCRC32C, false, false).decode(ctx, encoded); !errors.Is(err, ErrCorruptValue) {
+		t.Fatalf("expected decoding with no KeyProvider to fail, got %v", err)
+	}
+}
+
+func TestEncryptTampered(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, &FlateCompressor{}, 1024, &StaticKeyProvider{Key: encryptTestKey}, ChecksumNone, false, false)
+	encoded, err := c.encode(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every byte, header and wrapped key included, is covered.
+	for i := range encoded {
+		tampered := append([]byte(nil), encoded...)
+		tampered[i] ^= 0x10
+		if _, _, err := c.decode(ctx, tampered); err == nil {
+			t.Fatalf("expected byte %d tampered with to fail decoding", i)
+		}
+	}
+	// So is the header alone, such as claiming the value is compressed.
+	h, _, body, err := parseFrame(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.flags |= frameCompressed
+	h.compressorID = (&FlateCompressor{}).ID()
+	if _, _, err := c.decode(ctx, h.frame(h.appendTo(nil), body)); !errors.Is(err, ErrCorruptValue) {
+		t.Fatalf("expected a rewritten header to fail decoding, got %v", err)
+	}
+}
+
+func TestEncryptRejectsUnencrypted(t *testing.T) {
+	ctx := context.Background()
+	c := newValueCodec(nil, nil, nil, 0, &StaticKeyProvider{Key: encryptTestKey}, ChecksumNone, false, false)
+	for _, value := range [][]byte{
+		{frameVersion, 0, 'h', 'i'},
+		[]byte("\xffoe\x00\x01xhello"),
+		checksumFrame([]byte("hello")),
+	} {
+		if _, _, err := c.decode(ctx, value); !errors.Is(err, ErrCorruptValue) {
+			t.Fatalf("expected %q to be rejected, got %v", value, err)
+		}
+	}
+}
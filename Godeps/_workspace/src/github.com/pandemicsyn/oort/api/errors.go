@@ -0,0 +1,181 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// These errors classify the errors returned by the Repl stores so callers
+// can branch on them with errors.Is rather than by parsing messages. The
+// errors returned still carry the details, such as the per store errors
+// available with errors.As into a ReplValueStoreError or ReplGroupStoreError.
+var (
+	// ErrNotFound indicates the key has no value; it also satisfies
+	// store.IsNotFound.
+	ErrNotFound error = notFoundError{}
+	// ErrTimeout indicates a backend store did not respond within the
+	// deadline of the request's context.
+	ErrTimeout = errors.New("timeout")
+	// ErrNoRing indicates no ring has been received yet, so requests cannot
+	// be routed to backend stores.
+	ErrNoRing = errors.New("no ring")
+	// ErrValueTooLarge indicates a value was larger than the ValueCap.
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrPartialWrite indicates a write or delete reached some replicas but
+	// not a quorum of them.
+	ErrPartialWrite = errors.New("partial write")
+	// ErrPartialRead indicates a read returned before all the replicas
+	// responded because its deadline was near; the value returned with it
+	// is the newest of those received. See ReadPartialMargin.
+	ErrPartialRead = errors.New("partial read")
+	// ErrAllReplicasFailed indicates none of the replicas responsible for a
+	// key could complete the request.
+	ErrAllReplicasFailed = errors.New("all replicas failed")
+	// ErrWritesDisabled indicates writes have been disabled on the client
+	// with DisableWrites; it also satisfies store.IsDisabled.
+	ErrWritesDisabled error = writesDisabledError{}
+	// ErrRingRejected indicates a ring was not applied because the
+	// ValidateRing config setting rejected it.
+	ErrRingRejected = errors.New("ring rejected")
+	// ErrRingStale indicates a write was refused because the ring service
+	// has been unreachable for longer than RingStaleAfter, so the ring in
+	// use may be too outdated to route writes by.
+	ErrRingStale = errors.New("ring stale")
+	// ErrCorruptValue indicates a value read lacked the header this client
+	// adds when values are encoded, such as for compression, or could not be
+	// decoded.
+	ErrCorruptValue = errors.New("corrupt value")
+	// ErrChecksumMismatch indicates a value read did not match the checksum
+	// written with it; see Checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrInvalidCursor indicates a cursor given to IterateFrom, or
+	// ObjectStore.List, was not one those calls gave out.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrKeyListingUnsupported indicates a backend store cannot list its
+	// keys for EnumerateKeys; see ValueKeyLister.
+	ErrKeyListingUnsupported = errors.New("key listing unsupported")
+	// ErrDeleted indicates, from LookupIncludingTombstones, that the key has
+	// a deletion marker rather than no record at all; it also matches
+	// ErrNotFound and satisfies store.IsNotFound.
+	ErrDeleted = errors.New("deleted")
+	// ErrPurgeUnsupported indicates a backend store cannot purge deletion
+	// markers; see ValuePurger.
+	ErrPurgeUnsupported = errors.New("purge unsupported")
+	// ErrQuotaExceeded indicates a write was refused because it would take a
+	// namespace past its ByteQuota; see ValueNamespaceConfig.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrPermissionDenied indicates the Authorizer denied an operation; the
+	// error returned also wraps the Authorizer's error.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrWriteAllFailed indicates WriteAll could not write every item; the
+	// error returned is a ValueWriteAllError or GroupWriteAllError saying
+	// what became of each item.
+	ErrWriteAllFailed = errors.New("write all failed")
+	// ErrMoveIncomplete indicates Move wrote the value to its destination but
+	// could not delete its source, so the value is at both; the error
+	// returned also wraps the error deleting the source.
+	ErrMoveIncomplete = errors.New("move incomplete")
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "not found" }
+
+func (notFoundError) ErrNotFound() string { return "not found" }
+
+type writesDisabledError struct{}
+
+func (writesDisabledError) Error() string { return "writes disabled" }
+
+func (writesDisabledError) ErrDisabled() string { return "writes disabled" }
+
+type deletedError struct {
+	timestampMicro int64
+}
+
+func (e *deletedError) Error() string {
+	return fmt.Sprintf("deleted at %d", e.timestampMicro)
+}
+
+func (e *deletedError) ErrNotFound() string { return e.Error() }
+
+func (e *deletedError) Is(target error) bool {
+	return target == ErrDeleted || target == ErrNotFound
+}
+
+func isTimeout(err error) bool {
+	return err == context.DeadlineExceeded || grpc.Code(err) == codes.DeadlineExceeded
+}
+
+type valueTooLargeError struct {
+	length   int
+	valueCap int
+}
+
+func (e *valueTooLargeError) Error() string {
+	return fmt.Sprintf("value length of %d > %d", e.length, e.valueCap)
+}
+
+func (e *valueTooLargeError) Is(target error) bool {
+	return target == ErrValueTooLarge
+}
+
+type quotaExceededError struct {
+	namespace string
+	usage     int64
+	delta     int64
+	quota     int64
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("namespace %q usage of %d + %d > %d", e.namespace, e.usage, e.delta, e.quota)
+}
+
+func (e *quotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+type moveIncompleteError struct {
+	err error
+}
+
+func (e *moveIncompleteError) Error() string {
+	return fmt.Sprintf("move incomplete: value written to destination but source not deleted: %s", e.err)
+}
+
+func (e *moveIncompleteError) Is(target error) bool {
+	return target == ErrMoveIncomplete
+}
+
+func (e *moveIncompleteError) Unwrap() error {
+	return e.err
+}
+
+type invalidCursorError struct {
+	cursor string
+	err    error
+}
+
+func (e *invalidCursorError) Error() string {
+	return fmt.Sprintf("invalid cursor %q: %s", e.cursor, e.err)
+}
+
+func (e *invalidCursorError) Is(target error) bool {
+	return target == ErrInvalidCursor
+}
+
+type corruptValueError struct {
+	reason string
+}
+
+func (e *corruptValueError) Error() string {
+	return "corrupt value: " + e.reason
+}
+
+func (e *corruptValueError) Is(target error) bool {
+	return target == ErrCorruptValue
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// exportTestKeys returns a closed channel of the keys given.
+func exportTestKeys(keys ...ValueKeyPair) <-chan ValueKeyPair {
+	c := make(chan ValueKeyPair, len(keys))
+	for _, key := range keys {
+		c <- key
+	}
+	close(c)
+	return c
+}
+
+// exportTestStore returns a store holding a at 5, b at 6, a deletion at 7,
+// and nothing for key 7.
+func exportTestStore(t *testing.T, cfg *ReplValueStoreConfig) (*ReplValueStore, []ValueKeyPair) {
+	rs, _ := NewMemReplValueStore(3, cfg)
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Write(ctx, 3, 4, 6, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Write(ctx, 5, 6, 6, []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Delete(ctx, 5, 6, 7); err != nil {
+		t.Fatal(err)
+	}
+	return rs, []ValueKeyPair{{1, 2}, {3, 4}, {5, 6}, {7, 8}}
+}
+
+func TestExportImport(t *testing.T) {
+	src, keys := exportTestStore(t, nil)
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if n, err := src.Export(ctx, &buf, &ValueExportOptions{Keys: exportTestKeys(keys...), IncludeDeleted: true}); err != nil || n != 3 {
+		t.Fatalf("expected 3 records, got %d %v", n, err)
+	}
+	dst, _ := NewMemReplValueStore(3, nil)
+	// Newer data already present is left in place.
+	if _, err := dst.Write(ctx, 1, 2, 9, []byte("newer")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.Write(ctx, 5, 6, 6, []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dst.Import(ctx, &buf, nil); err != nil || n != 3 {
+		t.Fatalf("expected 3 records imported, got %d %v", n, err)
+	}
+	if ts, v, err := dst.Read(ctx, 1, 2, nil); err != nil || ts != 9 || string(v) != "newer" {
+		t.Fatalf("expected newer at 9, got %q at %d %v", v, ts, err)
+	}
+	if ts, v, err := dst.Read(ctx, 3, 4, nil); err != nil || ts != 6 || string(v) != "b" {
+		t.Fatalf("expected b at 6, got %q at %d %v", v, ts, err)
+	}
+	if ts, _, err := dst.Lookup(ctx, 5, 6); !errors.Is(err, ErrNotFound) || ts != 7 {
+		t.Fatalf("expected the deletion at 7, got %d %v", ts, err)
+	}
+}
+
+func TestExportOptions(t *testing.T) {
+	src, keys := exportTestStore(t, nil)
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if n, err := src.Export(ctx, &buf, &ValueExportOptions{Keys: exportTestKeys(keys...)}); err != nil || n != 2 {
+		t.Fatalf("expected 2 records without deletions, got %d %v", n, err)
+	}
+	buf.Reset()
+	if n, err := src.Export(ctx, &buf, &ValueExportOptions{Keys: exportTestKeys(keys...), IncludeDeleted: true, MaxTimestampMicro: 6}); err != nil || n != 2 {
+		t.Fatalf("expected 2 records up to 6, got %d %v", n, err)
+	}
+	buf.Reset()
+	if _, err := src.Export(ctx, &buf, &ValueExportOptions{Keys: exportTestKeys(keys...), IncludeDeleted: true}); err != nil {
+		t.Fatal(err)
+	}
+	dst, _ := NewMemReplValueStore(3, nil)
+	if n, err := dst.Import(ctx, &buf, &ValueImportOptions{MaxTimestampMicro: 5}); err != nil || n != 1 {
+		t.Fatalf("expected 1 record imported up to 5, got %d %v", n, err)
+	}
+	if _, _, err := dst.Lookup(ctx, 3, 4); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected b skipped, got %v", err)
+	}
+}
+
+func TestExportEncoded(t *testing.T) {
+	cfg := &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{Compressor: &FlateCompressor{}, CompressMinSize: 1, Checksum: ChecksumCRC32C}}
+	src, keys := exportTestStore(t, cfg)
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if _, err := src.Export(ctx, &buf, &ValueExportOptions{Keys: exportTestKeys(keys...)}); err != nil {
+		t.Fatal(err)
+	}
+	// Values are exported as stored, for a store configured alike.
+	dst, ms := NewMemReplValueStore(3, cfg)
+	if _, err := dst.Import(ctx, &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := dst.Read(ctx, 3, 4, nil); err != nil || string(v) != "b" {
+		t.Fatalf("expected b, got %q %v", v, err)
+	}
+	if _, raw, err := ms[0].Read(ctx, 3, 4, nil); err != nil || string(raw) == "b" {
+		t.Fatalf("expected b stored encoded, got %q %v", raw, err)
+	}
+}
+
+func TestImportTruncated(t *testing.T) {
+	src, keys := exportTestStore(t, nil)
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if _, err := src.Export(ctx, &buf, &ValueExportOptions{Keys: exportTestKeys(keys...)}); err != nil {
+		t.Fatal(err)
+	}
+	dst, _ := NewMemReplValueStore(3, nil)
+	if n, err := dst.Import(ctx, bytes.NewReader(buf.Bytes()[:buf.Len()-1]), nil); err == nil || n != 1 {
+		t.Fatalf("expected an error after 1 record, got %d %v", n, err)
+	}
+}
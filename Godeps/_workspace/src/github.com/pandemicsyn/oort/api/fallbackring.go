@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+
+	"github.com/gholt/ring"
+)
+
+// fallbackPartitionBitCount gives a fallback ring 65,536 partitions, enough
+// to spread keys evenly over any likely FallbackNodes list.
+const fallbackPartitionBitCount = 16
+
+// fallbackRing is the ring used, once FallbackDelay has passed, when neither
+// the ring service nor a cached ring has given one and FallbackNodes is
+// configured. Each partition's replicas are chosen by rendezvous hashing of
+// the partition with each node's address, so every client given the same
+// nodes, in any order, places keys alike, and adding or removing a node only
+// moves the partitions it gains or loses. The embedded ring supplies the
+// nodes; its own partition assignments are not used.
+type fallbackRing struct {
+	ring.Ring
+	replicas int
+}
+
+// newFallbackRing returns a fallbackRing of the addresses given, with up to
+// replicas replicas of each partition.
+func newFallbackRing(addrs []string, replicas, addressIndex int) ring.Ring {
+	b := ring.NewBuilder(64)
+	for _, addr := range addrs {
+		nodeAddrs := make([]string, addressIndex+1)
+		for i := range nodeAddrs {
+			nodeAddrs[i] = addr
+		}
+		// Only running out of node IDs fails, which 64 bits will not.
+		if _, err := b.AddNode(true, 1, nil, nodeAddrs, "", nil); err != nil {
+			panic(err)
+		}
+	}
+	if replicas > len(addrs) {
+		replicas = len(addrs)
+	}
+	return &fallbackRing{Ring: b.Ring(), replicas: replicas}
+}
+
+func (r *fallbackRing) PartitionBitCount() uint16 {
+	return fallbackPartitionBitCount
+}
+
+func (r *fallbackRing) ReplicaCount() int {
+	return r.replicas
+}
+
+func (r *fallbackRing) Responsible(partition uint32) bool {
+	return false
+}
+
+func (r *fallbackRing) ResponsibleReplica(partition uint32) int {
+	return -1
+}
+
+func (r *fallbackRing) ResponsibleNodes(partition uint32) ring.NodeSlice {
+	nodes := r.Nodes()
+	scores := make([]uint64, len(nodes))
+	var p [4]byte
+	binary.BigEndian.PutUint32(p[:], partition)
+	for i, n := range nodes {
+		h := fnv.New64a()
+		h.Write(p[:])
+		h.Write([]byte(n.Address(0)))
+		scores[i] = h.Sum64()
+	}
+	sort.Sort(&nodesByScore{nodes, scores})
+	return nodes[:r.replicas]
+}
+
+type nodesByScore struct {
+	nodes  ring.NodeSlice
+	scores []uint64
+}
+
+func (s *nodesByScore) Len() int {
+	return len(s.nodes)
+}
+
+func (s *nodesByScore) Swap(i, j int) {
+	s.nodes[i], s.nodes[j] = s.nodes[j], s.nodes[i]
+	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+}
+
+func (s *nodesByScore) Less(i, j int) bool {
+	return s.scores[i] > s.scores[j]
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrInjectedFault is the default error returned by the calls a Fault store
+// fails on purpose.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultOps selects the calls Faults apply to.
+type FaultOps int
+
+const (
+	// FaultReads covers Lookup, Read, LookupGroup, and ReadGroup.
+	FaultReads FaultOps = 1 << iota
+	// FaultWrites covers Write and Delete.
+	FaultWrites
+	// FaultAll covers every data call; the zero FaultOps means the same.
+	FaultAll = FaultReads | FaultWrites
+)
+
+// Faults describes what a FaultValueStore or FaultGroupStore injects into
+// the calls it passes along. The zero value injects nothing.
+type Faults struct {
+	// Ops selects the calls the faults apply to. Default: FaultAll
+	Ops FaultOps
+	// Down fails every call, as for a replica that cannot be reached.
+	Down bool
+	// ErrorRate is the fraction, 0 to 1, of calls failed with Err.
+	ErrorRate float64
+	// Err is the error failed calls return. Default: ErrInjectedFault
+	Err error
+	// Latency delays every call, plus up to LatencyJitter more chosen
+	// uniformly at random.
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	// SlowRate is the fraction, 0 to 1, of calls delayed by SlowLatency on
+	// top of Latency, for the long tail of a struggling node.
+	SlowRate    float64
+	SlowLatency time.Duration
+	// FailAfter, for writes, fails the call only after passing it along,
+	// as when a request is applied but its response is lost.
+	FailAfter bool
+}
+
+func (f *Faults) applies(op FaultOps) bool {
+	return f.Ops == 0 || f.Ops&op != 0
+}
+
+func (f *Faults) delay() time.Duration {
+	d := f.Latency
+	if f.LatencyJitter > 0 {
+		d += time.Duration(rand.Int63n(int64(f.LatencyJitter)))
+	}
+	if f.SlowRate > 0 && rand.Float64() < f.SlowRate {
+		d += f.SlowLatency
+	}
+	return d
+}
+
+func (f *Faults) fail() error {
+	if !f.Down && (f.ErrorRate <= 0 || rand.Float64() >= f.ErrorRate) {
+		return nil
+	}
+	if f.Err != nil {
+		return f.Err
+	}
+	return ErrInjectedFault
+}
+
+// inject waits out the delay for a call and returns the error it should
+// fail with, if any. It returns the ctx's error if the ctx is done first.
+func (f *Faults) inject(ctx context.Context, op FaultOps) error {
+	if !f.applies(op) {
+		return nil
+	}
+	if d := f.delay(); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return f.fail()
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// frameVersion begins every value written while a valueCodec is in use. It is
+// followed by a byte of frame flags saying which optional header fields come
+// next, in the order the flags are declared, and then the value itself. Every
+// value is framed, including one stored as is with no flags set, so nothing
+// in a value can be mistaken for a header.
+const frameVersion = 1
+
+// frameMagic comes before the frameVersion of every value written with
+// LegacyRawValues set, so such values can be told apart from the raw values
+// written before values were framed. It does not begin with frameVersion, so
+// values written with it can still be read once LegacyRawValues is unset.
+const frameMagic = "\xfeOFR"
+
+const (
+	// frameCompressed is followed by the ID of the Compressor used.
+	frameCompressed byte = 1 << iota
+	// frameEncrypted is followed by the uint16 length of the wrapped data
+	// key the value is encrypted with, and then the wrapped key itself.
+	frameEncrypted
+	// frameExpiring is followed by the int64 Unix time in microseconds the
+	// value, written with WriteTTL, expires at.
+	frameExpiring
+	// frameSplitManifest marks the manifest written in place of a value
+	// split with SplitLargeValues; it has no field.
+	frameSplitManifest
+	// frameStreamManifest marks the manifest WriteStream writes once a
+	// value's chunks are written; it has no field.
+	frameStreamManifest
+	// frameChecksummed is followed by the Checksum type and the checksum,
+	// which covers the rest of the header and the value. It is always the
+	// last field of the header.
+	frameChecksummed
+)
+
+const frameKnownFlags = frameCompressed | frameEncrypted | frameExpiring | frameSplitManifest | frameStreamManifest | frameChecksummed
+
+type frameFlagsKey struct{}
+
+// withFrameFlags returns a context for writing a value whose frame is to be
+// marked with the flags given, such as frameSplitManifest.
+func withFrameFlags(ctx context.Context, flags byte) context.Context {
+	return context.WithValue(ctx, frameFlagsKey{}, flags)
+}
+
+// frameFlagsFrom returns the flags set with withFrameFlags, or 0 if there
+// are none.
+func frameFlagsFrom(ctx context.Context) byte {
+	flags, _ := ctx.Value(frameFlagsKey{}).(byte)
+	return flags
+}
+
+// frameHeader holds the fields of a frame header; only those whose flags are
+// set are written.
+type frameHeader struct {
+	flags        byte
+	compressorID byte
+	wrappedKey   []byte
+	expiresMicro int64
+	checksum     Checksum
+}
+
+// appendTo appends the header, all but its checksum, to b.
+func (h *frameHeader) appendTo(b []byte) []byte {
+	b = append(b, frameVersion, h.flags)
+	if h.flags&frameCompressed != 0 {
+		b = append(b, h.compressorID)
+	}
+	if h.flags&frameEncrypted != 0 {
+		b = append(b, byte(len(h.wrappedKey)>>8), byte(len(h.wrappedKey)))
+		b = append(b, h.wrappedKey...)
+	}
+	if h.flags&frameExpiring != 0 {
+		b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(h.expiresMicro))
+	}
+	return b
+}
+
+// frame returns the value given framed with the header given, as returned by
+// appendTo, and the checksum of both if the header is flagged as checksummed.
+func (h *frameHeader) frame(header, value []byte) []byte {
+	b := make([]byte, 0, len(header)+5+len(value))
+	b = append(b, header...)
+	if h.flags&frameChecksummed != 0 {
+		b = append(b, byte(h.checksum), 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], h.checksum.sum(header, value))
+	}
+	return append(b, value...)
+}
+
+// checksumFrame frames the value given with just a CRC-32C checksum, as the
+// chunks of a split value are whether or not Checksum is set.
+func checksumFrame(value []byte) []byte {
+	h := &frameHeader{flags: frameChecksummed, checksum: ChecksumCRC32C}
+	return h.frame(h.appendTo(nil), value)
+}
+
+// checksumFrameOverhead is the length of the header checksumFrame adds.
+const checksumFrameOverhead = 2 + 5
+
+// parseFrame returns the header of a framed value, the bytes of the header
+// before its checksum, and the value it holds, having verified the checksum
+// if there is one.
+func parseFrame(value []byte) (frameHeader, []byte, []byte, error) {
+	var h frameHeader
+	value = bytes.TrimPrefix(value, []byte(frameMagic))
+	framed := value
+	if len(value) < 2 {
+		return h, nil, nil, &corruptValueError{reason: "truncated frame header"}
+	}
+	if value[0] != frameVersion {
+		return h, nil, nil, &corruptValueError{reason: fmt.Sprintf("unknown frame version %d", value[0])}
+	}
+	h.flags = value[1]
+	if h.flags&^frameKnownFlags != 0 {
+		return h, nil, nil, &corruptValueError{reason: fmt.Sprintf("unknown frame flags %02x", h.flags&^frameKnownFlags)}
+	}
+	value = value[2:]
+	if h.flags&frameCompressed != 0 {
+		if len(value) < 1 {
+			return h, nil, nil, &corruptValueError{reason: "truncated frame header"}
+		}
+		h.compressorID = value[0]
+		value = value[1:]
+	}
+	if h.flags&frameEncrypted != 0 {
+		if len(value) < 2 {
+			return h, nil, nil, &corruptValueError{reason: "truncated frame header"}
+		}
+		n := int(binary.BigEndian.Uint16(value))
+		value = value[2:]
+		if len(value) < n {
+			return h, nil, nil, &corruptValueError{reason: "truncated frame header"}
+		}
+		h.wrappedKey = value[:n]
+		value = value[n:]
+	}
+	if h.flags&frameExpiring != 0 {
+		if len(value) < 8 {
+			return h, nil, nil, &corruptValueError{reason: "truncated frame header"}
+		}
+		h.expiresMicro = int64(binary.BigEndian.Uint64(value))
+		value = value[8:]
+	}
+	header := framed[:len(framed)-len(value)]
+	if h.flags&frameChecksummed != 0 {
+		if len(value) < 5 {
+			return h, nil, nil, &corruptValueError{reason: "truncated frame header"}
+		}
+		h.checksum = Checksum(value[0])
+		if h.checksum != ChecksumCRC32C {
+			return h, nil, nil, &corruptValueError{reason: fmt.Sprintf("unknown checksum type %d", h.checksum)}
+		}
+		expected := binary.BigEndian.Uint32(value[1:])
+		value = value[5:]
+		if actual := h.checksum.sum(header, value); actual != expected {
+			return h, nil, nil, &checksumMismatchError{checksum: h.checksum, expected: expected, actual: actual}
+		}
+	}
+	return h, header, value, nil
+}
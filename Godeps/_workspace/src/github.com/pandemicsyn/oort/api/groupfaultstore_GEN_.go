@@ -0,0 +1,153 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// FaultGroupStore wraps a store.GroupStore, injecting errors and latency
+// into its calls as set with SetFaults. Giving each replica of a
+// ReplGroupStore its own, with the WrapStore config setting, lets tests
+// check how an application copes with failing and slow nodes.
+type FaultGroupStore struct {
+	// Store is the store calls are passed along to.
+	Store  store.GroupStore
+	lock   sync.RWMutex
+	faults Faults
+}
+
+// NewFaultGroupStore returns a FaultGroupStore wrapping s that injects
+// nothing until SetFaults is called.
+func NewFaultGroupStore(s store.GroupStore) *FaultGroupStore {
+	return &FaultGroupStore{Store: s}
+}
+
+// SetFaults replaces the faults injected; it is safe to call while the store
+// is in use.
+func (fs *FaultGroupStore) SetFaults(f Faults) {
+	fs.lock.Lock()
+	fs.faults = f
+	fs.lock.Unlock()
+}
+
+func (fs *FaultGroupStore) Startup(ctx context.Context) error {
+	return fs.Store.Startup(ctx)
+}
+
+func (fs *FaultGroupStore) Shutdown(ctx context.Context) error {
+	return fs.Store.Shutdown(ctx)
+}
+
+func (fs *FaultGroupStore) EnableWrites(ctx context.Context) error {
+	return fs.Store.EnableWrites(ctx)
+}
+
+func (fs *FaultGroupStore) DisableWrites(ctx context.Context) error {
+	return fs.Store.DisableWrites(ctx)
+}
+
+func (fs *FaultGroupStore) Flush(ctx context.Context) error {
+	return fs.Store.Flush(ctx)
+}
+
+func (fs *FaultGroupStore) AuditPass(ctx context.Context) error {
+	return fs.Store.AuditPass(ctx)
+}
+
+func (fs *FaultGroupStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	return fs.Store.Stats(ctx, debug)
+}
+
+func (fs *FaultGroupStore) ValueCap(ctx context.Context) (uint32, error) {
+	return fs.Store.ValueCap(ctx)
+}
+
+// Faults returns the faults being injected.
+func (fs *FaultGroupStore) Faults() Faults {
+	fs.lock.RLock()
+	f := fs.faults
+	fs.lock.RUnlock()
+	return f
+}
+
+func (fs *FaultGroupStore) Lookup(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64) (int64, uint32, error) {
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return 0, 0, err
+	}
+	return fs.Store.Lookup(ctx, keyA, keyB, childKeyA, childKeyB)
+}
+
+func (fs *FaultGroupStore) Read(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, value []byte) (int64, []byte, error) {
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return 0, value, err
+	}
+	return fs.Store.Read(ctx, keyA, keyB, childKeyA, childKeyB, value)
+}
+
+func (fs *FaultGroupStore) Write(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	f := fs.Faults()
+	if !f.FailAfter {
+		if err := f.inject(ctx, FaultWrites); err != nil {
+			return 0, err
+		}
+		return fs.Store.Write(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro, value)
+	}
+	oldTimestampMicro, err := fs.Store.Write(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro, value)
+	if ierr := f.inject(ctx, FaultWrites); ierr != nil {
+		return 0, ierr
+	}
+	return oldTimestampMicro, err
+}
+
+func (fs *FaultGroupStore) Delete(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, timestampMicro int64) (int64, error) {
+	f := fs.Faults()
+	if !f.FailAfter {
+		if err := f.inject(ctx, FaultWrites); err != nil {
+			return 0, err
+		}
+		return fs.Store.Delete(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro)
+	}
+	oldTimestampMicro, err := fs.Store.Delete(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro)
+	if ierr := f.inject(ctx, FaultWrites); ierr != nil {
+		return 0, ierr
+	}
+	return oldTimestampMicro, err
+}
+
+func (fs *FaultGroupStore) LookupGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.LookupGroupItem, error) {
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return nil, err
+	}
+	return fs.Store.LookupGroup(ctx, parentKeyA, parentKeyB)
+}
+
+func (fs *FaultGroupStore) ReadGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.ReadGroupItem, error) {
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return nil, err
+	}
+	return fs.Store.ReadGroup(ctx, parentKeyA, parentKeyB)
+}
+
+// NewFaultMemReplGroupStore is NewMemReplGroupStore with each in-memory
+// replica wrapped in a FaultGroupStore, returned in the same order, for
+// setting the faults of each replica. Any WrapStore in c is applied outside
+// the fault stores.
+func NewFaultMemReplGroupStore(replicas int, c *ReplGroupStoreConfig) (*ReplGroupStore, []*FaultGroupStore) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	fss := make([]*FaultGroupStore, replicas)
+	ss := make([]store.GroupStore, replicas)
+	for i := range fss {
+		fss[i] = NewFaultGroupStore(&MemGroupStore{})
+		ss[i] = fss[i]
+	}
+	return newLocalReplGroupStore(ss, c), fss
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// MemGroupStore is a store.GroupStore held entirely in memory, for
+// application tests that would otherwise need a running oort cluster. It
+// follows the timestamp rules of a real store: a write or delete only takes
+// effect if newer than what is held, and a delete wins a tie with a write.
+// The zero value is ready to use.
+type MemGroupStore struct {
+	lock           sync.RWMutex
+	items          map[replGroupCacheKey]*memGroupItem
+	writesDisabled bool
+}
+
+type memGroupItem struct {
+	timestampMicro int64
+	value          []byte
+	deleted        bool
+}
+
+type memGroupStoreStats struct {
+	items      int
+	tombstones int
+}
+
+func (s *memGroupStoreStats) String() string {
+	return fmt.Sprintf("items %d tombstones %d", s.items, s.tombstones)
+}
+
+func (s *MemGroupStore) Startup(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemGroupStore) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemGroupStore) EnableWrites(ctx context.Context) error {
+	s.lock.Lock()
+	s.writesDisabled = false
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemGroupStore) DisableWrites(ctx context.Context) error {
+	s.lock.Lock()
+	s.writesDisabled = true
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemGroupStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemGroupStore) AuditPass(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemGroupStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	stats := &memGroupStoreStats{}
+	s.lock.RLock()
+	for _, item := range s.items {
+		if item.deleted {
+			stats.tombstones++
+		} else {
+			stats.items++
+		}
+	}
+	s.lock.RUnlock()
+	return stats, nil
+}
+
+func (s *MemGroupStore) ValueCap(ctx context.Context) (uint32, error) {
+	return math.MaxUint32, nil
+}
+
+func (s *MemGroupStore) Lookup(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64) (int64, uint32, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	item := s.items[replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}]
+	if item == nil {
+		return 0, 0, ErrNotFound
+	}
+	if item.deleted {
+		return item.timestampMicro, 0, ErrNotFound
+	}
+	return item.timestampMicro, uint32(len(item.value)), nil
+}
+
+func (s *MemGroupStore) Read(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, value []byte) (int64, []byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	item := s.items[replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}]
+	if item == nil {
+		return 0, value, ErrNotFound
+	}
+	if item.deleted {
+		return item.timestampMicro, value, ErrNotFound
+	}
+	return item.timestampMicro, append(value, item.value...), nil
+}
+
+func (s *MemGroupStore) Write(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.writesDisabled {
+		return 0, ErrWritesDisabled
+	}
+	key := replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}
+	item := s.items[key]
+	if item != nil && item.timestampMicro >= timestampMicro {
+		return item.timestampMicro, nil
+	}
+	var oldTimestampMicro int64
+	if item != nil {
+		oldTimestampMicro = item.timestampMicro
+	}
+	if s.items == nil {
+		s.items = make(map[replGroupCacheKey]*memGroupItem)
+	}
+	s.items[key] = &memGroupItem{timestampMicro: timestampMicro, value: append([]byte(nil), value...)}
+	return oldTimestampMicro, nil
+}
+
+func (s *MemGroupStore) Delete(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, timestampMicro int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.writesDisabled {
+		return 0, ErrWritesDisabled
+	}
+	key := replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}
+	item := s.items[key]
+	if item != nil && (item.timestampMicro > timestampMicro || (item.timestampMicro == timestampMicro && item.deleted)) {
+		return item.timestampMicro, nil
+	}
+	var oldTimestampMicro int64
+	if item != nil {
+		oldTimestampMicro = item.timestampMicro
+	}
+	if s.items == nil {
+		s.items = make(map[replGroupCacheKey]*memGroupItem)
+	}
+	s.items[key] = &memGroupItem{timestampMicro: timestampMicro, deleted: true}
+	return oldTimestampMicro, nil
+}
+
+func (s *MemGroupStore) LookupGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.LookupGroupItem, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var rv []store.LookupGroupItem
+	for key, item := range s.items {
+		if key.keyA == parentKeyA && key.keyB == parentKeyB && !item.deleted {
+			rv = append(rv, store.LookupGroupItem{ChildKeyA: key.childKeyA, ChildKeyB: key.childKeyB, TimestampMicro: item.timestampMicro, Length: uint32(len(item.value))})
+		}
+	}
+	return rv, nil
+}
+
+func (s *MemGroupStore) ReadGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.ReadGroupItem, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var rv []store.ReadGroupItem
+	for key, item := range s.items {
+		if key.keyA == parentKeyA && key.keyB == parentKeyB && !item.deleted {
+			rv = append(rv, store.ReadGroupItem{ChildKeyA: key.childKeyA, ChildKeyB: key.childKeyB, TimestampMicro: item.timestampMicro, Value: append([]byte(nil), item.value...)})
+		}
+	}
+	return rv, nil
+}
+
+// NewMemReplGroupStore returns a ReplGroupStore routing to the given
+// number of in-memory replicas, along with those replicas so a test can
+// inspect them or stop a replica's writes. The ring used is static, and c's
+// RingSource is ignored; c may be nil for the defaults.
+func NewMemReplGroupStore(replicas int, c *ReplGroupStoreConfig) (*ReplGroupStore, []*MemGroupStore) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	ms := make([]*MemGroupStore, replicas)
+	ss := make([]store.GroupStore, replicas)
+	for i := range ms {
+		ms[i] = &MemGroupStore{}
+		ss[i] = ms[i]
+	}
+	return newLocalReplGroupStore(ss, c), ms
+}
+
+// newLocalReplGroupStore returns a ReplGroupStore routing to the stores
+// given, each a replica of every key, with a static ring.
+func newLocalReplGroupStore(ss []store.GroupStore, c *ReplGroupStoreConfig) *ReplGroupStore {
+	var cfg ReplGroupStoreConfig
+	if c != nil {
+		cfg = *c
+	}
+	r, addrs := localRing(len(ss), cfg.AddressIndex)
+	stores := make(map[string]store.GroupStore, len(ss))
+	for i, addr := range addrs {
+		stores[addr] = ss[i]
+	}
+	cfg.RingSource = &StaticRingSource{Ring: r}
+	rs := NewReplGroupStore(&cfg)
+	rs.newBackendStore = func(addr string) (store.GroupStore, error) {
+		if s := stores[addr]; s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("no local store for %s", addr)
+	}
+	rs.SetRing(r)
+	return rs
+}
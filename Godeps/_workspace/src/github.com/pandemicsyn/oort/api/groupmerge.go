@@ -0,0 +1,42 @@
+package api
+
+// GroupMergePolicy decides how the group stores combine the differing views
+// of a group's membership the replicas return for ReadGroup and LookupGroup.
+type GroupMergePolicy int
+
+const (
+	// GroupMergeLargest uses the view of the replica with the most members.
+	GroupMergeLargest GroupMergePolicy = iota
+	// GroupMergeSingleNewest uses the view of the replica with the most
+	// recently written member, so the result is always exactly what one
+	// replica holds.
+	GroupMergeSingleNewest
+	// GroupMergeUnion combines the views of all replicas, keeping the
+	// newest version of each member.
+	GroupMergeUnion
+)
+
+func (p GroupMergePolicy) String() string {
+	switch p {
+	case GroupMergeLargest:
+		return "GroupMergeLargest"
+	case GroupMergeSingleNewest:
+		return "GroupMergeSingleNewest"
+	case GroupMergeUnion:
+		return "GroupMergeUnion"
+	}
+	return "GroupMergePolicy?"
+}
+
+// GroupReadInfo describes how the result of a ReadGroupInfo or
+// LookupGroupInfo was assembled.
+type GroupReadInfo struct {
+	// Replicas is how many replicas are responsible for the group.
+	Replicas int
+	// Responded is how many of them returned their view of the group.
+	Responded int
+	// Contributed is how many of those views are reflected in the result:
+	// 1 with GroupMergeLargest and GroupMergeSingleNewest, and the number
+	// providing at least one member with GroupMergeUnion.
+	Contributed int
+}
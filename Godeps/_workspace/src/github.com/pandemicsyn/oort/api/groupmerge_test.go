@@ -0,0 +1,82 @@
+package api
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// scriptGroupViews has the first replica hold two members, the second an
+// older membership with just the first member but newer, and the third fail.
+func scriptGroupViews(sss []*ScriptedGroupStore) {
+	sss[0].Push("ReadGroup", ScriptedResponse{ReadGroupItems: []store.ReadGroupItem{
+		{ChildKeyA: 1, ChildKeyB: 1, TimestampMicro: 5, Value: []byte("a")},
+		{ChildKeyA: 2, ChildKeyB: 2, TimestampMicro: 5, Value: []byte("b")},
+	}})
+	sss[1].Push("ReadGroup", ScriptedResponse{ReadGroupItems: []store.ReadGroupItem{
+		{ChildKeyA: 1, ChildKeyB: 1, TimestampMicro: 9, Value: []byte("A")},
+	}})
+	sss[2].Push("ReadGroup", ScriptedResponse{Err: errUnavailable})
+	sss[0].Push("LookupGroup", ScriptedResponse{LookupGroupItems: []store.LookupGroupItem{
+		{ChildKeyA: 1, ChildKeyB: 1, TimestampMicro: 5, Length: 1},
+		{ChildKeyA: 2, ChildKeyB: 2, TimestampMicro: 5, Length: 1},
+	}})
+	sss[1].Push("LookupGroup", ScriptedResponse{LookupGroupItems: []store.LookupGroupItem{
+		{ChildKeyA: 1, ChildKeyB: 1, TimestampMicro: 9, Length: 1},
+	}})
+	sss[2].Push("LookupGroup", ScriptedResponse{Err: errUnavailable})
+}
+
+func TestGroupMergePolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy      GroupMergePolicy
+		want        string
+		contributed int
+	}{
+		{GroupMergeLargest, "ab", 1},
+		{GroupMergeSingleNewest, "A", 1},
+		{GroupMergeUnion, "Ab", 2},
+	} {
+		rs, sss := NewScriptedReplGroupStore(3, &ReplGroupStoreConfig{GroupMergePolicy: tc.policy})
+		ctx := context.Background()
+		scriptGroupViews(sss)
+		items, info, err := rs.ReadGroupInfo(ctx, 1, 2)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.policy, err)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].ChildKeyA < items[j].ChildKeyA })
+		got := ""
+		for _, item := range items {
+			got += string(item.Value)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.policy, tc.want, got)
+		}
+		if info != (GroupReadInfo{Replicas: 3, Responded: 2, Contributed: tc.contributed}) {
+			t.Fatalf("%s: unexpected info %+v", tc.policy, info)
+		}
+		lookups, info, err := rs.LookupGroupInfo(ctx, 1, 2)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.policy, err)
+		}
+		if len(lookups) != len(tc.want) {
+			t.Fatalf("%s: expected %d members, got %#v", tc.policy, len(tc.want), lookups)
+		}
+		if info != (GroupReadInfo{Replicas: 3, Responded: 2, Contributed: tc.contributed}) {
+			t.Fatalf("%s: unexpected info %+v", tc.policy, info)
+		}
+	}
+}
+
+func TestGroupMergeAllFail(t *testing.T) {
+	rs, sss := NewScriptedReplGroupStore(3, &ReplGroupStoreConfig{GroupMergePolicy: GroupMergeUnion})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: errUnavailable})
+	}
+	if _, info, err := rs.ReadGroupInfo(ctx, 1, 2); err == nil || info.Responded != 0 || info.Contributed != 0 {
+		t.Fatalf("expected an error with no views, got %+v %v", info, err)
+	}
+}
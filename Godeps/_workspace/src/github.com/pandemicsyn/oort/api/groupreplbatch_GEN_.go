@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// GroupWriteItem is a single write to be issued with
+// ReplGroupStore.WriteBatch.
+type GroupWriteItem struct {
+	KeyA           uint64
+	KeyB           uint64
+	ChildKeyA      uint64
+	ChildKeyB      uint64
+	TimestampMicro int64
+	Value          []byte
+}
+
+// GroupWriteResult is the outcome of a single GroupWriteItem; it is
+// equivalent to the return values of ReplGroupStore.Write.
+type GroupWriteResult struct {
+	OldTimestampMicro int64
+	Err               error
+}
+
+// WriteBatch issues all the items given, returning a result for each item in
+// the same order. Each item is passed through the Middleware chain and
+// written just as Write would write it, split with SplitLargeValues, retried
+// under the RetryPolicy, and waking any watchers, but the items are grouped
+// by the replicas the ReplicaSelector picks for them and each group is
+// pipelined to its replicas over their existing streams, bounded by
+// ConcurrentRequestsPerStore. Items the Authorizer or a middleware denies
+// fail alone.
+func (rs *ReplGroupStore) WriteBatch(ctx context.Context, items []GroupWriteItem) []GroupWriteResult {
+	return rs.writeGrouped(ctx, items, rs.Write)
+}
+
+// writeBatch writes the items given, already encoded, each with write, as
+// with writeGrouped; it is for writes made on behalf of others, such as the
+// chunks of a split value, which are neither split nor retried themselves.
+func (rs *ReplGroupStore) writeBatch(ctx context.Context, items []GroupWriteItem) []GroupWriteResult {
+	return rs.writeGrouped(ctx, items, rs.write)
+}
+
+// writeGrouped writes each of the items given with write, which is rs.Write
+// or rs.write, so each item goes through writeReplicas just as a single
+// Write would. The items are grouped by the replicas the
+// ReplicaSelector picks for them and each group is pipelined to its replicas
+// by up to ConcurrentRequestsPerStore workers.
+func (rs *ReplGroupStore) writeGrouped(ctx context.Context, items []GroupWriteItem, write func(ctx context.Context, keyA uint64, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64, value []byte) (int64, error)) []GroupWriteResult {
+	results := make([]GroupWriteResult, len(items))
+	groups := make(map[string][]int)
+	for i := range items {
+		item := &items[i]
+		if len(item.Value) == 0 {
+			results[i].Err = fmt.Errorf("zero length value")
+			continue
+		}
+		stores, err := rs.storesFor(ctx, item.KeyA)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		addrs := make([]string, len(stores))
+		for j, s := range stores {
+			addrs[j] = s.addr
+		}
+		sort.Strings(addrs)
+		replicaSet := strings.Join(addrs, "\x00")
+		groups[replicaSet] = append(groups[replicaSet], i)
+	}
+	var wg sync.WaitGroup
+	for _, indexes := range groups {
+		indexChan := make(chan int, len(indexes))
+		for _, i := range indexes {
+			indexChan <- i
+		}
+		close(indexChan)
+		workers := rs.concurrentRequestsPerStore
+		if workers > len(indexes) {
+			workers = len(indexes)
+		}
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for i := range indexChan {
+					item := &items[i]
+					results[i].OldTimestampMicro, results[i].Err = write(ctx, item.KeyA, item.KeyB, item.ChildKeyA, item.ChildKeyB, item.TimestampMicro, item.Value)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// GroupKeyPair identifies a single item to be read with
+// ReplGroupStore.ReadMulti.
+type GroupKeyPair struct {
+	KeyA      uint64
+	KeyB      uint64
+	ChildKeyA uint64
+	ChildKeyB uint64
+}
+
+// GroupReadResult is the outcome of reading a single GroupKeyPair; it is
+// equivalent to the return values of ReplGroupStore.Read.
+type GroupReadResult struct {
+	TimestampMicro int64
+	Value          []byte
+	Err            error
+}
+
+// ReadMulti reads all the keys given, returning a result for each key in the
+// same order. At most ConcurrentRequestsPerStore reads will be in flight at
+// once so a large set of keys won't starve other callers of the backend
+// stores' request tickets.
+func (rs *ReplGroupStore) ReadMulti(ctx context.Context, keys []GroupKeyPair) []GroupReadResult {
+	results := make([]GroupReadResult, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+	workers := rs.concurrentRequestsPerStore
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	indexChan := make(chan int, workers)
+	doneChan := make(chan struct{}, workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range indexChan {
+				k := &keys[i]
+				results[i].TimestampMicro, results[i].Value, results[i].Err = rs.Read(ctx, k.KeyA, k.KeyB, k.ChildKeyA, k.ChildKeyB, nil)
+			}
+			doneChan <- struct{}{}
+		}()
+	}
+	for i := range keys {
+		indexChan <- i
+	}
+	close(indexChan)
+	for w := 0; w < workers; w++ {
+		<-doneChan
+	}
+	return results
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type replGroupCacheKey struct {
+	keyA      uint64
+	keyB      uint64
+	childKeyA uint64
+	childKeyB uint64
+}
+
+type replGroupCacheEntry struct {
+	key            replGroupCacheKey
+	timestampMicro int64
+	value          []byte
+	expires        time.Time
+}
+
+// replGroupCache is a size-bounded LRU of recently read values, each kept
+// for no longer than the ttl. A nil *replGroupCache is valid and caches
+// nothing.
+type replGroupCache struct {
+	lock  sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[replGroupCacheKey]*list.Element
+	lru   *list.List
+}
+
+func newReplGroupCache(size int, ttl time.Duration) *replGroupCache {
+	if size < 1 {
+		return nil
+	}
+	return &replGroupCache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[replGroupCacheKey]*list.Element, size),
+		lru:   list.New(),
+	}
+}
+
+// get returns the cached timestampMicro and value, appended to the value
+// given, if there is an unexpired entry for the key.
+func (c *replGroupCache) get(key replGroupCacheKey, value []byte) (int64, []byte, bool) {
+	if c == nil {
+		return 0, value, false
+	}
+	c.lock.Lock()
+	el := c.items[key]
+	if el == nil {
+		c.lock.Unlock()
+		return 0, value, false
+	}
+	e := el.Value.(*replGroupCacheEntry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.items, key)
+		c.lock.Unlock()
+		return 0, value, false
+	}
+	c.lru.MoveToFront(el)
+	timestampMicro := e.timestampMicro
+	value = append(value, e.value...)
+	c.lock.Unlock()
+	return timestampMicro, value, true
+}
+
+// put caches a copy of the value for the key, evicting the least recently
+// used entry if the cache is full.
+func (c *replGroupCache) put(key replGroupCacheKey, timestampMicro int64, value []byte) {
+	if c == nil {
+		return
+	}
+	e := &replGroupCacheEntry{
+		key:            key,
+		timestampMicro: timestampMicro,
+		value:          append([]byte(nil), value...),
+		expires:        time.Now().Add(c.ttl),
+	}
+	c.lock.Lock()
+	if el := c.items[key]; el != nil {
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[key] = c.lru.PushFront(e)
+		if c.lru.Len() > c.size {
+			el := c.lru.Back()
+			c.lru.Remove(el)
+			delete(c.items, el.Value.(*replGroupCacheEntry).key)
+		}
+	}
+	c.lock.Unlock()
+}
+
+func (c *replGroupCache) remove(key replGroupCacheKey) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	if el := c.items[key]; el != nil {
+		c.lru.Remove(el)
+		delete(c.items, key)
+	}
+	c.lock.Unlock()
+}
+
+// uncache removes any cached results for the key, as it has been written or
+// deleted.
+func (rs *ReplGroupStore) uncache(key replGroupCacheKey) {
+	rs.readCache.remove(key)
+	rs.notFoundCache.remove(key)
+}
@@ -0,0 +1,63 @@
+package api
+
+import "sync"
+
+type replGroupReadCall struct {
+	done           chan struct{}
+	waiters        int
+	timestampMicro int64
+	value          []byte
+	err            error
+}
+
+// replGroupReadCalls tracks the Reads in flight so concurrent Reads of the
+// same key can share a single fan-out to the backend stores. A nil
+// *replGroupReadCalls is valid and coalesces nothing.
+type replGroupReadCalls struct {
+	lock  sync.Mutex
+	calls map[replGroupCacheKey]*replGroupReadCall
+}
+
+func newReplGroupReadCalls(enabled bool) *replGroupReadCalls {
+	if !enabled {
+		return nil
+	}
+	return &replGroupReadCalls{calls: make(map[replGroupCacheKey]*replGroupReadCall)}
+}
+
+// join returns the call for the key and whether the caller is its leader;
+// the leader must do the read and then call finish, others wait for the
+// call's done to be closed and then use its results.
+func (c *replGroupReadCalls) join(key replGroupCacheKey) (*replGroupReadCall, bool) {
+	if c == nil {
+		return nil, true
+	}
+	c.lock.Lock()
+	if call := c.calls[key]; call != nil {
+		call.waiters++
+		c.lock.Unlock()
+		return call, false
+	}
+	call := &replGroupReadCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.lock.Unlock()
+	return call, true
+}
+
+// finish records the results of the leader's read for the waiters. The
+// value is copied if there are any, since the leader's caller owns it.
+func (c *replGroupReadCalls) finish(key replGroupCacheKey, call *replGroupReadCall, timestampMicro int64, value []byte, err error) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	delete(c.calls, key)
+	waiters := call.waiters
+	c.lock.Unlock()
+	if waiters > 0 {
+		call.timestampMicro = timestampMicro
+		call.value = append([]byte(nil), value...)
+		call.err = err
+	}
+	close(call.done)
+}
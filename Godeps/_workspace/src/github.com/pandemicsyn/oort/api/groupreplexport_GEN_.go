@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/gholt/store"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/pandemicsyn/oort/api/groupproto"
+	"golang.org/x/net/context"
+)
+
+// GroupExportOptions defines the settings for ReplGroupStore.Export.
+type GroupExportOptions struct {
+	// Keys supplies the keys to export, as the backend stores offer no way
+	// to enumerate them; Export returns once it is closed and drained.
+	Keys <-chan GroupKeyPair
+	// IncludeDeleted exports deletion markers too, so an Import will delete
+	// the keys in the destination rather than leave any older values there.
+	IncludeDeleted bool
+	// MaxTimestampMicro, if set, skips keys whose newest version is newer
+	// than it. As the backend stores only keep the newest version of each
+	// key, the earlier versions of skipped keys are not recoverable from a
+	// live store; for a true point in time restore, Import an earlier
+	// export with GroupImportOptions.MaxTimestampMicro instead.
+	MaxTimestampMicro int64
+}
+
+// GroupImportOptions defines the settings for ReplGroupStore.Import.
+type GroupImportOptions struct {
+	// MaxTimestampMicro, if set, skips records newer than it, so a series of
+	// exports can be Imported to reconstruct the keyspace as of that time,
+	// such as just before an application level corruption.
+	MaxTimestampMicro int64
+}
+
+// Export writes the newest version of each key given by the opts to w as a
+// series of records, each a uvarint length followed by a groupproto
+// WriteRequest, with deletion markers having no Value. Values are exported
+// as stored, so any compression, encryption, or checksum applied by this
+// client is kept and the store Imported into needs the same configuration
+// to read them. Keys that are not found are skipped. The number of records
+// written is returned.
+func (rs *ReplGroupStore) Export(ctx context.Context, w io.Writer, opts *GroupExportOptions) (int, error) {
+	var count int
+	var buf []byte
+	for {
+		var key GroupKeyPair
+		var ok bool
+		select {
+		case key, ok = <-opts.Keys:
+		case <-ctx.Done():
+			return count, ctx.Err()
+		}
+		if !ok {
+			return count, nil
+		}
+		timestampMicro, value, err := rs.read(ctx, key.KeyA, key.KeyB, key.ChildKeyA, key.ChildKeyB, nil)
+		if store.IsNotFound(err) {
+			if timestampMicro == 0 || !opts.IncludeDeleted {
+				continue
+			}
+			value = nil
+		} else if err != nil {
+			return count, err
+		}
+		if opts.MaxTimestampMicro > 0 && timestampMicro > opts.MaxTimestampMicro {
+			continue
+		}
+		b, err := proto.Marshal(&pb.WriteRequest{KeyA: key.KeyA, KeyB: key.KeyB, ChildKeyA: key.ChildKeyA, ChildKeyB: key.ChildKeyB, TimestampMicro: timestampMicro, Value: value})
+		putReadBuffer(value)
+		if err != nil {
+			return count, err
+		}
+		if cap(buf) < binary.MaxVarintLen64+len(b) {
+			buf = make([]byte, binary.MaxVarintLen64+len(b))
+		}
+		n := binary.PutUvarint(buf, uint64(len(b)))
+		n += copy(buf[n:], b)
+		if _, err = w.Write(buf[:n]); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// Import reads records written by Export from r and writes each to this
+// store, or deletes it for deletion markers, with its original timestamp so
+// newer data already present is left in place. The number of records
+// imported, not counting any skipped by the opts, is returned; opts may be
+// nil.
+func (rs *ReplGroupStore) Import(ctx context.Context, r io.Reader, opts *GroupImportOptions) (int, error) {
+	if opts == nil {
+		opts = &GroupImportOptions{}
+	}
+	if err := rs.writesBlocked(); err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(r)
+	var count int
+	var buf []byte
+	for {
+		length, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		// Allow for the keys and timestamp around the value.
+		if length > uint64(rs.valueCap)+64 {
+			return count, fmt.Errorf("import record %d has length %d > %d", count, length, uint64(rs.valueCap)+64)
+		}
+		if uint64(cap(buf)) < length {
+			buf = make([]byte, length)
+		}
+		if _, err = io.ReadFull(br, buf[:length]); err != nil {
+			return count, err
+		}
+		req := &pb.WriteRequest{}
+		if err = proto.Unmarshal(buf[:length], req); err != nil {
+			return count, err
+		}
+		if opts.MaxTimestampMicro > 0 && req.TimestampMicro > opts.MaxTimestampMicro {
+			continue
+		}
+		if err = rs.importRecord(ctx, req); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+func (rs *ReplGroupStore) importRecord(ctx context.Context, req *pb.WriteRequest) error {
+	var err error
+	if len(req.Value) == 0 {
+		_, err = rs.delete(ctx, req.KeyA, req.KeyB, req.ChildKeyA, req.ChildKeyB, req.TimestampMicro)
+	} else {
+		_, err = rs.write(ctx, req.KeyA, req.KeyB, req.ChildKeyA, req.ChildKeyB, req.TimestampMicro, req.Value)
+	}
+	rs.uncache(replGroupCacheKey{keyA: req.KeyA, keyB: req.KeyB, childKeyA: req.ChildKeyA, childKeyB: req.ChildKeyB})
+	return err
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// groupIteratePageSize is how many members Iterate reads at once.
+const groupIteratePageSize = 100
+
+// Iterate calls fn for each member of the group, in child key order, until
+// fn returns false or all members have been visited. Membership is the union
+// of all responding replicas' views, and each member is read with Read, so
+// the newest value is given. Members deleted while iterating are skipped.
+//
+// The cursor passed to fn can be given to IterateFrom to resume the
+// iteration just after that member, such as in a later request.
+func (rs *ReplGroupStore) Iterate(ctx context.Context, parentKeyA, parentKeyB uint64, fn func(item store.ReadGroupItem, cursor string) bool) error {
+	return rs.IterateFrom(ctx, parentKeyA, parentKeyB, "", fn)
+}
+
+// IterateFrom is Iterate but resumes after the member the cursor, as given
+// to an earlier Iterate's fn, identifies; an empty cursor starts from the
+// beginning.
+func (rs *ReplGroupStore) IterateFrom(ctx context.Context, parentKeyA, parentKeyB uint64, cursor string, fn func(item store.ReadGroupItem, cursor string) bool) error {
+	var after store.LookupGroupItem
+	if cursor != "" {
+		if _, err := fmt.Sscanf(cursor, "%016x%016x", &after.ChildKeyA, &after.ChildKeyB); err != nil {
+			return &invalidCursorError{cursor: cursor, err: err}
+		}
+	}
+	lists, _, err := rs.lookupGroupReplicas(ctx, parentKeyA, parentKeyB)
+	if err != nil {
+		return err
+	}
+	items, _ := unionLookupGroupItems(lists)
+	if cursor != "" {
+		items = items[sort.Search(len(items), func(i int) bool {
+			return lookupGroupItemsByChildKey{after, items[i]}.Less(0, 1)
+		}):]
+	}
+	for len(items) > 0 {
+		page := items
+		if len(page) > groupIteratePageSize {
+			page = page[:groupIteratePageSize]
+		}
+		items = items[len(page):]
+		keys := make([]GroupKeyPair, len(page))
+		for i, item := range page {
+			keys[i] = GroupKeyPair{KeyA: parentKeyA, KeyB: parentKeyB, ChildKeyA: item.ChildKeyA, ChildKeyB: item.ChildKeyB}
+		}
+		for i, res := range rs.ReadMulti(ctx, keys) {
+			if res.Err != nil {
+				if store.IsNotFound(res.Err) {
+					continue
+				}
+				return res.Err
+			}
+			item := store.ReadGroupItem{ChildKeyA: keys[i].ChildKeyA, ChildKeyB: keys[i].ChildKeyB, TimestampMicro: res.TimestampMicro, Value: res.Value}
+			if !fn(item, fmt.Sprintf("%016x%016x", item.ChildKeyA, item.ChildKeyB)) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
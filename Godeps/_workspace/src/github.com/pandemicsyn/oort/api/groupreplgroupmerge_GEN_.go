@@ -0,0 +1,135 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/gholt/store"
+)
+
+type lookupGroupItemsByChildKey []store.LookupGroupItem
+
+func (items lookupGroupItemsByChildKey) Len() int      { return len(items) }
+func (items lookupGroupItemsByChildKey) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+func (items lookupGroupItemsByChildKey) Less(i, j int) bool {
+	return items[i].ChildKeyA < items[j].ChildKeyA || (items[i].ChildKeyA == items[j].ChildKeyA && items[i].ChildKeyB < items[j].ChildKeyB)
+}
+
+type groupChildKey struct {
+	childKeyA uint64
+	childKeyB uint64
+}
+
+// unionLookupGroupItems returns the union of the items from each replica,
+// keeping the newest of each member, sorted by child keys; it also returns
+// how many of the lists provided at least one of the items kept.
+func unionLookupGroupItems(lists [][]store.LookupGroupItem) ([]store.LookupGroupItem, int) {
+	newest := make(map[groupChildKey]int)
+	var items []store.LookupGroupItem
+	var from []int
+	for l, list := range lists {
+		for _, item := range list {
+			k := groupChildKey{item.ChildKeyA, item.ChildKeyB}
+			if i, ok := newest[k]; !ok {
+				newest[k] = len(items)
+				items = append(items, item)
+				from = append(from, l)
+			} else if item.TimestampMicro > items[i].TimestampMicro {
+				items[i] = item
+				from[i] = l
+			}
+		}
+	}
+	contributed := countGroupContributors(from)
+	sort.Sort(lookupGroupItemsByChildKey(items))
+	return items, contributed
+}
+
+// unionReadGroupItems is unionLookupGroupItems for ReadGroupItems, though the
+// items are left unsorted as ReadGroup does not promise an order.
+func unionReadGroupItems(lists [][]store.ReadGroupItem) ([]store.ReadGroupItem, int) {
+	newest := make(map[groupChildKey]int)
+	var items []store.ReadGroupItem
+	var from []int
+	for l, list := range lists {
+		for _, item := range list {
+			k := groupChildKey{item.ChildKeyA, item.ChildKeyB}
+			if i, ok := newest[k]; !ok {
+				newest[k] = len(items)
+				items = append(items, item)
+				from = append(from, l)
+			} else if item.TimestampMicro > items[i].TimestampMicro {
+				items[i] = item
+				from[i] = l
+			}
+		}
+	}
+	return items, countGroupContributors(from)
+}
+
+func countGroupContributors(from []int) int {
+	contributors := make(map[int]struct{})
+	for _, l := range from {
+		contributors[l] = struct{}{}
+	}
+	return len(contributors)
+}
+
+// pickGroupReplica returns the index of the replica view to use with the
+// single replica GroupMergePolicys, given the member count and newest member
+// timestamp of each view.
+func (rs *ReplGroupStore) pickGroupReplica(counts []int, newests []int64) int {
+	best := 0
+	for l := range counts {
+		if rs.groupMergePolicy == GroupMergeSingleNewest {
+			if newests[l] > newests[best] {
+				best = l
+			}
+		} else if counts[l] > counts[best] {
+			best = l
+		}
+	}
+	return best
+}
+
+// mergeLookupGroup combines the replicas' views of a group according to the
+// GroupMergePolicy, returning how many views are reflected in the result.
+func (rs *ReplGroupStore) mergeLookupGroup(lists [][]store.LookupGroupItem) ([]store.LookupGroupItem, int) {
+	if len(lists) == 0 {
+		return nil, 0
+	}
+	if rs.groupMergePolicy == GroupMergeUnion {
+		return unionLookupGroupItems(lists)
+	}
+	counts := make([]int, len(lists))
+	newests := make([]int64, len(lists))
+	for l, list := range lists {
+		counts[l] = len(list)
+		for _, item := range list {
+			if item.TimestampMicro > newests[l] {
+				newests[l] = item.TimestampMicro
+			}
+		}
+	}
+	return lists[rs.pickGroupReplica(counts, newests)], 1
+}
+
+// mergeReadGroup is mergeLookupGroup for ReadGroupItems.
+func (rs *ReplGroupStore) mergeReadGroup(lists [][]store.ReadGroupItem) ([]store.ReadGroupItem, int) {
+	if len(lists) == 0 {
+		return nil, 0
+	}
+	if rs.groupMergePolicy == GroupMergeUnion {
+		return unionReadGroupItems(lists)
+	}
+	counts := make([]int, len(lists))
+	newests := make([]int64, len(lists))
+	for l, list := range lists {
+		counts[l] = len(list)
+		for _, item := range list {
+			if item.TimestampMicro > newests[l] {
+				newests[l] = item.TimestampMicro
+			}
+		}
+	}
+	return lists[rs.pickGroupReplica(counts, newests)], 1
+}
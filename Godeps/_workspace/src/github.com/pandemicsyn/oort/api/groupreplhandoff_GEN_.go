@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// replGroupHint is a write or delete that a backend store could not be
+// reached for, kept to be replayed to that store later. A nil Value indicates
+// a delete. The fields are exported only so the hint can be persisted with
+// encoding/gob.
+type replGroupHint struct {
+	Addr           string
+	KeyA           uint64
+	KeyB           uint64
+	ChildKeyA      uint64
+	ChildKeyB      uint64
+	TimestampMicro int64
+	Value          []byte
+}
+
+// replGroupHintOverhead is roughly what a hint takes besides its address and
+// value, counted toward HintedHandoffMaxBytes.
+const replGroupHintOverhead = 64
+
+func (h *replGroupHint) size() int {
+	return replGroupHintOverhead + len(h.Addr) + len(h.Value)
+}
+
+// addHint queues the hint for later replay, assuming hinted handoff is
+// enabled and there is room, appending it to HintedHandoffPath if set. The
+// hint's Value will be copied as the caller may reuse it.
+func (rs *ReplGroupStore) addHint(ctx context.Context, h *replGroupHint) {
+	if rs.hintedHandoffMaxBytes < 1 || ctx.Err() != nil {
+		return
+	}
+	if h.Value != nil {
+		v := make([]byte, len(h.Value))
+		copy(v, h.Value)
+		h.Value = v
+	}
+	rs.hintsLock.Lock()
+	if rs.hintBytes+h.size() > rs.hintedHandoffMaxBytes {
+		rs.hintsLock.Unlock()
+		rs.logDebug("replGroupStore: hinted handoff queue full; dropping hint for %s", h.Addr)
+		return
+	}
+	rs.queueHint(h)
+	rs.appendHint(h)
+	rs.hintsLock.Unlock()
+}
+
+// queueHint adds the hint to the in memory queue, starting the replay if it
+// is not running; the hintsLock must be held.
+func (rs *ReplGroupStore) queueHint(h *replGroupHint) {
+	rs.hints[h.Addr] = append(rs.hints[h.Addr], h)
+	rs.hintCount++
+	rs.hintBytes += h.size()
+	if !rs.hintsReplaying {
+		rs.hintsReplaying = true
+		go rs.replayHints()
+	}
+}
+
+// replayHints runs until all queued hints have been replayed or dropped,
+// making a pass every FailedConnectRetryDelay seconds.
+func (rs *ReplGroupStore) replayHints() {
+	for {
+		time.Sleep(time.Duration(rs.failedConnectRetryDelay) * time.Second)
+		rs.hintsLock.Lock()
+		addrs := make([]string, 0, len(rs.hints))
+		for addr := range rs.hints {
+			addrs = append(addrs, addr)
+		}
+		rs.hintsLock.Unlock()
+		replayed := false
+		for _, addr := range addrs {
+			if rs.replayHintsFor(addr) {
+				replayed = true
+			}
+		}
+		if replayed {
+			// Rewriting the file drops the hints replayed from it.
+			rs.persistHints()
+		}
+		rs.hintsLock.Lock()
+		if rs.hintCount == 0 {
+			rs.hintsReplaying = false
+			rs.hintsLock.Unlock()
+			return
+		}
+		rs.hintsLock.Unlock()
+	}
+}
+
+// replayHintsFor replays the hints for the addr in order, stopping at the
+// first failure so the rest will be tried on the next pass. It returns true
+// if any hints were dealt with.
+func (rs *ReplGroupStore) replayHintsFor(addr string) bool {
+	replayed := false
+	for {
+		rs.hintsLock.Lock()
+		hs := rs.hints[addr]
+		if len(hs) == 0 {
+			delete(rs.hints, addr)
+			rs.hintsLock.Unlock()
+			return replayed
+		}
+		h := hs[0]
+		rs.hintsLock.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rs.failedConnectRetryDelay)*time.Second)
+		done, err := rs.replayHint(ctx, h)
+		cancel()
+		if !done {
+			rs.logDebug("replGroupStore: error replaying hint to %s: %s", addr, err)
+			return replayed
+		}
+		replayed = true
+		rs.hintsLock.Lock()
+		if hs = rs.hints[addr]; len(hs) > 0 && hs[0] == h {
+			hs[0] = nil
+			rs.hints[addr] = hs[1:]
+			rs.hintCount--
+			rs.hintBytes -= h.size()
+		}
+		rs.hintsLock.Unlock()
+	}
+}
+
+// replayHint returns true if the hint has been dealt with, either by being
+// replayed or by the addr no longer being responsible for the key.
+func (rs *ReplGroupStore) replayHint(ctx context.Context, h *replGroupHint) (bool, error) {
+	stores, err := rs.storesFor(ctx, h.KeyA)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range stores {
+		if s.addr != h.Addr {
+			continue
+		}
+		select {
+		case <-s.tickets(ctx):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		if h.Value == nil {
+			_, err = s.store.Delete(ctx, h.KeyA, h.KeyB, h.ChildKeyA, h.ChildKeyB, h.TimestampMicro)
+		} else {
+			_, err = s.store.Write(ctx, h.KeyA, h.KeyB, h.ChildKeyA, h.ChildKeyB, h.TimestampMicro, h.Value)
+		}
+		s.tickets(ctx) <- struct{}{}
+		s.record(err)
+		return err == nil, err
+	}
+	rs.logDebug("replGroupStore: dropping hint for %s as it is no longer responsible for %x", h.Addr, h.KeyA)
+	return true, nil
+}
+
+// encodeGroupHint returns the hint as a record for HintedHandoffPath: the length
+// and CRC-32 of the gob encoded hint followed by the hint, so a record cut
+// short by a crash can be told apart and skipped on loading.
+func encodeGroupHint(h *replGroupHint) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	if err := gob.NewEncoder(&buf).Encode(h); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-8))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[8:]))
+	return b, nil
+}
+
+// decodeGroupHints returns the hints from the records in b, up to the first that
+// is incomplete or corrupt, along with an error if there was such a record.
+func decodeGroupHints(b []byte) ([]*replGroupHint, error) {
+	var hs []*replGroupHint
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return hs, errors.New("truncated hint header")
+		}
+		n := binary.BigEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-8) {
+			return hs, errors.New("truncated hint")
+		}
+		rec := b[8 : 8+n]
+		if crc32.ChecksumIEEE(rec) != binary.BigEndian.Uint32(b[4:]) {
+			return hs, errors.New("hint checksum mismatch")
+		}
+		h := &replGroupHint{}
+		if err := gob.NewDecoder(bytes.NewReader(rec)).Decode(h); err != nil {
+			return hs, err
+		}
+		hs = append(hs, h)
+		b = b[8+n:]
+	}
+	return hs, nil
+}
+
+// appendHint appends the hint to HintedHandoffPath, if set, so it survives
+// the process being killed; the hintsLock must be held. The file is not
+// synced, so hints still in the OS's buffers can be lost if the machine
+// itself fails.
+func (rs *ReplGroupStore) appendHint(h *replGroupHint) {
+	if rs.hintedHandoffPath == "" {
+		return
+	}
+	b, err := encodeGroupHint(h)
+	if err == nil && rs.hintsFile == nil {
+		dir, _ := path.Split(rs.hintedHandoffPath)
+		_ = os.MkdirAll(dir, 0755)
+		rs.hintsFile, err = os.OpenFile(rs.hintedHandoffPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	}
+	if err == nil {
+		_, err = rs.hintsFile.Write(b)
+	}
+	if err != nil {
+		rs.logDebug("replGroupStore: error appending hint %q: %s", rs.hintedHandoffPath, err)
+	}
+}
+
+// loadHints queues the hints saved at HintedHandoffPath and rewrites the
+// file with just those, dropping any record cut short by a crash.
+func (rs *ReplGroupStore) loadHints() {
+	b, err := ioutil.ReadFile(rs.hintedHandoffPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			rs.logDebug("replGroupStore: error loading hints %q: %s", rs.hintedHandoffPath, err)
+		}
+		return
+	}
+	hs, err := decodeGroupHints(b)
+	if err != nil {
+		rs.logDebug("replGroupStore: error loading hints %q, keeping the %d before it: %s", rs.hintedHandoffPath, len(hs), err)
+	}
+	rs.hintsLock.Lock()
+	for _, h := range hs {
+		if rs.hintBytes+h.size() > rs.hintedHandoffMaxBytes {
+			rs.logDebug("replGroupStore: hinted handoff queue full; dropping hint for %s", h.Addr)
+			continue
+		}
+		rs.queueHint(h)
+	}
+	rs.hintsLock.Unlock()
+	rs.persistHints()
+}
+
+// persistHints rewrites HintedHandoffPath with just the hints still queued,
+// or removes the file if there are none, so they can be reloaded by the next
+// ReplGroupStore. Hints are appended to the file as they are queued; this
+// compacts it after hints have been replayed and on Shutdown.
+func (rs *ReplGroupStore) persistHints() {
+	if rs.hintedHandoffPath == "" {
+		return
+	}
+	rs.hintsLock.Lock()
+	defer rs.hintsLock.Unlock()
+	if rs.hintsFile != nil {
+		rs.hintsFile.Close()
+		rs.hintsFile = nil
+	}
+	var buf bytes.Buffer
+	for _, ahs := range rs.hints {
+		for _, h := range ahs {
+			b, err := encodeGroupHint(h)
+			if err != nil {
+				rs.logDebug("replGroupStore: error persisting hints %q: %s", rs.hintedHandoffPath, err)
+				return
+			}
+			buf.Write(b)
+		}
+	}
+	if buf.Len() == 0 {
+		os.Remove(rs.hintedHandoffPath)
+		return
+	}
+	dir, name := path.Split(rs.hintedHandoffPath)
+	_ = os.MkdirAll(dir, 0755)
+	fp, err := ioutil.TempFile(dir, name)
+	if err != nil {
+		rs.logDebug("replGroupStore: error persisting hints %q: %s", rs.hintedHandoffPath, err)
+	} else if _, err := fp.Write(buf.Bytes()); err != nil {
+		fp.Close()
+		os.Remove(fp.Name())
+		rs.logDebug("replGroupStore: error persisting hints %q: %s", rs.hintedHandoffPath, err)
+	} else {
+		fp.Close()
+		if err := os.Rename(fp.Name(), rs.hintedHandoffPath); err != nil {
+			os.Remove(fp.Name())
+			rs.logDebug("replGroupStore: error persisting hints %q: %s", rs.hintedHandoffPath, err)
+		}
+	}
+}
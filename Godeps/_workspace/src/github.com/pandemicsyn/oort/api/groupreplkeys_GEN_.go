@@ -0,0 +1,229 @@
+package api
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// GroupListedKey is a key as listed by a GroupKeyLister.
+type GroupListedKey struct {
+	GroupKeyPair
+	TimestampMicro int64
+	// Length is that of the value as stored, so includes any header added
+	// by this client for compression, encryption, or checksums.
+	Length uint32
+	// Deleted is set if the key holds a deletion marker rather than a value.
+	Deleted bool
+}
+
+// GroupKeyLister is implemented by backend stores that can enumerate the
+// keys they hold, as MemGroupStore and FaultGroupStore do. The stores
+// created for oort nodes do not yet, as the nodes offer no listing RPC;
+// until they do, EnumerateKeys returns ErrKeyListingUnsupported for them.
+type GroupKeyLister interface {
+	// ListKeys calls fn for each key held whose keyA is within
+	// [startKeyA, stopKeyA], deletion markers included, until fn returns
+	// false.
+	ListKeys(ctx context.Context, startKeyA, stopKeyA uint64, fn func(key GroupListedKey) bool) error
+}
+
+// GroupEnumerateOptions defines the settings for
+// ReplGroupStore.EnumerateKeys.
+type GroupEnumerateOptions struct {
+	// StartKeyA and StopKeyA bound the keys enumerated to those whose keyA
+	// is within [StartKeyA, StopKeyA]; a zero StopKeyA means no bound, so
+	// the zero options cover the whole keyspace.
+	StartKeyA uint64
+	StopKeyA  uint64
+	// IncludeDeleted includes keys whose newest version is a deletion
+	// marker.
+	IncludeDeleted bool
+}
+
+// EnumerateKeys calls fn for each key in the range the opts give until fn
+// returns false, so tools such as backups, garbage collectors, and analytics
+// can walk the keyspace through the client rather than each node. The range
+// is walked a ring partition at a time, in keyA order; each partition's keys
+// are listed from all its replicas, merged to the newest version of each,
+// and passed to fn sorted by key. A key is missed only if every replica
+// holding it fails to list, and an error is returned if every replica of a
+// partition fails. Keys written or moved between partitions during the walk
+// may or may not be seen.
+//
+// The keys listed can be fed to Export, Verify, or Repair.
+func (rs *ReplGroupStore) EnumerateKeys(ctx context.Context, opts *GroupEnumerateOptions, fn func(key GroupListedKey) bool) error {
+	if opts == nil {
+		opts = &GroupEnumerateOptions{}
+	}
+	stopKeyA := opts.StopKeyA
+	if stopKeyA == 0 {
+		stopKeyA = ^uint64(0)
+	}
+	if opts.StartKeyA > stopKeyA {
+		return nil
+	}
+	r := rs.Ring(ctx)
+	if r == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrNoRing
+	}
+	shift := 64 - r.PartitionBitCount()
+	startKeyA := opts.StartKeyA
+	for {
+		partitionStopKeyA := startKeyA | (^uint64(0) >> (64 - shift))
+		if partitionStopKeyA > stopKeyA {
+			partitionStopKeyA = stopKeyA
+		}
+		keys, err := rs.listPartition(ctx, startKeyA, partitionStopKeyA)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.Deleted && !opts.IncludeDeleted {
+				continue
+			}
+			if !fn(key) {
+				return nil
+			}
+		}
+		if partitionStopKeyA == stopKeyA {
+			return nil
+		}
+		startKeyA = partitionStopKeyA + 1
+	}
+}
+
+// listPartition lists the keys within [startKeyA, stopKeyA], which must lie
+// within one partition, from each of its replicas, returning the newest
+// version of each key sorted by key.
+func (rs *ReplGroupStore) listPartition(ctx context.Context, startKeyA, stopKeyA uint64) ([]GroupListedKey, error) {
+	stores, err := rs.storesFor(ctx, startKeyA)
+	if err != nil {
+		return nil, err
+	}
+	var lock sync.Mutex
+	newest := make(map[GroupKeyPair]GroupListedKey)
+	errs := make(ReplGroupStoreErrorSlice, 0, len(stores))
+	var wg sync.WaitGroup
+	for _, s := range stores {
+		s := s
+		wg.Add(1)
+		s.workers.run(func() {
+			defer wg.Done()
+			var err error
+			lister, ok := s.store.(GroupKeyLister)
+			select {
+			case <-s.tickets(ctx):
+				if !ok {
+					s.tickets(ctx) <- struct{}{}
+					lock.Lock()
+					errs = append(errs, &replGroupStoreError{store: s.store, err: ErrKeyListingUnsupported})
+					lock.Unlock()
+					return
+				}
+				sctx, done := rs.startReplica(ctx, "ListKeys", s)
+				var keys []GroupListedKey
+				err = lister.ListKeys(sctx, startKeyA, stopKeyA, func(key GroupListedKey) bool {
+					keys = append(keys, key)
+					return true
+				})
+				done(err)
+				s.tickets(ctx) <- struct{}{}
+				if err == nil {
+					lock.Lock()
+					for _, key := range keys {
+						if have, ok := newest[key.GroupKeyPair]; !ok || key.TimestampMicro > have.TimestampMicro || (key.TimestampMicro == have.TimestampMicro && key.Deleted) {
+							newest[key.GroupKeyPair] = key
+						}
+					}
+					lock.Unlock()
+				}
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			if err != nil {
+				lock.Lock()
+				errs = append(errs, rs.storeError(s, err))
+				lock.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if len(errs) == len(stores) {
+		return nil, errs
+	}
+	keys := make([]GroupListedKey, 0, len(newest))
+	for _, key := range newest {
+		keys = append(keys, key)
+	}
+	sort.Sort(replGroupListedKeysByKey(keys))
+	return keys, nil
+}
+
+type replGroupListedKeysByKey []GroupListedKey
+
+func (ks replGroupListedKeysByKey) Len() int {
+	return len(ks)
+}
+
+func (ks replGroupListedKeysByKey) Swap(i, j int) {
+	ks[i], ks[j] = ks[j], ks[i]
+}
+
+func (ks replGroupListedKeysByKey) Less(i, j int) bool {
+	a, b := ks[i], ks[j]
+	if a.KeyA != b.KeyA {
+		return a.KeyA < b.KeyA
+	}
+
+	if a.KeyB != b.KeyB {
+		return a.KeyB < b.KeyB
+	}
+	if a.ChildKeyA != b.ChildKeyA {
+		return a.ChildKeyA < b.ChildKeyA
+	}
+	return a.ChildKeyB < b.ChildKeyB
+
+}
+
+// ListKeys implements GroupKeyLister.
+func (s *MemGroupStore) ListKeys(ctx context.Context, startKeyA, stopKeyA uint64, fn func(key GroupListedKey) bool) error {
+	s.lock.RLock()
+	keys := make([]GroupListedKey, 0, len(s.items))
+	for k, item := range s.items {
+		if k.keyA < startKeyA || k.keyA > stopKeyA {
+			continue
+		}
+		keys = append(keys, GroupListedKey{
+			GroupKeyPair:   GroupKeyPair{k.keyA, k.keyB, k.childKeyA, k.childKeyB},
+			TimestampMicro: item.timestampMicro,
+			Length:         uint32(len(item.value)),
+			Deleted:        item.deleted,
+		})
+	}
+	s.lock.RUnlock()
+	for _, key := range keys {
+		if !fn(key) {
+			break
+		}
+	}
+	return nil
+}
+
+// ListKeys implements GroupKeyLister if the wrapped store does, with the
+// FaultReads faults injected; otherwise it returns ErrKeyListingUnsupported.
+func (fs *FaultGroupStore) ListKeys(ctx context.Context, startKeyA, stopKeyA uint64, fn func(key GroupListedKey) bool) error {
+	lister, ok := fs.Store.(GroupKeyLister)
+	if !ok {
+		return ErrKeyListingUnsupported
+	}
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return err
+	}
+	return lister.ListKeys(ctx, startKeyA, stopKeyA, fn)
+}
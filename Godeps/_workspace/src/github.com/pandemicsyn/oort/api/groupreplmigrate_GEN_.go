@@ -0,0 +1,179 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gholt/ring"
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ReplGroupMigrateConfig defines the settings for ReplGroupStore.Migrate.
+type ReplGroupMigrateConfig struct {
+	// OldRing and NewRing are the rings being migrated between; each key's
+	// nodes in each are chosen with the store's ReplicaSelector.
+	OldRing ring.Ring
+	NewRing ring.Ring
+	// Keys supplies the keys to consider, as the backend stores offer no
+	// way to enumerate them; Migrate returns once it is closed and drained.
+	// Keys whose nodes are the same in both rings are skipped, so an
+	// application can feed all of its keys through.
+	Keys <-chan GroupKeyPair
+	// Concurrency is how many keys are copied at once. Default: 10
+	Concurrency int
+	// KeysPerSecond, if set, throttles the copying. Default: 0, no limit
+	KeysPerSecond int
+	// Progress, if set, is called about once a second and once more when
+	// the migration ends.
+	Progress func(MigrateProgress)
+}
+
+// Migrate copies keys whose responsible nodes differ between the OldRing and
+// NewRing from their old nodes to their new ones, so the new nodes hold the
+// data before the NewRing is put into service rather than relying on
+// server side replication to catch up. The newest version of each key on
+// the old nodes, including deletion markers, is written to each new node
+// that was not also an old one.
+func (rs *ReplGroupStore) Migrate(ctx context.Context, cfg *ReplGroupMigrateConfig) (MigrateProgress, error) {
+	var progress MigrateProgress
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 10
+	}
+	limit := newTokenBucket(cfg.KeysPerSecond)
+	report := func() {
+		if cfg.Progress != nil {
+			cfg.Progress(MigrateProgress{
+				Scanned: atomic.LoadUint64(&progress.Scanned),
+				Moved:   atomic.LoadUint64(&progress.Moved),
+				Copied:  atomic.LoadUint64(&progress.Copied),
+				Failed:  atomic.LoadUint64(&progress.Failed),
+			})
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var key GroupKeyPair
+				var ok bool
+				select {
+				case key, ok = <-cfg.Keys:
+				case <-ctx.Done():
+				}
+				if !ok {
+					return
+				}
+				atomic.AddUint64(&progress.Scanned, 1)
+				from := rs.replicaSelector.Select(cfg.OldRing, key.KeyA)
+				to := addrsMissing(from, rs.replicaSelector.Select(cfg.NewRing, key.KeyA))
+				if len(to) == 0 {
+					continue
+				}
+				atomic.AddUint64(&progress.Moved, 1)
+				if err := limit.take(ctx, 1); err != nil {
+					return
+				}
+				if err := rs.migrateKey(ctx, key, from, to); err != nil {
+					atomic.AddUint64(&progress.Failed, 1)
+					rs.logDebug("replGroupStore: error migrating %x %x %x %x: %s", key.KeyA, key.KeyB, key.ChildKeyA, key.ChildKeyB, err)
+				} else {
+					atomic.AddUint64(&progress.Copied, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	report()
+	return progress, ctx.Err()
+}
+
+func (rs *ReplGroupStore) migrateKey(ctx context.Context, key GroupKeyPair, from, to []string) error {
+	stores, err := rs.storesForAddrs(ctx, from)
+	if err != nil {
+		return err
+	}
+	var timestampMicro int64
+	var value []byte
+	var errs ReplGroupStoreErrorSlice
+	for _, s := range stores {
+		var t int64
+		var v []byte
+		select {
+		case <-s.tickets(ctx):
+			sctx, done := rs.startReplica(ctx, "Read", s)
+			t, v, err = s.store.Read(sctx, key.KeyA, key.KeyB, key.ChildKeyA, key.ChildKeyB, nil)
+			done(err)
+			s.tickets(ctx) <- struct{}{}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err != nil && !store.IsNotFound(err) {
+			errs = append(errs, rs.storeError(s, err))
+			continue
+		}
+		s.record(nil)
+		if t > timestampMicro {
+			timestampMicro = t
+			value = v
+			if err != nil {
+				value = nil
+			}
+		}
+	}
+	if len(errs) == len(stores) {
+		return errs
+	}
+	if timestampMicro == 0 {
+		// Nothing to copy.
+		return nil
+	}
+	if stores, err = rs.storesForAddrs(ctx, to); err != nil {
+		return err
+	}
+	errs = nil
+	for _, s := range stores {
+		select {
+		case <-s.tickets(ctx):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if value == nil {
+			sctx, done := rs.startReplica(ctx, "Delete", s)
+			_, err = s.store.Delete(sctx, key.KeyA, key.KeyB, key.ChildKeyA, key.ChildKeyB, timestampMicro)
+			done(err)
+		} else {
+			sctx, done := rs.startReplica(ctx, "Write", s)
+			_, err = s.store.Write(sctx, key.KeyA, key.KeyB, key.ChildKeyA, key.ChildKeyB, timestampMicro, value)
+			done(err)
+		}
+		s.tickets(ctx) <- struct{}{}
+		if err != nil {
+			errs = append(errs, rs.storeError(s, err))
+		} else {
+			s.record(nil)
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
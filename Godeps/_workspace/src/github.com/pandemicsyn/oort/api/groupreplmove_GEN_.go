@@ -0,0 +1,60 @@
+package api
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Move moves the value at the source key to the destination key: it reads
+// the source, writes its value to the destination with timestampMicro, and
+// then deletes the source with timestampMicro, so both sides of the move
+// carry the same timestamp. With the ExpiringValues config option, the value
+// keeps its expiry.
+//
+// A failure before the destination is written, including a source with a
+// timestamp not older than timestampMicro or a destination already holding
+// a newer value, which are returned as a *ConflictError, leaves the source
+// as it was and the move may simply be retried. A failure deleting the
+// source returns an error matching ErrMoveIncomplete; the value is then at
+// both keys, and retrying the Move with the same timestampMicro completes it.
+// A failure writing the destination may leave it written to some replicas,
+// as with any failed Write; the source is not deleted.
+func (rs *ReplGroupStore) Move(ctx context.Context, srcKeyA, srcKeyB uint64, srcChildKeyA, srcChildKeyB uint64, dstKeyA, dstKeyB uint64, dstChildKeyA, dstChildKeyB uint64, timestampMicro int64) error {
+	if err := rs.writesBlocked(); err != nil {
+		return err
+	}
+	var srcTimestampMicro int64
+	var value []byte
+	var ttl time.Duration
+	var err error
+	if rs.expiringValues {
+		srcTimestampMicro, value, ttl, err = rs.ReadTTL(ctx, srcKeyA, srcKeyB, srcChildKeyA, srcChildKeyB, nil)
+	} else {
+		srcTimestampMicro, value, err = rs.Read(ctx, srcKeyA, srcKeyB, srcChildKeyA, srcChildKeyB, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if srcTimestampMicro >= timestampMicro {
+		return &ConflictError{ExpectedTimestampMicro: timestampMicro, TimestampMicro: srcTimestampMicro}
+	}
+	var dstTimestampMicro int64
+	if ttl > 0 {
+		dstTimestampMicro, err = rs.WriteTTL(ctx, dstKeyA, dstKeyB, dstChildKeyA, dstChildKeyB, timestampMicro, value, ttl)
+	} else {
+		dstTimestampMicro, err = rs.Write(ctx, dstKeyA, dstKeyB, dstChildKeyA, dstChildKeyB, timestampMicro, value)
+	}
+	if err != nil {
+		return err
+	}
+	if dstTimestampMicro > timestampMicro {
+		return &ConflictError{ExpectedTimestampMicro: timestampMicro, TimestampMicro: dstTimestampMicro}
+	}
+	// Should the source have been written again since it was read, the
+	// newer value wins over the deletion and is left in place, as it should.
+	if _, err := rs.Delete(ctx, srcKeyA, srcKeyB, srcChildKeyA, srcChildKeyB, timestampMicro); err != nil {
+		return &moveIncompleteError{err: err}
+	}
+	return nil
+}
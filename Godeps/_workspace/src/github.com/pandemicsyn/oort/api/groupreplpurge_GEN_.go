@@ -0,0 +1,152 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// GroupPurger is implemented by backend stores that can remove a deletion
+// marker before the store would discard it itself, as MemGroupStore and
+// FaultGroupStore do. The stores created for oort nodes do not, as the
+// nodes discard deletion markers on their own schedule and offer no RPC to
+// do so sooner; Purge returns ErrPurgeUnsupported for them.
+type GroupPurger interface {
+	// Purge removes the key if it holds a deletion marker no newer than
+	// timestampMicro, leaving it as if never written; a value is left
+	// alone.
+	Purge(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64) error
+}
+
+// LookupIncludingTombstones is Lookup but tells a deleted key from one with
+// no record at all, such as one never written or whose deletion marker has
+// been discarded or purged. For a deleted key it returns the timestamp of
+// the deletion marker and an error matching both ErrDeleted and ErrNotFound;
+// for a key with no record it returns ErrNotFound alone. With the
+// ExpiringValues config setting, an expired value counts as deleted at its
+// timestamp.
+func (rs *ReplGroupStore) LookupIncludingTombstones(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64) (int64, uint32, error) {
+	timestampMicro, length, err := rs.Lookup(ctx, keyA, keyB, childKeyA, childKeyB)
+	if store.IsNotFound(err) {
+		if timestampMicro == 0 {
+			return 0, 0, ErrNotFound
+		}
+		return timestampMicro, 0, &deletedError{timestampMicro: timestampMicro}
+	}
+	return timestampMicro, length, err
+}
+
+// Purge removes the deletion marker for the key from every replica, if it
+// is no newer than timestampMicro, so the key has no record at all rather
+// than waiting for the backend stores to discard the marker. It is for
+// tooling that must reclaim space or reuse keys sooner; while markers
+// remain, a replica that missed the delete is repaired rather than its value
+// coming back, so purge only once every replica has the marker.
+//
+// To that end, every replica must be reachable and support purging, or
+// ErrPurgeUnsupported is returned, and replicas found behind the newest
+// deletion are repaired before any marker is removed. If the key has a
+// value, ErrExists is returned; if its deletion is newer than
+// timestampMicro, a *ConflictError. Nothing is done for a key with no
+// record. The timestamp of the marker purged is returned.
+func (rs *ReplGroupStore) Purge(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64) (int64, error) {
+	start := time.Now()
+	var purgedTimestampMicro int64
+	err := rs.authorize(ctx, "Purge", keyA, keyB)
+	if err == nil {
+		purgedTimestampMicro, err = rs.purge(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro)
+	}
+	rs.audit(ctx, "Purge", start, keyA, keyB, childKeyA, childKeyB, timestampMicro, 0, err)
+	return purgedTimestampMicro, err
+}
+
+func (rs *ReplGroupStore) purge(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64) (int64, error) {
+	if err := rs.writesBlocked(); err != nil {
+		return 0, err
+	}
+	key := replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}
+	reads, err := rs.readEachReplica(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	var newest *replGroupReplicaRead
+	behind := false
+	for _, read := range reads {
+		if _, ok := read.s.store.(GroupPurger); !ok {
+			return 0, &replGroupStoreError{store: read.s.store, err: ErrPurgeUnsupported}
+		}
+		if read.err != nil && !store.IsNotFound(read.err) {
+			return 0, &replGroupStoreError{store: read.s.store, err: read.err}
+		}
+		if newest != nil && read.timestampMicro != newest.timestampMicro {
+			behind = true
+		}
+		if newest == nil || read.timestampMicro > newest.timestampMicro {
+			newest = read
+		}
+	}
+	if newest == nil || newest.timestampMicro == 0 {
+		return 0, nil
+	}
+	if newest.err == nil {
+		return newest.timestampMicro, ErrExists
+	}
+	if newest.timestampMicro > timestampMicro {
+		return newest.timestampMicro, &ConflictError{ExpectedTimestampMicro: timestampMicro, TimestampMicro: newest.timestampMicro}
+	}
+	if behind {
+		if err := rs.repair(ctx, key); err != nil {
+			return newest.timestampMicro, err
+		}
+	}
+	var errs ReplGroupStoreErrorSlice
+	for _, read := range reads {
+		s := read.s
+		select {
+		case <-s.tickets(ctx):
+		case <-ctx.Done():
+			return newest.timestampMicro, ctx.Err()
+		}
+		sctx, done := rs.startReplica(ctx, "Purge", s)
+		err := s.store.(GroupPurger).Purge(sctx, keyA, keyB, childKeyA, childKeyB, timestampMicro)
+		done(err)
+		s.tickets(ctx) <- struct{}{}
+		if err != nil {
+			errs = append(errs, rs.storeError(s, err))
+		}
+	}
+	rs.uncache(key)
+	if len(errs) > 0 {
+		return newest.timestampMicro, errs
+	}
+	return newest.timestampMicro, nil
+}
+
+// Purge implements GroupPurger.
+func (s *MemGroupStore) Purge(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.writesDisabled {
+		return ErrWritesDisabled
+	}
+	key := replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}
+	if item := s.items[key]; item != nil && item.deleted && item.timestampMicro <= timestampMicro {
+		delete(s.items, key)
+	}
+	return nil
+}
+
+// Purge implements GroupPurger if the wrapped store does, with the
+// FaultWrites faults injected; otherwise it returns ErrPurgeUnsupported.
+func (fs *FaultGroupStore) Purge(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64) error {
+	purger, ok := fs.Store.(GroupPurger)
+	if !ok {
+		return ErrPurgeUnsupported
+	}
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultWrites); err != nil {
+		return err
+	}
+	return purger.Purge(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gholt/ring"
+)
+
+// replGroupRingUpdater is the RingUpdater the ReplGroupStore gives its
+// RingSource.
+type replGroupRingUpdater struct {
+	rs *ReplGroupStore
+}
+
+func (u *replGroupRingUpdater) Update(r ring.Ring) error {
+	if r == nil || r.Version() == u.rs.RingVersion() {
+		return nil
+	}
+	// This will cache the ring if ringCachePath is not empty.
+	if err := u.rs.applyRing(r); err != nil {
+		return err
+	}
+	if atomic.LoadInt64(&u.rs.ringContact) != 0 {
+		u.rs.touchRingContact(time.Now())
+	}
+	u.rs.logDebug("replGroupStore: got new ring %d", r.Version())
+	return nil
+}
+
+func (u *replGroupRingUpdater) Reachable(reachable bool) {
+	rs := u.rs
+	if reachable {
+		atomic.StoreInt32(&rs.ringReachable, 1)
+		rs.touchRingContact(time.Now())
+		return
+	}
+	if atomic.SwapInt32(&rs.ringReachable, 0) == 1 {
+		rs.touchRingContact(time.Now())
+	} else if atomic.LoadInt64(&rs.ringContact) == 0 {
+		// Never reached yet, so a ring loaded from RingCachePath is only as
+		// fresh as when it was received.
+		if receivedAt := rs.RingCacheInfo().ReceivedAt; !receivedAt.IsZero() {
+			rs.touchRingContact(receivedAt)
+		} else {
+			rs.touchRingContact(time.Now())
+		}
+	}
+}
+
+func (u *replGroupRingUpdater) LogError(format string, args ...interface{}) {
+	u.rs.logError("replGroupStore: "+format, args...)
+}
+
+func (u *replGroupRingUpdater) LogDebug(format string, args ...interface{}) {
+	u.rs.logDebug("replGroupStore: "+format, args...)
+}
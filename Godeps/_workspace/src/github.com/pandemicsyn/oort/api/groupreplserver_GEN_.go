@@ -0,0 +1,206 @@
+package api
+
+import (
+	"io"
+
+	pb "github.com/pandemicsyn/oort/api/groupproto"
+	"github.com/pandemicsyn/oort/api/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ReplGroupStoreServer serves the GroupStore gRPC service of
+// groupproto from a ReplGroupStore, so it can run as a gateway or sidecar
+// giving applications in any language the ring aware replication of this
+// client through the protocol a single oort node speaks. Even a Go
+// application can point a plain NewGroupStore at it.
+//
+// Errors are returned in each response's Err field, translated as the oort
+// servers do, so not found and disabled errors keep their meaning.
+type ReplGroupStoreServer struct {
+	rs *ReplGroupStore
+}
+
+// NewReplGroupStoreServer returns a ReplGroupStoreServer for rs, which
+// should already be started.
+func NewReplGroupStoreServer(rs *ReplGroupStore) *ReplGroupStoreServer {
+	return &ReplGroupStoreServer{rs: rs}
+}
+
+// Register registers the GroupStore service with g.
+func (s *ReplGroupStoreServer) Register(g *grpc.Server) {
+	pb.RegisterGroupStoreServer(g, s)
+}
+
+func (s *ReplGroupStoreServer) translateError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return proto.TranslateError(err)
+}
+
+func (s *ReplGroupStoreServer) write(ctx context.Context, req *pb.WriteRequest) *pb.WriteResponse {
+	resp := &pb.WriteResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, err = s.rs.Write(ctx, req.KeyA, req.KeyB, req.ChildKeyA, req.ChildKeyB, req.TimestampMicro, req.Value)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplGroupStoreServer) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteResponse, error) {
+	return s.write(ctx, req), nil
+}
+
+func (s *ReplGroupStoreServer) StreamWrite(stream pb.GroupStore_StreamWriteServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.write(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplGroupStoreServer) lookup(ctx context.Context, req *pb.LookupRequest) *pb.LookupResponse {
+	resp := &pb.LookupResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, resp.Length, err = s.rs.Lookup(ctx, req.KeyA, req.KeyB, req.ChildKeyA, req.ChildKeyB)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplGroupStoreServer) Lookup(ctx context.Context, req *pb.LookupRequest) (*pb.LookupResponse, error) {
+	return s.lookup(ctx, req), nil
+}
+
+func (s *ReplGroupStoreServer) StreamLookup(stream pb.GroupStore_StreamLookupServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.lookup(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplGroupStoreServer) read(ctx context.Context, req *pb.ReadRequest) *pb.ReadResponse {
+	resp := &pb.ReadResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, resp.Value, err = s.rs.Read(ctx, req.KeyA, req.KeyB, req.ChildKeyA, req.ChildKeyB, nil)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplGroupStoreServer) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadResponse, error) {
+	return s.read(ctx, req), nil
+}
+
+func (s *ReplGroupStoreServer) StreamRead(stream pb.GroupStore_StreamReadServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.read(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplGroupStoreServer) delete(ctx context.Context, req *pb.DeleteRequest) *pb.DeleteResponse {
+	resp := &pb.DeleteResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, err = s.rs.Delete(ctx, req.KeyA, req.KeyB, req.ChildKeyA, req.ChildKeyB, req.TimestampMicro)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplGroupStoreServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	return s.delete(ctx, req), nil
+}
+
+func (s *ReplGroupStoreServer) StreamDelete(stream pb.GroupStore_StreamDeleteServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.delete(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplGroupStoreServer) lookupGroup(ctx context.Context, req *pb.LookupGroupRequest) *pb.LookupGroupResponse {
+	resp := &pb.LookupGroupResponse{Rpcid: req.Rpcid}
+	items, err := s.rs.LookupGroup(ctx, req.KeyA, req.KeyB)
+	resp.Err = s.translateError(err)
+	for _, item := range items {
+		resp.Items = append(resp.Items, &pb.LookupGroupItem{ChildKeyA: item.ChildKeyA, ChildKeyB: item.ChildKeyB, TimestampMicro: item.TimestampMicro, Length: item.Length})
+	}
+	return resp
+}
+
+func (s *ReplGroupStoreServer) LookupGroup(ctx context.Context, req *pb.LookupGroupRequest) (*pb.LookupGroupResponse, error) {
+	return s.lookupGroup(ctx, req), nil
+}
+
+func (s *ReplGroupStoreServer) StreamLookupGroup(stream pb.GroupStore_StreamLookupGroupServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.lookupGroup(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplGroupStoreServer) readGroup(ctx context.Context, req *pb.ReadGroupRequest) *pb.ReadGroupResponse {
+	resp := &pb.ReadGroupResponse{Rpcid: req.Rpcid}
+	items, err := s.rs.ReadGroup(ctx, req.KeyA, req.KeyB)
+	resp.Err = s.translateError(err)
+	for _, item := range items {
+		resp.Items = append(resp.Items, &pb.ReadGroupItem{ChildKeyA: item.ChildKeyA, ChildKeyB: item.ChildKeyB, TimestampMicro: item.TimestampMicro, Value: item.Value})
+	}
+	return resp
+}
+
+func (s *ReplGroupStoreServer) ReadGroup(ctx context.Context, req *pb.ReadGroupRequest) (*pb.ReadGroupResponse, error) {
+	return s.readGroup(ctx, req), nil
+}
+
+func (s *ReplGroupStoreServer) StreamReadGroup(stream pb.GroupStore_StreamReadGroupServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.readGroup(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// recordLatency folds the duration of a request into the store's moving
+// average latency, weighting the newest request at 1/8.
+func (s *replGroupStoreAndTicketChan) recordLatency(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&s.latency)
+		n := int64(d)
+		if old != 0 {
+			n = old + (n-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&s.latency, old, n) {
+			return
+		}
+	}
+}
+
+// Stats returns a *ReplStoreStats with the client's own counters and view of
+// the backend stores, along with the Stats of each connected backend store,
+// gathered concurrently. Backend stores that have not responded by the time
+// the ctx is done are reported in BackendErrors.
+func (rs *ReplGroupStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	stats := &ReplStoreStats{
+		Requests:         atomic.LoadUint64(&rs.metrics.requestCount),
+		NotFounds:        atomic.LoadUint64(&rs.metrics.notFoundCount),
+		Errors:           atomic.LoadUint64(&rs.metrics.errorCount),
+		Latencies:        make(map[string]time.Duration),
+		RepairQueueDepth: rs.repairQueueDepth(),
+		Backoffs:         rs.backoff.snapshot(),
+		Backends:         make(map[string]fmt.Stringer),
+		BackendErrors:    make(map[string]error),
+	}
+	var stores []*replGroupStoreAndTicketChan
+	rs.storesLock.RLock()
+	for addr, s := range rs.stores {
+		if s == nil {
+			continue
+		}
+		if latency := atomic.LoadInt64(&s.latency); latency != 0 {
+			stats.Latencies[addr] = time.Duration(latency)
+		}
+		stores = append(stores, s)
+	}
+	rs.storesLock.RUnlock()
+	type rettype struct {
+		addr  string
+		stats fmt.Stringer
+		err   error
+	}
+	ec := make(chan *rettype, len(stores))
+	for _, s := range stores {
+		s := s
+		s.workers.run(func() {
+			ret := &rettype{addr: s.addr}
+			ret.stats, ret.err = s.store.Stats(ctx, debug)
+			ec <- ret
+		})
+	}
+	pending := make(map[string]struct{}, len(stores))
+	for _, s := range stores {
+		pending[s.addr] = struct{}{}
+	}
+	for len(pending) > 0 {
+		select {
+		case ret := <-ec:
+			delete(pending, ret.addr)
+			if ret.err != nil {
+				stats.BackendErrors[ret.addr] = ret.err
+			} else {
+				stats.Backends[ret.addr] = ret.stats
+			}
+		case <-ctx.Done():
+			for addr := range pending {
+				stats.BackendErrors[addr] = ctx.Err()
+			}
+			return stats, nil
+		}
+	}
+	return stats, nil
+}
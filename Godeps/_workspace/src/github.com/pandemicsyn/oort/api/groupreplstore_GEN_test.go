@@ -0,0 +1,949 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gholt/store"
+	pb "github.com/pandemicsyn/oort/api/groupproto"
+	"github.com/pandemicsyn/oort/api/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestGroupStoreInterface(t *testing.T) {
+	func(s store.GroupStore) {}(NewReplGroupStore(nil))
+	func(s store.GroupStore) {}(&groupStorePool{})
+	func(s store.GroupStore) {}(&MemGroupStore{})
+	func(s store.GroupStore) {}(&FaultGroupStore{})
+	func(s store.GroupStore) {}(&ScriptedGroupStore{})
+}
+
+func TestMemReplGroupStore(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range ms {
+		if _, v, err := m.Read(ctx, 1, 2, 3, 4, nil); err != nil || string(v) != "v" {
+			t.Fatalf("replica %d: expected v; got %q %v", i, v, err)
+		}
+	}
+	if _, err := rs.Delete(ctx, 1, 2, 3, 4, 5); err != nil {
+		t.Fatal(err)
+	}
+	if ts, _, err := rs.Read(ctx, 1, 2, 3, 4, nil); !store.IsNotFound(err) || ts != 5 {
+		t.Fatalf("expected the delete to win the tie; got %d %v", ts, err)
+	}
+}
+
+func TestReplGroupStoreHintsPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replGroupStoreHints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	first := &replGroupHint{Addr: "a", KeyA: 1, TimestampMicro: 2, Value: []byte("v")}
+	cfg := &ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{HintedHandoffMaxBytes: first.size() + 1, HintedHandoffPath: path.Join(dir, "hints")}}
+	rs := NewReplGroupStore(cfg)
+	rs.addHint(context.Background(), first)
+	rs.addHint(context.Background(), &replGroupHint{Addr: "a", KeyA: 3, TimestampMicro: 4})
+	rs.hintsLock.Lock()
+	count := rs.hintCount
+	rs.hintsLock.Unlock()
+	if count != 1 {
+		t.Fatalf("expected hints to be capped at 1; got %d", count)
+	}
+	if err := rs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rs = NewReplGroupStore(cfg)
+	rs.hintsLock.Lock()
+	defer rs.hintsLock.Unlock()
+	hs := rs.hints["a"]
+	if len(hs) != 1 || hs[0].KeyA != 1 || hs[0].TimestampMicro != 2 || string(hs[0].Value) != "v" {
+		t.Fatalf("unexpected hints after reload: %#v", hs)
+	}
+}
+
+func TestFaultReplGroupStore(t *testing.T) {
+	rs, fss := NewFaultMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	fss[0].SetFaults(Faults{Down: true})
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("v")); err != nil {
+		t.Fatalf("expected a quorum with one replica down; got %v", err)
+	}
+	fss[1].SetFaults(Faults{Ops: FaultWrites, ErrorRate: 1})
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 6, []byte("w")); !errors.Is(err, ErrPartialWrite) || !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected a partial write from the injected faults; got %v", err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || string(v) != "w" {
+		t.Fatalf("expected w from the replicas still reading; got %q %v", v, err)
+	}
+}
+
+func TestReplGroupStoreScriptedRead(t *testing.T) {
+	rs, sss := NewScriptedReplGroupStore(3, nil)
+	ctx := context.Background()
+	sss[0].Push("Read", ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	sss[1].Push("Read", ScriptedResponse{TimestampMicro: 7, Value: []byte("b")})
+	sss[2].Push("Read", ScriptedResponse{Err: ErrNotFound})
+	if ts, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || ts != 7 || string(v) != "b" {
+		t.Fatalf("expected the newest value; got %d %q %v", ts, v, err)
+	}
+	sss[0].Push("Read", ScriptedResponse{TimestampMicro: 9, Err: ErrNotFound})
+	sss[1].Push("Read", ScriptedResponse{TimestampMicro: 7, Value: []byte("b")})
+	sss[2].Push("Read", ScriptedResponse{TimestampMicro: 7, Value: []byte("b")})
+	if ts, _, err := rs.Read(ctx, 5, 6, 7, 8, nil); !store.IsNotFound(err) || ts != 9 {
+		t.Fatalf("expected the newer deletion to win; got %d %v", ts, err)
+	}
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	sss[0].Push("Read", ScriptedResponse{TimestampMicro: 7, Value: []byte("b")})
+	sss[1].Push("Read", ScriptedResponse{TimestampMicro: 7, Value: []byte("b")})
+	sss[2].Push("Read", ScriptedResponse{TimestampMicro: 8, Value: []byte("c"), Delay: time.Second})
+	if ts, v, err := rs.Read(tctx, 9, 10, 11, 12, nil); err != nil || ts != 7 || string(v) != "b" {
+		t.Fatalf("expected the value from the replicas in time; got %d %q %v", ts, v, err)
+	}
+}
+
+func TestReplGroupStoreScriptedWrite(t *testing.T) {
+	rs, sss := NewScriptedReplGroupStore(3, nil)
+	ctx := context.Background()
+	boom := errors.New("boom")
+	sss[0].Push("Write", ScriptedResponse{Err: boom})
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("v")); err != nil {
+		t.Fatalf("expected a quorum with one failure; got %v", err)
+	}
+	sss[0].Push("Write", ScriptedResponse{Err: boom})
+	sss[1].Push("Write", ScriptedResponse{Err: boom})
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 6, []byte("v")); !errors.Is(err, ErrPartialWrite) {
+		t.Fatalf("expected a partial write with two failures; got %v", err)
+	}
+	for i, s := range sss {
+		if calls := s.Calls(); len(calls) != 2 || calls[1].Op != "Write" || calls[1].TimestampMicro != 6 {
+			t.Fatalf("replica %d: unexpected calls %#v", i, calls)
+		}
+	}
+	// A zero length value is refused before reaching any replica.
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 7, nil); err == nil {
+		t.Fatal("expected a zero length value to be refused")
+	}
+	for i, s := range sss {
+		if calls := s.Calls(); len(calls) != 2 {
+			t.Fatalf("replica %d: unexpected calls %#v", i, calls)
+		}
+	}
+}
+
+func TestReplGroupStoreErrorsIs(t *testing.T) {
+	timeout := &replGroupStoreError{err: context.DeadlineExceeded}
+	notFound := &replGroupStoreError{err: ErrNotFound}
+	if !errors.Is(timeout, ErrTimeout) || errors.Is(timeout, ErrNotFound) {
+		t.Fatal("store error did not classify a deadline as ErrTimeout")
+	}
+	var err error = &ReplGroupStoreErrorPartialWrite{SuccessCount: 1, ReplicaCount: 3, Errs: ReplGroupStoreErrorSlice{timeout, timeout}}
+	if !errors.Is(err, ErrPartialWrite) || !errors.Is(err, ErrTimeout) || errors.Is(err, ErrAllReplicasFailed) {
+		t.Fatalf("unexpected classification of %s", err)
+	}
+	var perr *ReplGroupStoreErrorPartialWrite
+	if !errors.As(err, &perr) || perr.SuccessCount != 1 || perr.ReplicaCount != 3 || len(perr.Errs) != 2 {
+		t.Fatalf("could not get the partial write details from %s", err)
+	}
+	var rerr ReplGroupStoreError
+	if !errors.As(err, &rerr) || rerr != timeout {
+		t.Fatalf("could not get the store error from %s", err)
+	}
+	err = ReplGroupStoreErrorNotFound{notFound}
+	if !errors.Is(err, ErrNotFound) || !store.IsNotFound(err) {
+		t.Fatalf("unexpected classification of %s", err)
+	}
+	err = &ReplGroupStoreErrorPartialRead{ResponseCount: 1, ReplicaCount: 3}
+	if !errors.Is(err, ErrPartialRead) || errors.Is(err, ErrPartialWrite) {
+		t.Fatalf("unexpected classification of %s", err)
+	}
+	if !errors.Is(ReplGroupStoreErrorSlice{timeout}, ErrAllReplicasFailed) {
+		t.Fatal("error slice did not match ErrAllReplicasFailed")
+	}
+	if !errors.Is(&valueTooLargeError{length: 2, valueCap: 1}, ErrValueTooLarge) {
+		t.Fatal("value too large error did not match ErrValueTooLarge")
+	}
+}
+
+func TestReplGroupStoreDisableWrites(t *testing.T) {
+	rs := NewReplGroupStore(nil)
+	ctx := context.Background()
+	if err := rs.DisableWrites(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("v")); err != ErrWritesDisabled {
+		t.Fatalf("expected ErrWritesDisabled from Write; got %v", err)
+	}
+	if _, err := rs.Delete(ctx, 1, 2, 3, 4, 5); !store.IsDisabled(err) {
+		t.Fatalf("expected a disabled error from Delete; got %v", err)
+	}
+	if err := rs.EnableWrites(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !rs.writesAllowed() {
+		t.Fatal("writes still disabled after EnableWrites")
+	}
+}
+
+func TestReplGroupStoreServer(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer()
+	NewReplGroupStoreServer(rs).Register(g)
+	go g.Serve(l)
+	defer g.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := pb.NewGroupStoreClient(conn)
+	ctx := context.Background()
+	if resp, err := c.Write(ctx, &pb.WriteRequest{Rpcid: 1, KeyA: 1, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4, TimestampMicro: 5, Value: []byte("v")}); err != nil || resp.Err != "" || resp.Rpcid != 1 {
+		t.Fatalf("write failed: %v %v", resp, err)
+	}
+	if resp, err := c.Read(ctx, &pb.ReadRequest{KeyA: 1, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4}); err != nil || resp.Err != "" || resp.TimestampMicro != 5 || string(resp.Value) != "v" {
+		t.Fatalf("read failed: %v %v", resp, err)
+	}
+
+	if resp, err := c.ReadGroup(ctx, &pb.ReadGroupRequest{KeyA: 1, KeyB: 2}); err != nil || resp.Err != "" || len(resp.Items) != 1 || resp.Items[0].ChildKeyB != 4 || string(resp.Items[0].Value) != "v" {
+		t.Fatalf("read group failed: %v %v", resp, err)
+	}
+
+	if resp, err := c.Delete(ctx, &pb.DeleteRequest{KeyA: 1, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4, TimestampMicro: 6}); err != nil || resp.Err != "" {
+		t.Fatalf("delete failed: %v %v", resp, err)
+	}
+	resp, err := c.Lookup(ctx, &pb.LookupRequest{KeyA: 1, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.IsNotFound(proto.TranslateErrorString(resp.Err)) || resp.TimestampMicro != 6 {
+		t.Fatalf("expected not found at 6 after the delete; got %v", resp)
+	}
+}
+
+func TestReplGroupStoreVerify(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	ms[0].Write(ctx, 1, 2, 3, 4, 5, []byte("a"))
+	ms[1].Write(ctx, 1, 2, 3, 4, 5, []byte("b"))
+	countProblems := func(res *GroupVerifyResult, kind string) int {
+		n := 0
+		for _, p := range res.Problems {
+			if strings.Contains(p, kind) {
+				n++
+			}
+		}
+		return n
+	}
+	res, err := rs.Verify(ctx, 1, 2, 3, 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Replicas) != 3 || len(res.Problems) != 2 || countProblems(res, "missing") != 1 || countProblems(res, "content differs") != 1 || !res.Fixed {
+		t.Fatalf("unexpected result %#v", res)
+	}
+	if ts, _, err := ms[2].Lookup(ctx, 1, 2, 3, 4); err != nil || ts != 5 {
+		t.Fatalf("missing replica not fixed: %d %v", ts, err)
+	}
+	rs.Write(ctx, 1, 2, 3, 4, 6, []byte("c"))
+	ms[0].Delete(ctx, 1, 2, 3, 4, 7)
+	res, err = rs.Verify(ctx, 1, 2, 3, 4, false)
+	if err != nil || countProblems(res, "behind at 6; newest is 7") != 2 || res.Fixed {
+		t.Fatalf("unexpected result %#v %v", res, err)
+	}
+
+	ms[1].Write(ctx, 1, 2, 5, 6, 8, []byte("d"))
+	results, err := rs.VerifyGroup(ctx, 1, 2, true)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("unexpected group results %v %v", results, err)
+	}
+	if res, err := rs.Verify(ctx, 1, 2, 5, 6, false); err != nil || !res.Consistent() {
+		t.Fatalf("group child not fixed: %#v %v", res, err)
+	}
+
+}
+
+func TestReplGroupStoreEnumerateKeys(t *testing.T) {
+	ms := []*MemGroupStore{&MemGroupStore{}, &MemGroupStore{}}
+	rs := newLocalReplGroupStore([]store.GroupStore{ms[0], ms[1], &ScriptedGroupStore{}}, nil)
+	ctx := context.Background()
+	ms[0].Write(ctx, 1<<63, 2, 3, 4, 5, []byte("a"))
+	ms[1].Write(ctx, 1<<63, 2, 3, 4, 6, []byte("bb"))
+	ms[1].Write(ctx, 1, 2, 3, 4, 5, []byte("c"))
+	ms[0].Delete(ctx, 1, 3, 3, 4, 5)
+	ms[0].Write(ctx, ^uint64(0), 2, 3, 4, 5, []byte("d"))
+	var keys []GroupListedKey
+	collect := func(key GroupListedKey) bool {
+		keys = append(keys, key)
+		return true
+	}
+	if err := rs.EnumerateKeys(ctx, nil, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0].KeyA != 1 || keys[1].KeyA != 1<<63 || keys[1].TimestampMicro != 6 || keys[1].Length != 2 || keys[2].KeyA != ^uint64(0) {
+		t.Fatalf("unexpected keys %#v", keys)
+	}
+	keys = nil
+	if err := rs.EnumerateKeys(ctx, &GroupEnumerateOptions{StopKeyA: 1<<63 - 1, IncludeDeleted: true}, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].KeyB != 2 || !keys[1].Deleted {
+		t.Fatalf("unexpected keys %#v", keys)
+	}
+	rs = newLocalReplGroupStore([]store.GroupStore{&ScriptedGroupStore{}}, nil)
+	if err := rs.EnumerateKeys(ctx, nil, collect); !errors.Is(err, ErrKeyListingUnsupported) {
+		t.Fatalf("expected ErrKeyListingUnsupported, got %v", err)
+	}
+}
+
+func TestReplGroupStoreWatch(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rs.Write(ctx, 1, 2, 3, 4, 5, []byte("a"))
+	evs := make(chan GroupWatchEvent)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- rs.Watch(ctx, 1, 2, 3, 4, &GroupWatchOptions{PollInterval: time.Hour}, func(ev GroupWatchEvent) bool {
+			evs <- ev
+			return !ev.Deleted
+		})
+	}()
+	// Local writes wake the watch, so retry until it has registered.
+	var ev GroupWatchEvent
+	for ts := int64(6); ev.TimestampMicro == 0; ts++ {
+		rs.Write(ctx, 1, 2, 3, 4, ts, []byte("b"))
+		select {
+		case ev = <-evs:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if ev.Deleted || ev.KeyA != 1 {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	rs.Delete(ctx, 1, 2, 3, 4, 100)
+	for !ev.Deleted {
+		ev = <-evs
+	}
+	if ev.TimestampMicro != 100 {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	// Changes made elsewhere are found by polling.
+	go func() {
+		errc <- rs.Watch(ctx, 5, 6, 7, 8, &GroupWatchOptions{PollInterval: time.Millisecond}, func(ev GroupWatchEvent) bool {
+			evs <- ev
+			return false
+		})
+	}()
+	ev = GroupWatchEvent{}
+	for ts := int64(200); ev.TimestampMicro == 0; ts++ {
+		for _, m := range ms {
+			m.Write(ctx, 5, 6, 7, 8, ts, []byte("c"))
+		}
+		select {
+		case ev = <-evs:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if ev.TimestampMicro < 200 || ev.KeyA != 5 {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		errc <- rs.WatchGroup(ctx, 10, 11, &GroupWatchOptions{PollInterval: time.Millisecond}, func(ev GroupWatchEvent) bool {
+			evs <- ev
+			return !ev.Deleted
+		})
+	}()
+	ev = GroupWatchEvent{}
+	for ts := int64(300); ev.TimestampMicro == 0; ts++ {
+		for _, m := range ms {
+			m.Write(ctx, 10, 11, 1, 1, ts, []byte("d"))
+		}
+		select {
+		case ev = <-evs:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if ev.ChildKeyA != 1 || ev.TimestampMicro < 300 || ev.Deleted {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	rs.Delete(ctx, 10, 11, 1, 1, 400)
+	for !ev.Deleted {
+		ev = <-evs
+	}
+	if ev.ChildKeyA != 1 || ev.TimestampMicro != 400 {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+func TestReplGroupStorePurge(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	if _, _, err := rs.LookupIncludingTombstones(ctx, 1, 2, 3, 4); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrDeleted) {
+		t.Fatalf("expected ErrNotFound alone, got %v", err)
+	}
+	rs.Write(ctx, 1, 2, 3, 4, 5, []byte("a"))
+	if _, err := rs.Purge(ctx, 1, 2, 3, 4, 10); err != ErrExists {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+	ms[0].Delete(ctx, 1, 2, 3, 4, 6)
+	ms[1].Delete(ctx, 1, 2, 3, 4, 6)
+	ts, _, err := rs.LookupIncludingTombstones(ctx, 1, 2, 3, 4)
+	if ts != 6 || !errors.Is(err, ErrDeleted) || !store.IsNotFound(err) {
+		t.Fatalf("expected deleted at 6, got %d %v", ts, err)
+	}
+	var conflict *ConflictError
+	if _, err := rs.Purge(ctx, 1, 2, 3, 4, 5); !errors.As(err, &conflict) {
+		t.Fatalf("expected *ConflictError, got %v", err)
+	}
+	if ts, err := rs.Purge(ctx, 1, 2, 3, 4, 6); ts != 6 || err != nil {
+		t.Fatalf("purge failed: %d %v", ts, err)
+	}
+	for i, m := range ms {
+		if ts, _, err := m.Lookup(ctx, 1, 2, 3, 4); ts != 0 || !store.IsNotFound(err) {
+			t.Fatalf("replica %d not purged: %d %v", i, ts, err)
+		}
+	}
+	rs = newLocalReplGroupStore([]store.GroupStore{&MemGroupStore{}, &ScriptedGroupStore{}}, nil)
+	if _, err := rs.Purge(ctx, 1, 2, 3, 4, 6); !errors.Is(err, ErrPurgeUnsupported) {
+		t.Fatalf("expected ErrPurgeUnsupported, got %v", err)
+	}
+}
+
+func TestReplGroupStoreNamespace(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	a := rs.Namespace(&GroupNamespaceConfig{Name: "a", ValueCap: 4, ByteQuota: 6})
+	b := rs.Namespace(&GroupNamespaceConfig{Name: "b"})
+	if _, err := a.Write(ctx, []byte("k"), []byte("c"), 1, []byte("abcde")); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	if _, err := a.Write(ctx, []byte("k"), []byte("c"), 1, []byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.Lookup(ctx, []byte("k"), []byte("c")); !store.IsNotFound(err) {
+		t.Fatalf("namespace b saw namespace a's key: %v", err)
+	}
+	if _, err := a.Write(ctx, []byte("k2"), []byte("c"), 1, []byte("abc")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	// Overwriting counts only the difference.
+	if _, err := a.Write(ctx, []byte("k"), []byte("c"), 2, []byte("ab")); err != nil {
+		t.Fatal(err)
+	}
+	if a.Usage() != 2 {
+		t.Fatalf("expected usage 2, got %d", a.Usage())
+	}
+	if _, err := a.Write(ctx, []byte("k2"), []byte("c"), 1, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Delete(ctx, []byte("k"), []byte("c"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if a.Usage() != 3 {
+		t.Fatalf("expected usage 3, got %d", a.Usage())
+	}
+	if _, v, err := a.Read(ctx, []byte("k2"), []byte("c"), nil); err != nil || string(v) != "abc" {
+		t.Fatalf("read %q %v", v, err)
+	}
+}
+
+func TestReplGroupStoreAuthorizer(t *testing.T) {
+	denial := errors.New("tenant may not write")
+	rs, _ := NewMemReplGroupStore(3, &ReplGroupStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{
+			Authorizer: func(ctx context.Context, op string, keyA, keyB uint64) error {
+				if keyA == 9 && op != "Read" {
+					return denial
+				}
+				return nil
+			},
+		},
+	})
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 9, 2, 3, 4, 1, []byte("a")); !errors.Is(err, ErrPermissionDenied) || !errors.Is(err, denial) {
+		t.Fatalf("expected the denial, got %v", err)
+	}
+	if _, _, err := rs.Read(ctx, 9, 2, 3, 4, nil); !store.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	results := rs.WriteBatch(ctx, []GroupWriteItem{
+		{KeyA: 1, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4, TimestampMicro: 1, Value: []byte("a")},
+		{KeyA: 9, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4, TimestampMicro: 1, Value: []byte("b")},
+	})
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrPermissionDenied) {
+		t.Fatalf("expected only the second item denied, got %v %v", results[0].Err, results[1].Err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || string(v) != "a" {
+		t.Fatalf("read %q %v", v, err)
+	}
+}
+
+func TestReplGroupStoreAudit(t *testing.T) {
+	var buf bytes.Buffer
+	signingKey := []byte("key")
+	rs, _ := NewMemReplGroupStore(3, &ReplGroupStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{
+			AuditSink:       NewAuditWriterSink(&buf),
+			AuditSigningKey: signingKey,
+			Authorizer: func(ctx context.Context, op string, keyA, keyB uint64) error {
+				if keyA == 9 {
+					return errors.New("no")
+				}
+				return nil
+			},
+		},
+	})
+	ctx := WithPrincipal(context.Background(), "alice")
+	rs.Write(ctx, 1, 2, 3, 4, 5, []byte("abc"))
+	rs.Read(ctx, 1, 2, 3, 4, nil)
+	rs.Delete(ctx, 1, 2, 3, 4, 6)
+	rs.Write(ctx, 9, 2, 3, 4, 5, []byte("abc"))
+	dec := json.NewDecoder(&buf)
+	for _, want := range []AuditRecord{
+		{Op: "Write", KeyA: 1, TimestampMicro: 5, Length: 3, Result: "ok"},
+		{Op: "Delete", KeyA: 1, TimestampMicro: 6, Result: "ok"},
+		{Op: "Write", KeyA: 9, TimestampMicro: 5, Length: 3, Result: "denied"},
+	} {
+		var rec AuditRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Op != want.Op || rec.KeyA != want.KeyA || rec.TimestampMicro != want.TimestampMicro || rec.Length != want.Length || rec.Result != want.Result || rec.Principal != "alice" || rec.Store != "group" {
+			t.Fatalf("expected %+v, got %+v", want, rec)
+		}
+		if !VerifyAuditRecord(&rec, signingKey) {
+			t.Fatalf("signature did not verify: %+v", rec)
+		}
+		rec.Length++
+		if VerifyAuditRecord(&rec, signingKey) {
+			t.Fatal("altered record verified")
+		}
+	}
+	if dec.More() {
+		t.Fatal("unexpected audit records")
+	}
+}
+
+func TestReplGroupStoreMiddleware(t *testing.T) {
+	var ops []string
+	logging := func(next GroupHandler) GroupHandler {
+		return func(ctx context.Context, req GroupRequest) GroupResponse {
+			ops = append(ops, req.Op)
+			return next(ctx, req)
+		}
+	}
+	caching := func(next GroupHandler) GroupHandler {
+		return func(ctx context.Context, req GroupRequest) GroupResponse {
+			if req.Op == "Read" && req.KeyA == 7 {
+				return GroupResponse{TimestampMicro: 1, Value: append(req.Value, "cached"...)}
+			}
+			return next(ctx, req)
+		}
+	}
+	rs, _ := NewMemReplGroupStore(3, &ReplGroupStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{
+			Authorizer: func(ctx context.Context, op string, keyA, keyB uint64) error {
+				if keyA == 9 {
+					return errors.New("no")
+				}
+				return nil
+			},
+		},
+		Middleware: []GroupMiddleware{logging, caching},
+	})
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 7, 2, 3, 4, nil); err != nil || string(v) != "cached" {
+		t.Fatalf("expected the middleware's value, got %q %v", v, err)
+	}
+	if _, _, err := rs.Lookup(ctx, 9, 2, 3, 4); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied, got %v", err)
+	}
+	if !reflect.DeepEqual(ops, []string{"Write", "Read"}) {
+		t.Fatalf("expected the authorized ops, got %v", ops)
+	}
+	if n := rs.metrics.requestCount; n != 3 {
+		t.Fatalf("expected 3 requests counted, got %d", n)
+	}
+}
+
+func TestReplGroupStoreValueTransform(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, &ReplGroupStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{
+			EncodeValue: func(ctx context.Context, value []byte) ([]byte, error) {
+				return append([]byte("enc:"), value...), nil
+			},
+			DecodeValue: func(ctx context.Context, value []byte) ([]byte, error) {
+				if !bytes.HasPrefix(value, []byte("enc:")) {
+					return nil, errors.New("not encoded")
+				}
+				return value[4:], nil
+			},
+			Compressor:      &FlateCompressor{},
+			CompressMinSize: 1,
+		},
+	})
+	ctx := context.Background()
+	value := bytes.Repeat([]byte("abc"), 100)
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, value); err != nil {
+		t.Fatal(err)
+	}
+	// EncodeValue comes before compression.
+	_, raw, err := ms[0].Read(ctx, 1, 2, 3, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, body, err := parseFrame(raw)
+	if err != nil || h.flags&frameCompressed == 0 {
+		t.Fatalf("expected a compressed value, got %q %v", raw, err)
+	}
+	if d, err := (&FlateCompressor{}).Decompress(body); err != nil || !bytes.Equal(d, append([]byte("enc:"), value...)) {
+		t.Fatalf("expected the encoded value compressed, got %q %v", d, err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || !bytes.Equal(v, value) {
+		t.Fatalf("read %q %v", v, err)
+	}
+}
+
+func TestReplGroupStoreSplitLargeValues(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, &ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{ValueCap: 64, SplitLargeValues: true}})
+	ctx := context.Background()
+	value := make([]byte, 1000)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, value); err != nil {
+		t.Fatal(err)
+	}
+	_, raw, err := ms[0].Read(ctx, 1, 2, 3, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, m, err := parseFrame(raw); err != nil || h.flags&frameSplitManifest == 0 || len(m) != streamManifestLen {
+		t.Fatalf("expected a manifest stored, got %q %v", raw, err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, []byte("x")); err != nil || !bytes.Equal(v, append([]byte("x"), value...)) {
+		t.Fatalf("read %d bytes %v", len(v), err)
+	}
+	// Small values are written as they are, even one shaped like a manifest.
+	if _, err := rs.Write(ctx, 6, 7, 8, 9, 5, []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 6, 7, 8, 9, nil); err != nil || string(v) != "small" {
+		t.Fatalf("read %q %v", v, err)
+	}
+	lookalike := append([]byte("OORTSPLT"), (&streamManifest{chunkSize: 57, chunkCount: 2, length: 100}).encode()...)
+	if _, err := rs.Write(ctx, 6, 7, 8, 9, 6, lookalike); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 6, 7, 8, 9, nil); err != nil || !bytes.Equal(v, lookalike) {
+		t.Fatalf("read %q %v", v, err)
+	}
+	if _, err := rs.Write(ctx, 6, 7, 8, 9, 7, lookalike[8:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := rs.Read(ctx, 6, 7, 8, 9, nil); err != nil || !bytes.Equal(v, lookalike[8:]) {
+		t.Fatalf("read %q %v", v, err)
+	}
+	keys := rs.streamChunkKeys(1, 2, 3, 4, 1)
+	if _, err := rs.Delete(ctx, 1, 2, 3, 4, 6); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ms[0].Read(ctx, keys[0].KeyA, keys[0].KeyB, keys[0].ChildKeyA, keys[0].ChildKeyB, nil); !store.IsNotFound(err) {
+		t.Fatalf("expected the chunks deleted, got %v", err)
+	}
+	rs, _ = NewMemReplGroupStore(3, &ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{ValueCap: 64}})
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, value); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge without SplitLargeValues, got %v", err)
+	}
+}
+
+func TestReplGroupStoreWriteAll(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, &ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{ValueCap: 8}})
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	items := []GroupWriteItem{
+		{KeyA: 1, KeyB: 2, ChildKeyA: 3, ChildKeyB: 4, TimestampMicro: 10, Value: []byte("new")},
+		{KeyA: 6, KeyB: 7, ChildKeyA: 8, ChildKeyB: 9, TimestampMicro: 10, Value: []byte("new")},
+	}
+	err := rs.WriteAll(ctx, append(items, GroupWriteItem{KeyA: 11, KeyB: 12, TimestampMicro: 10, Value: []byte("too large")}))
+	var waerr *GroupWriteAllError
+	if !errors.Is(err, ErrWriteAllFailed) || !errors.As(err, &waerr) || !waerr.RolledBack() || !errors.Is(waerr.Results[2].Err, ErrValueTooLarge) {
+		t.Fatalf("expected a rolled back WriteAll, got %v", err)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || string(v) != "old" {
+		t.Fatalf("expected the old value restored, got %q %v", v, err)
+	}
+	if _, _, err := rs.Read(ctx, 6, 7, 8, 9, nil); !store.IsNotFound(err) {
+		t.Fatalf("expected the new key deleted, got %v", err)
+	}
+	items[0].TimestampMicro, items[1].TimestampMicro = 20, 20
+	if err := rs.WriteAll(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if _, v, err := rs.Read(ctx, item.KeyA, item.KeyB, item.ChildKeyA, item.ChildKeyB, nil); err != nil || string(v) != "new" {
+			t.Fatalf("read %q %v", v, err)
+		}
+	}
+}
+
+func TestReplGroupStoreMove(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, &ReplGroupStoreConfig{
+		ReplStoreConfig: ReplStoreConfig{
+			Authorizer: func(ctx context.Context, op string, keyA, keyB uint64) error {
+				if op == "Delete" && keyA == 20 {
+					return errors.New("no deleting 20")
+				}
+				return nil
+			},
+		},
+	})
+	ctx := context.Background()
+	if err := rs.Move(ctx, 1, 2, 3, 4, 6, 7, 8, 9, 10); !store.IsNotFound(err) {
+		t.Fatalf("expected not found moving a missing value, got %v", err)
+	}
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	var cerr *ConflictError
+	if err := rs.Move(ctx, 1, 2, 3, 4, 6, 7, 8, 9, 5); !errors.As(err, &cerr) {
+		t.Fatalf("expected a conflict moving with the source's own timestamp, got %v", err)
+	}
+	if err := rs.Move(ctx, 1, 2, 3, 4, 6, 7, 8, 9, 10); err != nil {
+		t.Fatal(err)
+	}
+	if ts, _, err := rs.Lookup(ctx, 1, 2, 3, 4); !store.IsNotFound(err) || ts != 10 {
+		t.Fatalf("expected the source deleted at 10, got %d %v", ts, err)
+	}
+	if ts, v, err := rs.Read(ctx, 6, 7, 8, 9, nil); err != nil || ts != 10 || string(v) != "a" {
+		t.Fatalf("read destination %d %q %v", ts, v, err)
+	}
+	if _, err := rs.Write(ctx, 20, 2, 3, 4, 5, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Move(ctx, 20, 2, 3, 4, 21, 2, 3, 4, 10); !errors.Is(err, ErrMoveIncomplete) || !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected an incomplete move, got %v", err)
+	}
+	for _, keyA := range []uint64{20, 21} {
+		if _, v, err := rs.Read(ctx, keyA, 2, 3, 4, nil); err != nil || string(v) != "b" {
+			t.Fatalf("read %d gave %q %v", keyA, v, err)
+		}
+	}
+}
+
+func TestReplGroupStoreAppend(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	for i, data := range []string{"a", "b", "c"} {
+		ts, err := rs.Append(ctx, 1, 2, 3, 4, 10, []byte(data))
+		if err != nil || ts != int64(10+i) {
+			t.Fatalf("append %q gave %d %v", data, ts, err)
+		}
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || string(v) != "abc" {
+		t.Fatalf("read %q %v", v, err)
+	}
+	// Another write landing between the read and the write has the update
+	// start over.
+	calls := 0
+	ts, err := rs.Update(ctx, 1, 2, 3, 4, 20, func(value []byte) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			if _, err := rs.Write(ctx, 1, 2, 3, 4, 30, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return append(value, 'd'), nil
+	})
+	if err != nil || calls != 2 || ts != 31 {
+		t.Fatalf("update gave %d %v after %d calls", ts, err, calls)
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, 3, 4, nil); err != nil || string(v) != "xd" {
+		t.Fatalf("read %q %v", v, err)
+	}
+	if _, err := rs.Update(ctx, 1, 2, 3, 4, 40, func(value []byte) ([]byte, error) {
+		return nil, errors.New("no")
+	}); err == nil || err.Error() != "no" {
+		t.Fatalf("expected update's error, got %v", err)
+	}
+}
+
+func TestReplGroupStoreCounter(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, nil)
+	ctx := context.Background()
+	if n, err := rs.ReadCounter(ctx, 1, 2, 3, 4); err != nil || n != 0 {
+		t.Fatalf("read missing counter %d %v", n, err)
+	}
+	for i, want := range []int64{5, 10, 15} {
+		if n, err := rs.Increment(ctx, 1, 2, 3, 4, int64(10+i), 5); err != nil || n != want {
+			t.Fatalf("increment gave %d %v, expected %d", n, err, want)
+		}
+	}
+	if n, err := rs.Decrement(ctx, 1, 2, 3, 4, 20, 20); err != nil || n != -5 {
+		t.Fatalf("decrement gave %d %v", n, err)
+	}
+	if n, err := rs.ReadCounter(ctx, 1, 2, 3, 4); err != nil || n != -5 {
+		t.Fatalf("read counter %d %v", n, err)
+	}
+	if _, err := rs.Write(ctx, 6, 7, 8, 9, 5, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Increment(ctx, 6, 7, 8, 9, 10, 1); err == nil {
+		t.Fatal("expected an error incrementing a value that is not a counter")
+	}
+}
+
+func TestReplGroupStoreWithReplica(t *testing.T) {
+	rs, ms := NewMemReplGroupStore(3, nil)
+	_, addrs := localRing(3, 0)
+	ctx := context.Background()
+	rs.Write(ctx, 1, 2, 3, 4, 5, []byte("a"))
+	ms[1].Write(ctx, 1, 2, 3, 4, 6, []byte("b"))
+	if _, value, err := rs.Read(WithReplica(ctx, addrs[0]), 1, 2, 3, 4, nil); err != nil || string(value) != "a" {
+		t.Fatalf("pinned read of %s gave %q %v", addrs[0], value, err)
+	}
+	if ts, _, err := rs.Lookup(WithReplica(ctx, addrs[1]), 1, 2, 3, 4); err != nil || ts != 6 {
+		t.Fatalf("pinned lookup of %s gave %d %v", addrs[1], ts, err)
+	}
+	if _, _, err := rs.Read(WithReplica(ctx, "nowhere:1"), 1, 2, 3, 4, nil); err == nil {
+		t.Fatal("expected an error reading from an unknown replica")
+	}
+
+	if items, err := rs.ReadGroup(WithReplica(ctx, addrs[1]), 1, 2); err != nil || len(items) != 1 || string(items[0].Value) != "b" {
+		t.Fatalf("pinned group read gave %v %v", items, err)
+	}
+
+}
+
+func TestReplGroupStoreReplicasFor(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, nil)
+	_, addrs := localRing(3, 0)
+	rns, err := rs.ReplicasFor(context.Background(), 1<<63)
+	if err != nil || len(rns) != 3 {
+		t.Fatalf("unexpected replicas %v %v", rns, err)
+	}
+	seen := make(map[string]bool)
+	for _, rn := range rns {
+		seen[rn.Addr] = true
+		if rn.NodeID == 0 || rn.Partition != uint32(uint64(1<<63)>>(64-rs.Ring(context.Background()).PartitionBitCount())) {
+			t.Fatalf("unexpected replica %#v", rn)
+		}
+	}
+	for _, addr := range addrs {
+		if !seen[addr] {
+			t.Fatalf("%s missing from %v", addr, rns)
+		}
+	}
+}
+
+func TestReplGroupStorePartitionMap(t *testing.T) {
+	rs, _ := NewMemReplGroupStore(3, nil)
+	m, err := rs.PartitionMap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Partitions) != 1<<m.PartitionBitCount || len(m.Nodes) != 3 || m.ReplicaCount != 3 {
+		t.Fatalf("unexpected map %#v", m)
+	}
+	primaries := 0
+	for _, n := range m.Nodes {
+		if n.NodeID == 0 || n.Partitions != len(m.Partitions) {
+			t.Fatalf("unexpected node %#v", n)
+		}
+		primaries += n.Primaries
+	}
+	if primaries != len(m.Partitions) {
+		t.Fatalf("%d primaries for %d partitions", primaries, len(m.Partitions))
+	}
+	if rns, _ := rs.ReplicasFor(context.Background(), ^uint64(0)); m.Nodes[m.Partitions[len(m.Partitions)-1][0]].Addr != rns[0].Addr {
+		t.Fatalf("last partition's first replica differs from ReplicasFor's %v", rns)
+	}
+}
+
+func TestReplGroupStoreFallbackNodes(t *testing.T) {
+	addrs := []string{"a:1", "b:2", "c:3", "d:4"}
+	ms := make(map[string]*MemGroupStore)
+	for _, addr := range addrs {
+		ms[addr] = &MemGroupStore{}
+	}
+	rs := NewReplGroupStore(&ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{FallbackNodes: addrs, FallbackDelay: time.Millisecond}})
+	rs.newBackendStore = func(addr string) (store.GroupStore, error) {
+		return ms[addr], nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := rs.Write(ctx, 1, 2, 3, 4, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	held := 0
+	for _, m := range ms {
+		if _, _, err := m.Lookup(ctx, 1, 2, 3, 4); err == nil {
+			held++
+		}
+	}
+	if held != 3 {
+		t.Fatalf("expected 3 replicas; %d held the key", held)
+	}
+	reversed := []string{addrs[3], addrs[2], addrs[1], addrs[0]}
+	other := NewReplGroupStore(&ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{FallbackNodes: reversed, FallbackDelay: time.Millisecond}})
+	for _, keyA := range []uint64{1, 1 << 40, 1 << 63, ^uint64(0)} {
+		a, _ := rs.ReplicasFor(ctx, keyA)
+		b, _ := other.ReplicasFor(ctx, keyA)
+		for i := range a {
+			if a[i].Addr != b[i].Addr {
+				t.Fatalf("placement of %x differs with the nodes reordered: %v %v", keyA, a, b)
+			}
+		}
+	}
+}
+
+func TestReplGroupStoreStartupWaitForRing(t *testing.T) {
+	ctx := context.Background()
+	rs := NewReplGroupStore(&ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{RingSource: &StaticRingSource{}, StartupWaitForRing: 20 * time.Millisecond, LogError: func(string, ...interface{}) {}}})
+	if err := rs.Startup(ctx); err != ErrNoRing {
+		t.Fatalf("expected ErrNoRing, got %v", err)
+	}
+	rs.Shutdown(ctx)
+	r, _ := localRing(1, 0)
+	rs = NewReplGroupStore(&ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{RingSource: &StaticRingSource{Ring: r}, StartupWaitForRing: 10 * time.Second}})
+	if err := rs.Startup(ctx); err != nil || rs.RingVersion() != r.Version() {
+		t.Fatalf("expected the ring after Startup, got %d %v", rs.RingVersion(), err)
+	}
+	rs.Shutdown(ctx)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// GroupReplicaState is what one replica holds for a key, as found by
+// Verify.
+type GroupReplicaState struct {
+	Addr string
+	// TimestampMicro is that of the value or deletion marker held, or 0 if
+	// the replica has neither.
+	TimestampMicro int64
+	// Deleted is set if the replica holds a deletion marker.
+	Deleted bool
+	Length  int
+	// Checksum is the CRC-32C of the value as stored, for comparing
+	// replicas holding the same timestamp.
+	Checksum uint32
+	// Err is set if the replica could not be read, including if its value
+	// failed its stored checksum.
+	Err error
+}
+
+// GroupVerifyResult is the outcome of Verify for a key.
+type GroupVerifyResult struct {
+	KeyA uint64
+	KeyB uint64
+
+	ChildKeyA uint64
+	ChildKeyB uint64
+
+	// Replicas gives each replica's state in ring order.
+	Replicas []GroupReplicaState
+	// Problems describes each divergence between the replicas; it is empty
+	// if they agree.
+	Problems []string
+	// Fixed is set if Verify was asked to fix the key and wrote the newest
+	// value, or deletion marker, to the replicas behind.
+	Fixed bool
+}
+
+// Consistent returns true if the replicas agreed.
+func (r *GroupVerifyResult) Consistent() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify reads the key from every replica directly, rather than merging to
+// the newest as Read does, and reports how they diverge: replicas that are
+// unreachable, that fail their stored checksum, that are missing the key,
+// that are behind the newest timestamp, or that hold different content at
+// the same timestamp. With fix, replicas missing the key or behind are given
+// the newest value as background repair would. Replicas holding different
+// content at the same timestamp, or failing their checksum, cannot be fixed
+// this way, as stores only accept newer timestamps; a fresh Write of the
+// right value resolves them.
+func (rs *ReplGroupStore) Verify(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, fix bool) (*GroupVerifyResult, error) {
+	key := replGroupCacheKey{keyA, keyB, childKeyA, childKeyB}
+	reads, err := rs.readEachReplica(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	res := &GroupVerifyResult{KeyA: keyA, KeyB: keyB, ChildKeyA: childKeyA, ChildKeyB: childKeyB}
+	var newest *GroupReplicaState
+	for _, read := range reads {
+		st := GroupReplicaState{Addr: read.s.addr, TimestampMicro: read.timestampMicro}
+		switch {
+		case read.err == nil:
+			st.Length = len(read.value)
+			st.Checksum = crc32.Checksum(read.value, crc32cTable)
+		case store.IsNotFound(read.err):
+			st.Deleted = read.timestampMicro != 0
+		default:
+			st.Err = read.err
+		}
+		res.Replicas = append(res.Replicas, st)
+	}
+	for i := range res.Replicas {
+		st := &res.Replicas[i]
+		if st.Err == nil && (newest == nil || st.TimestampMicro > newest.TimestampMicro) {
+			newest = st
+		}
+	}
+	behind := false
+	for i := range res.Replicas {
+		st := &res.Replicas[i]
+		switch {
+		case errors.Is(st.Err, ErrChecksumMismatch):
+			res.Problems = append(res.Problems, fmt.Sprintf("%s: corrupt: %s", st.Addr, st.Err))
+		case st.Err != nil:
+			res.Problems = append(res.Problems, fmt.Sprintf("%s: unreachable: %s", st.Addr, st.Err))
+		case st.TimestampMicro == 0 && newest.TimestampMicro != 0:
+			res.Problems = append(res.Problems, fmt.Sprintf("%s: missing; newest is %d", st.Addr, newest.TimestampMicro))
+			behind = true
+		case st.TimestampMicro < newest.TimestampMicro:
+			res.Problems = append(res.Problems, fmt.Sprintf("%s: behind at %d; newest is %d", st.Addr, st.TimestampMicro, newest.TimestampMicro))
+			behind = true
+		case st.Deleted != newest.Deleted || st.Checksum != newest.Checksum || st.Length != newest.Length:
+			res.Problems = append(res.Problems, fmt.Sprintf("%s: content differs from %s at %d", st.Addr, newest.Addr, st.TimestampMicro))
+		}
+	}
+	if fix && behind {
+		if err := rs.repair(ctx, key); err != nil {
+			return res, err
+		}
+		res.Fixed = true
+	}
+	return res, nil
+}
+
+// VerifyGroup runs Verify for every child key any replica has in the group,
+// as listed by each replica's LookupGroup, so children missing from some
+// replicas are found too. It returns the results for all the children, and
+// an error if any replica could not list the group.
+func (rs *ReplGroupStore) VerifyGroup(ctx context.Context, parentKeyA, parentKeyB uint64, fix bool) ([]*GroupVerifyResult, error) {
+	stores, err := rs.storesFor(ctx, parentKeyA)
+	if err != nil {
+		return nil, err
+	}
+	type childKey struct {
+		a, b uint64
+	}
+	seen := make(map[childKey]struct{})
+	var children []childKey
+	var listErr error
+	for _, s := range stores {
+		select {
+		case <-s.tickets(ctx):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		sctx, done := rs.startReplica(ctx, "LookupGroup", s)
+		items, err := s.store.LookupGroup(sctx, parentKeyA, parentKeyB)
+		done(err)
+		s.tickets(ctx) <- struct{}{}
+		if err != nil {
+			listErr = rs.storeError(s, err)
+			continue
+		}
+		for _, item := range items {
+			k := childKey{item.ChildKeyA, item.ChildKeyB}
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				children = append(children, k)
+			}
+		}
+	}
+	results := make([]*GroupVerifyResult, 0, len(children))
+	for _, k := range children {
+		res, err := rs.Verify(ctx, parentKeyA, parentKeyB, k.a, k.b, fix)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, listErr
+}
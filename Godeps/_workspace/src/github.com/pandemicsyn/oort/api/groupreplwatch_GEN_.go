@@ -0,0 +1,152 @@
+package api
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// GroupWatchEvent is a change to a key seen by Watch or WatchGroup.
+type GroupWatchEvent struct {
+	GroupKeyPair
+	// TimestampMicro is that of the new value or deletion marker; it is 0
+	// for a member removed from a group without a deletion marker being
+	// found.
+	TimestampMicro int64
+	// Deleted is set if the key was deleted rather than written.
+	Deleted bool
+}
+
+// GroupWatchOptions defines the settings for Watch and WatchGroup; nil
+// gives the defaults.
+type GroupWatchOptions struct {
+	// PollInterval is how often the replicas are checked for changes;
+	// default is 1s.
+	PollInterval time.Duration
+}
+
+func (opts *GroupWatchOptions) pollInterval() time.Duration {
+	if opts == nil || opts.PollInterval <= 0 {
+		return defaultWatchPollInterval
+	}
+	return opts.PollInterval
+}
+
+// Watch calls fn for each write or delete of the key until fn returns false
+// or the ctx is done, for caches and indexers to stay in sync. The backend
+// stores offer no subscription, so the replicas are polled for the key's
+// timestamp every PollInterval; writes and deletes made through this client
+// are seen at once. Changes between polls coalesce into one event for the
+// newest, and polls that fail are retried at the next interval. Watch
+// returns nil if fn stopped it, or the ctx's error.
+func (rs *ReplGroupStore) Watch(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, opts *GroupWatchOptions, fn func(ev GroupWatchEvent) bool) error {
+	wake, unwatch := rs.watchers.add(keyA, keyB)
+	defer unwatch()
+	interval := opts.pollInterval()
+	last, _, err := rs.lookup(ctx, keyA, keyB, childKeyA, childKeyB)
+	for err != nil && !store.IsNotFound(err) {
+		if !waitWatch(ctx, wake, interval) {
+			return ctx.Err()
+		}
+		last, _, err = rs.lookup(ctx, keyA, keyB, childKeyA, childKeyB)
+	}
+	for waitWatch(ctx, wake, interval) {
+		timestampMicro, _, err := rs.lookup(ctx, keyA, keyB, childKeyA, childKeyB)
+		if err != nil && !store.IsNotFound(err) {
+			continue
+		}
+		if timestampMicro <= last {
+			continue
+		}
+		last = timestampMicro
+		if !fn(GroupWatchEvent{
+			GroupKeyPair:   GroupKeyPair{keyA, keyB, childKeyA, childKeyB},
+			TimestampMicro: timestampMicro,
+			Deleted:        err != nil,
+		}) {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// WatchGroup is Watch for every member of a group: fn is called for members
+// added or rewritten, with the union of the replicas' LookupGroup polled for
+// changed timestamps, and for members removed, which are looked up for their
+// deletion timestamp. Events for a poll are given in child key order. Writes
+// and deletes of members made through this client are seen at once.
+func (rs *ReplGroupStore) WatchGroup(ctx context.Context, parentKeyA, parentKeyB uint64, opts *GroupWatchOptions, fn func(ev GroupWatchEvent) bool) error {
+	wake, unwatch := rs.watchers.add(parentKeyA, parentKeyB)
+	defer unwatch()
+	interval := opts.pollInterval()
+	poll := func() (map[groupChildKey]int64, bool) {
+		lists, _, err := rs.lookupGroupReplicas(ctx, parentKeyA, parentKeyB)
+		if err != nil {
+			return nil, false
+		}
+		items, _ := unionLookupGroupItems(lists)
+		members := make(map[groupChildKey]int64, len(items))
+		for _, item := range items {
+			members[groupChildKey{item.ChildKeyA, item.ChildKeyB}] = item.TimestampMicro
+		}
+		return members, true
+	}
+	last, ok := poll()
+	for !ok {
+		if !waitWatch(ctx, wake, interval) {
+			return ctx.Err()
+		}
+		last, ok = poll()
+	}
+	for waitWatch(ctx, wake, interval) {
+		members, ok := poll()
+		if !ok {
+			continue
+		}
+		var evs []GroupWatchEvent
+		for k, timestampMicro := range members {
+			if timestampMicro > last[k] {
+				evs = append(evs, GroupWatchEvent{GroupKeyPair: GroupKeyPair{parentKeyA, parentKeyB, k.childKeyA, k.childKeyB}, TimestampMicro: timestampMicro})
+			}
+		}
+		for k := range last {
+			if _, ok := members[k]; ok {
+				continue
+			}
+			timestampMicro, _, err := rs.lookup(ctx, parentKeyA, parentKeyB, k.childKeyA, k.childKeyB)
+			if err == nil {
+				// Missing from the listing only in passing.
+				members[k] = timestampMicro
+				continue
+			}
+			evs = append(evs, GroupWatchEvent{GroupKeyPair: GroupKeyPair{parentKeyA, parentKeyB, k.childKeyA, k.childKeyB}, TimestampMicro: timestampMicro, Deleted: true})
+		}
+		sort.Sort(replGroupWatchEventsByKey(evs))
+		last = members
+		for _, ev := range evs {
+			if !fn(ev) {
+				return nil
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+type replGroupWatchEventsByKey []GroupWatchEvent
+
+func (evs replGroupWatchEventsByKey) Len() int {
+	return len(evs)
+}
+
+func (evs replGroupWatchEventsByKey) Swap(i, j int) {
+	evs[i], evs[j] = evs[j], evs[i]
+}
+
+func (evs replGroupWatchEventsByKey) Less(i, j int) bool {
+	if evs[i].ChildKeyA != evs[j].ChildKeyA {
+		return evs[i].ChildKeyA < evs[j].ChildKeyA
+	}
+	return evs[i].ChildKeyB < evs[j].ChildKeyB
+}
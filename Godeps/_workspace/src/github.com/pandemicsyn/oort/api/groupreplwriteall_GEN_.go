@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// GroupWriteAllError is returned by ReplGroupStore.WriteAll when not every
+// item could be written, saying what became of each item.
+type GroupWriteAllError struct {
+	// Results holds the outcome of writing each item, in the order given. An
+	// item whose OldTimestampMicro is newer than its own TimestampMicro was
+	// superseded rather than written. Items are left as they were, with no
+	// write attempted, when the failure was found before writing, such as an
+	// item the Authorizer denied.
+	Results []GroupWriteResult
+	// RollbackErrs holds, for each item, the error rolling it back; it is
+	// nil if no item was written or every item was rolled back.
+	RollbackErrs []error
+}
+
+func (e *GroupWriteAllError) Error() string {
+	failed := 0
+	for _, result := range e.Results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	notRolledBack := 0
+	for _, err := range e.RollbackErrs {
+		if err != nil {
+			notRolledBack++
+		}
+	}
+	if notRolledBack > 0 {
+		return fmt.Sprintf("write all: %d of %d items failed; %d items could not be rolled back", failed, len(e.Results), notRolledBack)
+	}
+	return fmt.Sprintf("write all: %d of %d items failed; rolled back", failed, len(e.Results))
+}
+
+// RolledBack returns true if no item written is left in place.
+func (e *GroupWriteAllError) RolledBack() bool {
+	for _, err := range e.RollbackErrs {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *GroupWriteAllError) Is(target error) bool {
+	return target == ErrWriteAllFailed
+}
+
+// WriteAll writes all the items given or, should any fail, none of them, as
+// far as it is able. The value each key holds is read first, every item is
+// then written with WriteBatch, through the Middleware chain, and, if any
+// item fails, such as one a middleware denies, or is superseded by a newer
+// value, every item written is rolled back: a key that held a value has it
+// written back, one timestamp after the item's, and a key that held none is
+// deleted at the item's timestamp. The roll back does not pass through the
+// Middleware chain. The error returned is then a GroupWriteAllError,
+// matching ErrWriteAllFailed, which reports each item's outcome and whether
+// the roll back completed.
+//
+// This is a best effort, not a transaction: each item is visible to readers
+// as soon as it is written, a write made to one of the keys by another client
+// in the meantime may be overwritten by the roll back, and should this client
+// stop part way the items written so far are left in place.
+func (rs *ReplGroupStore) WriteAll(ctx context.Context, items []GroupWriteItem) error {
+	start := time.Now()
+	results := make([]GroupWriteResult, len(items))
+	failed := false
+	for i := range items {
+		if results[i].Err = rs.authorize(ctx, "Write", items[i].KeyA, items[i].KeyB); results[i].Err != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return &GroupWriteAllError{Results: results}
+	}
+	previous := rs.readPrevious(ctx, items)
+	for i := range previous {
+		if err := previous[i].Err; err != nil && !store.IsNotFound(err) {
+			results[i].Err = fmt.Errorf("error reading the value to roll back to: %s", err)
+			failed = true
+		}
+	}
+	if failed {
+		return &GroupWriteAllError{Results: results}
+	}
+	results = rs.WriteBatch(ctx, items)
+	for i := range items {
+		if results[i].Err != nil || results[i].OldTimestampMicro > items[i].TimestampMicro {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return &GroupWriteAllError{Results: results, RollbackErrs: rs.rollBack(ctx, start, items, results, previous)}
+}
+
+// readPrevious reads the raw value, as stored, for each item, so WriteAll can
+// roll it back.
+func (rs *ReplGroupStore) readPrevious(ctx context.Context, items []GroupWriteItem) []GroupReadResult {
+	previous := make([]GroupReadResult, len(items))
+	for start := 0; start < len(items); start += rs.concurrentRequestsPerStore {
+		end := start + rs.concurrentRequestsPerStore
+		if end > len(items) {
+			end = len(items)
+		}
+		doneChan := make(chan struct{}, end-start)
+		for i := start; i < end; i++ {
+			go func(i int) {
+				item := &items[i]
+				previous[i].TimestampMicro, previous[i].Value, previous[i].Err = rs.read(ctx, item.KeyA, item.KeyB, item.ChildKeyA, item.ChildKeyB, nil)
+				doneChan <- struct{}{}
+			}(i)
+		}
+		for i := start; i < end; i++ {
+			<-doneChan
+		}
+	}
+	return previous
+}
+
+// rollBack undoes each item WriteAll may have written, all but those
+// superseded, returning the error rolling back each item, or nil if every
+// item was rolled back.
+func (rs *ReplGroupStore) rollBack(ctx context.Context, start time.Time, items []GroupWriteItem, results []GroupWriteResult, previous []GroupReadResult) []error {
+	errs := make([]error, len(items))
+	var restores []GroupWriteItem
+	var indexes []int
+	for i := range items {
+		item := &items[i]
+		if results[i].Err == nil && results[i].OldTimestampMicro > item.TimestampMicro {
+			continue
+		}
+		if previous[i].Err == nil {
+			restores = append(restores, GroupWriteItem{KeyA: item.KeyA, KeyB: item.KeyB, ChildKeyA: item.ChildKeyA, ChildKeyB: item.ChildKeyB, TimestampMicro: item.TimestampMicro + 1, Value: previous[i].Value})
+			indexes = append(indexes, i)
+			continue
+		}
+		// Deletions win ties, so this removes the item at its own timestamp.
+		_, errs[i] = rs.delete(ctx, item.KeyA, item.KeyB, item.ChildKeyA, item.ChildKeyB, item.TimestampMicro)
+		rs.audit(ctx, "Rollback", start, item.KeyA, item.KeyB, item.ChildKeyA, item.ChildKeyB, item.TimestampMicro, 0, errs[i])
+	}
+	for j, result := range rs.writeBatch(ctx, restores) {
+		restore := &restores[j]
+		errs[indexes[j]] = result.Err
+		rs.audit(ctx, "Rollback", start, restore.KeyA, restore.KeyB, restore.ChildKeyA, restore.ChildKeyB, restore.TimestampMicro, len(restore.Value), result.Err)
+	}
+	rolledBack := true
+	for i := range items {
+		item := &items[i]
+		rs.uncache(replGroupCacheKey{keyA: item.KeyA, keyB: item.KeyB, childKeyA: item.ChildKeyA, childKeyB: item.ChildKeyB})
+		if errs[i] != nil {
+			rolledBack = false
+		}
+	}
+	if rolledBack {
+		return nil
+	}
+	return errs
+}
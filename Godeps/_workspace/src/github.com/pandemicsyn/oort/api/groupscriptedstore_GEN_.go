@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ScriptedGroupStore is a store.GroupStore giving each data call the next
+// response queued for its op with Push, or the default response once the
+// queue is empty. Every data call is recorded, for Calls. The zero value
+// answers everything with an empty success.
+type ScriptedGroupStore struct {
+	lock      sync.Mutex
+	responses map[string][]ScriptedResponse
+	dflt      ScriptedResponse
+	calls     []ScriptedCall
+}
+
+// Push queues responses for the op, one of "Lookup", "Read", "Write",
+// "Delete", "LookupGroup", or "ReadGroup".
+func (s *ScriptedGroupStore) Push(op string, responses ...ScriptedResponse) {
+	s.lock.Lock()
+	if s.responses == nil {
+		s.responses = make(map[string][]ScriptedResponse)
+	}
+	s.responses[op] = append(s.responses[op], responses...)
+	s.lock.Unlock()
+}
+
+// SetDefault sets the response given when an op's queue is empty.
+func (s *ScriptedGroupStore) SetDefault(r ScriptedResponse) {
+	s.lock.Lock()
+	s.dflt = r
+	s.lock.Unlock()
+}
+
+// Calls returns the data calls made so far, oldest first.
+func (s *ScriptedGroupStore) Calls() []ScriptedCall {
+	s.lock.Lock()
+	calls := append([]ScriptedCall(nil), s.calls...)
+	s.lock.Unlock()
+	return calls
+}
+
+// next records the call and returns the response for it.
+func (s *ScriptedGroupStore) next(call ScriptedCall) ScriptedResponse {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls = append(s.calls, call)
+	if rs := s.responses[call.Op]; len(rs) > 0 {
+		s.responses[call.Op] = rs[1:]
+		return rs[0]
+	}
+	return s.dflt
+}
+
+func (s *ScriptedGroupStore) Startup(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedGroupStore) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedGroupStore) EnableWrites(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedGroupStore) DisableWrites(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedGroupStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedGroupStore) AuditPass(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedGroupStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	s.lock.Lock()
+	stats := scriptedGroupStoreStats(len(s.calls))
+	s.lock.Unlock()
+	return stats, nil
+}
+
+type scriptedGroupStoreStats int
+
+func (s scriptedGroupStoreStats) String() string {
+	return fmt.Sprintf("calls %d", int(s))
+}
+
+func (s *ScriptedGroupStore) ValueCap(ctx context.Context) (uint32, error) {
+	return math.MaxUint32, nil
+}
+
+func (s *ScriptedGroupStore) Lookup(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64) (int64, uint32, error) {
+	r := s.next(ScriptedCall{Op: "Lookup", KeyA: keyA, KeyB: keyB, ChildKeyA: childKeyA, ChildKeyB: childKeyB})
+	if err := r.wait(ctx); err != nil {
+		return 0, 0, err
+	}
+	return r.TimestampMicro, r.length(), r.Err
+}
+
+func (s *ScriptedGroupStore) Read(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, value []byte) (int64, []byte, error) {
+	r := s.next(ScriptedCall{Op: "Read", KeyA: keyA, KeyB: keyB, ChildKeyA: childKeyA, ChildKeyB: childKeyB})
+	if err := r.wait(ctx); err != nil {
+		return 0, value, err
+	}
+	if r.Err != nil {
+		return r.TimestampMicro, value, r.Err
+	}
+	return r.TimestampMicro, append(value, r.Value...), nil
+}
+
+func (s *ScriptedGroupStore) Write(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	r := s.next(ScriptedCall{Op: "Write", KeyA: keyA, KeyB: keyB, ChildKeyA: childKeyA, ChildKeyB: childKeyB, TimestampMicro: timestampMicro, Value: append([]byte(nil), value...)})
+	if err := r.wait(ctx); err != nil {
+		return 0, err
+	}
+	return r.TimestampMicro, r.Err
+}
+
+func (s *ScriptedGroupStore) Delete(ctx context.Context, keyA uint64, keyB uint64, childKeyA uint64, childKeyB uint64, timestampMicro int64) (int64, error) {
+	r := s.next(ScriptedCall{Op: "Delete", KeyA: keyA, KeyB: keyB, ChildKeyA: childKeyA, ChildKeyB: childKeyB, TimestampMicro: timestampMicro})
+	if err := r.wait(ctx); err != nil {
+		return 0, err
+	}
+	return r.TimestampMicro, r.Err
+}
+
+func (s *ScriptedGroupStore) LookupGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.LookupGroupItem, error) {
+	r := s.next(ScriptedCall{Op: "LookupGroup", KeyA: parentKeyA, KeyB: parentKeyB})
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.LookupGroupItems, r.Err
+}
+
+func (s *ScriptedGroupStore) ReadGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.ReadGroupItem, error) {
+	r := s.next(ScriptedCall{Op: "ReadGroup", KeyA: parentKeyA, KeyB: parentKeyB})
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.ReadGroupItems, r.Err
+}
+
+// NewScriptedReplGroupStore returns a ReplGroupStore routing to the given
+// number of ScriptedGroupStores, each a replica of every key, for unit
+// testing how replica responses are combined without a cluster. As with
+// NewMemReplGroupStore, c's RingSource is ignored and c may be nil.
+func NewScriptedReplGroupStore(replicas int, c *ReplGroupStoreConfig) (*ReplGroupStore, []*ScriptedGroupStore) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	sss := make([]*ScriptedGroupStore, replicas)
+	ss := make([]store.GroupStore, replicas)
+	for i := range sss {
+		sss[i] = &ScriptedGroupStore{}
+		ss[i] = sss[i]
+	}
+	return newLocalReplGroupStore(ss, c), sss
+}
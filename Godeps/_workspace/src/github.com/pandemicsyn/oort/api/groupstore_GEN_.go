@@ -49,6 +49,12 @@ type groupStore struct {
 
 // NewGroupStore creates a GroupStore connection via grpc to the given
 // address.
+//
+// Requests are pipelined: each request type is multiplexed, tagged with an
+// Rpcid, over a single long lived bidirectional Stream RPC per connection
+// rather than each paying for a unary call. Up to concurrency requests of
+// each type may be in flight at once; see NewGroupStorePool to spread them
+// over more than one connection.
 func NewGroupStore(addr string, concurrency int, ftlsConfig *ftls.Config, opts ...grpc.DialOption) (store.GroupStore, error) {
 	stor := &groupStore{
 		addr:             addr,
@@ -612,7 +618,7 @@ func (stor *groupStore) Read(ctx context.Context, keyA, keyB uint64, childKeyA,
 	}
 
 	timestampMicro = res.res.TimestampMicro
-	rvalue = append(rvalue, res.res.Value...)
+	rvalue = append(value, res.res.Value...)
 
 	if res.res.Err == "" {
 		err = nil
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gholt/store"
+	"github.com/pandemicsyn/ftls"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// groupStorePool spreads requests round robin across several connections to
+// the same backend store address, so a single HTTP/2 connection does not
+// become the bottleneck under high throughput.
+type groupStorePool struct {
+	// next is first to keep it 64-bit aligned for atomic use.
+	next   uint64
+	stores []store.GroupStore
+}
+
+// NewGroupStorePool creates a GroupStore with the given number of
+// connections via grpc to the address, each able to carry the concurrency
+// given.
+func NewGroupStorePool(addr string, connections int, concurrency int, ftlsConfig *ftls.Config, opts ...grpc.DialOption) (store.GroupStore, error) {
+	if connections < 2 {
+		return NewGroupStore(addr, concurrency, ftlsConfig, opts...)
+	}
+	pool := &groupStorePool{stores: make([]store.GroupStore, connections)}
+	for i := range pool.stores {
+		var err error
+		if pool.stores[i], err = NewGroupStore(addr, concurrency, ftlsConfig, opts...); err != nil {
+			for _, s := range pool.stores[:i] {
+				if c, ok := s.(interface{ Close() }); ok {
+					c.Close()
+				}
+			}
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+func (pool *groupStorePool) pick() store.GroupStore {
+	return pool.stores[atomic.AddUint64(&pool.next, 1)%uint64(len(pool.stores))]
+}
+
+// all calls f for each connection, returning the first error.
+func (pool *groupStorePool) all(f func(s store.GroupStore) error) error {
+	var rerr error
+	for _, s := range pool.stores {
+		if err := f(s); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	return rerr
+}
+
+func (pool *groupStorePool) Startup(ctx context.Context) error {
+	return pool.all(func(s store.GroupStore) error { return s.Startup(ctx) })
+}
+
+func (pool *groupStorePool) Shutdown(ctx context.Context) error {
+	return pool.all(func(s store.GroupStore) error { return s.Shutdown(ctx) })
+}
+
+// Close closes each connection; see groupStore.Close.
+func (pool *groupStorePool) Close() {
+	for _, s := range pool.stores {
+		if c, ok := s.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+// The store level requests go to just one connection as they all reach the
+// same backend store.
+
+func (pool *groupStorePool) EnableWrites(ctx context.Context) error {
+	return pool.stores[0].EnableWrites(ctx)
+}
+
+func (pool *groupStorePool) DisableWrites(ctx context.Context) error {
+	return pool.stores[0].DisableWrites(ctx)
+}
+
+func (pool *groupStorePool) Flush(ctx context.Context) error {
+	return pool.stores[0].Flush(ctx)
+}
+
+func (pool *groupStorePool) AuditPass(ctx context.Context) error {
+	return pool.stores[0].AuditPass(ctx)
+}
+
+func (pool *groupStorePool) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	return pool.stores[0].Stats(ctx, debug)
+}
+
+func (pool *groupStorePool) ValueCap(ctx context.Context) (uint32, error) {
+	return pool.stores[0].ValueCap(ctx)
+}
+
+func (pool *groupStorePool) Lookup(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64) (int64, uint32, error) {
+	return pool.pick().Lookup(ctx, keyA, keyB, childKeyA, childKeyB)
+}
+
+func (pool *groupStorePool) Read(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, value []byte) (int64, []byte, error) {
+	return pool.pick().Read(ctx, keyA, keyB, childKeyA, childKeyB, value)
+}
+
+func (pool *groupStorePool) Write(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	return pool.pick().Write(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro, value)
+}
+
+func (pool *groupStorePool) Delete(ctx context.Context, keyA, keyB uint64, childKeyA, childKeyB uint64, timestampMicro int64) (int64, error) {
+	return pool.pick().Delete(ctx, keyA, keyB, childKeyA, childKeyB, timestampMicro)
+}
+
+func (pool *groupStorePool) LookupGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.LookupGroupItem, error) {
+	return pool.pick().LookupGroup(ctx, parentKeyA, parentKeyB)
+}
+
+func (pool *groupStorePool) ReadGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.ReadGroupItem, error) {
+	return pool.pick().ReadGroup(ctx, parentKeyA, parentKeyB)
+}
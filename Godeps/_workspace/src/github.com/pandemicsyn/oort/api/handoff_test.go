@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// queuedHints returns the keyAs of the hints queued for addr.
+func queuedHints(rs *ReplValueStore, addr string) []uint64 {
+	rs.hintsLock.Lock()
+	defer rs.hintsLock.Unlock()
+	var keys []uint64
+	for _, h := range rs.hints[addr] {
+		keys = append(keys, h.KeyA)
+	}
+	return keys
+}
+
+func TestHintsAppended(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "hints")
+	cfg := &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{HintedHandoffMaxBytes: 1 << 20, HintedHandoffPath: name}}
+	ctx := context.Background()
+	rs := NewReplValueStore(cfg)
+	rs.addHint(ctx, &replValueHint{Addr: "a", KeyA: 1, TimestampMicro: 2, Value: []byte("v")})
+	rs.addHint(ctx, &replValueHint{Addr: "a", KeyA: 3, TimestampMicro: 4})
+	// Without a Shutdown, as after a crash, the hints are still reloaded.
+	if keys := queuedHints(NewReplValueStore(cfg), "a"); len(keys) != 2 || keys[0] != 1 || keys[1] != 3 {
+		t.Fatalf("expected both hints reloaded, got %v", keys)
+	}
+	// A record cut short is dropped along with anything after it.
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, b[:len(b)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if keys := queuedHints(NewReplValueStore(cfg), "a"); len(keys) != 1 || keys[0] != 1 {
+		t.Fatalf("expected the first hint reloaded, got %v", keys)
+	}
+	// Reloading rewrote the file with just the hints kept.
+	if keys := queuedHints(NewReplValueStore(cfg), "a"); len(keys) != 1 || keys[0] != 1 {
+		t.Fatalf("expected the first hint reloaded, got %v", keys)
+	}
+}
+
+func TestHintsMaxBytes(t *testing.T) {
+	small := &replValueHint{Addr: "a", KeyA: 1, TimestampMicro: 2, Value: []byte("v")}
+	rs := NewReplValueStore(&ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{HintedHandoffMaxBytes: 1000}})
+	ctx := context.Background()
+	rs.addHint(ctx, small)
+	// A large value does not fit in what is left, while small ones do.
+	rs.addHint(ctx, &replValueHint{Addr: "a", KeyA: 2, TimestampMicro: 2, Value: bytes.Repeat([]byte("v"), 1000)})
+	rs.addHint(ctx, &replValueHint{Addr: "a", KeyA: 3, TimestampMicro: 2, Value: []byte("v")})
+	if keys := queuedHints(rs, "a"); len(keys) != 2 || keys[0] != 1 || keys[1] != 3 {
+		t.Fatalf("expected the large hint dropped, got %v", keys)
+	}
+	rs.hintsLock.Lock()
+	defer rs.hintsLock.Unlock()
+	if rs.hintBytes != 2*small.size() {
+		t.Fatalf("expected %d bytes queued, got %d", 2*small.size(), rs.hintBytes)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import "time"
+
+// ReplStoreHealth is returned by the Health method of the Repl stores and is
+// meant to be easily serialized for liveness and readiness probes.
+type ReplStoreHealth struct {
+	// Ready is true once a ring is available; until then no requests can
+	// be routed to backend stores.
+	Ready bool `json:"ready"`
+	// RingVersion is the Version of the current ring, or 0 if none.
+	RingVersion int64 `json:"ringVersion"`
+	// RingAge is how long ago the current ring was established. It assumes
+	// the ring's Version is the UnixNano time it was built, as ring.Builder
+	// sets it; a ring versioned some other way gives a meaningless age.
+	RingAge time.Duration `json:"ringAge"`
+	// Backends lists every backend store address in the current ring.
+	Backends []ReplStoreBackendHealth `json:"backends"`
+}
+
+// ReplStoreBackendHealth reports the state of a single backend store.
+type ReplStoreBackendHealth struct {
+	Addr string `json:"addr"`
+	// State is one of "unconnected" (nothing has been sent to the store
+	// yet), "connected" (the last request succeeded), "failing" (the last
+	// request failed), or "error" (a connection could not be created and
+	// will be retried once its reconnect backoff has passed).
+	State         string    `json:"state"`
+	LastSuccess   time.Time `json:"lastSuccess"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+	TicketsInUse  int       `json:"ticketsInUse"`
+}
+
+// ReplStoreBackendStateChange is passed to the OnBackendStateChange callback
+// of the Repl stores whenever a backend store changes state.
+type ReplStoreBackendStateChange struct {
+	Addr string
+	// State is the new state: "connected" and "failing" as with
+	// ReplStoreBackendHealth, "error" when a connection could not be created,
+	// "unconnected" when an error state is cleared so the connection will
+	// be retried, or "removed" when the store has left the ring and been
+	// shut down.
+	State string
+	// Err is the error causing a "failing" or "error" state.
+	Err  error
+	Time time.Time
+}
+
+type replStoreBackendHealthByAddr []ReplStoreBackendHealth
+
+func (hs replStoreBackendHealthByAddr) Len() int           { return len(hs) }
+func (hs replStoreBackendHealthByAddr) Swap(i, j int)      { hs[i], hs[j] = hs[j], hs[i] }
+func (hs replStoreBackendHealthByAddr) Less(i, j int) bool { return hs[i].Addr < hs[j].Addr }
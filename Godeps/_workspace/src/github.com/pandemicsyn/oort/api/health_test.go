@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+func TestHealth(t *testing.T) {
+	if h := NewReplValueStore(nil).Health(context.Background()); h.Ready || h.RingVersion != 0 || len(h.Backends) != 0 {
+		t.Fatalf("expected no ring, got %+v", h)
+	}
+	rs, sss := NewScriptedReplValueStore(4, nil)
+	sss[1].SetDefault(ScriptedResponse{Err: errUnavailable})
+	newBackendStore := rs.newBackendStore
+	rs.newBackendStore = func(addr string) (store.ValueStore, error) {
+		if addr == "local3" {
+			return nil, fmt.Errorf("no connection")
+		}
+		return newBackendStore(addr)
+	}
+	ctx := context.Background()
+	h := rs.Health(ctx)
+	if !h.Ready || len(h.Backends) != 4 {
+		t.Fatalf("expected 4 backends, got %+v", h)
+	}
+	for _, b := range h.Backends {
+		if b.State != "unconnected" {
+			t.Fatalf("expected %s unconnected before any request, got %q", b.Addr, b.State)
+		}
+	}
+	rs.Write(ctx, 1, 2, 3, []byte("a"))
+	h = rs.Health(ctx)
+	rs.ringLock.RLock()
+	version := rs.ring.Version()
+	rs.ringLock.RUnlock()
+	if h.RingVersion != version {
+		t.Fatalf("expected ring version %d, got %d", version, h.RingVersion)
+	}
+	if age := time.Since(time.Unix(0, version)); h.RingAge <= 0 || h.RingAge > age {
+		t.Fatalf("expected a ring age up to %s, got %s", age, h.RingAge)
+	}
+	for i, want := range []string{"connected", "failing", "connected", "error"} {
+		b := h.Backends[i]
+		if b.Addr != fmt.Sprintf("local%d", i) || b.State != want {
+			t.Fatalf("expected local%d %s, got %s %s", i, want, b.Addr, b.State)
+		}
+		if want == "connected" && (b.LastSuccess.IsZero() || b.LastError != "") {
+			t.Fatalf("expected %s to have only succeeded, got %+v", b.Addr, b)
+		}
+		if want != "connected" && b.LastError == "" {
+			t.Fatalf("expected %s to report its error, got %+v", b.Addr, b)
+		}
+	}
+}
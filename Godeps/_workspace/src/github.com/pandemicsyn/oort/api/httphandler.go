@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// maxHTTPBody bounds the request bodies NewHTTPHandler accepts; values are
+// further limited by the stores' ValueCap.
+const maxHTTPBody = 64 * 1024 * 1024
+
+// HTTPValue is the JSON form of a value used by NewHTTPHandler. Value is
+// encoded as the encoding query parameter asks: base64, the default, or hex.
+// ChildKeyA and ChildKeyB are only set for group items.
+type HTTPValue struct {
+	ChildKeyA      uint64 `json:"childKeyA,omitempty"`
+	ChildKeyB      uint64 `json:"childKeyB,omitempty"`
+	TimestampMicro int64  `json:"timestampMicro"`
+	Value          string `json:"value"`
+}
+
+type httpHandler struct {
+	vs *ReplValueStore
+	gs *ReplGroupStore
+}
+
+// NewHTTPHandler returns an http.Handler exposing the stores given as a
+// simple JSON interface, for scripting and debugging with curl rather than
+// for production traffic. Either store may be nil to leave its routes out.
+// Keys are uint64s in decimal, or hex with a 0x prefix.
+//
+//     GET    /v1/values/{keyA}/{keyB}
+//     PUT    /v1/values/{keyA}/{keyB}
+//     DELETE /v1/values/{keyA}/{keyB}
+//     GET    /v1/groups/{keyA}/{keyB}
+//     GET    /v1/groups/{keyA}/{keyB}/{childKeyA}/{childKeyB}
+//     PUT    /v1/groups/{keyA}/{keyB}/{childKeyA}/{childKeyB}
+//     DELETE /v1/groups/{keyA}/{keyB}/{childKeyA}/{childKeyB}
+//
+// GET returns an HTTPValue, or for a whole group a JSON array of them. HEAD
+// does a Lookup instead, giving the timestamp and length in the
+// X-Oort-Timestamp-Micro and Content-Length headers. PUT takes an HTTPValue;
+// a zero timestampMicro means now. DELETE takes its timestamp from the
+// timestampMicro query parameter, again defaulting to now. PUT and DELETE
+// return the old timestamp as {"timestampMicro": n}.
+//
+// Errors are returned as {"error": "..."} with 404 for not found, 400 for a
+// bad request, 503 when writes are disabled, and 500 otherwise.
+//
+// The handler does no authentication of its own; wrap it or serve it only
+// where trusted.
+func NewHTTPHandler(vs *ReplValueStore, gs *ReplGroupStore) http.Handler {
+	return &httpHandler{vs: vs, gs: gs}
+}
+
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.serve(w, r); err != nil {
+		status := http.StatusInternalServerError
+		switch e := err.(type) {
+		case *httpError:
+			status = e.status
+		default:
+			if store.IsNotFound(err) {
+				status = http.StatusNotFound
+			} else if store.IsDisabled(err) {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		writeHTTPJSON(w, status, map[string]string{"error": err.Error()})
+	}
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func parseHTTPKeys(parts []string) ([]uint64, error) {
+	keys := make([]uint64, len(parts))
+	for i, part := range parts {
+		var err error
+		if keys[i], err = strconv.ParseUint(part, 0, 64); err != nil {
+			return nil, badRequest("invalid key %q", part)
+		}
+	}
+	return keys, nil
+}
+
+func encodeHTTPValue(r *http.Request, value []byte) (string, error) {
+	switch r.URL.Query().Get("encoding") {
+	case "", "base64":
+		return base64.StdEncoding.EncodeToString(value), nil
+	case "hex":
+		return hex.EncodeToString(value), nil
+	}
+	return "", badRequest("unknown encoding %q", r.URL.Query().Get("encoding"))
+}
+
+func decodeHTTPValue(r *http.Request, value string) ([]byte, error) {
+	var b []byte
+	var err error
+	switch r.URL.Query().Get("encoding") {
+	case "", "base64":
+		b, err = base64.StdEncoding.DecodeString(value)
+	case "hex":
+		b, err = hex.DecodeString(value)
+	default:
+		return nil, badRequest("unknown encoding %q", r.URL.Query().Get("encoding"))
+	}
+	if err != nil {
+		return nil, badRequest("invalid value: %s", err)
+	}
+	return b, nil
+}
+
+// httpTimestamp returns the timestamp given, or now if it is zero.
+func httpTimestamp(timestampMicro int64) int64 {
+	if timestampMicro == 0 {
+		return time.Now().UnixNano() / 1000
+	}
+	return timestampMicro
+}
+
+// httpOps are the store calls behind a single key's routes, so values and
+// group items are served alike.
+type httpOps struct {
+	lookup func(ctx context.Context) (int64, uint32, error)
+	read   func(ctx context.Context) (int64, []byte, error)
+	write  func(ctx context.Context, timestampMicro int64, value []byte) (int64, error)
+	delete func(ctx context.Context, timestampMicro int64) (int64, error)
+}
+
+func (h *httpHandler) serve(w http.ResponseWriter, r *http.Request) error {
+	ctx := context.Background()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		return &httpError{status: http.StatusNotFound, msg: "no such route"}
+	}
+	keys, err := parseHTTPKeys(parts[2:])
+	if err != nil {
+		return err
+	}
+	var ops *httpOps
+	switch {
+	case parts[1] == "values" && h.vs != nil && len(keys) == 2:
+		ops = &httpOps{
+			lookup: func(ctx context.Context) (int64, uint32, error) {
+				return h.vs.Lookup(ctx, keys[0], keys[1])
+			},
+			read: func(ctx context.Context) (int64, []byte, error) {
+				return h.vs.Read(ctx, keys[0], keys[1], nil)
+			},
+			write: func(ctx context.Context, timestampMicro int64, value []byte) (int64, error) {
+				return h.vs.Write(ctx, keys[0], keys[1], timestampMicro, value)
+			},
+			delete: func(ctx context.Context, timestampMicro int64) (int64, error) {
+				return h.vs.Delete(ctx, keys[0], keys[1], timestampMicro)
+			},
+		}
+	case parts[1] == "groups" && h.gs != nil && len(keys) == 2:
+		if r.Method != "GET" {
+			return &httpError{status: http.StatusMethodNotAllowed, msg: "only GET is allowed for a whole group"}
+		}
+		return h.readGroup(ctx, w, r, keys[0], keys[1])
+	case parts[1] == "groups" && h.gs != nil && len(keys) == 4:
+		ops = &httpOps{
+			lookup: func(ctx context.Context) (int64, uint32, error) {
+				return h.gs.Lookup(ctx, keys[0], keys[1], keys[2], keys[3])
+			},
+			read: func(ctx context.Context) (int64, []byte, error) {
+				return h.gs.Read(ctx, keys[0], keys[1], keys[2], keys[3], nil)
+			},
+			write: func(ctx context.Context, timestampMicro int64, value []byte) (int64, error) {
+				return h.gs.Write(ctx, keys[0], keys[1], keys[2], keys[3], timestampMicro, value)
+			},
+			delete: func(ctx context.Context, timestampMicro int64) (int64, error) {
+				return h.gs.Delete(ctx, keys[0], keys[1], keys[2], keys[3], timestampMicro)
+			},
+		}
+	default:
+		return &httpError{status: http.StatusNotFound, msg: "no such route"}
+	}
+	switch r.Method {
+	case "HEAD":
+		timestampMicro, length, err := ops.lookup(ctx)
+		if err != nil {
+			if store.IsNotFound(err) {
+				w.WriteHeader(http.StatusNotFound)
+				return nil
+			}
+			return err
+		}
+		w.Header().Set("X-Oort-Timestamp-Micro", strconv.FormatInt(timestampMicro, 10))
+		w.Header().Set("Content-Length", strconv.FormatUint(uint64(length), 10))
+		w.WriteHeader(http.StatusOK)
+	case "GET":
+		timestampMicro, value, err := ops.read(ctx)
+		if err != nil {
+			return err
+		}
+		v := &HTTPValue{TimestampMicro: timestampMicro}
+		if v.Value, err = encodeHTTPValue(r, value); err != nil {
+			return err
+		}
+		writeHTTPJSON(w, http.StatusOK, v)
+	case "PUT":
+		var v HTTPValue
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxHTTPBody)).Decode(&v); err != nil {
+			return badRequest("invalid JSON body: %s", err)
+		}
+		value, err := decodeHTTPValue(r, v.Value)
+		if err != nil {
+			return err
+		}
+		oldTimestampMicro, err := ops.write(ctx, httpTimestamp(v.TimestampMicro), value)
+		if err != nil {
+			return err
+		}
+		writeHTTPJSON(w, http.StatusOK, map[string]int64{"timestampMicro": oldTimestampMicro})
+	case "DELETE":
+		var timestampMicro int64
+		if s := r.URL.Query().Get("timestampMicro"); s != "" {
+			if timestampMicro, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return badRequest("invalid timestampMicro %q", s)
+			}
+		}
+		oldTimestampMicro, err := ops.delete(ctx, httpTimestamp(timestampMicro))
+		if err != nil {
+			return err
+		}
+		writeHTTPJSON(w, http.StatusOK, map[string]int64{"timestampMicro": oldTimestampMicro})
+	default:
+		return &httpError{status: http.StatusMethodNotAllowed, msg: fmt.Sprintf("method %s not allowed", r.Method)}
+	}
+	return nil
+}
+
+func (h *httpHandler) readGroup(ctx context.Context, w http.ResponseWriter, r *http.Request, keyA, keyB uint64) error {
+	items, err := h.gs.ReadGroup(ctx, keyA, keyB)
+	if err != nil {
+		return err
+	}
+	vs := make([]*HTTPValue, len(items))
+	for i, item := range items {
+		vs[i] = &HTTPValue{ChildKeyA: item.ChildKeyA, ChildKeyB: item.ChildKeyB, TimestampMicro: item.TimestampMicro}
+		if vs[i].Value, err = encodeHTTPValue(r, item.Value); err != nil {
+			return err
+		}
+	}
+	writeHTTPJSON(w, http.StatusOK, vs)
+	return nil
+}
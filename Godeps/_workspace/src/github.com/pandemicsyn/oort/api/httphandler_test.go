@@ -0,0 +1,47 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	vs, _ := NewMemReplValueStore(3, nil)
+	gs, _ := NewMemReplGroupStore(3, nil)
+	srv := httptest.NewServer(NewHTTPHandler(vs, gs))
+	defer srv.Close()
+	do := func(method, path, body string, status int) string {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != status {
+			t.Fatalf("%s %s: expected %d; got %d %s", method, path, status, resp.StatusCode, b)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	do("PUT", "/v1/values/1/0x2?encoding=hex", `{"timestampMicro": 5, "value": "6869"}`, http.StatusOK)
+	if b := do("GET", "/v1/values/1/2", "", http.StatusOK); b != `{"timestampMicro":5,"value":"aGk="}` {
+		t.Fatalf("unexpected value %s", b)
+	}
+	do("DELETE", "/v1/values/1/2?timestampMicro=6", "", http.StatusOK)
+	do("GET", "/v1/values/1/2", "", http.StatusNotFound)
+	do("HEAD", "/v1/values/1/2", "", http.StatusNotFound)
+	do("PUT", "/v1/groups/1/2/3/4", `{"value": "aGk="}`, http.StatusOK)
+	do("HEAD", "/v1/groups/1/2/3/4", "", http.StatusOK)
+	if b := do("GET", "/v1/groups/1/2?encoding=hex", "", http.StatusOK); !strings.Contains(b, `"childKeyA":3,"childKeyB":4,`) || !strings.Contains(b, `"value":"6869"`) {
+		t.Fatalf("unexpected group %s", b)
+	}
+	do("GET", "/v1/values/1/nope", "", http.StatusBadRequest)
+	do("PUT", "/v1/values/1/2?encoding=rot13", `{"value": ""}`, http.StatusBadRequest)
+	do("GET", "/v2/values/1/2", "", http.StatusNotFound)
+}
@@ -0,0 +1,240 @@
+// Package index maintains secondary indexes of the values in a value store,
+// kept in a group store, so values can be looked up by their attributes as
+// well as by their keys. Each index has a function giving the terms a value
+// is to be found by, such as a user's email address, and Index.Write and
+// Index.Delete keep, for each term, a group of the keys of the values with
+// that term:
+//
+//	byEmail := index.New(vs, gs, "users-by-email", func(value []byte) ([]string, error) {
+//	    var u user
+//	    if err := json.Unmarshal(value, &u); err != nil {
+//	        return nil, err
+//	    }
+//	    return []string{u.Email}, nil
+//	})
+//	_, err := byEmail.Write(ctx, keyA, keyB, timestampMicro, value)
+//	...
+//	results, err := byEmail.Query(ctx, "someone@example.com")
+//
+// The index is updated alongside the value rather than with it, so a failure
+// part way can leave the index with entries for terms a value no longer has;
+// it never lacks an entry for a value written through the Index, as new
+// entries are written before the value and stale ones deleted after. Query
+// checks each value against the term and skips stale entries, while Lookup
+// returns the keys as indexed.
+package index
+
+import (
+	"fmt"
+
+	"github.com/gholt/store"
+	"github.com/pandemicsyn/oort/api"
+	"golang.org/x/net/context"
+)
+
+// Terms returns the terms a value is to be found by in an index.
+type Terms func(value []byte) ([]string, error)
+
+// Key is the key of a value found in an index.
+type Key struct {
+	KeyA uint64
+	KeyB uint64
+}
+
+// Result is a value found by Query.
+type Result struct {
+	KeyA           uint64
+	KeyB           uint64
+	TimestampMicro int64
+	Value          []byte
+}
+
+// entryValue is stored for each index entry; the entry's child key is the
+// value's key, so there is nothing more to store, but the stores do not
+// accept empty values.
+var entryValue = []byte{1}
+
+// Index is a secondary index of the values in a value store.
+type Index struct {
+	values store.ValueStore
+	groups store.GroupStore
+	keys   api.KeyNamespace
+	terms  Terms
+}
+
+// New returns an Index of the values in the value store given, kept in the
+// group store given under parent keys derived from each term and the name
+// given, so that indexes with different names never share entries. Every
+// write and delete of the values indexed must go through the Index for it to
+// stay complete.
+func New(values store.ValueStore, groups store.GroupStore, name string, terms Terms) *Index {
+	return &Index{values: values, groups: groups, keys: api.NewKeyNamespace("index:" + name), terms: terms}
+}
+
+// termsOf returns the value's terms, without duplicates.
+func (ix *Index) termsOf(value []byte) (map[string]struct{}, error) {
+	terms, err := ix.terms(value)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{}, len(terms))
+	for _, term := range terms {
+		set[term] = struct{}{}
+	}
+	return set, nil
+}
+
+// oldTerms returns the terms of the value currently stored for the key, if
+// any.
+func (ix *Index) oldTerms(ctx context.Context, keyA, keyB uint64) (map[string]struct{}, error) {
+	_, value, err := ix.values.Read(ctx, keyA, keyB, nil)
+	if store.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	terms, err := ix.termsOf(value)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the terms of the value stored: %s", err)
+	}
+	return terms, nil
+}
+
+// Write writes the value to the value store and adds index entries for the
+// terms it has that the value it replaces did not, and, once the value is
+// written, deletes the entries for the terms it no longer has. The return
+// values are those of the value store's Write.
+func (ix *Index) Write(ctx context.Context, keyA, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	terms, err := ix.termsOf(value)
+	if err != nil {
+		return 0, err
+	}
+	old, err := ix.oldTerms(ctx, keyA, keyB)
+	if err != nil {
+		return 0, err
+	}
+	for term := range terms {
+		if _, ok := old[term]; ok {
+			continue
+		}
+		termA, termB := ix.keys.HashString(term)
+		if _, err := ix.groups.Write(ctx, termA, termB, keyA, keyB, timestampMicro, entryValue); err != nil {
+			return 0, fmt.Errorf("error adding index entry for %q: %s", term, err)
+		}
+	}
+	oldTimestampMicro, err := ix.values.Write(ctx, keyA, keyB, timestampMicro, value)
+	if err != nil || oldTimestampMicro > timestampMicro {
+		// Not written, or superseded by a newer value, whose terms are not
+		// known; the entries for the old terms stay.
+		return oldTimestampMicro, err
+	}
+	for term := range old {
+		if _, ok := terms[term]; ok {
+			continue
+		}
+		termA, termB := ix.keys.HashString(term)
+		if _, err := ix.groups.Delete(ctx, termA, termB, keyA, keyB, timestampMicro); err != nil {
+			return oldTimestampMicro, fmt.Errorf("value written but error deleting index entry for %q: %s", term, err)
+		}
+	}
+	return oldTimestampMicro, nil
+}
+
+// Delete deletes the value from the value store and then its index entries.
+// The return values are those of the value store's Delete.
+func (ix *Index) Delete(ctx context.Context, keyA, keyB uint64, timestampMicro int64) (int64, error) {
+	old, err := ix.oldTerms(ctx, keyA, keyB)
+	if err != nil {
+		return 0, err
+	}
+	oldTimestampMicro, err := ix.values.Delete(ctx, keyA, keyB, timestampMicro)
+	if err != nil || oldTimestampMicro > timestampMicro {
+		return oldTimestampMicro, err
+	}
+	for term := range old {
+		termA, termB := ix.keys.HashString(term)
+		if _, err := ix.groups.Delete(ctx, termA, termB, keyA, keyB, timestampMicro); err != nil {
+			return oldTimestampMicro, fmt.Errorf("value deleted but error deleting index entry for %q: %s", term, err)
+		}
+	}
+	return oldTimestampMicro, nil
+}
+
+// Lookup returns the keys indexed under the term, without reading the
+// values, so it may include keys of values that no longer have the term.
+func (ix *Index) Lookup(ctx context.Context, term string) ([]Key, error) {
+	termA, termB := ix.keys.HashString(term)
+	items, err := ix.groups.LookupGroup(ctx, termA, termB)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, len(items))
+	for i, item := range items {
+		keys[i] = Key{KeyA: item.ChildKeyA, KeyB: item.ChildKeyB}
+	}
+	return keys, nil
+}
+
+// LookupAll returns the keys indexed under every one of the terms; see
+// Lookup.
+func (ix *Index) LookupAll(ctx context.Context, terms ...string) ([]Key, error) {
+	var keys []Key
+	for i, term := range terms {
+		termKeys, err := ix.Lookup(ctx, term)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			keys = termKeys
+			continue
+		}
+		found := make(map[Key]struct{}, len(termKeys))
+		for _, k := range termKeys {
+			found[k] = struct{}{}
+		}
+		kept := keys[:0]
+		for _, k := range keys {
+			if _, ok := found[k]; ok {
+				kept = append(kept, k)
+			}
+		}
+		keys = kept
+	}
+	return keys, nil
+}
+
+// Query returns the values that have every one of the terms, reading each
+// value indexed under them and skipping any that are gone or, as with stale
+// entries, no longer have the terms.
+func (ix *Index) Query(ctx context.Context, terms ...string) ([]Result, error) {
+	keys, err := ix.LookupAll(ctx, terms...)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, k := range keys {
+		timestampMicro, value, err := ix.values.Read(ctx, k.KeyA, k.KeyB, nil)
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		has, err := ix.termsOf(value)
+		if err != nil {
+			continue
+		}
+		matched := true
+		for _, term := range terms {
+			if _, ok := has[term]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			results = append(results, Result{KeyA: k.KeyA, KeyB: k.KeyB, TimestampMicro: timestampMicro, Value: value})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func TestIndex(t *testing.T) {
+	vs, _ := api.NewMemReplValueStore(3, nil)
+	gs, _ := api.NewMemReplGroupStore(3, nil)
+	// Values are space separated words, each a term.
+	ix := New(vs, gs, "test", func(value []byte) ([]string, error) {
+		return strings.Fields(string(value)), nil
+	})
+	ctx := context.Background()
+	for i, value := range []string{"red big", "red small", "blue big"} {
+		if _, err := ix.Write(ctx, uint64(i+1), 0, 10, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := func(terms ...string) string {
+		results, err := ix.Query(ctx, terms...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for _, r := range results {
+			values = append(values, string(r.Value))
+		}
+		sort.Strings(values)
+		return strings.Join(values, ",")
+	}
+	if got := query("red"); got != "red big,red small" {
+		t.Fatalf("red gave %q", got)
+	}
+	if got := query("red", "big"); got != "red big" {
+		t.Fatalf("red big gave %q", got)
+	}
+	if _, err := ix.Write(ctx, 1, 0, 20, []byte("green big")); err != nil {
+		t.Fatal(err)
+	}
+	if got := query("red"); got != "red small" {
+		t.Fatalf("red after rewrite gave %q", got)
+	}
+	if keys, err := ix.Lookup(ctx, "red"); err != nil || len(keys) != 1 || keys[0].KeyA != 2 {
+		t.Fatalf("expected the stale entry deleted, got %v %v", keys, err)
+	}
+	if got := query("green"); got != "green big" {
+		t.Fatalf("green gave %q", got)
+	}
+	if _, err := ix.Delete(ctx, 3, 0, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := query("big"); got != "green big" {
+		t.Fatalf("big after delete gave %q", got)
+	}
+	if keys, err := ix.Lookup(ctx, "blue"); err != nil || len(keys) != 0 {
+		t.Fatalf("expected the deleted value's entries deleted, got %v %v", keys, err)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/binary"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// KeyHash returns the keyA, keyB pair to store a value under for an
+// arbitrary byte key, using the 128 bit murmur3 hash so keys spread evenly
+// across the ring. Applications should use this, or a KeyNamespace, rather
+// than each deriving keys their own way. For group stores the same applies
+// to the parent and child keys.
+func KeyHash(key []byte) (uint64, uint64) {
+	return murmur3.Sum128(key)
+}
+
+// KeyHashString is KeyHash for a string key.
+func KeyHashString(key string) (uint64, uint64) {
+	return murmur3.Sum128([]byte(key))
+}
+
+// KeyNamespace derives keys as KeyHash does but with the namespace mixed into
+// the hash, so the same byte key in different namespaces, such as different
+// applications or tenants sharing a store, yields unrelated keys. The zero
+// KeyNamespace is valid and gives the same results as KeyHash.
+type KeyNamespace struct {
+	prefix []byte
+}
+
+// NewKeyNamespace returns a KeyNamespace for the name given.
+func NewKeyNamespace(name string) KeyNamespace {
+	if name == "" {
+		return KeyNamespace{}
+	}
+	// The name's length is included so that, for example, namespace "ab"
+	// with key "c" and namespace "a" with key "bc" do not collide.
+	prefix := make([]byte, binary.MaxVarintLen64+len(name))
+	n := binary.PutUvarint(prefix, uint64(len(name)))
+	return KeyNamespace{prefix: append(prefix[:n], name...)}
+}
+
+// Hash returns the keyA, keyB pair for the key within the namespace.
+func (ns KeyNamespace) Hash(key []byte) (uint64, uint64) {
+	if ns.prefix == nil {
+		return murmur3.Sum128(key)
+	}
+	h := murmur3.New128()
+	h.Write(ns.prefix)
+	h.Write(key)
+	return h.Sum128()
+}
+
+// HashString is Hash for a string key.
+func (ns KeyNamespace) HashString(key string) (uint64, uint64) {
+	return ns.Hash([]byte(key))
+}
@@ -0,0 +1,205 @@
+// Package lease provides leases, locks that expire unless renewed, kept in
+// an oort value store, so jobs coordinating over the store need no separate
+// lock service. Each lease handed out carries a fencing token, larger than
+// any given out before for the same name, for the holder to pass along with
+// its work so that work from a holder whose lease has since been lost can be
+// refused:
+//
+//	m := lease.NewManager(vs, "jobs")
+//	l, err := m.Acquire(ctx, "nightly-report", hostname, time.Minute)
+//	if errors.Is(err, lease.ErrHeld) {
+//	    return // another host has it
+//	}
+//	...
+//	err = m.Renew(ctx, l, time.Minute)
+//	...
+//	err = m.Release(ctx, l)
+//
+// Leases are built on CompareAndWrite and so share its limits: two callers
+// racing to acquire an expired lease in the same microsecond can both
+// succeed, and clocks must be roughly in step, as the expiry is judged by the
+// clock of whoever next tries to acquire the lease.
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gholt/store"
+	"github.com/pandemicsyn/oort/api"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrHeld indicates Acquire found the lease held by another holder; the
+	// error returned is a *HeldError.
+	ErrHeld = errors.New("lease held")
+	// ErrLost indicates Renew or Release found the lease no longer the
+	// caller's, such as after it expired and another holder acquired it.
+	ErrLost = errors.New("lease lost")
+)
+
+// HeldError is returned by Acquire when another holder has the lease.
+type HeldError struct {
+	Holder  string
+	Expires time.Time
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("lease held by %q until %s", e.Holder, e.Expires)
+}
+
+func (e *HeldError) Is(target error) bool {
+	return target == ErrHeld
+}
+
+// Store is what a Manager needs of the value store holding the leases; an
+// *api.ReplValueStore satisfies it.
+type Store interface {
+	Read(ctx context.Context, keyA, keyB uint64, value []byte) (int64, []byte, error)
+	CompareAndWrite(ctx context.Context, keyA, keyB uint64, expectedTimestampMicro, newTimestampMicro int64, value []byte) (int64, error)
+}
+
+// Lease is a holder's claim on a named lease, as returned by Acquire.
+type Lease struct {
+	Name   string
+	Holder string
+	// Token is the fencing token; see the package documentation.
+	Token int64
+	// Expires is when the lease lapses unless renewed.
+	Expires time.Time
+}
+
+// record is the value stored for each lease, as JSON.
+type record struct {
+	Holder       string `json:"holder"`
+	Token        int64  `json:"token"`
+	ExpiresMicro int64  `json:"expires"`
+}
+
+// Manager acquires, renews, and releases leases kept in a Store.
+type Manager struct {
+	store Store
+	keys  api.KeyNamespace
+	now   func() time.Time
+}
+
+// NewManager returns a Manager keeping its leases in the store given, under
+// keys derived from each lease's name and the namespace given, so that
+// managers for different namespaces never share a lease.
+func NewManager(s Store, namespace string) *Manager {
+	return &Manager{store: s, keys: api.NewKeyNamespace("lease:" + namespace), now: time.Now}
+}
+
+func (m *Manager) nowMicro() int64 {
+	return m.now().UnixNano() / int64(time.Microsecond)
+}
+
+// read returns the lease record stored for the name and its timestamp; the
+// record is nil if the lease has never been acquired.
+func (m *Manager) read(ctx context.Context, name string) (*record, int64, error) {
+	keyA, keyB := m.keys.HashString(name)
+	timestampMicro, value, err := m.store.Read(ctx, keyA, keyB, nil)
+	if store.IsNotFound(err) {
+		return nil, timestampMicro, nil
+	}
+	if err != nil {
+		return nil, timestampMicro, err
+	}
+	rec := &record{}
+	if err := json.Unmarshal(value, rec); err != nil {
+		return nil, timestampMicro, fmt.Errorf("lease %q: not a lease record: %s", name, err)
+	}
+	return rec, timestampMicro, nil
+}
+
+// write stores the lease record in place of the one read at timestampMicro,
+// with a timestamp of now or just past timestampMicro, whichever is later. A
+// record without a token is given that timestamp as its token.
+func (m *Manager) write(ctx context.Context, name string, rec *record, timestampMicro int64) error {
+	newTimestampMicro := m.nowMicro()
+	if newTimestampMicro <= timestampMicro {
+		newTimestampMicro = timestampMicro + 1
+	}
+	if rec.Token == 0 {
+		rec.Token = newTimestampMicro
+	}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	keyA, keyB := m.keys.HashString(name)
+	_, err = m.store.CompareAndWrite(ctx, keyA, keyB, timestampMicro, newTimestampMicro, value)
+	return err
+}
+
+// Acquire takes the named lease for the holder for ttl, should it be free or
+// expired, returning an error matching ErrHeld otherwise. A holder may
+// acquire a lease it already holds, such as after restarting, and is then
+// given a new fencing token. Should another caller acquire the lease at the
+// same time, one of them gets an error, an *api.ConflictError, and may retry.
+func (m *Manager) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	rec, timestampMicro, err := m.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	nowMicro := m.nowMicro()
+	if rec != nil && rec.Holder != holder && rec.ExpiresMicro > nowMicro {
+		return nil, &HeldError{Holder: rec.Holder, Expires: time.Unix(0, rec.ExpiresMicro*int64(time.Microsecond))}
+	}
+	// The token is left for write to set to the timestamp written with,
+	// which is newer than that of any earlier record and so larger than any
+	// token given out before.
+	rec = &record{Holder: holder, ExpiresMicro: nowMicro + int64(ttl/time.Microsecond)}
+	if err := m.write(ctx, name, rec, timestampMicro); err != nil {
+		return nil, err
+	}
+	return &Lease{Name: name, Holder: holder, Token: rec.Token, Expires: time.Unix(0, rec.ExpiresMicro*int64(time.Microsecond))}, nil
+}
+
+// Renew extends the lease to ttl from now, returning ErrLost if it is no
+// longer the caller's. A lease that has expired but not been acquired by
+// another holder can still be renewed.
+func (m *Manager) Renew(ctx context.Context, l *Lease, ttl time.Duration) error {
+	rec, timestampMicro, err := m.read(ctx, l.Name)
+	if err != nil {
+		return err
+	}
+	if rec == nil || rec.Token != l.Token {
+		return ErrLost
+	}
+	rec.ExpiresMicro = m.nowMicro() + int64(ttl/time.Microsecond)
+	if err := m.write(ctx, l.Name, rec, timestampMicro); err != nil {
+		if _, ok := err.(*api.ConflictError); ok {
+			return ErrLost
+		}
+		return err
+	}
+	l.Expires = time.Unix(0, rec.ExpiresMicro*int64(time.Microsecond))
+	return nil
+}
+
+// Release gives up the lease so another holder can acquire it without
+// waiting for it to expire, returning ErrLost if it is no longer the
+// caller's. The lease's record is kept, expired, so fencing tokens given out
+// later are still larger.
+func (m *Manager) Release(ctx context.Context, l *Lease) error {
+	rec, timestampMicro, err := m.read(ctx, l.Name)
+	if err != nil {
+		return err
+	}
+	if rec == nil || rec.Token != l.Token {
+		return ErrLost
+	}
+	rec.ExpiresMicro = 0
+	if err := m.write(ctx, l.Name, rec, timestampMicro); err != nil {
+		if _, ok := err.(*api.ConflictError); ok {
+			return ErrLost
+		}
+		return err
+	}
+	l.Expires = time.Time{}
+	return nil
+}
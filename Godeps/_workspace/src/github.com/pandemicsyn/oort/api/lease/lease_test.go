@@ -0,0 +1,61 @@
+package lease
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func TestLease(t *testing.T) {
+	vs, _ := api.NewMemReplValueStore(3, nil)
+	m := NewManager(vs, "test")
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+	a, err := m.Acquire(ctx, "job", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Acquire(ctx, "job", "b", time.Minute); !errors.Is(err, ErrHeld) {
+		t.Fatalf("expected the lease held, got %v", err)
+	}
+	if _, err := m.Acquire(ctx, "other", "b", time.Minute); err != nil {
+		t.Fatalf("expected another lease free, got %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if err := m.Renew(ctx, a, time.Minute); err != nil || !a.Expires.Equal(now.Add(time.Minute)) {
+		t.Fatalf("renew gave %s %v", a.Expires, err)
+	}
+	now = now.Add(45 * time.Second)
+	if _, err := m.Acquire(ctx, "job", "b", time.Minute); !errors.Is(err, ErrHeld) {
+		t.Fatalf("expected the renewed lease still held, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	b, err := m.Acquire(ctx, "job", "b", time.Minute)
+	if err != nil {
+		t.Fatalf("expected the expired lease acquired, got %v", err)
+	}
+	if b.Token <= a.Token {
+		t.Fatalf("expected token %d > %d", b.Token, a.Token)
+	}
+	if err := m.Renew(ctx, a, time.Minute); err != ErrLost {
+		t.Fatalf("expected the lost lease not renewed, got %v", err)
+	}
+	if err := m.Release(ctx, a); err != ErrLost {
+		t.Fatalf("expected the lost lease not released, got %v", err)
+	}
+	if err := m.Release(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	c, err := m.Acquire(ctx, "job", "c", time.Minute)
+	if err != nil {
+		t.Fatalf("expected the released lease acquired, got %v", err)
+	}
+	if c.Token <= b.Token {
+		t.Fatalf("expected token %d > %d", c.Token, b.Token)
+	}
+}
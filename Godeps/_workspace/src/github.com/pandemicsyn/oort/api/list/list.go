@@ -0,0 +1,201 @@
+// Package list provides ordered lists, usable as lightweight work queues,
+// kept in an oort group store. Each list is a group whose members are the
+// list's elements, ordered by the timestamp each was pushed with:
+//
+//	q := list.New(gs, "thumbnail-jobs")
+//	err := q.PushBack(ctx, job)
+//	...
+//	job, err := q.PopFront(ctx)
+//	if err == list.ErrEmpty {
+//	    // nothing to do
+//	}
+//
+// PopFront claims an element before removing it, so callers popping at once
+// get different elements; should two race for the same element, the newer
+// claim wins. The group store offers no stronger guarantee than its
+// timestamps, though, so on rare occasions, such as a claim read back before
+// the other has reached every replica, an element may be returned to two
+// callers; work taken from a list should be safe to repeat. An element whose
+// popper fails to remove it is returned again once its claim times out.
+//
+// The order of elements pushed by different clients is only as good as the
+// agreement of their clocks.
+package list
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/gholt/store"
+	"github.com/pandemicsyn/oort/api"
+	"golang.org/x/net/context"
+)
+
+// ErrEmpty is returned by PopFront when the list has no elements to pop.
+var ErrEmpty = errors.New("list empty")
+
+const (
+	// Each element's value begins with its state.
+	stateQueued  = 0
+	stateClaimed = 1
+	// claimTimeout is how long a claimed element stays hidden from
+	// PopFront and Range before it is treated as queued again, in case its
+	// popper failed to remove it.
+	claimTimeout = time.Minute
+	// popAttempts is how many times PopFront reads the list when every
+	// element it tried was claimed by another caller first, backing off
+	// between reads.
+	popAttempts   = 5
+	popBackoff    = 5 * time.Millisecond
+	popBackoffMax = 200 * time.Millisecond
+)
+
+// Store is what a List needs of the group store holding it; an
+// *api.ReplGroupStore satisfies it.
+type Store interface {
+	Read(ctx context.Context, keyA, keyB, childKeyA, childKeyB uint64, value []byte) (int64, []byte, error)
+	Write(ctx context.Context, keyA, keyB, childKeyA, childKeyB uint64, timestampMicro int64, value []byte) (int64, error)
+	Delete(ctx context.Context, keyA, keyB, childKeyA, childKeyB uint64, timestampMicro int64) (int64, error)
+	CompareAndWrite(ctx context.Context, keyA, keyB, childKeyA, childKeyB uint64, expectedTimestampMicro, newTimestampMicro int64, value []byte) (int64, error)
+	ReadGroup(ctx context.Context, keyA, keyB uint64) ([]store.ReadGroupItem, error)
+}
+
+// List is an ordered list kept in a Store.
+type List struct {
+	store Store
+	keyA  uint64
+	keyB  uint64
+	now   func() time.Time
+}
+
+// New returns the List with the name given, kept in the group store given.
+func New(s Store, name string) *List {
+	keyA, keyB := api.NewKeyNamespace("list").HashString(name)
+	return &List{store: s, keyA: keyA, keyB: keyB, now: time.Now}
+}
+
+func (l *List) nowMicro() int64 {
+	return l.now().UnixNano() / int64(time.Microsecond)
+}
+
+// elements returns the list's members in order, leaving out those claimed by
+// a PopFront within claimTimeout.
+func (l *List) elements(ctx context.Context) ([]store.ReadGroupItem, error) {
+	items, err := l.store.ReadGroup(ctx, l.keyA, l.keyB)
+	if err != nil {
+		return nil, err
+	}
+	claimedAfter := l.nowMicro() - int64(claimTimeout/time.Microsecond)
+	elements := items[:0]
+	for _, item := range items {
+		if len(item.Value) == 0 || (item.Value[0] == stateClaimed && item.TimestampMicro > claimedAfter) {
+			continue
+		}
+		elements = append(elements, item)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].ChildKeyA != elements[j].ChildKeyA {
+			return elements[i].ChildKeyA < elements[j].ChildKeyA
+		}
+		return elements[i].ChildKeyB < elements[j].ChildKeyB
+	})
+	return elements, nil
+}
+
+// PushBack adds the value to the end of the list.
+func (l *List) PushBack(ctx context.Context, value []byte) error {
+	timestampMicro := l.nowMicro()
+	// The element's child key orders it by when it was pushed, with a random
+	// second half so elements pushed at once do not collide.
+	_, err := l.store.Write(ctx, l.keyA, l.keyB, uint64(timestampMicro), uint64(rand.Int63()), timestampMicro, append([]byte{stateQueued}, value...))
+	return err
+}
+
+// PopFront removes and returns the value at the front of the list, returning
+// ErrEmpty if there is none, or if every element it tries is claimed by
+// other callers first, after a few attempts backing off in between. Should the element be claimed but not then
+// removed, the value is returned along with the error; the element will be
+// returned again once its claim times out.
+func (l *List) PopFront(ctx context.Context) ([]byte, error) {
+	backoff := popBackoff
+	for attempt := 1; ; attempt++ {
+		elements, err := l.elements(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(elements) == 0 {
+			return nil, ErrEmpty
+		}
+		for _, element := range elements {
+			value, won, err := l.claim(ctx, &element)
+			if err != nil || won {
+				return value, err
+			}
+		}
+		if attempt == popAttempts {
+			return nil, ErrEmpty
+		}
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff)))):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > popBackoffMax {
+			backoff = popBackoffMax
+		}
+	}
+}
+
+// claim tries to take the element for this caller, returning its value and
+// true if it did, or false if another caller claimed it first. The claim is
+// a conditional write of the element marked claimed, read back to find which
+// of any racing claims, the newest, won; the element is then deleted with
+// the claim's timestamp, which deletions win ties with.
+func (l *List) claim(ctx context.Context, element *store.ReadGroupItem) ([]byte, bool, error) {
+	claimTimestampMicro := l.nowMicro()
+	if claimTimestampMicro <= element.TimestampMicro {
+		claimTimestampMicro = element.TimestampMicro + 1
+	}
+	claimed := append([]byte{stateClaimed}, element.Value[1:]...)
+	if _, err := l.store.CompareAndWrite(ctx, l.keyA, l.keyB, element.ChildKeyA, element.ChildKeyB, element.TimestampMicro, claimTimestampMicro, claimed); err != nil {
+		if _, ok := err.(*api.ConflictError); ok {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	timestampMicro, _, err := l.store.Read(ctx, l.keyA, l.keyB, element.ChildKeyA, element.ChildKeyB, nil)
+	if err != nil && !store.IsNotFound(err) {
+		return nil, false, err
+	}
+	if timestampMicro != claimTimestampMicro {
+		return nil, false, nil
+	}
+	if _, err := l.store.Delete(ctx, l.keyA, l.keyB, element.ChildKeyA, element.ChildKeyB, claimTimestampMicro); err != nil {
+		return claimed[1:], true, err
+	}
+	return claimed[1:], true, nil
+}
+
+// Range returns up to n values from the list, starting with the one at index
+// start, 0 being the front, leaving them in the list. Values claimed by a
+// PopFront in progress are left out.
+func (l *List) Range(ctx context.Context, start, n int) ([][]byte, error) {
+	elements, err := l.elements(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if start >= len(elements) {
+		return nil, nil
+	}
+	elements = elements[start:]
+	if n < len(elements) {
+		elements = elements[:n]
+	}
+	values := make([][]byte, len(elements))
+	for i, element := range elements {
+		values[i] = element.Value[1:]
+	}
+	return values, nil
+}
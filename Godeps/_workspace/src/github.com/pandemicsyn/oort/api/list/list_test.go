@@ -0,0 +1,84 @@
+package list
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func TestList(t *testing.T) {
+	gs, _ := api.NewMemReplGroupStore(3, nil)
+	l := New(gs, "test")
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	ctx := context.Background()
+	if _, err := l.PopFront(ctx); err != ErrEmpty {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		if err := l.PushBack(ctx, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if values, err := l.Range(ctx, 1, 5); err != nil || fmt.Sprintf("%s", values) != "[b c]" {
+		t.Fatalf("range gave %s %v", values, err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		if v, err := l.PopFront(ctx); err != nil || string(v) != want {
+			t.Fatalf("pop gave %q %v, expected %q", v, err, want)
+		}
+	}
+	if _, err := l.PopFront(ctx); err != ErrEmpty {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestListConcurrentPop(t *testing.T) {
+	gs, _ := api.NewMemReplGroupStore(3, nil)
+	l := New(gs, "test")
+	ctx := context.Background()
+	const n = 50
+	for i := 0; i < n; i++ {
+		if err := l.PushBack(ctx, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lock sync.Mutex
+	popped := make(map[string]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, err := l.PopFront(ctx)
+				if err == ErrEmpty {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				lock.Lock()
+				popped[string(v)] = true
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// Every element is popped; the odd one may be popped twice.
+	if len(popped) != n {
+		t.Fatalf("expected %d elements popped, got %d", n, len(popped))
+	}
+	if values, err := l.Range(ctx, 0, n); err != nil || len(values) != 0 {
+		t.Fatalf("expected an empty list, got %d values %v", len(values), err)
+	}
+}
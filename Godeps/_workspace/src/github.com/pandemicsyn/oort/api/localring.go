@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gholt/ring"
+)
+
+// localRing returns a ring of n nodes, each a replica of every partition,
+// and the address of each node at addressIndex. It is for routing a Repl
+// store to stores in the same process, such as MemValueStores.
+func localRing(n, addressIndex int) (ring.Ring, []string) {
+	b := ring.NewBuilder(64)
+	b.SetReplicaCount(n)
+	addrs := make([]string, n)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("local%d", i)
+		nodeAddrs := make([]string, addressIndex+1)
+		for j := range nodeAddrs {
+			nodeAddrs[j] = addrs[i]
+		}
+		// Only running out of node IDs fails, which 64 bits will not.
+		if _, err := b.AddNode(true, 1, nil, nodeAddrs, "", nil); err != nil {
+			panic(err)
+		}
+	}
+	return b.Ring(), addrs
+}
@@ -0,0 +1,73 @@
+package api
+
+import "github.com/gholt/ring"
+
+// PartitionMove describes a partition whose responsible nodes differ between
+// two rings.
+type PartitionMove struct {
+	// Partition is at the finer of the two rings' partition bit counts.
+	Partition uint32
+	// From and To are the addresses of the nodes responsible in the old and
+	// new rings.
+	From []string
+	To   []string
+}
+
+// MovedPartitions returns the partitions whose responsible nodes, by their
+// address at addressIndex, differ between the old and new rings.
+func MovedPartitions(oldRing, newRing ring.Ring, addressIndex int) []PartitionMove {
+	bits := oldRing.PartitionBitCount()
+	if newRing.PartitionBitCount() > bits {
+		bits = newRing.PartitionBitCount()
+	}
+	oldShift := bits - oldRing.PartitionBitCount()
+	newShift := bits - newRing.PartitionBitCount()
+	var moves []PartitionMove
+	for p := uint64(0); p < 1<<bits; p++ {
+		from := nodeAddrs(oldRing.ResponsibleNodes(uint32(p>>oldShift)), addressIndex)
+		to := nodeAddrs(newRing.ResponsibleNodes(uint32(p>>newShift)), addressIndex)
+		if len(addrsMissing(from, to)) > 0 || len(from) != len(to) {
+			moves = append(moves, PartitionMove{Partition: uint32(p), From: from, To: to})
+		}
+	}
+	return moves
+}
+
+func nodeAddrs(ns []ring.Node, addressIndex int) []string {
+	as := make([]string, len(ns))
+	for i, n := range ns {
+		as[i] = n.Address(addressIndex)
+	}
+	return as
+}
+
+// addrsMissing returns the addresses in to that are not in from.
+func addrsMissing(from, to []string) []string {
+	var missing []string
+	for _, t := range to {
+		found := false
+		for _, f := range from {
+			if f == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// MigrateProgress reports how far a Migrate has gotten.
+type MigrateProgress struct {
+	// Scanned is how many keys have been considered.
+	Scanned uint64
+	// Moved is how many of those keys have new responsible nodes.
+	Moved uint64
+	// Copied is how many of those were copied to all their new nodes.
+	Copied uint64
+	// Failed is how many could not be read from the old nodes or written to
+	// all the new nodes.
+	Failed uint64
+}
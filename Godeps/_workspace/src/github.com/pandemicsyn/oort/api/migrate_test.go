@@ -0,0 +1,102 @@
+package api
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gholt/ring"
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// migrateTestRing returns a ring holding every partition on each of the
+// nodes at the addresses given.
+func migrateTestRing(t *testing.T, addrs ...string) ring.Ring {
+	b := ring.NewBuilder(64)
+	b.SetReplicaCount(len(addrs))
+	for _, addr := range addrs {
+		if _, err := b.AddNode(true, 1, nil, []string{addr}, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Ring()
+}
+
+func TestMovedPartitions(t *testing.T) {
+	oldRing := migrateTestRing(t, "local0", "local1")
+	if moves := MovedPartitions(oldRing, oldRing, 0); len(moves) != 0 {
+		t.Fatalf("expected no moves between the same ring, got %v", moves)
+	}
+	newRing := migrateTestRing(t, "local1", "local2")
+	moves := MovedPartitions(oldRing, newRing, 0)
+	if len(moves) != 1<<newRing.PartitionBitCount() {
+		t.Fatalf("expected every partition moved, got %d", len(moves))
+	}
+	if to := addrsMissing(moves[0].From, moves[0].To); len(to) != 1 || to[0] != "local2" {
+		t.Fatalf("expected a move to local2, got %+v", moves[0])
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ms := []*MemValueStore{{}, {}, {}}
+	rs := newLocalReplValueStore([]store.ValueStore{ms[0], ms[1], ms[2]}, nil)
+	ctx := context.Background()
+	// The old nodes disagree; the newest version of each key is copied.
+	ms[0].Write(ctx, 1, 2, 5, []byte("a"))
+	ms[1].Write(ctx, 1, 2, 6, []byte("b"))
+	ms[0].Delete(ctx, 3, 4, 7)
+	ms[1].Write(ctx, 3, 4, 6, []byte("old"))
+	keys := make(chan ValueKeyPair, 3)
+	keys <- ValueKeyPair{1, 2}
+	keys <- ValueKeyPair{3, 4}
+	keys <- ValueKeyPair{5, 6}
+	close(keys)
+	var lock sync.Mutex
+	var reported []MigrateProgress
+	progress, err := rs.Migrate(ctx, &ReplValueMigrateConfig{
+		OldRing:  migrateTestRing(t, "local0", "local1"),
+		NewRing:  migrateTestRing(t, "local1", "local2"),
+		Keys:     keys,
+		Progress: func(p MigrateProgress) {
+			lock.Lock()
+			reported = append(reported, p)
+			lock.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != (MigrateProgress{Scanned: 3, Moved: 3, Copied: 3}) {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+	if len(reported) == 0 || reported[len(reported)-1] != progress {
+		t.Fatalf("expected the final progress reported, got %+v", reported)
+	}
+	if ts, v, err := ms[2].Read(ctx, 1, 2, nil); err != nil || ts != 6 || string(v) != "b" {
+		t.Fatalf("expected b at 6 copied, got %q at %d %v", v, ts, err)
+	}
+	if ts, _, err := ms[2].Lookup(ctx, 3, 4); !store.IsNotFound(err) || ts != 7 {
+		t.Fatalf("expected the deletion at 7 copied, got %d %v", ts, err)
+	}
+	if _, _, err := ms[2].Lookup(ctx, 5, 6); !store.IsNotFound(err) {
+		t.Fatalf("expected nothing copied for a missing key, got %v", err)
+	}
+	// The old nodes are left as they were.
+	if ts, v, err := ms[0].Read(ctx, 1, 2, nil); err != nil || ts != 5 || string(v) != "a" {
+		t.Fatalf("expected a at 5 left in place, got %q at %d %v", v, ts, err)
+	}
+}
+
+func TestMigrateUnmoved(t *testing.T) {
+	ms := []*MemValueStore{{}, {}}
+	rs := newLocalReplValueStore([]store.ValueStore{ms[0], ms[1]}, nil)
+	ctx := context.Background()
+	r := migrateTestRing(t, "local0", "local1")
+	keys := make(chan ValueKeyPair, 1)
+	keys <- ValueKeyPair{1, 2}
+	close(keys)
+	progress, err := rs.Migrate(ctx, &ReplValueMigrateConfig{OldRing: r, NewRing: r, Keys: keys})
+	if err != nil || progress != (MigrateProgress{Scanned: 1}) {
+		t.Fatalf("expected the key scanned but not moved, got %+v %v", progress, err)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ObjectInfo describes an object in an ObjectStore.
+type ObjectInfo struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	// MD5 is the hex MD5 digest of the object's data.
+	MD5            string            `json:"md5"`
+	Meta           map[string]string `json:"meta,omitempty"`
+	TimestampMicro int64             `json:"-"`
+}
+
+// ObjectStore stores objects by string key within a bucket of a
+// ReplGroupStore, so applications need not derive keys or deal with groups
+// and chunking themselves. Each object's data is written with WriteStream,
+// so it may be any size and the ReplGroupStore must frame values, see the
+// FramedValues config option, and its ObjectInfo is kept as a member of the
+// bucket's index group for Head and List.
+//
+// Put writes the data before the index entry, both with the same timestamp,
+// so listed objects are always readable; a Get that finds the two differ,
+// from a Put in progress or one that failed part way, returns a
+// *ConflictError.
+type ObjectStore struct {
+	groups *ReplGroupStore
+	ns     KeyNamespace
+	indexA uint64
+	indexB uint64
+	dataA  uint64
+	dataB  uint64
+}
+
+// NewObjectStore returns an ObjectStore for the bucket given, stored in gs.
+// Different buckets have unrelated keys, so the same object key may be used
+// in each.
+func NewObjectStore(gs *ReplGroupStore, bucket string) *ObjectStore {
+	o := &ObjectStore{groups: gs, ns: NewKeyNamespace(bucket)}
+	o.indexA, o.indexB = NewKeyNamespace("oort.objects.index").HashString(bucket)
+	o.dataA, o.dataB = NewKeyNamespace("oort.objects.data").HashString(bucket)
+	return o
+}
+
+// countingReader counts and hashes the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+	h hash.Hash
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.h.Write(p[:n])
+	return n, err
+}
+
+// Put stores everything read from r as the object for the key, with the
+// metadata given, replacing any object already there. Chunks left over from
+// a larger object replaced are not removed; Delete first if that matters.
+func (o *ObjectStore) Put(ctx context.Context, key string, r io.Reader, meta map[string]string) (*ObjectInfo, error) {
+	childKeyA, childKeyB := o.ns.HashString(key)
+	timestampMicro := time.Now().UnixNano() / 1000
+	cr := &countingReader{r: r, h: md5.New()}
+	if _, err := o.groups.WriteStream(ctx, o.dataA, o.dataB, childKeyA, childKeyB, timestampMicro, cr); err != nil {
+		return nil, err
+	}
+	info := &ObjectInfo{Key: key, Size: cr.n, MD5: hex.EncodeToString(cr.h.Sum(nil)), Meta: meta, TimestampMicro: timestampMicro}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := o.groups.Write(ctx, o.indexA, o.indexB, childKeyA, childKeyB, timestampMicro, b); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Head returns the ObjectInfo for the key, or ErrNotFound.
+func (o *ObjectStore) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	childKeyA, childKeyB := o.ns.HashString(key)
+	timestampMicro, b, err := o.groups.Read(ctx, o.indexA, o.indexB, childKeyA, childKeyB, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeObjectInfo(timestampMicro, b)
+}
+
+func decodeObjectInfo(timestampMicro int64, b []byte) (*ObjectInfo, error) {
+	info := &ObjectInfo{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, err
+	}
+	info.TimestampMicro = timestampMicro
+	return info, nil
+}
+
+// Get writes the object for the key to w and returns its ObjectInfo, or
+// ErrNotFound.
+func (o *ObjectStore) Get(ctx context.Context, key string, w io.Writer) (*ObjectInfo, error) {
+	info, err := o.Head(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	childKeyA, childKeyB := o.ns.HashString(key)
+	timestampMicro, err := o.groups.ReadStream(ctx, o.dataA, o.dataB, childKeyA, childKeyB, w)
+	if err == nil && timestampMicro != info.TimestampMicro {
+		err = &ConflictError{ExpectedTimestampMicro: info.TimestampMicro, TimestampMicro: timestampMicro}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Delete removes the object for the key, returning the old timestamp of its
+// index entry.
+func (o *ObjectStore) Delete(ctx context.Context, key string) (int64, error) {
+	childKeyA, childKeyB := o.ns.HashString(key)
+	timestampMicro := time.Now().UnixNano() / 1000
+	oldTimestampMicro, err := o.groups.Delete(ctx, o.indexA, o.indexB, childKeyA, childKeyB, timestampMicro)
+	if err != nil {
+		return oldTimestampMicro, err
+	}
+	if _, err := o.groups.DeleteStream(ctx, o.dataA, o.dataB, childKeyA, childKeyB, timestampMicro); err != nil {
+		return oldTimestampMicro, err
+	}
+	return oldTimestampMicro, nil
+}
+
+// List calls fn for each object whose key has the prefix given until fn
+// returns false. Objects are visited in hashed key order rather than by key.
+// As with IterateFrom, the cursor passed to fn can be given to a later List
+// to resume just after that object; an empty cursor starts from the
+// beginning.
+func (o *ObjectStore) List(ctx context.Context, prefix, cursor string, fn func(info *ObjectInfo, cursor string) bool) error {
+	var err error
+	ierr := o.groups.IterateFrom(ctx, o.indexA, o.indexB, cursor, func(item store.ReadGroupItem, cursor string) bool {
+		var info *ObjectInfo
+		if info, err = decodeObjectInfo(item.TimestampMicro, item.Value); err != nil {
+			return false
+		}
+		if !strings.HasPrefix(info.Key, prefix) {
+			return true
+		}
+		return fn(info, cursor)
+	})
+	if ierr != nil {
+		return ierr
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestObjectStore(t *testing.T) {
+	gs, _ := NewMemReplGroupStore(3, &ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{StreamChunkSize: 4, FramedValues: true}})
+	o := NewObjectStore(gs, "bucket")
+	ctx := context.Background()
+	if _, err := o.Put(ctx, "a/1", bytes.NewBufferString("hello world"), map[string]string{"type": "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Put(ctx, "b/1", bytes.NewBufferString("other"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	info, err := o.Get(ctx, "a/1", &buf)
+	if err != nil || buf.String() != "hello world" || info.Size != 11 || info.Meta["type"] != "text" {
+		t.Fatalf("unexpected get: %q %#v %v", buf.String(), info, err)
+	}
+	var listed []string
+	if err := o.List(ctx, "a/", "", func(info *ObjectInfo, cursor string) bool {
+		listed = append(listed, info.Key)
+		return true
+	}); err != nil || len(listed) != 1 || listed[0] != "a/1" {
+		t.Fatalf("unexpected list: %v %v", listed, err)
+	}
+	if _, err := o.Delete(ctx, "a/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Head(ctx, "a/1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Delete; got %v", err)
+	}
+	if _, err := o.Head(ctx, "b/1"); err != nil {
+		t.Fatal(err)
+	}
+}
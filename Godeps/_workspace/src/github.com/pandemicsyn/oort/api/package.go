@@ -1,7 +1,5 @@
 package api
 
-import "errors"
-
 // got is at https://github.com/gholt/got
 //go:generate got config.got valueconfig_GEN_.go TT=VALUE T=Value t=value
 //go:generate got config.got groupconfig_GEN_.go TT=GROUP T=Group t=group
@@ -9,6 +7,70 @@ import "errors"
 //go:generate got store.got groupstore_GEN_.go TT=GROUP T=Group t=group R,Lookup,Read,Write,Delete,LookupGroup,ReadGroup
 //go:generate got replstore.got valuereplstore_GEN_.go TT=VALUE T=Value t=value
 //go:generate got replstore.got groupreplstore_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replbatch.got valuereplbatch_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replbatch.got groupreplbatch_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replmetrics.got valuereplmetrics_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replmetrics.got groupreplmetrics_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replhandoff.got valuereplhandoff_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replhandoff.got groupreplhandoff_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replstream.got valuereplstream_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replstream.got groupreplstream_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replhealth.got valuereplhealth_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replhealth.got groupreplhealth_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replringsource.got valuereplringsource_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replringsource.got groupreplringsource_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replcache.got valuereplcache_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replcache.got groupreplcache_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replconditional.got valuereplconditional_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replconditional.got groupreplconditional_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replstats.got valuereplstats_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replstats.got groupreplstats_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replrepair.got valuereplrepair_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replrepair.got groupreplrepair_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replmaint.got valuereplmaint_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replmaint.got groupreplmaint_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replttl.got valuereplttl_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replttl.got groupreplttl_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replgroupiter.got groupreplgroupiter_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replgroupmerge.got groupreplgroupmerge_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replshadow.got valuereplshadow_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replshadow.got groupreplshadow_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replmigrate.got valuereplmigrate_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replmigrate.got groupreplmigrate_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replexport.got valuereplexport_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replexport.got groupreplexport_GEN_.go TT=GROUP T=Group t=group
+//go:generate got storepool.got valuestorepool_GEN_.go TT=VALUE T=Value t=value
+//go:generate got storepool.got groupstorepool_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replcoalesce.got valuereplcoalesce_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replcoalesce.got groupreplcoalesce_GEN_.go TT=GROUP T=Group t=group
+//go:generate got memstore.got valuememstore_GEN_.go TT=VALUE T=Value t=value
+//go:generate got memstore.got groupmemstore_GEN_.go TT=GROUP T=Group t=group
+//go:generate got faultstore.got valuefaultstore_GEN_.go TT=VALUE T=Value t=value
+//go:generate got faultstore.got groupfaultstore_GEN_.go TT=GROUP T=Group t=group
+//go:generate got scriptedstore.got valuescriptedstore_GEN_.go TT=VALUE T=Value t=value
+//go:generate got scriptedstore.got groupscriptedstore_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replserver.got valuereplserver_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replserver.got groupreplserver_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replverify.got valuereplverify_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replverify.got groupreplverify_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replkeys.got valuereplkeys_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replkeys.got groupreplkeys_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replwatch.got valuereplwatch_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replwatch.got groupreplwatch_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replpurge.got valuereplpurge_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replpurge.got groupreplpurge_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replnamespace.got valuereplnamespace_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replnamespace.got groupreplnamespace_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replmiddleware.got valuereplmiddleware_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replmiddleware.got groupreplmiddleware_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replsplit.got valuereplsplit_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replsplit.got groupreplsplit_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replwriteall.got valuereplwriteall_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replwriteall.got groupreplwriteall_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replmove.got valuereplmove_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replmove.got groupreplmove_GEN_.go TT=GROUP T=Group t=group
+//go:generate got replcounter.got valuereplcounter_GEN_.go TT=VALUE T=Value t=value
+//go:generate got replcounter.got groupreplcounter_GEN_.go TT=GROUP T=Group t=group
 //go:generate got replstore_test.got valuereplstore_GEN_test.go TT=VALUE T=Value t=value
 //go:generate got replstore_test.got groupreplstore_GEN_test.go TT=GROUP T=Group t=group
 //go:generate got errorstore.got valueerrorstore_GEN_.go TT=VALUE T=Value t=value
@@ -21,5 +83,3 @@ func (*s) String() string {
 }
 
 var noStats = &s{}
-
-var noRingErr = errors.New("no ring")
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestReadPartial(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadPartialMargin: 200 * time.Millisecond}})
+	// The slow replicas have the newer value but would miss the deadline.
+	sss[0].SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	for _, ss := range sss[1:] {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 6, Value: []byte("b"), Delay: time.Second})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ts, v, err := rs.Read(ctx, 1, 2, []byte("x"))
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("expected the read back before the deadline, took %s", elapsed)
+	}
+	if ts != 5 || string(v) != "xa" {
+		t.Fatalf("expected xa at 5, got %q at %d", v, ts)
+	}
+	var perr *ReplValueStoreErrorPartialRead
+	if !errors.Is(err, ErrPartialRead) || !errors.As(err, &perr) || perr.ResponseCount != 1 || perr.ReplicaCount != 3 {
+		t.Fatalf("expected a partial read of 1 of 3, got %v", err)
+	}
+}
+
+func TestReadPartialNoValue(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadPartialMargin: 250 * time.Millisecond}})
+	// With no value by the margin, the read waits on as usual.
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a"), Delay: 100 * time.Millisecond})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 5 || string(v) != "a" {
+		t.Fatalf("expected a at 5, got %q at %d %v", v, ts, err)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import "github.com/gholt/ring"
+
+// PartitionMap is the placement of every partition of a ring, as given by
+// PartitionMap, for dashboards to show where data lives and spot nodes with
+// more or less than their share. It marshals to JSON as is.
+type PartitionMap struct {
+	RingVersion       int64  `json:"ringVersion"`
+	PartitionBitCount uint16 `json:"partitionBitCount"`
+	ReplicaCount      int    `json:"replicaCount"`
+	// Nodes lists each backend store any partition is placed on.
+	Nodes []PartitionMapNode `json:"nodes"`
+	// Partitions gives, for each partition in order, the indexes into Nodes
+	// of its replicas, in the order the ReplicaSelector gives.
+	Partitions [][]int `json:"partitions"`
+}
+
+// PartitionMapNode is a backend store in a PartitionMap.
+type PartitionMapNode struct {
+	Addr string `json:"addr"`
+	// NodeID is the ID of the ring node at Addr, or 0 if the
+	// ReplicaSelector chose an address not in the ring.
+	NodeID   uint64 `json:"nodeID"`
+	Capacity uint32 `json:"capacity"`
+	// Partitions is how many partitions the node holds a replica of, and
+	// Primaries how many of those it is first for.
+	Partitions int `json:"partitions"`
+	Primaries  int `json:"primaries"`
+}
+
+// newPartitionMap returns the PartitionMap for the ring, selecting each
+// partition's replicas with the selector.
+func newPartitionMap(r ring.Ring, selector ReplicaSelector, addressIndex int) *PartitionMap {
+	bits := r.PartitionBitCount()
+	m := &PartitionMap{
+		RingVersion:       r.Version(),
+		PartitionBitCount: bits,
+		ReplicaCount:      r.ReplicaCount(),
+		Partitions:        make([][]int, 1<<bits),
+	}
+	indexes := make(map[string]int)
+	for _, n := range r.Nodes() {
+		addr := n.Address(addressIndex)
+		indexes[addr] = len(m.Nodes)
+		m.Nodes = append(m.Nodes, PartitionMapNode{Addr: addr, NodeID: n.ID(), Capacity: n.Capacity()})
+	}
+	for p := range m.Partitions {
+		addrs := selector.Select(r, uint64(p)<<(64-bits))
+		m.Partitions[p] = make([]int, len(addrs))
+		for i, addr := range addrs {
+			index, ok := indexes[addr]
+			if !ok {
+				index = len(m.Nodes)
+				indexes[addr] = index
+				m.Nodes = append(m.Nodes, PartitionMapNode{Addr: addr})
+			}
+			m.Partitions[p][i] = index
+			m.Nodes[index].Partitions++
+			if i == 0 {
+				m.Nodes[index].Primaries++
+			}
+		}
+	}
+	return m
+}
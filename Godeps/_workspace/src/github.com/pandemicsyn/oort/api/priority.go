@@ -0,0 +1,44 @@
+package api
+
+import "golang.org/x/net/context"
+
+// Priority is the lane a request waits in for a backend store's request
+// tickets; see WithPriority.
+type Priority int
+
+const (
+	// PriorityNormal is the default for requests and is also what
+	// background work, such as repairs and hint replays, uses.
+	PriorityNormal Priority = iota
+	// PriorityHigh requests draw from a separate set of tickets,
+	// HighPriorityRequestsPerStore in size, so they do not queue behind
+	// bulk normal priority traffic.
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "PriorityNormal"
+	case PriorityHigh:
+		return "PriorityHigh"
+	}
+	return "Priority?"
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of the ctx that will cause requests made with
+// it to use the Priority given.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the Priority set on the ctx with WithPriority, or
+// PriorityNormal if none was set.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
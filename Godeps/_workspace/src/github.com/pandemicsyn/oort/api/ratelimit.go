@@ -0,0 +1,57 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// tokenBucket limits a rate of operations or bytes, allowing bursts of up to
+// one second's worth. A nil *tokenBucket never limits.
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int) *tokenBucket {
+	if rate < 1 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// take removes n tokens, waiting until the bucket has refilled enough to cover
+// them or the ctx is done. Taking more than the bucket can hold is allowed;
+// the wait, and that of whoever takes next, is just longer.
+func (b *tokenBucket) take(ctx context.Context, n int) error {
+	if b == nil || n < 1 {
+		return nil
+	}
+	b.lock.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.lock.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	var none *tokenBucket
+	if err := none.take(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	b := newTokenBucket(100)
+	start := time.Now()
+	// A second's worth is available at once.
+	if err := b.take(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("expected the burst allowed at once, took %s", elapsed)
+	}
+	// Beyond that, takes wait for the bucket to refill.
+	if err := b.take(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected to wait about 100ms, took %s", elapsed)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := b.take(ctx, 100); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline exceeded, got %v", err)
+	}
+}
+
+func TestWriteOpsLimit(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{WriteOpsPerSecond: 50}})
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		if _, err := rs.Write(ctx, uint64(i), 2, 5, []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected 10 writes past the burst to wait about 200ms, took %s", elapsed)
+	}
+	// Reads are limited separately.
+	start = time.Now()
+	for i := 0; i < 60; i++ {
+		if _, _, err := rs.Read(ctx, uint64(i), 2, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected reads not to wait, took %s", elapsed)
+	}
+	// A write that would wait past the ctx's deadline fails.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 60; i++ {
+		if _, err := rs.Write(ctx, uint64(i), 2, 6, []byte("b")); err != nil {
+			if err != context.DeadlineExceeded {
+				t.Fatalf("expected the deadline exceeded, got %v", err)
+			}
+			return
+		}
+	}
+	t.Fatal("expected a write to exceed the deadline")
+}
+
+func TestReadBytesLimit(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadBytesPerSecond: 2000}})
+	ctx := context.Background()
+	value := bytes.Repeat([]byte("a"), 100)
+	if _, err := rs.Write(ctx, 1, 2, 5, value); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		if _, _, err := rs.Read(ctx, 1, 2, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected 500 bytes past the burst to wait about 250ms, took %s", elapsed)
+	}
+}
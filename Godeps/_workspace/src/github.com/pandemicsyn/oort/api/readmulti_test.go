@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// inFlightValueStore is a MemValueStore that takes a while over each Read,
+// recording the most Reads it has had in flight at once.
+type inFlightValueStore struct {
+	MemValueStore
+	lock     sync.Mutex
+	inFlight int
+	most     int
+}
+
+func (s *inFlightValueStore) Read(ctx context.Context, keyA, keyB uint64, value []byte) (int64, []byte, error) {
+	s.lock.Lock()
+	s.inFlight++
+	if s.inFlight > s.most {
+		s.most = s.inFlight
+	}
+	s.lock.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	s.lock.Lock()
+	s.inFlight--
+	s.lock.Unlock()
+	return s.MemValueStore.Read(ctx, keyA, keyB, value)
+}
+
+func TestReadMulti(t *testing.T) {
+	s := &inFlightValueStore{}
+	rs := newLocalReplValueStore([]store.ValueStore{s}, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ConcurrentRequestsPerStore: 3}})
+	ctx := context.Background()
+	keys := make([]ValueKeyPair, 20)
+	for i := range keys {
+		keys[i] = ValueKeyPair{KeyA: uint64(i), KeyB: 2}
+		// Every third key is missing.
+		if i%3 != 0 {
+			s.Write(ctx, uint64(i), 2, int64(i+1), []byte(fmt.Sprint(i)))
+		}
+	}
+	results := rs.ReadMulti(ctx, keys)
+	if len(results) != len(keys) {
+		t.Fatalf("expected %d results, got %d", len(keys), len(results))
+	}
+	for i, res := range results {
+		if i%3 == 0 {
+			if !store.IsNotFound(res.Err) {
+				t.Fatalf("result %d: expected not found, got %q %v", i, res.Value, res.Err)
+			}
+		} else if res.Err != nil || res.TimestampMicro != int64(i+1) || string(res.Value) != fmt.Sprint(i) {
+			t.Fatalf("result %d: expected %d at %d, got %q at %d %v", i, i, i+1, res.Value, res.TimestampMicro, res.Err)
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.most > 3 || s.most < 2 {
+		t.Fatalf("expected up to 3 reads in flight, got %d", s.most)
+	}
+	if empty := rs.ReadMulti(ctx, nil); len(empty) != 0 {
+		t.Fatalf("expected no results, got %v", empty)
+	}
+}
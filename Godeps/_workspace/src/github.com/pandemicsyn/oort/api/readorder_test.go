@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gholt/ring"
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// readCalls returns how many Reads each replica has been sent.
+func readCalls(sss []*ScriptedValueStore) []int {
+	n := make([]int, len(sss))
+	for i, ss := range sss {
+		n[i] = countCalls(ss, "Read")
+	}
+	return n
+}
+
+func TestReadReplicas(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadReplicas: 2}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	}
+	// A failed Write leaves the first replica failing, and so last in line.
+	sss[0].Push("Write", ScriptedResponse{Err: errUnavailable})
+	rs.Write(ctx, 1, 2, 5, []byte("a"))
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if n := readCalls(sss); n[0] != 0 || n[1] != 1 || n[2] != 1 {
+		t.Fatalf("expected the healthy replicas read, got %v", n)
+	}
+	// A replica that fails is replaced by the next in line.
+	sss[1].Push("Read", ScriptedResponse{Err: errUnavailable})
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if n := readCalls(sss); n[0] != 1 || n[1] != 2 || n[2] != 2 {
+		t.Fatalf("expected the failing replica replaced, got %v", n)
+	}
+}
+
+func TestReadReplicasNotFound(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadReplicas: 1}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: ErrNotFound})
+	}
+	// The key is found on the one replica that has it, last in line after a
+	// failed Write, though those asked first do not have it.
+	sss[2].Push("Write", ScriptedResponse{Err: errUnavailable})
+	rs.Write(ctx, 1, 2, 5, []byte("a"))
+	sss[2].SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 5 || string(v) != "a" {
+		t.Fatalf("expected a at 5, got %q at %d %v", v, ts, err)
+	}
+	if _, length, err := rs.Lookup(ctx, 1, 2); err != nil || length != 1 {
+		t.Fatalf("expected a length of 1, got %d %v", length, err)
+	}
+	if n := readCalls(sss); n[0] != 1 || n[1] != 1 || n[2] != 1 {
+		t.Fatalf("expected every replica read, got %v", n)
+	}
+}
+
+func TestReadLatencyOrder(t *testing.T) {
+	for _, cfg := range []ReplStoreConfig{
+		{ReadReplicas: 1},
+		{ReadStrategy: ReadFastest, ReadHedgeDelay: time.Second},
+	} {
+		rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: cfg})
+		ctx := context.Background()
+		// The Write has every replica connected, with the second fastest.
+		for i, delay := range []time.Duration{40, 0, 20} {
+			sss[i].Push("Write", ScriptedResponse{Delay: delay * time.Millisecond})
+			sss[i].SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+		}
+		if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+			t.Fatalf("expected a, got %q %v", v, err)
+		}
+		if n := readCalls(sss); n[0] != 0 || n[1] != 1 || n[2] != 0 {
+			t.Fatalf("%+v: expected the fastest replica read, got %v", cfg, n)
+		}
+	}
+}
+
+func TestReadLocalTier(t *testing.T) {
+	b := ring.NewBuilder(64)
+	b.SetReplicaCount(3)
+	sss := []*ScriptedValueStore{{}, {}, {}}
+	for i, tier := range []string{"b", "a", "b"} {
+		if _, err := b.AddNode(true, 1, []string{tier}, []string{fmt.Sprintf("local%d", i)}, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := b.Ring()
+	rs := NewReplValueStore(&ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RingSource: &StaticRingSource{Ring: r}, LocalTier: "a"}})
+	rs.newBackendStore = func(addr string) (store.ValueStore, error) {
+		var i int
+		_, err := fmt.Sscanf(addr, "local%d", &i)
+		return sss[i], err
+	}
+	rs.SetRing(r)
+	ctx := context.Background()
+	local := sss[1]
+	local.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if n := countCalls(local, "Read"); n != 1 || totalCalls(sss, "Read") != 1 {
+		t.Fatalf("expected just the local replica read, got %d of %d", n, totalCalls(sss, "Read"))
+	}
+	// A remote replica is read when the local one fails or does not have
+	// the key.
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 6, Value: []byte("b")})
+	}
+	for _, resp := range []ScriptedResponse{{Err: errUnavailable}, {Err: ErrNotFound}} {
+		local.Push("Read", resp)
+		if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 6 || string(v) != "b" {
+			t.Fatalf("expected b at 6 after %v, got %q at %d %v", resp.Err, v, ts, err)
+		}
+	}
+}
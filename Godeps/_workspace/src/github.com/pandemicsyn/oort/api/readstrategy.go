@@ -0,0 +1,135 @@
+package api
+
+import "time"
+
+// ReadStrategy defines how the Repl stores gather the responses to a Lookup
+// or Read from the replicas responsible for the key.
+type ReadStrategy int
+
+const (
+	// ReadAll waits for every replica to respond and returns the newest
+	// value. This is the default and ensures the latest write is seen if any
+	// reachable replica has it, but the latency of each request is that of
+	// the slowest replica.
+	ReadAll ReadStrategy = iota
+	// ReadFastest returns the first successful response, trading the chance
+	// of returning an older value for not waiting on slow replicas. Errors,
+	// including not found, do not end the request unless every replica
+	// returns one.
+	ReadFastest
+	// ReadHedged sends each request to just one replica at first, returning
+	// its response if it succeeds within ReadHedgeDelay. Otherwise, the
+	// request is sent to the rest of the replicas and they are all waited on
+	// as with ReadAll. This greatly reduces the load on the backend stores
+	// for read heavy workloads while still bounding the tail latency.
+	ReadHedged
+)
+
+// defaultReadHedgeDelay is the ReadHedgeDelay used with ReadHedged when none
+// is configured.
+const defaultReadHedgeDelay = 20 * time.Millisecond
+
+func (s ReadStrategy) String() string {
+	switch s {
+	case ReadAll:
+		return "ReadAll"
+	case ReadFastest:
+		return "ReadFastest"
+	case ReadHedged:
+		return "ReadHedged"
+	}
+	return "ReadStrategy(?)"
+}
+
+// readFanOut decides when each of a request's replicas is sent the request,
+// according to the ReadStrategy. The caller selects on c alongside its
+// responses, calling fire when c fires and respond for each response, until
+// it has received as many responses as launched and c is nil.
+type readFanOut struct {
+	strategy ReadStrategy
+	delay    time.Duration
+	count    int
+	limit    int
+	launched int
+	launch   func(i int)
+	timer    *time.Timer
+	c        <-chan time.Time
+}
+
+// newReadFanOut starts the request for the count replicas, calling launch
+// with the index of each replica as it should be sent the request. Only limit
+// replicas are sent the request unless some of those fail; a limit < 1 means
+// all of them.
+func newReadFanOut(strategy ReadStrategy, delay time.Duration, count int, limit int, launch func(i int)) *readFanOut {
+	if limit < 1 || limit > count {
+		limit = count
+	}
+	f := &readFanOut{strategy: strategy, delay: delay, count: count, limit: limit, launch: launch}
+	if limit > 1 && delay > 0 && (strategy == ReadFastest || strategy == ReadHedged) {
+		f.launchNext()
+		f.timer = time.NewTimer(delay)
+		f.c = f.timer.C
+	} else {
+		f.launchRest()
+	}
+	return f
+}
+
+func (f *readFanOut) launchNext() {
+	f.launch(f.launched)
+	f.launched++
+}
+
+func (f *readFanOut) launchRest() {
+	for f.launched < f.limit {
+		f.launchNext()
+	}
+}
+
+// advance sends the request to the next replica or, with ReadHedged, all the
+// remaining replicas. If the timer is not known to have fired, it is stopped
+// first.
+func (f *readFanOut) advance(fired bool) {
+	if !fired && !f.timer.Stop() {
+		<-f.timer.C
+	}
+	if f.strategy == ReadHedged {
+		f.launchRest()
+	} else {
+		f.launchNext()
+	}
+	if f.launched < f.limit {
+		f.timer.Reset(f.delay)
+	} else {
+		f.c = nil
+	}
+}
+
+// fire is to be called when c fires.
+func (f *readFanOut) fire() {
+	f.advance(true)
+}
+
+// respond is to be called with each response, returning true if that
+// response should be returned to the caller without waiting for any others.
+// A response that is not ok, a failure or a not found, has another replica
+// beyond the limit sent the request in its place, as a not found from just
+// some of the replicas may only mean the others have yet to be told.
+func (f *readFanOut) respond(ok bool) bool {
+	if ok {
+		return f.strategy == ReadFastest || (f.strategy == ReadHedged && f.launched == 1)
+	}
+	if f.c != nil {
+		// No point waiting out the delay after an error.
+		f.advance(false)
+	} else if f.launched < f.count {
+		f.launchNext()
+	}
+	return false
+}
+
+func (f *readFanOut) stop() {
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// totalCalls returns how many of the calls made to all of sss so far were op.
+func totalCalls(sss []*ScriptedValueStore, op string) int {
+	n := 0
+	for _, ss := range sss {
+		n += countCalls(ss, op)
+	}
+	return n
+}
+
+func TestReadFastest(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadStrategy: ReadFastest}})
+	ctx := context.Background()
+	// The newest values are the slowest to arrive.
+	sss[0].SetDefault(ScriptedResponse{TimestampMicro: 6, Value: []byte("slow"), Delay: 200 * time.Millisecond})
+	sss[1].SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("fast")})
+	sss[2].SetDefault(ScriptedResponse{TimestampMicro: 7, Value: []byte("slower"), Delay: 300 * time.Millisecond})
+	start := time.Now()
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 5 || string(v) != "fast" {
+		t.Fatalf("expected fast at 5, got %q at %d %v", v, ts, err)
+	}
+	if _, _, err := rs.Lookup(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Fatalf("expected not to wait on the slow replicas, took %s", elapsed)
+	}
+	// ReadAll, set per call, waits for the newest.
+	if ts, v, err := rs.Read(WithReadStrategy(ctx, ReadAll), 1, 2, nil); err != nil || ts != 7 || string(v) != "slower" {
+		t.Fatalf("expected slower at 7, got %q at %d %v", v, ts, err)
+	}
+}
+
+func TestReadFastestErrors(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadStrategy: ReadFastest}})
+	ctx := context.Background()
+	// Not found and failures are passed over for a value.
+	sss[0].Push("Read", ScriptedResponse{Err: ErrNotFound})
+	sss[1].Push("Read", ScriptedResponse{Err: errUnavailable})
+	sss[2].Push("Read", ScriptedResponse{TimestampMicro: 5, Value: []byte("a"), Delay: 10 * time.Millisecond})
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 5 || string(v) != "a" {
+		t.Fatalf("expected a at 5, got %q at %d %v", v, ts, err)
+	}
+	// Only if every replica returns an error is one returned.
+	for _, ss := range sss {
+		ss.Push("Read", ScriptedResponse{Err: ErrNotFound})
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %q %v", v, err)
+	}
+}
+
+func TestReadFastestHedgeDelay(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadStrategy: ReadFastest, ReadHedgeDelay: 100 * time.Millisecond}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	}
+	// A replica answering within the delay is the only one asked.
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if n := totalCalls(sss, "Read"); n != 1 {
+		t.Fatalf("expected one replica read, got %d", n)
+	}
+	// Replicas slower than the delay are joined by one more at a time.
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a"), Delay: 150 * time.Millisecond})
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if n := totalCalls(sss, "Read") - 1; n != 2 {
+		t.Fatalf("expected two replicas read, got %d", n)
+	}
+}
+
+func TestReadHedged(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadStrategy: ReadHedged, ReadHedgeDelay: 100 * time.Millisecond}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	}
+	// A replica answering within the delay is the only one asked, for
+	// Lookups as for Reads.
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if _, length, err := rs.Lookup(ctx, 1, 2); err != nil || length != 1 {
+		t.Fatalf("expected a length of 1, got %d %v", length, err)
+	}
+	if n := totalCalls(sss, "Read") + totalCalls(sss, "Lookup"); n != 2 {
+		t.Fatalf("expected one replica asked each time, got %d calls", n)
+	}
+}
+
+func TestReadHedgedSlow(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadStrategy: ReadHedged, ReadHedgeDelay: 20 * time.Millisecond}})
+	ctx := context.Background()
+	// Past the delay every replica is asked and, as with ReadAll, the newest
+	// value is returned.
+	for i, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: int64(5 + i), Value: []byte{'a' + byte(i)}, Delay: 50 * time.Millisecond})
+	}
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 7 || string(v) != "c" {
+		t.Fatalf("expected c at 7, got %q at %d %v", v, ts, err)
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Read"); n != 1 {
+			t.Fatalf("expected replica %d read once, got %d", i, n)
+		}
+	}
+}
+
+func TestReadHedgedDefaultDelay(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ReadStrategy: ReadHedged}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{TimestampMicro: 5, Value: []byte("a"), Delay: 2 * defaultReadHedgeDelay})
+	}
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "a" {
+		t.Fatalf("expected a, got %q %v", v, err)
+	}
+	if n := totalCalls(sss, "Read"); n != 3 {
+		t.Fatalf("expected the request hedged to every replica, got %d calls", n)
+	}
+}
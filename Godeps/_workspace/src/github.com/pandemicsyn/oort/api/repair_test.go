@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRepair(t *testing.T) {
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RepairQueueSize: 10, RepairRate: 1000}})
+	ctx := context.Background()
+	ms[0].Write(ctx, 1, 2, 5, []byte("a"))
+	ms[1].Write(ctx, 1, 2, 6, []byte("b"))
+	ms[2].Write(ctx, 1, 2, 6, []byte("b"))
+	// The replicas disagreeing queues the key for repair.
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || string(v) != "b" {
+		t.Fatalf("expected b, got %q %v", v, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		ts, v, err := ms[0].Read(ctx, 1, 2, nil)
+		if err == nil && ts == 6 && string(v) == "b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the stale replica repaired, got %q at %d %v", v, ts, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRepairQueueFull(t *testing.T) {
+	// A slow rate keeps the queued keys waiting.
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RepairQueueSize: 2, RepairRate: 1}})
+	for i := uint64(0); i < 5; i++ {
+		rs.repairKey(replValueCacheKey{keyA: i, keyB: 2})
+	}
+	// A key already waiting is not queued again.
+	rs.repairKey(replValueCacheKey{keyA: 0, keyB: 2})
+	stats, err := rs.Stats(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := stats.(*ReplStoreStats).RepairQueueDepth; depth != 2 {
+		t.Fatalf("expected the keys past the queue size dropped, got a depth of %d", depth)
+	}
+	rs.repairLock.Lock()
+	queued := append([]replValueCacheKey(nil), rs.repairQueue...)
+	rs.repairLock.Unlock()
+	if len(queued) != 2 || queued[0].keyA != 0 || queued[1].keyA != 1 {
+		t.Fatalf("expected the first two keys kept, got %+v", queued)
+	}
+}
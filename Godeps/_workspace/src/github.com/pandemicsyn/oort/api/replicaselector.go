@@ -0,0 +1,51 @@
+package api
+
+import "github.com/gholt/ring"
+
+// ReplicaSelector chooses the backend stores a key's requests go to, letting
+// custom policies such as canary nodes or weighted selection be plugged in.
+type ReplicaSelector interface {
+	// Select returns the addresses of the backend stores for the key, given
+	// the current ring, in order of preference; reads may still be reordered
+	// by health, locality, and latency as configured. Stores at addresses
+	// not in the ring are connected to as needed but are shut down, and
+	// reconnected on next use, whenever a new ring is set.
+	Select(r ring.Ring, keyA uint64) []string
+}
+
+// RingReplicaSelector is the default ReplicaSelector, returning the nodes
+// the ring holds responsible for the key's partition, using the node address
+// at AddressIndex.
+type RingReplicaSelector struct {
+	AddressIndex int
+}
+
+func (s *RingReplicaSelector) Select(r ring.Ring, keyA uint64) []string {
+	return nodeAddrs(r.ResponsibleNodes(uint32(keyA>>(64-r.PartitionBitCount()))), s.AddressIndex)
+}
+
+// ReplicaNode is a backend store responsible for a key, as given by
+// ReplicasFor.
+type ReplicaNode struct {
+	Addr string
+	// NodeID is the ID of the ring node at Addr, or 0 if the
+	// ReplicaSelector chose an address not in the ring.
+	NodeID uint64
+	// Partition is the ring partition the key falls in.
+	Partition uint32
+}
+
+// replicaNodes returns the ReplicaNodes for the addresses selected for
+// keyA, matching them to the ring's nodes by the address at addressIndex.
+func replicaNodes(r ring.Ring, keyA uint64, addrs []string, addressIndex int) []ReplicaNode {
+	partition := uint32(keyA >> (64 - r.PartitionBitCount()))
+	ids := make(map[string]uint64)
+	for _, n := range r.Nodes() {
+		ids[n.Address(addressIndex)] = n.ID()
+	}
+	rns := make([]ReplicaNode, len(addrs))
+	for i, addr := range addrs {
+		rns[i] = ReplicaNode{Addr: addr, NodeID: ids[addr], Partition: partition}
+	}
+	return rns
+}
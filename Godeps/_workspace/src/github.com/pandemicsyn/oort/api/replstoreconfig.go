@@ -0,0 +1,405 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gholt/ring"
+	"github.com/pandemicsyn/ftls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ReplStoreConfig holds the settings ReplValueStoreConfig and
+// ReplGroupStoreConfig share; each embeds it, so a setting added here is
+// offered by both kinds of store.
+type ReplStoreConfig struct {
+	// LogError sets the func to use for error messages. Defaults to stderr.
+	LogError func(fmt string, args ...interface{})
+	// LogDebug sets the func to use for debug messages. Defaults to not
+	// logging debug messages.
+	LogDebug func(fmt string, args ...interface{})
+	// AddressIndex indicates which of the ring node addresses to use when
+	// connecting to a node (see github.com/gholt/ring/Node.Address).
+	AddressIndex int
+	// ReplicaSelector chooses the backend stores for each key. Default:
+	// &RingReplicaSelector{AddressIndex: AddressIndex}
+	ReplicaSelector ReplicaSelector
+	// ValueCap defines the maximum value size supported by the set of stores.
+	// This defaults to 0xffffffff, or math.MaxUint32. In order to discover the
+	// true value cap, all stores would have to be queried and then the lowest
+	// cap used. However, that's probably not really necessary and configuring
+	// a set value cap here is probably fine.
+	ValueCap uint32
+	// SplitLargeValues has Write split values longer than ValueCap, once
+	// encoded, into chunks stored under keys derived from the one given,
+	// with a manifest of the chunks written to the key itself, rather than
+	// reject them; Read reassembles them. Lookup reports the length of the
+	// manifest for such values, and Delete has to read each value first for
+	// any chunks to delete. Overwriting a split value leaves whatever chunks
+	// the new value does not reuse in place. Manifests are marked in the
+	// header values are framed with, as described for EncodeValue, so
+	// SplitLargeValues must be set before the first value is written.
+	// Default: false
+	SplitLargeValues bool
+	// StreamChunkSize defines the size of the chunks WriteStream splits
+	// values into. Default: 1048576, or ValueCap if that is smaller.
+	StreamChunkSize uint32
+	// FramedValues frames values as described for EncodeValue even with none
+	// of the settings that need it set, as WriteStream, ReadStream, and
+	// DeleteStream require. Default: false
+	FramedValues bool
+	// LegacyRawValues lets framing, as described for EncodeValue, be enabled
+	// on backend stores already holding values written without it: values
+	// written are then marked as framed, and values read without the mark
+	// are returned as they are, taken to be raw values written before. Set
+	// it when framing is first enabled on such stores. Raw values are not
+	// checksummed or encrypted, so with KeyProvider set, anyone able to write
+	// to the backend stores could have plaintext values of their choosing
+	// accepted; unset it once every raw value has been rewritten. Default:
+	// false
+	LegacyRawValues bool
+	// ConcurrentRequestsPerStore defines the concurrent requests per
+	// underlying connected store. Default: 10
+	ConcurrentRequestsPerStore int
+	// HighPriorityRequestsPerStore defines the additional concurrent
+	// requests per underlying connected store reserved for requests made
+	// with WithPriority(ctx, PriorityHigh), so latency sensitive requests
+	// can jump ahead of bulk traffic. Default: ConcurrentRequestsPerStore /
+	// 4, minimum 1
+	HighPriorityRequestsPerStore int
+	// ConnectionsPerStore is how many gRPC connections are made to each
+	// backend store, with requests spread across them round robin, for
+	// when a single HTTP/2 connection becomes the bottleneck. The concurrent
+	// requests to each store are still bounded by ConcurrentRequestsPerStore
+	// and HighPriorityRequestsPerStore in total. Default: 1
+	ConnectionsPerStore int
+	// FailedConnectRetryDelay defines the most seconds that must pass before
+	// retrying a failed connection; see ReconnectBackoffMax. Default: 15
+	// seconds
+	FailedConnectRetryDelay int
+	// ReconnectBackoffInitial and ReconnectBackoffMax bound the exponential
+	// backoff, with jitter, applied per address when a connection to a
+	// backend store fails: requests to it fail fast until the backoff has
+	// passed, each consecutive failure doubles the backoff, and a
+	// successful request resets it. The state is reported by Stats.
+	// Defaults: 250ms and FailedConnectRetryDelay seconds
+	ReconnectBackoffInitial time.Duration
+	ReconnectBackoffMax     time.Duration
+	// StoreDrainTimeout defines how many seconds a store removed from the
+	// ring is given to finish its in flight requests before it is shut down.
+	// Default: 30 seconds
+	StoreDrainTimeout int
+	// ReadCacheSize defines the maximum number of recently read values to
+	// keep in memory, to be returned by further Reads without going to the
+	// backend stores. Writes and Deletes through this client remove the
+	// affected entries, but changes made by other clients will not be seen
+	// until an entry expires. Default: 0, no caching.
+	ReadCacheSize int
+	// ReadCacheTTL defines how long a value is kept in the read cache.
+	// Default: 5 seconds
+	ReadCacheTTL time.Duration
+	// NotFoundCacheSize defines the maximum number of keys recently found to
+	// have no value to remember, so further Lookups and Reads of them are
+	// answered without going to the backend stores. As with the read cache,
+	// Writes through this client remove the affected entries but writes by
+	// other clients will not be seen until an entry expires.
+	// Default: 0, no caching.
+	NotFoundCacheSize int
+	// NotFoundCacheTTL defines how long a not found result is kept in the
+	// not found cache; it is best kept short. Default: 1 second
+	NotFoundCacheTTL time.Duration
+	// CoalesceReads has concurrent Reads of the same key share a single
+	// request to the backend stores, with each caller given its own copy of
+	// the result, so a hot key cannot multiply the load on the backends.
+	// Reads that join one already in flight get its result even if it
+	// failed, such as from the first caller's context being canceled.
+	// Default: false
+	CoalesceReads bool
+	// ReadStrategy defines how Lookups and Reads gather responses from the
+	// replicas; it can be overridden per call with WithReadStrategy.
+	// Default: ReadAll
+	ReadStrategy ReadStrategy
+	// ReadHedgeDelay, with ReadFastest, sends each request to just one
+	// replica at first, sending to another only after this long without a
+	// successful response, or immediately on an error; 0 sends to all
+	// replicas at once. With ReadHedged, it is how long to wait on the first
+	// replica before sending to the rest. Default: 0, or 20ms with ReadHedged
+	ReadHedgeDelay time.Duration
+	// ReadPartialMargin, if set, has a Read whose context has a deadline stop
+	// waiting on the remaining replicas this long before the deadline,
+	// returning the newest value received so far along with a
+	// ReplValueStoreErrorPartialRead or ReplGroupStoreErrorPartialRead, which
+	// matches ErrPartialRead with errors.Is. If no replica has returned a
+	// value by then the Read waits on as usual. This suits serving paths
+	// where a possibly older value within the latency budget beats an error.
+	// Default: 0, disabled
+	ReadPartialMargin time.Duration
+	// DefaultRequestTimeout, if set, limits how long each request to a
+	// backend store may take when the caller's context has no deadline, so
+	// a single hung backend cannot stall a request indefinitely; it can be
+	// overridden per call with WithRequestTimeout. Default: 0, no limit
+	DefaultRequestTimeout time.Duration
+	// DefaultConnectTimeout, if set, limits how long dialing a backend store
+	// may take. Default: 0, no limit beyond gRPC's own
+	DefaultConnectTimeout time.Duration
+	// KeepAlive, if set, is the period of the TCP keep alive probes on
+	// connections to the backend stores and ring server, so long lived idle
+	// connections behind NATs and load balancers stay open and dead ones are
+	// detected; 30s suits most such setups. Unset, connections are dialed by
+	// gRPC as before.
+	//
+	// Only TCP keep alive is offered: the vendored gRPC has no HTTP/2 keep
+	// alive time or timeout, flow control window size, max message size, or
+	// max concurrent streams settings, so there are none here, nor any
+	// grpc.DialOptions for them to pass in GRPCOpts. Requests per connection
+	// are bounded instead by ConcurrentRequestsPerStore and message sizes by
+	// ValueCap. Default: 0, disabled
+	KeepAlive time.Duration
+	// OnBackendStateChange, if set, is called whenever a backend store
+	// changes state, such as to alert on flapping backends. Calls are made in
+	// order from a single goroutine; if the func falls far enough behind,
+	// further changes are dropped rather than block requests.
+	OnBackendStateChange func(change ReplStoreBackendStateChange)
+	// OnRingChange, if set, is called whenever a new ring is set, such as
+	// for invalidating caches keyed by node when the topology changes. As
+	// with OnBackendStateChange, calls are made in order from a single
+	// goroutine and changes are dropped if the func falls far behind.
+	OnRingChange func(change ReplStoreRingChange)
+	// ValidateRing, if set, is called with the ring in use and a new ring
+	// received from the RingSource, or RefreshRing, before the new ring is
+	// applied; an error rejects the new ring, which is logged, and the ring
+	// in use is kept. It is not called for the first ring or for rings
+	// given to SetRing directly. See MaxRingChurn.
+	ValidateRing func(oldRing, newRing ring.Ring) error
+	// AuditPassProgress, if set, is called by AuditPass as each backend
+	// store finishes its audit pass, with the store's error, if any, and how
+	// many of the total stores have finished.
+	AuditPassProgress func(addr string, err error, done, total int)
+	// Tracer, if set, is used to trace requests through to the backend stores
+	// and ring updates.
+	Tracer Tracer
+	// Authorizer, if set, is called before each operation and may deny it;
+	// see Authorizer.
+	Authorizer Authorizer
+	// AuditSink, if set, is given an AuditRecord for every mutation; see
+	// AuditRecord and NewAuditWriterSink.
+	AuditSink AuditSink
+	// AuditSigningKey, if set, signs each AuditRecord; see
+	// AuditRecord.Signature.
+	AuditSigningKey []byte
+	// ReadReplicas, if set, limits how many of the replicas responsible for a
+	// key each Lookup and Read is sent to, preferring the healthiest. Another
+	// replica is only used in place of one that fails or does not have the
+	// key. Writes and Deletes are still sent to every replica. Default: 0,
+	// all replicas
+	ReadReplicas int
+	// LocalTier, if set, is the client's own tier value, such as its zone,
+	// at LocalTierLevel in the ring. Lookups and Reads are then sent only to
+	// the replicas in the same tier, unless ReadReplicas says otherwise,
+	// going to other tiers only when those replicas fail or do not have the
+	// key.
+	LocalTier string
+	// LocalTierLevel is the ring tier level LocalTier is compared with.
+	// Default: 0
+	LocalTierLevel int
+	// RepairQueueSize, if set, enables the background repair of keys whose
+	// replicas were found to disagree or could not all be written to, and
+	// limits how many keys may wait for repair. Default: 0, no repair
+	RepairQueueSize int
+	// RepairRate defines the most keys repaired per second. Default: 100
+	RepairRate int
+	// ReadOpsPerSecond, ReadBytesPerSecond, WriteOpsPerSecond, and
+	// WriteBytesPerSecond, if set, limit the rate of requests made through
+	// this client, so one heavy user, such as a batch job, cannot starve
+	// others sharing the same backend stores. Reads are Lookups, Reads, and
+	// their group and batch forms; writes are Writes, Deletes, and
+	// WriteBatches. Each retry counts as another request. Bursts of up to
+	// one second's worth are allowed. Default: 0, no limit
+	ReadOpsPerSecond    int
+	ReadBytesPerSecond  int
+	WriteOpsPerSecond   int
+	WriteBytesPerSecond int
+	// EncodeValue and DecodeValue, if set, transform values as they are
+	// written and read, such as to serialize or to apply a format of the
+	// application's own; DecodeValue must reverse EncodeValue. Values are
+	// transformed in a fixed order: EncodeValue, then Compressor, KeyProvider,
+	// and Checksum as below, and the reverse as they are read. Setting any
+	// of these, Compressor, KeyProvider, Checksum, ExpiringValues,
+	// SplitLargeValues, or FramedValues frames every value written with a
+	// small header, even one stored as is, and every value read must then
+	// have one, unless LegacyRawValues is set; so they must be set before
+	// the first value is written, or with LegacyRawValues, and values
+	// written with them can only be read with one of them still set.
+	// Default: nil, values are left as they are
+	EncodeValue ValueTransform
+	DecodeValue ValueTransform
+	// Compressor, if set, compresses values of at least CompressMinSize
+	// bytes before they are written, when doing so makes them smaller.
+	// Compressed values are flagged in their header so they are
+	// decompressed on Read. Once values have been written compressed, a
+	// Compressor with the same ID must stay configured to read them.
+	// Default: nil, no compression
+	Compressor Compressor
+	// CompressMinSize is the smallest value, in bytes, Compressor is applied
+	// to. Default: 1024
+	CompressMinSize int
+	// KeyProvider, if set, enables envelope encryption: values are
+	// encrypted with AES-GCM under a new random data key, wrapped by the
+	// KeyProvider, before being written and decrypted on Read, so the
+	// backend stores never see plaintext. Values are compressed, if
+	// configured, before being encrypted, and the header saying how each
+	// value was encoded, with the wrapped data key, is authenticated along
+	// with it. Values read that were not encrypted are rejected as corrupt.
+	// Default: nil, no encryption
+	KeyProvider KeyProvider
+	// Checksum, if set, adds a checksum to values as they are written that
+	// is verified on each replica's response as they are read. A replica
+	// whose value does not match is treated as failed, so another replica is
+	// tried, and if none have a good copy the Read returns an error
+	// satisfying errors.Is(err, ErrChecksumMismatch). The checksum covers
+	// the value after any compression and encryption, and the header saying
+	// how it was encoded. Default: ChecksumNone
+	Checksum Checksum
+	// ExpiringValues enables WriteTTL and the checking of expiries on read:
+	// Read, ReadGroup for group stores, and Lookup treat expired values as
+	// not found. Lookup has to read the whole value to check it, so is no
+	// cheaper than Read with this set; LookupGroup does not check expiries.
+	// Values cached with ReadCacheSize may be returned for up to
+	// ReadCacheTTL past their expiry. Expiries are kept in the header values
+	// are framed with, as described for EncodeValue. Default: false
+	ExpiringValues bool
+	// DeleteExpired, with ExpiringValues, issues a Delete in the background
+	// for each expired value found by a read. Default: false
+	DeleteExpired bool
+	// ShadowQueueSize is how many mirrored requests may wait for the
+	// ShadowStore before more are dropped. Default: 1000
+	ShadowQueueSize int
+	// ShadowConcurrency is how many mirrored requests may be in flight to
+	// the ShadowStore at once. Default: 10
+	ShadowConcurrency int
+	// RetryPolicy, if set, is applied to each Lookup, Read, Write, and
+	// Delete so transient failures of backend stores are retried before
+	// being returned to the caller; it can be overridden per call with
+	// WithRetryPolicy. Default: nil, no retries.
+	RetryPolicy *RetryPolicy
+	// HintedHandoffMaxBytes is the most memory, counting each value and a
+	// little for its key, the writes and deletes kept queued for backend
+	// stores that could not be reached may take, to be replayed once they
+	// can be. Default: 0, hinted handoff disabled.
+	HintedHandoffMaxBytes int
+	// HintedHandoffPath is the full location file name where you'd like to
+	// persist queued hints across restarts, such as
+	// "/var/lib/myprog/valuestore.hints". Hints are appended to it as they
+	// are queued, the file is compacted as they are replayed and on
+	// Shutdown, and it is reloaded on creation. An empty string will keep
+	// hints in memory only.
+	HintedHandoffPath string
+	// WriteAck defines how many replicas must acknowledge a write or delete
+	// for it to succeed; it can be overridden per call with WithWriteAck.
+	// Default: WriteAckQuorum
+	WriteAck WriteAck
+	// StoreFTLSConfig is the ftls config you want use to build a tls.Config for
+	// each grpc client used to communicate to the Store.
+	StoreFTLSConfig *ftls.Config
+	// GRPCOpts are any additional reusable options you'd like to pass to GRPC
+	// when connecting to stores.
+	GRPCOpts []grpc.DialOption
+	// PerRPCCredentials, if set, are sent with every request to the stores
+	// and the ring server, such as for a cluster behind an authenticating
+	// proxy; see BearerToken, TokenSourceCredentials, and
+	// PerRPCCredentialsFunc.
+	PerRPCCredentials credentials.Credentials
+	// RingServer is the network address to use to connect to a ring server. An
+	// empty string will use RingServerSRV or, if that is also empty, the
+	// default DNS method of determining the ring server location.
+	RingServer string
+	// RingServerSRV is the name of a DNS SRV record, such as
+	// "_syndicate._tcp.value.example.com", listing the ring servers to
+	// connect to. The targets are tried in order, moving on to the next
+	// whenever a connection fails or ends.
+	RingServerSRV string
+	// RingServerRecheck, if set, has the ring service resolved again this
+	// often while connected, from RingServerSRV or the default DNS method,
+	// and the connection moved if its address is no longer listed, so
+	// moving the ring service in DNS takes effect without waiting for the
+	// old connection to fail. It has no effect with RingServer set.
+	// Default: 0, the ring service is only resolved when connecting
+	RingServerRecheck time.Duration
+	// RingSource, if set, is where Startup gets rings from, in place of the
+	// ring service, RingFile, or RingURL; see RingSource.
+	RingSource RingSource
+	// RingFile, if set, is a ring file to watch instead of connecting to a
+	// ring server; for when rings are distributed by other means, such as
+	// config management. Startup will load the ring file and then reload it
+	// whenever it changes.
+	RingFile string
+	// RingURL, if set, is an HTTP or HTTPS URL of a ring file to poll
+	// instead of connecting to a ring server, such as for rings published
+	// to object storage or a CDN. Conditional requests, with If-None-Match
+	// and If-Modified-Since, keep an unchanged ring from being downloaded
+	// again. RingFile takes precedence if both are set.
+	RingURL string
+	// RingURLClient is the http.Client used to fetch RingURL.
+	// Default: an http.Client with a 30 second timeout
+	RingURLClient *http.Client
+	// RingFilePollInterval defines how many seconds pass between checks of
+	// RingFile or RingURL for changes. Default: 5 seconds
+	RingFilePollInterval int
+	// RingServerGRPCOpts are any additional options you'd like to pass to GRPC
+	// when connecting to the ring server.
+	RingServerGRPCOpts []grpc.DialOption
+	// RingServerFTLSConfig is the ftls config you want use to build a
+	// tls.Config for the grpc client used to communicate to the ring server.
+	// This is kept separate from StoreFTLSConfig since the ring server is
+	// often secured differently than the stores. If nil, transport security
+	// is left to RingServerGRPCOpts.
+	RingServerFTLSConfig *ftls.Config
+	// RingClientID is a unique identifier for this client, used when
+	// registering with the RingServer. This allows the ring server to
+	// proactively clean up stale connections should a reconnection be needed.
+	RingClientID string
+	// RingCachePath is the full location file name where you'd like persist
+	// last received ring data, such as "/var/lib/myprog/ring/valuestore.ring".
+	// An empty string will disable caching. The cacher will need permission to
+	// create a new file with the path given plus a temporary suffix, and will
+	// then move that temporary file into place using the exact path given.
+	// The ring is cached with a length and checksum, and the previous ring
+	// is kept with ".bak" added to the path; should the cached ring be found
+	// truncated or corrupt on startup, the previous ring is used instead.
+	RingCachePath string
+	// RingStaleAfter, if set, has writes and deletes fail with ErrRingStale,
+	// while reads continue, once the ring service has been unreachable for
+	// this long, so writes are not routed by a badly outdated ring. It only
+	// applies while Startup's connector to the ring service is running.
+	// Default: 0, disabled
+	RingStaleAfter time.Duration
+	// RingCacheMaxAge, if set, keeps a ring cached at RingCachePath from
+	// being used on startup if it was received longer ago than this; the
+	// store then waits for a ring from the ring service instead. The version
+	// and receipt time of the cached ring are saved beside it, in
+	// RingCachePath plus ".meta"; see also RingCacheInfo. Default: 0, any
+	// cached ring is used
+	RingCacheMaxAge time.Duration
+	// StartupWaitForRing, if set, has Startup block until a ring is
+	// available, from RingCachePath, the ring service, or FallbackNodes, so
+	// a service does not take traffic it cannot route; Startup returns
+	// ErrNoRing if none arrives in this time, leaving the ring service
+	// connector running. Default: 0, Startup returns at once
+	StartupWaitForRing time.Duration
+	// FallbackNodes, if set, are the addresses of backend stores to route to
+	// by consistent hashing if no ring has arrived, from the ring service or
+	// RingCachePath, within FallbackDelay; requests then proceed, degraded,
+	// rather than failing with ErrNoRing. Every client should be given the
+	// same list, in any order, so they place keys alike. The first ring to
+	// arrive replaces the fallback; data written meanwhile to stores the
+	// ring does not make responsible is left to the backend stores' own
+	// replication to move. Default: none, requests wait for a ring
+	FallbackNodes []string
+	// FallbackReplicas is how many of the FallbackNodes each key is placed
+	// on. Default: 3, or fewer if there are fewer FallbackNodes
+	FallbackReplicas int
+	// FallbackDelay is how long to wait for a ring before using the
+	// FallbackNodes. Default: 5s
+	FallbackDelay time.Duration
+}
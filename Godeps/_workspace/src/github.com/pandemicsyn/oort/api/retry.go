@@ -0,0 +1,101 @@
+package api
+
+import (
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy defines how the Repl stores retry a Lookup, Read, Write, or
+// Delete that failed before surfacing the error to the caller.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made, including the first.
+	// Default: 3
+	MaxAttempts int
+	// InitialBackoff is how long to wait before the first retry; each
+	// further retry doubles the wait. Default: 50ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries. Default: 2s
+	MaxBackoff time.Duration
+	// Jitter is the fraction, 0 to 1, of each wait that is randomized so
+	// many clients don't retry in lockstep. Default: 0
+	Jitter float64
+	// Retryable decides whether an error is worth retrying. Defaults to
+	// DefaultRetryable.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryable returns true for errors that come from the backend stores
+// themselves, such as connection failures. Not found errors, context errors,
+// and errors with the request itself are not retried.
+func DefaultRetryable(err error) bool {
+	switch err.(type) {
+	case ReplValueStoreErrorSlice, ReplGroupStoreErrorSlice, *ReplValueStoreErrorPartialWrite, *ReplGroupStoreErrorPartialWrite:
+		return true
+	}
+	return false
+}
+
+func resolveRetryPolicy(p *RetryPolicy) *RetryPolicy {
+	if p == nil {
+		return nil
+	}
+	cfg := &RetryPolicy{}
+	*cfg = *p
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 50 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 2 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = cfg.InitialBackoff
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+	if cfg.Jitter > 1 {
+		cfg.Jitter = 1
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = DefaultRetryable
+	}
+	return cfg
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * p.Jitter * rand.Float64())
+	}
+	return d
+}
+
+// do calls f until it succeeds, returns an error the policy doesn't consider
+// retryable, runs out of attempts, or the ctx is done. A nil policy calls f
+// just once.
+func (p *RetryPolicy) do(ctx context.Context, f func() error) error {
+	err := f()
+	if p == nil {
+		return err
+	}
+	for attempt := 1; err != nil && attempt < p.MaxAttempts && p.Retryable(err); attempt++ {
+		select {
+		case <-time.After(p.backoff(attempt)):
+		case <-ctx.Done():
+			return err
+		}
+		err = f()
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// countCalls returns how many of the calls made to ss so far were op.
+func countCalls(ss *ScriptedValueStore, op string) int {
+	n := 0
+	for _, call := range ss.Calls() {
+		if call.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+var errUnavailable = errors.New("unavailable")
+
+func TestRetryRead(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{InitialBackoff: time.Millisecond}}})
+	ctx := context.Background()
+	// Every replica fails the first attempt.
+	for _, ss := range sss {
+		ss.Push("Read", ScriptedResponse{Err: errUnavailable}, ScriptedResponse{TimestampMicro: 5, Value: []byte("a")})
+	}
+	if ts, v, err := rs.Read(ctx, 1, 2, nil); err != nil || ts != 5 || string(v) != "a" {
+		t.Fatalf("expected a at 5 on retrying, got %q at %d %v", v, ts, err)
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Read"); n != 2 {
+			t.Fatalf("expected replica %d read twice, got %d", i, n)
+		}
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond}}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: errUnavailable})
+	}
+	if _, err := rs.Delete(ctx, 1, 2, 5); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected the replicas' error, got %v", err)
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Delete"); n != 4 {
+			t.Fatalf("expected replica %d sent 4 deletes, got %d", i, n)
+		}
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{InitialBackoff: time.Millisecond}}})
+	ctx := context.Background()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: ErrNotFound})
+	}
+	if _, _, err := rs.Lookup(ctx, 1, 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Lookup"); n != 1 {
+			t.Fatalf("expected replica %d looked up once, got %d", i, n)
+		}
+	}
+	// A policy's own Retryable decides instead.
+	retryAll := &RetryPolicy{InitialBackoff: time.Millisecond, Retryable: func(err error) bool { return true }}
+	if _, _, err := rs.Lookup(WithRetryPolicy(ctx, retryAll), 1, 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Lookup"); n != 4 {
+			t.Fatalf("expected replica %d looked up 3 more times, got %d", i, n-1)
+		}
+	}
+}
+
+func TestRetryDisabled(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{InitialBackoff: time.Millisecond}}})
+	ctx := WithRetryPolicy(context.Background(), nil)
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: errUnavailable})
+	}
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	for i, ss := range sss {
+		if n := countCalls(ss, "Write"); n != 1 {
+			t.Fatalf("expected replica %d written to once, got %d", i, n)
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RetryPolicy: &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for _, ss := range sss {
+		ss.SetDefault(ScriptedResponse{Err: errUnavailable})
+	}
+	start := time.Now()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected the last error, got %v", err)
+	}
+	if time.Since(start) > time.Minute {
+		t.Fatal("expected the backoff cut short")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := resolveRetryPolicy(&RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 35 * time.Millisecond})
+	for attempt, want := range []time.Duration{0, 10, 20, 35, 35} {
+		if attempt == 0 {
+			continue
+		}
+		if got := p.backoff(attempt); got != want*time.Millisecond {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt, want*time.Millisecond, got)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 5*time.Millisecond || d > 10*time.Millisecond {
+			t.Fatalf("expected up to half of 10ms taken off, got %s", d)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/gholt/ring"
+)
+
+// RingCacheInfo describes the ring in use; see RingCacheInfo on the Repl
+// stores.
+type RingCacheInfo struct {
+	Version int64
+	// ReceivedAt is when the ring was received. For a ring loaded from
+	// RingCachePath it is when the ring was originally received, not when it
+	// was loaded.
+	ReceivedAt time.Time
+	// FromCache is true if the ring was loaded from RingCachePath and no
+	// ring has been received since.
+	FromCache bool
+}
+
+// ringCacheMeta is saved as JSON beside the cached ring, in RingCachePath
+// plus ".meta".
+type ringCacheMeta struct {
+	Version    int64     `json:"version"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// ringCacheMagic begins a cached ring, followed by the length of the ring
+// data as a uint64 and its CRC-32C as a uint32, both big endian, and then the
+// ring data itself. Rings cached by older clients lack the header and are
+// loaded without being verified.
+const ringCacheMagic = "OORTRNGC"
+
+const ringCacheHeaderLen = len(ringCacheMagic) + 12
+
+// writeFileAtomic writes the file by way of a temporary file in the same
+// directory that is then synced and moved into place.
+func writeFileAtomic(name string, write func(fp *os.File) error) error {
+	dir, base := path.Split(name)
+	_ = os.MkdirAll(dir, 0755)
+	fp, err := ioutil.TempFile(dir, base)
+	if err != nil {
+		return err
+	}
+	if err = write(fp); err == nil {
+		err = fp.Sync()
+	}
+	if err != nil {
+		fp.Close()
+		os.Remove(fp.Name())
+		return err
+	}
+	fp.Close()
+	if err = os.Rename(fp.Name(), name); err != nil {
+		os.Remove(fp.Name())
+	}
+	return err
+}
+
+// writeRingCache caches the ring at name, with a checksum and length header,
+// and its info at name plus ".meta". A ring of another version already
+// cached there that still verifies is first moved to name plus ".bak", its
+// info along with it, as the previous generation to fall back on should the
+// new one be found corrupt.
+func writeRingCache(name string, r ring.Ring, receivedAt time.Time) error {
+	var buf bytes.Buffer
+	buf.WriteString(ringCacheMagic)
+	buf.Write(make([]byte, 12))
+	if err := r.Persist(&buf); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint64(b[len(ringCacheMagic):], uint64(len(b)-ringCacheHeaderLen))
+	binary.BigEndian.PutUint32(b[len(ringCacheMagic)+8:], crc32.Checksum(b[ringCacheHeaderLen:], crc32cTable))
+	if old, _, err := loadRingCache(name); err == nil && old.Version() != r.Version() {
+		if err := os.Rename(name, name+".bak"); err != nil {
+			return err
+		}
+		os.Remove(name + ".bak.meta")
+		os.Rename(name+".meta", name+".bak.meta")
+	}
+	if err := writeFileAtomic(name, func(fp *os.File) error {
+		_, err := fp.Write(b)
+		return err
+	}); err != nil {
+		return err
+	}
+	return writeFileAtomic(name+".meta", func(fp *os.File) error {
+		return json.NewEncoder(fp).Encode(&ringCacheMeta{Version: r.Version(), ReceivedAt: receivedAt})
+	})
+}
+
+// loadRingCache loads the cached ring and its info, returning an error for a
+// ring that is truncated or fails its checksum. Should the metadata be
+// missing or for another version, such as from an older client, the ring
+// file's modification time is used as when it was received.
+func loadRingCache(name string) (ring.Ring, RingCacheInfo, error) {
+	info := RingCacheInfo{FromCache: true}
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, info, err
+	}
+	defer fp.Close()
+	b, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return nil, info, err
+	}
+	if bytes.HasPrefix(b, []byte(ringCacheMagic)) {
+		if len(b) < ringCacheHeaderLen {
+			return nil, info, errors.New("truncated header")
+		}
+		length := binary.BigEndian.Uint64(b[len(ringCacheMagic):])
+		sum := binary.BigEndian.Uint32(b[len(ringCacheMagic)+8:])
+		b = b[ringCacheHeaderLen:]
+		if uint64(len(b)) != length {
+			return nil, info, fmt.Errorf("truncated: %d bytes rather than %d", len(b), length)
+		}
+		if crc32.Checksum(b, crc32cTable) != sum {
+			return nil, info, errors.New("checksum mismatch")
+		}
+	}
+	r, err := ring.LoadRing(bytes.NewReader(b))
+	if err != nil {
+		return nil, info, err
+	}
+	info.Version = r.Version()
+	var meta ringCacheMeta
+	if b, err := ioutil.ReadFile(name + ".meta"); err == nil && json.Unmarshal(b, &meta) == nil && meta.Version == r.Version() {
+		info.ReceivedAt = meta.ReceivedAt
+	} else if fi, err := fp.Stat(); err == nil {
+		info.ReceivedAt = fi.ModTime()
+	}
+	return r, info, nil
+}
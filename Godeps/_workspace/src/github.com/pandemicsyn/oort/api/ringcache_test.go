@@ -0,0 +1,53 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRingCacheCorruption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ringCache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "ring")
+	prev, _ := localRing(1, 0)
+	cur, _ := localRing(2, 0)
+	for _, err := range []error{writeRingCache(name, prev, time.Now()), writeRingCache(name, cur, time.Now()), writeRingCache(name, cur, time.Now())} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, _, err := loadRingCache(name); err != nil || r.Version() != cur.Version() {
+		t.Fatalf("loaded %v %v", r, err)
+	}
+	// Caching the same ring again keeps the previous generation as the backup.
+	if r, _, err := loadRingCache(name + ".bak"); err != nil || r.Version() != prev.Version() {
+		t.Fatalf("loaded backup %v %v", r, err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, b[:len(b)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadRingCache(name); err == nil {
+		t.Fatal("expected an error loading a truncated ring")
+	}
+	b[len(b)-1] ^= 0xff
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadRingCache(name); err == nil {
+		t.Fatal("expected an error loading a corrupted ring")
+	}
+	rs := NewReplGroupStore(&ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{RingCachePath: name, LogError: func(string, ...interface{}) {}}})
+	if info := rs.RingCacheInfo(); !info.FromCache || info.Version != prev.Version() {
+		t.Fatalf("expected the previous ring, got %+v", info)
+	}
+}
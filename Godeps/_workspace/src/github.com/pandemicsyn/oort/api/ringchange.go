@@ -0,0 +1,35 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gholt/ring"
+)
+
+// ReplStoreRingChange is passed to the OnRingChange callback of the Repl
+// stores whenever a new ring is set.
+type ReplStoreRingChange struct {
+	// OldVersion is the version of the ring replaced, or 0 if this is the
+	// first ring.
+	OldVersion int64
+	NewVersion int64
+	// Added and Removed are the addresses, per AddressIndex, of the nodes
+	// that joined or left with the new ring.
+	Added   []string
+	Removed []string
+	Time    time.Time
+}
+
+func newReplStoreRingChange(oldRing, newRing ring.Ring, addressIndex int) ReplStoreRingChange {
+	change := ReplStoreRingChange{NewVersion: newRing.Version(), Time: time.Now()}
+	newAddrs := nodeAddrs(newRing.Nodes(), addressIndex)
+	if oldRing == nil {
+		change.Added = newAddrs
+		return change
+	}
+	change.OldVersion = oldRing.Version()
+	oldAddrs := nodeAddrs(oldRing.Nodes(), addressIndex)
+	change.Added = addrsMissing(oldAddrs, newAddrs)
+	change.Removed = addrsMissing(newAddrs, oldAddrs)
+	return change
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"os"
+
+	"github.com/gholt/ring"
+)
+
+func loadRingFile(name string) (ring.Ring, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return ring.LoadRing(fp)
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gholt/ring"
+	synpb "github.com/pandemicsyn/syndicate/api/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// RingSource is where a Repl store gets its rings from once Startup is
+// called; see the RingSource config setting. The RingFile, RingURL, and ring
+// service settings each select one of the sources here, but any other means
+// of discovery can be plugged in by implementing this interface.
+type RingSource interface {
+	// Run passes each ring it obtains to the updater until the ctx is done,
+	// and then returns.
+	Run(ctx context.Context, updater RingUpdater)
+}
+
+// RingUpdater is given to RingSource.Run by the Repl store running it.
+type RingUpdater interface {
+	// Update applies the ring unless it is rejected, such as by
+	// ValidateRing, or is the version already in use. The source should log
+	// a rejection and carry on.
+	Update(r ring.Ring) error
+	// Reachable reports whether the source can reach wherever its rings
+	// come from; sources that cannot tell need not call it. Writes are
+	// refused with ErrRingStale once it has been false for RingStaleAfter.
+	Reachable(reachable bool)
+	// LogError and LogDebug log with the Repl store's loggers.
+	LogError(format string, args ...interface{})
+	LogDebug(format string, args ...interface{})
+}
+
+// StaticRingSource supplies just its Ring.
+type StaticRingSource struct {
+	Ring ring.Ring
+}
+
+func (s *StaticRingSource) Run(ctx context.Context, updater RingUpdater) {
+	if err := updater.Update(s.Ring); err != nil {
+		updater.LogError("static ring: %s", err)
+	}
+	<-ctx.Done()
+}
+
+// RingFileSource polls a ring file for changes, as for the RingFile config
+// setting. A file that fails to load, such as one only partially written,
+// will be tried again on the next poll.
+type RingFileSource struct {
+	Path         string
+	PollInterval time.Duration
+}
+
+func (s *RingFileSource) Run(ctx context.Context, updater RingUpdater) {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+	var modTime time.Time
+	var size int64
+	for {
+		if fi, err := os.Stat(s.Path); err != nil {
+			updater.LogDebug("error checking ring file %q: %s", s.Path, err)
+		} else if !fi.ModTime().Equal(modTime) || fi.Size() != size {
+			if r, err := loadRingFile(s.Path); err != nil {
+				updater.LogError("error loading ring file %q: %s", s.Path, err)
+			} else {
+				modTime = fi.ModTime()
+				size = fi.Size()
+				if err := updater.Update(r); err != nil {
+					updater.LogError("ring file %q: %s", s.Path, err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RingURLSource polls a ring file served over HTTP(S), as for the RingURL
+// config setting.
+type RingURLSource struct {
+	URL          string
+	Client       *http.Client
+	PollInterval time.Duration
+}
+
+func (s *RingURLSource) Run(ctx context.Context, updater RingUpdater) {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+	f := &ringURLFetcher{url: s.URL, client: s.Client}
+	for {
+		if r, err := f.fetch(ctx); err != nil {
+			updater.LogError("error fetching ring %q: %s", s.URL, err)
+		} else if r != nil {
+			if err := updater.Update(r); err != nil {
+				updater.LogError("ring url %q: %s", s.URL, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyndicateRingSource subscribes to the ring stream of a ring service, the
+// default source. Dial connects to the ring service, returning the
+// connection and the address it is for; it is called again for every
+// reconnection. If Recheck is set, it is called every RecheckInterval while
+// connected, and the connection is dropped and Dial called again at once if
+// it returns false for the address connected to.
+type SyndicateRingSource struct {
+	Dial            func() (*grpc.ClientConn, string, error)
+	ClientID        string
+	Recheck         func(addr string) bool
+	RecheckInterval time.Duration
+}
+
+func (s *SyndicateRingSource) Run(ctx context.Context, updater RingUpdater) {
+	sleeperTicks := 2
+	sleeperTicker := time.NewTicker(time.Second)
+	defer sleeperTicker.Stop()
+	// sleeper returns false if the ctx is done and the source should exit.
+	sleeper := func() bool {
+		for i := sleeperTicks; i > 0; i-- {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-sleeperTicker.C:
+			}
+		}
+		if sleeperTicks < 60 {
+			sleeperTicks *= 2
+		}
+		return true
+	}
+	for ctx.Err() == nil {
+		conn, ringServer, err := s.Dial()
+		if err != nil {
+			updater.Reachable(false)
+			updater.LogError("%s", err)
+			sleeper()
+			continue
+		}
+		// The stream's context is canceled when the ctx is, which unblocks
+		// Recv. If nothing arrives for fifteen minutes, we assume the stream
+		// has gone stale and cancel it too, looping around to try a new
+		// conn.
+		streamCtx, streamCancel := context.WithCancel(ctx)
+		idle := time.AfterFunc(15*time.Minute, streamCancel)
+		stream, err := synpb.NewSyndicateClient(conn).GetRingStream(streamCtx, &synpb.SubscriberID{Id: s.ClientID})
+		if err != nil {
+			idle.Stop()
+			streamCancel()
+			conn.Close()
+			updater.Reachable(false)
+			updater.LogError("error creating stream with ring service %q: %s", ringServer, err)
+			sleeper()
+			continue
+		}
+		updater.Reachable(true)
+		// moved is only read after stopRecheck, which waits for the check.
+		moved := false
+		stopRecheck := s.recheck(ringServer, func() {
+			moved = true
+			updater.LogError("ring service %q no longer listed; reconnecting", ringServer)
+			streamCancel()
+		})
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				updater.LogDebug("error with stream to ring service %q: %s", ringServer, err)
+				break
+			}
+			idle.Reset(15 * time.Minute)
+			if res != nil {
+				if r, err := ring.LoadRing(bytes.NewBuffer(res.Ring)); err != nil {
+					updater.LogDebug("error with ring received from stream to ring service %q: %s", ringServer, err)
+				} else {
+					if err := updater.Update(r); err != nil {
+						updater.LogError("ring from stream to ring service %q: %s", ringServer, err)
+					}
+					// Resets the exponential sleeper since we had success.
+					sleeperTicks = 2
+				}
+			}
+		}
+		stopRecheck()
+		updater.Reachable(false)
+		idle.Stop()
+		streamCancel()
+		conn.Close()
+		if !moved {
+			sleeper()
+		}
+	}
+}
+
+// recheck calls moved if Recheck returns false for addr, checking every
+// RecheckInterval until the func returned is called, which waits for any
+// check in progress.
+func (s *SyndicateRingSource) recheck(addr string, moved func()) func() {
+	if s.Recheck == nil || s.RecheckInterval <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.RecheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if !s.Recheck(addr) {
+				moved()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
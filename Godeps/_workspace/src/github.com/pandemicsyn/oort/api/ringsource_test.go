@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	synpb "github.com/pandemicsyn/syndicate/api/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeSyndicate sends its ring to each subscriber, reporting the
+// subscription on subscribed and, if set, its metadata on metadata.
+type fakeSyndicate struct {
+	synpb.SyndicateServer
+	name       string
+	ring       []byte
+	subscribed chan string
+	metadata   chan metadata.MD
+}
+
+func (s *fakeSyndicate) GetRingStream(id *synpb.SubscriberID, stream synpb.Syndicate_GetRingStreamServer) error {
+	s.subscribed <- s.name
+	if s.metadata != nil {
+		md, _ := metadata.FromContext(stream.Context())
+		s.metadata <- md
+	}
+	if err := stream.Send(&synpb.Ring{Ring: s.ring}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func TestSyndicateRingSourceRecheck(t *testing.T) {
+	r, _ := localRing(1, 0)
+	var buf bytes.Buffer
+	if err := r.Persist(&buf); err != nil {
+		t.Fatal(err)
+	}
+	subscribed := make(chan string, 10)
+	var addrs []string
+	for _, name := range []string{"old", "new"} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := grpc.NewServer()
+		synpb.RegisterSyndicateServer(g, &fakeSyndicate{name: name, ring: buf.Bytes(), subscribed: subscribed})
+		go g.Serve(l)
+		defer g.Stop()
+		addrs = append(addrs, l.Addr().String())
+	}
+	dials := 0
+	src := &SyndicateRingSource{
+		Dial: func() (*grpc.ClientConn, string, error) {
+			addr := addrs[1]
+			if dials == 0 {
+				addr = addrs[0]
+			}
+			dials++
+			conn, err := grpc.Dial(addr, grpc.WithInsecure())
+			return conn, addr, err
+		},
+		Recheck: func(addr string) bool {
+			return addr != addrs[0]
+		},
+		RecheckInterval: 10 * time.Millisecond,
+	}
+	rs := NewReplGroupStore(&ReplGroupStoreConfig{ReplStoreConfig: ReplStoreConfig{RingSource: src, LogError: func(string, ...interface{}) {}}})
+	ctx := context.Background()
+	rs.Startup(ctx)
+	defer rs.Shutdown(ctx)
+	for _, want := range []string{"old", "new"} {
+		select {
+		case got := <-subscribed:
+			if got != want {
+				t.Fatalf("expected a subscription to %s, got %s", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no subscription to %s", want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRingStale(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{RingStaleAfter: 50 * time.Millisecond}})
+	ctx := context.Background()
+	updater := &replValueRingUpdater{rs: rs}
+	check := func(want error) {
+		if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != want {
+			t.Fatalf("expected Write error %v, got %v", want, err)
+		}
+		if _, err := rs.Delete(ctx, 1, 2, 4); err != want {
+			t.Fatalf("expected Delete error %v, got %v", want, err)
+		}
+		// Reads carry on regardless.
+		if _, _, err := rs.Read(ctx, 1, 2, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(nil)
+	// Unreachable from the start, the ring is as fresh as when it was set.
+	updater.Reachable(false)
+	check(nil)
+	time.Sleep(80 * time.Millisecond)
+	check(ErrRingStale)
+	// A new ring counts as contact.
+	r, _ := localRing(3, 0)
+	if err := updater.Update(r); err != nil {
+		t.Fatal(err)
+	}
+	check(nil)
+	time.Sleep(80 * time.Millisecond)
+	check(ErrRingStale)
+	// As does the ring service being reachable again, for as long as it is.
+	updater.Reachable(true)
+	time.Sleep(80 * time.Millisecond)
+	check(nil)
+}
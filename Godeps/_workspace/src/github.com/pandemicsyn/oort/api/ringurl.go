@@ -0,0 +1,60 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gholt/ring"
+	"golang.org/x/net/context"
+)
+
+// ringURLFetcher fetches a ring file over HTTP(S), using the ETag and
+// Last-Modified of the previous response so an unchanged ring is not
+// downloaded again.
+type ringURLFetcher struct {
+	url          string
+	client       *http.Client
+	etag         string
+	lastModified string
+}
+
+// fetch returns the ring at the URL, or nil if it has not changed since the
+// last fetch.
+func (f *ringURLFetcher) fetch(ctx context.Context) (ring.Ring, error) {
+	req, err := http.NewRequest("GET", f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	req.Cancel = ctx.Done()
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ring.LoadRing(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	return r, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRingURLFetcher(t *testing.T) {
+	var lock sync.Mutex
+	var ring []byte
+	var etag string
+	var headers []http.Header
+	modified := time.Unix(1e9, 0).UTC().Format(http.TimeFormat)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		headers = append(headers, req.Header)
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified)
+		w.Write(ring)
+	}))
+	defer srv.Close()
+	serve := func(tag string) int64 {
+		r, _ := localRing(3, 0)
+		var buf bytes.Buffer
+		if err := r.Persist(&buf); err != nil {
+			t.Fatal(err)
+		}
+		lock.Lock()
+		ring, etag = buf.Bytes(), tag
+		lock.Unlock()
+		return r.Version()
+	}
+	f := &ringURLFetcher{url: srv.URL, client: http.DefaultClient}
+	ctx := context.Background()
+	version := serve(`"1"`)
+	if r, err := f.fetch(ctx); err != nil || r == nil || r.Version() != version {
+		t.Fatalf("expected ring %d, got %v %v", version, r, err)
+	}
+	// The next request is conditional, and not modified gives no ring.
+	if r, err := f.fetch(ctx); err != nil || r != nil {
+		t.Fatalf("expected no ring, got %v %v", r, err)
+	}
+	lock.Lock()
+	if len(headers) != 2 || headers[0].Get("If-None-Match") != "" || headers[1].Get("If-None-Match") != `"1"` || headers[1].Get("If-Modified-Since") != modified {
+		t.Fatalf("unexpected request headers %v", headers)
+	}
+	lock.Unlock()
+	version = serve(`"2"`)
+	if r, err := f.fetch(ctx); err != nil || r == nil || r.Version() != version {
+		t.Fatalf("expected ring %d, got %v %v", version, r, err)
+	}
+	lock.Lock()
+	ring = []byte("not a ring")
+	etag = `"3"`
+	lock.Unlock()
+	if _, err := f.fetch(ctx); err == nil {
+		t.Fatal("expected an error for a bad ring")
+	}
+}
+
+func TestRingURLFetcherStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	f := &ringURLFetcher{url: srv.URL, client: http.DefaultClient}
+	if _, err := f.fetch(context.Background()); err == nil {
+		t.Fatal("expected an error for a 404")
+	}
+}
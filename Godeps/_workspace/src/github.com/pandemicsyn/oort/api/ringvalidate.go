@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gholt/ring"
+)
+
+// MaxRingChurn returns a func for the ValidateRing config setting that
+// rejects a new ring if more than the fraction, 0 to 1, of the old ring's
+// nodes are gone from it or more than the fraction of its nodes are new.
+// Such large changes are more likely operator error than a planned change.
+func MaxRingChurn(fraction float64) func(oldRing, newRing ring.Ring) error {
+	return func(oldRing, newRing ring.Ring) error {
+		oldIDs := make(map[uint64]struct{})
+		for _, n := range oldRing.Nodes() {
+			oldIDs[n.ID()] = struct{}{}
+		}
+		newNodes := newRing.Nodes()
+		var added int
+		for _, n := range newNodes {
+			if _, ok := oldIDs[n.ID()]; ok {
+				delete(oldIDs, n.ID())
+			} else {
+				added++
+			}
+		}
+		removed := len(oldIDs)
+		if oldCount := len(oldRing.Nodes()); oldCount > 0 && float64(removed)/float64(oldCount) > fraction {
+			return fmt.Errorf("%d of %d nodes removed", removed, oldCount)
+		}
+		if len(newNodes) > 0 && float64(added)/float64(len(newNodes)) > fraction {
+			return fmt.Errorf("%d of %d nodes added", added, len(newNodes))
+		}
+		return nil
+	}
+}
+
+type ringRejectedError struct {
+	version int64
+	err     error
+}
+
+func (e *ringRejectedError) Error() string {
+	return fmt.Sprintf("ring %d rejected: %s", e.version, e.err)
+}
+
+func (e *ringRejectedError) Is(target error) bool {
+	return target == ErrRingRejected
+}
+
+func (e *ringRejectedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gholt/ring"
+)
+
+// churnTestBuilder returns a builder with n nodes, each a replica of every
+// partition, and their IDs.
+func churnTestBuilder(t *testing.T, n int) (*ring.Builder, []uint64) {
+	b := ring.NewBuilder(64)
+	b.SetReplicaCount(n)
+	ids := make([]uint64, n)
+	for i := range ids {
+		node, err := b.AddNode(true, 1, nil, []string{fmt.Sprintf("local%d", i)}, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = node.ID()
+	}
+	return b, ids
+}
+
+func TestMaxRingChurn(t *testing.T) {
+	b, ids := churnTestBuilder(t, 4)
+	old := b.Ring()
+	validate := MaxRingChurn(0.25)
+	if err := validate(old, old); err != nil {
+		t.Fatalf("expected the same ring to pass, got %s", err)
+	}
+	b.RemoveNode(ids[0])
+	if err := validate(old, b.Ring()); err != nil {
+		t.Fatalf("expected 1 of 4 nodes removed to pass, got %s", err)
+	}
+	b.RemoveNode(ids[1])
+	if err := validate(old, b.Ring()); err == nil {
+		t.Fatal("expected 2 of 4 nodes removed to fail")
+	}
+	b, _ = churnTestBuilder(t, 2)
+	old = b.Ring()
+	b.AddNode(true, 1, nil, []string{"local2"}, "", nil)
+	if err := validate(old, b.Ring()); err == nil {
+		t.Fatal("expected 1 of 3 nodes added to fail")
+	}
+}
+
+func TestValidateRing(t *testing.T) {
+	b, ids := churnTestBuilder(t, 4)
+	current := b.Ring()
+	b.RemoveNode(ids[0])
+	small := b.Ring()
+	b.RemoveNode(ids[1])
+	large := b.Ring()
+	rs := NewReplValueStore(&ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{ValidateRing: MaxRingChurn(0.25), LogError: func(string, ...interface{}) {}}})
+	rs.SetRing(current)
+	updater := &replValueRingUpdater{rs: rs}
+	// Too many nodes gone is rejected, keeping the ring in use.
+	if err := updater.Update(large); !errors.Is(err, ErrRingRejected) {
+		t.Fatalf("expected the ring rejected, got %v", err)
+	}
+	if v := rs.RingVersion(); v != current.Version() {
+		t.Fatalf("expected ring %d kept, got %d", current.Version(), v)
+	}
+	// A smaller change is applied.
+	if err := updater.Update(small); err != nil {
+		t.Fatal(err)
+	}
+	if v := rs.RingVersion(); v != small.Version() {
+		t.Fatalf("expected ring %d applied, got %d", small.Version(), v)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ScriptedResponse is a response a ScriptedValueStore or ScriptedGroupStore
+// gives to a call, so tests can feed a Repl store exact replica answers and
+// check how they are combined.
+type ScriptedResponse struct {
+	// TimestampMicro is the timestamp returned; for Write and Delete it is
+	// the old timestamp. With an ErrNotFound Err, a non-zero TimestampMicro
+	// is that of a deletion marker.
+	TimestampMicro int64
+	// Value is returned by Read; its length is returned by Lookup unless
+	// Length is set.
+	Value  []byte
+	Length uint32
+	// LookupGroupItems and ReadGroupItems are returned by LookupGroup and
+	// ReadGroup.
+	LookupGroupItems []store.LookupGroupItem
+	ReadGroupItems   []store.ReadGroupItem
+	// Err is the error returned, such as ErrNotFound.
+	Err error
+	// Delay is how long the call takes, to script the order responses
+	// arrive in or a replica that misses its deadline. If the call's ctx is
+	// done first, its error is returned instead.
+	Delay time.Duration
+}
+
+// ScriptedCall records a call made to a ScriptedValueStore or
+// ScriptedGroupStore. ChildKeyA and ChildKeyB are only set for the group
+// store, and TimestampMicro and Value only for the calls given them.
+type ScriptedCall struct {
+	Op             string
+	KeyA           uint64
+	KeyB           uint64
+	ChildKeyA      uint64
+	ChildKeyB      uint64
+	TimestampMicro int64
+	Value          []byte
+}
+
+// wait waits out the response's Delay, returning the ctx's error if it is
+// done first.
+func (r *ScriptedResponse) wait(ctx context.Context) error {
+	if r.Delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(r.Delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (r *ScriptedResponse) length() uint32 {
+	if r.Length != 0 {
+		return r.Length
+	}
+	return uint32(len(r.Value))
+}
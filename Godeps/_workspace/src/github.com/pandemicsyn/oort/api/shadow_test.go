@@ -0,0 +1,76 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+)
+
+// shadowOps returns the count of shadow ops with the result given.
+func shadowOps(t *testing.T, rs *ReplValueStore, result string) float64 {
+	m := &dto.Metric{}
+	if err := rs.metrics.shadowOps.WithLabelValues(result).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestShadowQueueFull(t *testing.T) {
+	shadow := &ScriptedValueStore{}
+	// The first op holds up the one shadower while the next fills the queue.
+	shadow.SetDefault(ScriptedResponse{Delay: 200 * time.Millisecond})
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ShadowStore: shadow, ReplStoreConfig: ReplStoreConfig{ShadowQueueSize: 1, ShadowConcurrency: 1}})
+	ctx := context.Background()
+	for i := int64(0); i < 4; i++ {
+		if _, err := rs.Write(ctx, 1, 2, 5+i, []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// Let the shadower take the first op off the queue.
+			for len(shadow.Calls()) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	if n := shadowOps(t, rs, "dropped"); n != 2 {
+		t.Fatalf("expected 2 ops dropped, got %v", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for shadowOps(t, rs, "ok") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 ops mirrored, got %v", shadowOps(t, rs, "ok"))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShadowShutdown(t *testing.T) {
+	shadow := &ScriptedValueStore{}
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ShadowStore: shadow})
+	ctx := context.Background()
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Shutdown waits for the shadowers, so the first op is either mirrored
+	// or dropped by then, and afterward ops are dropped.
+	calls := len(shadow.Calls())
+	if _, err := rs.Write(ctx, 1, 2, 6, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, dropped := shadowOps(t, rs, "ok"), shadowOps(t, rs, "dropped"); ok+dropped != 2 || dropped < 1 {
+		t.Fatalf("expected the op after Shutdown dropped, got %v mirrored and %v dropped", ok, dropped)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := len(shadow.Calls()); n != calls {
+		t.Fatalf("expected no more ops mirrored, got %d", n-calls)
+	}
+	// Shutdown can be called again.
+	if err := rs.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// srvResolver hands out the targets of a DNS SRV record in turn, resolving
+// the record again each time so a changed record takes effect at the next
+// connection. While the record lists the same targets, they are handed out
+// in the order first resolved, so each is tried before any is repeated. It
+// is not safe for concurrent use.
+type srvResolver struct {
+	name  string
+	addrs []string
+	next  int
+}
+
+func (r *srvResolver) target() (string, error) {
+	addrs, err := lookupSRVTargets(r.name)
+	if err != nil {
+		return "", err
+	}
+	if !sameAddrs(addrs, r.addrs) {
+		r.addrs = addrs
+		r.next = 0
+	}
+	addr := r.addrs[r.next%len(r.addrs)]
+	r.next++
+	return addr, nil
+}
+
+// lookupSRVTargets returns the host:port targets of the SRV record.
+func lookupSRVTargets(name string) ([]string, error) {
+	_, srvs, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(srvs) == 0 {
+		return nil, fmt.Errorf("SRV lookup of %q is empty", name)
+	}
+	addrs := make([]string, len(srvs))
+	for i, srv := range srvs {
+		addrs[i] = fmt.Sprintf("%s:%d", srv.Target, srv.Port)
+	}
+	return addrs, nil
+}
+
+// sameAddrs returns true if a and b hold the same addresses in any order.
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string(nil), a...)
+	sb := append([]string(nil), b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAddr returns true if addr is one of addrs.
+func containsAddr(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
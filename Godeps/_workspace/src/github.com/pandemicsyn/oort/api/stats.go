@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ReplStoreStats is returned by the Stats method of the Repl stores.
+type ReplStoreStats struct {
+	// Requests, NotFounds, and Errors count the Lookups, Reads, Writes, and
+	// Deletes made through the client, and those that ended not found or
+	// with some other error.
+	Requests  uint64
+	NotFounds uint64
+	Errors    uint64
+	// Latencies is the moving average response latency of each backend
+	// store the client has made requests to, as used to prefer faster
+	// replicas for reads.
+	Latencies map[string]time.Duration
+	// RepairQueueDepth is the number of keys waiting for background repair.
+	RepairQueueDepth int
+	// Backoffs holds the reconnect backoff state of each backend store
+	// address whose connection has failed and not yet been reestablished.
+	Backoffs map[string]ReplStoreBackoff
+	// Backends holds the Stats returned by each connected backend store.
+	Backends map[string]fmt.Stringer
+	// BackendErrors holds the errors from backend stores that could not
+	// return their Stats.
+	BackendErrors map[string]error
+}
+
+func (s *ReplStoreStats) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "requests: %d\n", s.Requests)
+	fmt.Fprintf(buf, "notFounds: %d\n", s.NotFounds)
+	fmt.Fprintf(buf, "errors: %d\n", s.Errors)
+	fmt.Fprintf(buf, "repairQueueDepth: %d\n", s.RepairQueueDepth)
+	addrs := make([]string, 0, len(s.Latencies))
+	for addr := range s.Latencies {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	fmt.Fprintf(buf, "latencies:\n")
+	for _, addr := range addrs {
+		fmt.Fprintf(buf, "  %s %s\n", addr, s.Latencies[addr])
+	}
+	addrs = addrs[:0]
+	for addr := range s.Backoffs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	fmt.Fprintf(buf, "backoffs:\n")
+	for _, addr := range addrs {
+		b := s.Backoffs[addr]
+		fmt.Fprintf(buf, "  %s failures=%d delay=%s retryAt=%s\n", addr, b.Failures, b.Delay, b.RetryAt.Format(time.RFC3339Nano))
+	}
+	addrs = addrs[:0]
+	for addr := range s.Backends {
+		addrs = append(addrs, addr)
+	}
+	for addr := range s.BackendErrors {
+		if _, ok := s.Backends[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	fmt.Fprintf(buf, "backends:\n")
+	for _, addr := range addrs {
+		if err := s.BackendErrors[addr]; err != nil {
+			fmt.Fprintf(buf, "  %s: error: %s\n", addr, err)
+			continue
+		}
+		fmt.Fprintf(buf, "  %s:\n", addr)
+		for _, line := range bytes.Split(bytes.TrimRight([]byte(s.Backends[addr].String()), "\n"), []byte("\n")) {
+			fmt.Fprintf(buf, "    %s\n", line)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/binary"
+
+	"github.com/spaolacci/murmur3"
+)
+
+const streamManifestLen = 16
+
+// streamManifest describes the chunks of a value written by WriteStream, or
+// split with SplitLargeValues; its frame is marked with frameStreamManifest
+// or frameSplitManifest to tell which, and to tell it from a plain value.
+type streamManifest struct {
+	chunkSize  uint32
+	chunkCount uint32
+	length     uint64
+}
+
+func (m *streamManifest) encode() []byte {
+	b := make([]byte, streamManifestLen)
+	binary.BigEndian.PutUint32(b, m.chunkSize)
+	binary.BigEndian.PutUint32(b[4:], m.chunkCount)
+	binary.BigEndian.PutUint64(b[8:], m.length)
+	return b
+}
+
+// decodeStreamManifest returns nil if the value is not the length of a
+// manifest.
+func decodeStreamManifest(b []byte) *streamManifest {
+	if len(b) != streamManifestLen {
+		return nil
+	}
+	return &streamManifest{
+		chunkSize:  binary.BigEndian.Uint32(b),
+		chunkCount: binary.BigEndian.Uint32(b[4:]),
+		length:     binary.BigEndian.Uint64(b[8:]),
+	}
+}
+
+// streamChunkKey returns the key the chunk at index is stored under for the
+// value identified by the keys given. Value stores just pass zeros for the
+// child keys.
+func streamChunkKey(keyA, keyB, childKeyA, childKeyB uint64, index uint32) (uint64, uint64) {
+	b := make([]byte, 36)
+	binary.BigEndian.PutUint64(b, keyA)
+	binary.BigEndian.PutUint64(b[8:], keyB)
+	binary.BigEndian.PutUint64(b[16:], childKeyA)
+	binary.BigEndian.PutUint64(b[24:], childKeyB)
+	binary.BigEndian.PutUint32(b[32:], index)
+	return murmur3.Sum128(b)
+}
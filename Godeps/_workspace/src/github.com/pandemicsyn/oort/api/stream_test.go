@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	rs, ms := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{StreamChunkSize: 4, FramedValues: true}})
+	ctx := context.Background()
+	data := []byte("hello stream world")
+	if _, err := rs.WriteStream(ctx, 1, 2, 5, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	_, raw, err := ms[0].Read(ctx, 1, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, m, err := parseFrame(raw); err != nil || h.flags != frameStreamManifest || len(m) != streamManifestLen {
+		t.Fatalf("expected a stream manifest stored, got %q %v", raw, err)
+	}
+	var buf bytes.Buffer
+	if ts, err := rs.ReadStream(ctx, 1, 2, &buf); err != nil || ts != 5 || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("expected %q at 5, got %q at %d %v", data, buf.Bytes(), ts, err)
+	}
+	// A plain Read returns the manifest itself.
+	if _, v, err := rs.Read(ctx, 1, 2, nil); err != nil || len(v) != streamManifestLen {
+		t.Fatalf("expected the manifest, got %q %v", v, err)
+	}
+	if _, err := rs.DeleteStream(ctx, 1, 2, 6); err != nil {
+		t.Fatal(err)
+	}
+	keys := rs.streamChunkKeys(1, 2, 5)
+	for _, k := range keys {
+		if _, _, err := ms[0].Read(ctx, k.KeyA, k.KeyB, nil); !store.IsNotFound(err) {
+			t.Fatalf("expected the chunks deleted, got %v", err)
+		}
+	}
+}
+
+func TestStreamValueLooksLikeManifest(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{StreamChunkSize: 4, FramedValues: true}})
+	ctx := context.Background()
+	manifest := (&streamManifest{chunkSize: 4, chunkCount: 2, length: 8}).encode()
+	for i, value := range [][]byte{
+		manifest,
+		append([]byte("OORTSTRM"), manifest...),
+	} {
+		keyA := uint64(i + 1)
+		if _, err := rs.Write(ctx, keyA, 2, 5, value); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if _, err := rs.ReadStream(ctx, keyA, 2, &buf); err != nil || !bytes.Equal(buf.Bytes(), value) {
+			t.Fatalf("expected %q as is, got %q %v", value, buf.Bytes(), err)
+		}
+		if _, err := rs.DeleteStream(ctx, keyA, 2, 6); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamRequiresFraming(t *testing.T) {
+	rs, _ := NewMemReplValueStore(3, nil)
+	ctx := context.Background()
+	if _, err := rs.WriteStream(ctx, 1, 2, 5, bytes.NewReader([]byte("hello"))); err == nil {
+		t.Fatal("expected WriteStream to fail without FramedValues")
+	}
+	if _, err := rs.ReadStream(ctx, 1, 2, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected ReadStream to fail without FramedValues")
+	}
+	if _, err := rs.DeleteStream(ctx, 1, 2, 5); err == nil {
+		t.Fatal("expected DeleteStream to fail without FramedValues")
+	}
+}
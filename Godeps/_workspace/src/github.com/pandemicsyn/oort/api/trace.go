@@ -0,0 +1,58 @@
+package api
+
+import "golang.org/x/net/context"
+
+// Tracer is an optional hook for tracing the work done by the Repl stores,
+// such as with OpenTelemetry. Spans are started around each Lookup, Read,
+// Write, and Delete, the ring lookup for the key (storesFor), each request to
+// a backend store, and each ring update. StartSpan should start a span as a
+// child of any span already in ctx and return a ctx carrying the new span;
+// that ctx is passed on to the backend store requests so any gRPC tracing
+// interceptors see it too.
+//
+// An OpenTelemetry adapter need only wrap a trace.Tracer's Start, calling
+// SetAttributes from SetAttribute, and RecordError, SetStatus, and End from
+// End.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	// SetAttribute annotates the span, such as with the backend store
+	// address or the ring version.
+	SetAttribute(key string, value interface{})
+	// End finishes the span, with the error the operation ended with, if
+	// any.
+	End(err error)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+func (noopSpan) End(err error) {}
+
+type spanKey struct{}
+
+// withSpan returns a copy of the ctx carrying the span of the operation in
+// progress, for spanFrom.
+func withSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// spanFrom returns the span set with withSpan, or a span that does nothing
+// if there is none.
+func spanFrom(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+func startSpan(t Tracer, ctx context.Context, name string) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.StartSpan(ctx, name)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type expiresMicroKey struct{}
+
+// withExpiry returns a context for writing a value that expires at the Unix
+// time in microseconds given; the expiry is kept in the value's frame header.
+func withExpiry(ctx context.Context, expiresMicro int64) context.Context {
+	return context.WithValue(ctx, expiresMicroKey{}, expiresMicro)
+}
+
+// expiryFrom returns the expiry set with withExpiry, or 0 if there is none.
+func expiryFrom(ctx context.Context) int64 {
+	expiresMicro, _ := ctx.Value(expiresMicroKey{}).(int64)
+	return expiresMicro
+}
+
+func nowMicro() int64 {
+	return time.Now().UnixNano() / int64(time.Microsecond)
+}
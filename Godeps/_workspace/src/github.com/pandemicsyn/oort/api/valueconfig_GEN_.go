@@ -5,57 +5,39 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net/http"
 	"time"
 
-	"github.com/pandemicsyn/ftls"
-	"google.golang.org/grpc"
+	"github.com/gholt/store"
 )
 
 // ReplValueStoreConfig defines the settings when calling NewValueStore.
 type ReplValueStoreConfig struct {
-	// LogError sets the func to use for error messages. Defaults to stderr.
-	LogError func(fmt string, args ...interface{})
-	// LogDebug sets the func to use for debug messages. Defaults to not
-	// logging debug messages.
-	LogDebug func(fmt string, args ...interface{})
-	// AddressIndex indicates which of the ring node addresses to use when
-	// connecting to a node (see github.com/gholt/ring/Node.Address).
-	AddressIndex int
-	// ValueCap defines the maximum value size supported by the set of stores.
-	// This defaults to 0xffffffff, or math.MaxUint32. In order to discover the
-	// true value cap, all stores would have to be queried and then the lowest
-	// cap used. However, that's probably not really necessary and configuring
-	// a set value cap here is probably fine.
-	ValueCap uint32
-	// ConcurrentRequestsPerStore defines the concurrent requests per
-	// underlying connected store. Default: 10
-	ConcurrentRequestsPerStore int
-	// FailedConnectRetryDelay defines how many seconds must pass before
-	// retrying a failed connection. Default: 15 seconds
-	FailedConnectRetryDelay int
-	// StoreFTLSConfig is the ftls config you want use to build a tls.Config for
-	// each grpc client used to communicate to the Store.
-	StoreFTLSConfig *ftls.Config
-	// GRPCOpts are any additional reusable options you'd like to pass to GRPC
-	// when connecting to stores.
-	GRPCOpts []grpc.DialOption
-	// RingServer is the network address to use to connect to a ring server. An
-	// empty string will use the default DNS method of determining the ring
-	// server location.
-	RingServer string
-	// RingServerGRPCOpts are any additional options you'd like to pass to GRPC
-	// when connecting to the ring server.
-	RingServerGRPCOpts []grpc.DialOption
-	// RingClientID is a unique identifier for this client, used when
-	// registering with the RingServer. This allows the ring server to
-	// proactively clean up stale connections should a reconnection be needed.
-	RingClientID string
-	// RingCachePath is the full location file name where you'd like persist
-	// last received ring data, such as "/var/lib/myprog/ring/valuestore.ring".
-	// An empty string will disable caching. The cacher will need permission to
-	// create a new file with the path given plus a temporary suffix, and will
-	// then move that temporary file into place using the exact path given.
-	RingCachePath string
+	// ReplStoreConfig holds the settings both kinds of store share.
+	ReplStoreConfig
+	// WrapStore, if set, is given each backend store as it is created and
+	// the store it returns is used instead, such as a FaultValueStore for
+	// testing how failing replicas are handled.
+	WrapStore func(addr string, s store.ValueStore) store.ValueStore
+	// Middleware wraps each Lookup, Read, Write, and Delete, including each
+	// item of a WriteBatch or WriteAll, the first given being the
+	// outermost; see ValueMiddleware.
+	Middleware []ValueMiddleware
+	// ShadowStore, if set, has every successful Write and Delete mirrored to
+	// it asynchronously, such as to warm up a second cluster, using its own
+	// ring, for a migration or disaster recovery. Mirrored values are as
+	// given to Write, before any compression or encryption configured here.
+	// Mirroring never slows the primary store: if the queue is full the
+	// mirror is dropped. The ShadowOps and ShadowSeconds metrics report
+	// results and latency. Default: nil
+	ShadowStore store.ValueStore
+}
+
+// GroupConfig returns a ReplGroupStoreConfig with the same ReplStoreConfig
+// settings as c, for configuring both kinds of store alike. The settings
+// specific to one kind of store, such as WrapStore, are left unset.
+func (c *ReplValueStoreConfig) GroupConfig() *ReplGroupStoreConfig {
+	return &ReplGroupStoreConfig{ReplStoreConfig: c.ReplStoreConfig}
 }
 
 func resolveReplValueStoreConfig(c *ReplValueStoreConfig) *ReplValueStoreConfig {
@@ -66,18 +48,109 @@ func resolveReplValueStoreConfig(c *ReplValueStoreConfig) *ReplValueStoreConfig
 	if cfg.ValueCap == 0 {
 		cfg.ValueCap = 0xffffffff
 	}
+	if cfg.FallbackReplicas < 1 {
+		cfg.FallbackReplicas = 3
+	}
+	if cfg.FallbackDelay <= 0 {
+		cfg.FallbackDelay = 5 * time.Second
+	}
+	if cfg.ReplicaSelector == nil {
+		cfg.ReplicaSelector = &RingReplicaSelector{AddressIndex: cfg.AddressIndex}
+	}
+	if cfg.StreamChunkSize == 0 {
+		cfg.StreamChunkSize = 1048576
+	}
+	if cfg.StreamChunkSize > cfg.ValueCap {
+		cfg.StreamChunkSize = cfg.ValueCap
+	}
 	if cfg.ConcurrentRequestsPerStore == 0 {
 		cfg.ConcurrentRequestsPerStore = 10
 	}
 	if cfg.ConcurrentRequestsPerStore < 1 {
 		cfg.ConcurrentRequestsPerStore = 1
 	}
+	if cfg.ConnectionsPerStore < 1 {
+		cfg.ConnectionsPerStore = 1
+	}
+	if cfg.HighPriorityRequestsPerStore == 0 {
+		cfg.HighPriorityRequestsPerStore = cfg.ConcurrentRequestsPerStore / 4
+	}
+	if cfg.HighPriorityRequestsPerStore < 1 {
+		cfg.HighPriorityRequestsPerStore = 1
+	}
 	if cfg.FailedConnectRetryDelay == 0 {
 		cfg.FailedConnectRetryDelay = 15
 	}
 	if cfg.FailedConnectRetryDelay < 1 {
 		cfg.FailedConnectRetryDelay = 1
 	}
+	if cfg.ReconnectBackoffInitial <= 0 {
+		cfg.ReconnectBackoffInitial = 250 * time.Millisecond
+	}
+	if cfg.ReconnectBackoffMax <= 0 {
+		cfg.ReconnectBackoffMax = time.Duration(cfg.FailedConnectRetryDelay) * time.Second
+	}
+	if cfg.ReconnectBackoffMax < cfg.ReconnectBackoffInitial {
+		cfg.ReconnectBackoffMax = cfg.ReconnectBackoffInitial
+	}
+	if cfg.StoreDrainTimeout == 0 {
+		cfg.StoreDrainTimeout = 30
+	}
+	if cfg.StoreDrainTimeout < 0 {
+		cfg.StoreDrainTimeout = 0
+	}
+	if cfg.DefaultRequestTimeout < 0 {
+		cfg.DefaultRequestTimeout = 0
+	}
+	if cfg.DefaultConnectTimeout < 0 {
+		cfg.DefaultConnectTimeout = 0
+	}
+	if cfg.RepairQueueSize < 0 {
+		cfg.RepairQueueSize = 0
+	}
+	if cfg.RepairRate < 1 {
+		cfg.RepairRate = 100
+	}
+	if cfg.ReadReplicas < 0 {
+		cfg.ReadReplicas = 0
+	}
+	if cfg.ReadHedgeDelay < 0 {
+		cfg.ReadHedgeDelay = 0
+	}
+	if cfg.ReadHedgeDelay == 0 && cfg.ReadStrategy == ReadHedged {
+		cfg.ReadHedgeDelay = defaultReadHedgeDelay
+	}
+	if cfg.ReadPartialMargin < 0 {
+		cfg.ReadPartialMargin = 0
+	}
+	if cfg.ReadCacheTTL <= 0 {
+		cfg.ReadCacheTTL = 5 * time.Second
+	}
+	if cfg.NotFoundCacheTTL <= 0 {
+		cfg.NotFoundCacheTTL = time.Second
+	}
+	if cfg.RingURLClient == nil {
+		cfg.RingURLClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.RingFilePollInterval == 0 {
+		cfg.RingFilePollInterval = 5
+	}
+	if cfg.RingFilePollInterval < 1 {
+		cfg.RingFilePollInterval = 1
+	}
+	if cfg.ShadowQueueSize < 1 {
+		cfg.ShadowQueueSize = 1000
+	}
+	if cfg.ShadowConcurrency < 1 {
+		cfg.ShadowConcurrency = 10
+	}
+	if cfg.CompressMinSize == 0 {
+		cfg.CompressMinSize = 1024
+	}
+	cfg.RetryPolicy = resolveRetryPolicy(cfg.RetryPolicy)
+	if cfg.HintedHandoffMaxBytes < 0 {
+		cfg.HintedHandoffMaxBytes = 0
+	}
 	if cfg.RingClientID == "" {
 		// Try to generate a random UUID according to RFC 4122.
 		uuid := make([]byte, 16)
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// FaultValueStore wraps a store.ValueStore, injecting errors and latency
+// into its calls as set with SetFaults. Giving each replica of a
+// ReplValueStore its own, with the WrapStore config setting, lets tests
+// check how an application copes with failing and slow nodes.
+type FaultValueStore struct {
+	// Store is the store calls are passed along to.
+	Store  store.ValueStore
+	lock   sync.RWMutex
+	faults Faults
+}
+
+// NewFaultValueStore returns a FaultValueStore wrapping s that injects
+// nothing until SetFaults is called.
+func NewFaultValueStore(s store.ValueStore) *FaultValueStore {
+	return &FaultValueStore{Store: s}
+}
+
+// SetFaults replaces the faults injected; it is safe to call while the store
+// is in use.
+func (fs *FaultValueStore) SetFaults(f Faults) {
+	fs.lock.Lock()
+	fs.faults = f
+	fs.lock.Unlock()
+}
+
+func (fs *FaultValueStore) Startup(ctx context.Context) error {
+	return fs.Store.Startup(ctx)
+}
+
+func (fs *FaultValueStore) Shutdown(ctx context.Context) error {
+	return fs.Store.Shutdown(ctx)
+}
+
+func (fs *FaultValueStore) EnableWrites(ctx context.Context) error {
+	return fs.Store.EnableWrites(ctx)
+}
+
+func (fs *FaultValueStore) DisableWrites(ctx context.Context) error {
+	return fs.Store.DisableWrites(ctx)
+}
+
+func (fs *FaultValueStore) Flush(ctx context.Context) error {
+	return fs.Store.Flush(ctx)
+}
+
+func (fs *FaultValueStore) AuditPass(ctx context.Context) error {
+	return fs.Store.AuditPass(ctx)
+}
+
+func (fs *FaultValueStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	return fs.Store.Stats(ctx, debug)
+}
+
+func (fs *FaultValueStore) ValueCap(ctx context.Context) (uint32, error) {
+	return fs.Store.ValueCap(ctx)
+}
+
+// Faults returns the faults being injected.
+func (fs *FaultValueStore) Faults() Faults {
+	fs.lock.RLock()
+	f := fs.faults
+	fs.lock.RUnlock()
+	return f
+}
+
+func (fs *FaultValueStore) Lookup(ctx context.Context, keyA uint64, keyB uint64) (int64, uint32, error) {
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return 0, 0, err
+	}
+	return fs.Store.Lookup(ctx, keyA, keyB)
+}
+
+func (fs *FaultValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
+	f := fs.Faults()
+	if err := f.inject(ctx, FaultReads); err != nil {
+		return 0, value, err
+	}
+	return fs.Store.Read(ctx, keyA, keyB, value)
+}
+
+func (fs *FaultValueStore) Write(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	f := fs.Faults()
+	if !f.FailAfter {
+		if err := f.inject(ctx, FaultWrites); err != nil {
+			return 0, err
+		}
+		return fs.Store.Write(ctx, keyA, keyB, timestampMicro, value)
+	}
+	oldTimestampMicro, err := fs.Store.Write(ctx, keyA, keyB, timestampMicro, value)
+	if ierr := f.inject(ctx, FaultWrites); ierr != nil {
+		return 0, ierr
+	}
+	return oldTimestampMicro, err
+}
+
+func (fs *FaultValueStore) Delete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
+	f := fs.Faults()
+	if !f.FailAfter {
+		if err := f.inject(ctx, FaultWrites); err != nil {
+			return 0, err
+		}
+		return fs.Store.Delete(ctx, keyA, keyB, timestampMicro)
+	}
+	oldTimestampMicro, err := fs.Store.Delete(ctx, keyA, keyB, timestampMicro)
+	if ierr := f.inject(ctx, FaultWrites); ierr != nil {
+		return 0, ierr
+	}
+	return oldTimestampMicro, err
+}
+
+// NewFaultMemReplValueStore is NewMemReplValueStore with each in-memory
+// replica wrapped in a FaultValueStore, returned in the same order, for
+// setting the faults of each replica. Any WrapStore in c is applied outside
+// the fault stores.
+func NewFaultMemReplValueStore(replicas int, c *ReplValueStoreConfig) (*ReplValueStore, []*FaultValueStore) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	fss := make([]*FaultValueStore, replicas)
+	ss := make([]store.ValueStore, replicas)
+	for i := range fss {
+		fss[i] = NewFaultValueStore(&MemValueStore{})
+		ss[i] = fss[i]
+	}
+	return newLocalReplValueStore(ss, c), fss
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// MemValueStore is a store.ValueStore held entirely in memory, for
+// application tests that would otherwise need a running oort cluster. It
+// follows the timestamp rules of a real store: a write or delete only takes
+// effect if newer than what is held, and a delete wins a tie with a write.
+// The zero value is ready to use.
+type MemValueStore struct {
+	lock           sync.RWMutex
+	items          map[replValueCacheKey]*memValueItem
+	writesDisabled bool
+}
+
+type memValueItem struct {
+	timestampMicro int64
+	value          []byte
+	deleted        bool
+}
+
+type memValueStoreStats struct {
+	items      int
+	tombstones int
+}
+
+func (s *memValueStoreStats) String() string {
+	return fmt.Sprintf("items %d tombstones %d", s.items, s.tombstones)
+}
+
+func (s *MemValueStore) Startup(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemValueStore) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemValueStore) EnableWrites(ctx context.Context) error {
+	s.lock.Lock()
+	s.writesDisabled = false
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemValueStore) DisableWrites(ctx context.Context) error {
+	s.lock.Lock()
+	s.writesDisabled = true
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemValueStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemValueStore) AuditPass(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemValueStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	stats := &memValueStoreStats{}
+	s.lock.RLock()
+	for _, item := range s.items {
+		if item.deleted {
+			stats.tombstones++
+		} else {
+			stats.items++
+		}
+	}
+	s.lock.RUnlock()
+	return stats, nil
+}
+
+func (s *MemValueStore) ValueCap(ctx context.Context) (uint32, error) {
+	return math.MaxUint32, nil
+}
+
+func (s *MemValueStore) Lookup(ctx context.Context, keyA uint64, keyB uint64) (int64, uint32, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	item := s.items[replValueCacheKey{keyA, keyB}]
+	if item == nil {
+		return 0, 0, ErrNotFound
+	}
+	if item.deleted {
+		return item.timestampMicro, 0, ErrNotFound
+	}
+	return item.timestampMicro, uint32(len(item.value)), nil
+}
+
+func (s *MemValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	item := s.items[replValueCacheKey{keyA, keyB}]
+	if item == nil {
+		return 0, value, ErrNotFound
+	}
+	if item.deleted {
+		return item.timestampMicro, value, ErrNotFound
+	}
+	return item.timestampMicro, append(value, item.value...), nil
+}
+
+func (s *MemValueStore) Write(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.writesDisabled {
+		return 0, ErrWritesDisabled
+	}
+	key := replValueCacheKey{keyA, keyB}
+	item := s.items[key]
+	if item != nil && item.timestampMicro >= timestampMicro {
+		return item.timestampMicro, nil
+	}
+	var oldTimestampMicro int64
+	if item != nil {
+		oldTimestampMicro = item.timestampMicro
+	}
+	if s.items == nil {
+		s.items = make(map[replValueCacheKey]*memValueItem)
+	}
+	s.items[key] = &memValueItem{timestampMicro: timestampMicro, value: append([]byte(nil), value...)}
+	return oldTimestampMicro, nil
+}
+
+func (s *MemValueStore) Delete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.writesDisabled {
+		return 0, ErrWritesDisabled
+	}
+	key := replValueCacheKey{keyA, keyB}
+	item := s.items[key]
+	if item != nil && (item.timestampMicro > timestampMicro || (item.timestampMicro == timestampMicro && item.deleted)) {
+		return item.timestampMicro, nil
+	}
+	var oldTimestampMicro int64
+	if item != nil {
+		oldTimestampMicro = item.timestampMicro
+	}
+	if s.items == nil {
+		s.items = make(map[replValueCacheKey]*memValueItem)
+	}
+	s.items[key] = &memValueItem{timestampMicro: timestampMicro, deleted: true}
+	return oldTimestampMicro, nil
+}
+
+// NewMemReplValueStore returns a ReplValueStore routing to the given
+// number of in-memory replicas, along with those replicas so a test can
+// inspect them or stop a replica's writes. The ring used is static, and c's
+// RingSource is ignored; c may be nil for the defaults.
+func NewMemReplValueStore(replicas int, c *ReplValueStoreConfig) (*ReplValueStore, []*MemValueStore) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	ms := make([]*MemValueStore, replicas)
+	ss := make([]store.ValueStore, replicas)
+	for i := range ms {
+		ms[i] = &MemValueStore{}
+		ss[i] = ms[i]
+	}
+	return newLocalReplValueStore(ss, c), ms
+}
+
+// newLocalReplValueStore returns a ReplValueStore routing to the stores
+// given, each a replica of every key, with a static ring.
+func newLocalReplValueStore(ss []store.ValueStore, c *ReplValueStoreConfig) *ReplValueStore {
+	var cfg ReplValueStoreConfig
+	if c != nil {
+		cfg = *c
+	}
+	r, addrs := localRing(len(ss), cfg.AddressIndex)
+	stores := make(map[string]store.ValueStore, len(ss))
+	for i, addr := range addrs {
+		stores[addr] = ss[i]
+	}
+	cfg.RingSource = &StaticRingSource{Ring: r}
+	rs := NewReplValueStore(&cfg)
+	rs.newBackendStore = func(addr string) (store.ValueStore, error) {
+		if s := stores[addr]; s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("no local store for %s", addr)
+	}
+	rs.SetRing(r)
+	return rs
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// ValueWriteItem is a single write to be issued with
+// ReplValueStore.WriteBatch.
+type ValueWriteItem struct {
+	KeyA           uint64
+	KeyB           uint64
+	TimestampMicro int64
+	Value          []byte
+}
+
+// ValueWriteResult is the outcome of a single ValueWriteItem; it is
+// equivalent to the return values of ReplValueStore.Write.
+type ValueWriteResult struct {
+	OldTimestampMicro int64
+	Err               error
+}
+
+// WriteBatch issues all the items given, returning a result for each item in
+// the same order. Each item is passed through the Middleware chain and
+// written just as Write would write it, split with SplitLargeValues, retried
+// under the RetryPolicy, and waking any watchers, but the items are grouped
+// by the replicas the ReplicaSelector picks for them and each group is
+// pipelined to its replicas over their existing streams, bounded by
+// ConcurrentRequestsPerStore. Items the Authorizer or a middleware denies
+// fail alone.
+func (rs *ReplValueStore) WriteBatch(ctx context.Context, items []ValueWriteItem) []ValueWriteResult {
+	return rs.writeGrouped(ctx, items, rs.Write)
+}
+
+// writeBatch writes the items given, already encoded, each with write, as
+// with writeGrouped; it is for writes made on behalf of others, such as the
+// chunks of a split value, which are neither split nor retried themselves.
+func (rs *ReplValueStore) writeBatch(ctx context.Context, items []ValueWriteItem) []ValueWriteResult {
+	return rs.writeGrouped(ctx, items, rs.write)
+}
+
+// writeGrouped writes each of the items given with write, which is rs.Write
+// or rs.write, so each item goes through writeReplicas just as a single
+// Write would. The items are grouped by the replicas the
+// ReplicaSelector picks for them and each group is pipelined to its replicas
+// by up to ConcurrentRequestsPerStore workers.
+func (rs *ReplValueStore) writeGrouped(ctx context.Context, items []ValueWriteItem, write func(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error)) []ValueWriteResult {
+	results := make([]ValueWriteResult, len(items))
+	groups := make(map[string][]int)
+	for i := range items {
+		item := &items[i]
+		if len(item.Value) == 0 {
+			results[i].Err = fmt.Errorf("zero length value")
+			continue
+		}
+		stores, err := rs.storesFor(ctx, item.KeyA)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		addrs := make([]string, len(stores))
+		for j, s := range stores {
+			addrs[j] = s.addr
+		}
+		sort.Strings(addrs)
+		replicaSet := strings.Join(addrs, "\x00")
+		groups[replicaSet] = append(groups[replicaSet], i)
+	}
+	var wg sync.WaitGroup
+	for _, indexes := range groups {
+		indexChan := make(chan int, len(indexes))
+		for _, i := range indexes {
+			indexChan <- i
+		}
+		close(indexChan)
+		workers := rs.concurrentRequestsPerStore
+		if workers > len(indexes) {
+			workers = len(indexes)
+		}
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for i := range indexChan {
+					item := &items[i]
+					results[i].OldTimestampMicro, results[i].Err = write(ctx, item.KeyA, item.KeyB, item.TimestampMicro, item.Value)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// ValueKeyPair identifies a single item to be read with
+// ReplValueStore.ReadMulti.
+type ValueKeyPair struct {
+	KeyA uint64
+	KeyB uint64
+}
+
+// ValueReadResult is the outcome of reading a single ValueKeyPair; it is
+// equivalent to the return values of ReplValueStore.Read.
+type ValueReadResult struct {
+	TimestampMicro int64
+	Value          []byte
+	Err            error
+}
+
+// ReadMulti reads all the keys given, returning a result for each key in the
+// same order. At most ConcurrentRequestsPerStore reads will be in flight at
+// once so a large set of keys won't starve other callers of the backend
+// stores' request tickets.
+func (rs *ReplValueStore) ReadMulti(ctx context.Context, keys []ValueKeyPair) []ValueReadResult {
+	results := make([]ValueReadResult, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+	workers := rs.concurrentRequestsPerStore
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	indexChan := make(chan int, workers)
+	doneChan := make(chan struct{}, workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range indexChan {
+				k := &keys[i]
+				results[i].TimestampMicro, results[i].Value, results[i].Err = rs.Read(ctx, k.KeyA, k.KeyB, nil)
+			}
+			doneChan <- struct{}{}
+		}()
+	}
+	for i := range keys {
+		indexChan <- i
+	}
+	close(indexChan)
+	for w := 0; w < workers; w++ {
+		<-doneChan
+	}
+	return results
+}
@@ -0,0 +1,63 @@
+package api
+
+import "sync"
+
+type replValueReadCall struct {
+	done           chan struct{}
+	waiters        int
+	timestampMicro int64
+	value          []byte
+	err            error
+}
+
+// replValueReadCalls tracks the Reads in flight so concurrent Reads of the
+// same key can share a single fan-out to the backend stores. A nil
+// *replValueReadCalls is valid and coalesces nothing.
+type replValueReadCalls struct {
+	lock  sync.Mutex
+	calls map[replValueCacheKey]*replValueReadCall
+}
+
+func newReplValueReadCalls(enabled bool) *replValueReadCalls {
+	if !enabled {
+		return nil
+	}
+	return &replValueReadCalls{calls: make(map[replValueCacheKey]*replValueReadCall)}
+}
+
+// join returns the call for the key and whether the caller is its leader;
+// the leader must do the read and then call finish, others wait for the
+// call's done to be closed and then use its results.
+func (c *replValueReadCalls) join(key replValueCacheKey) (*replValueReadCall, bool) {
+	if c == nil {
+		return nil, true
+	}
+	c.lock.Lock()
+	if call := c.calls[key]; call != nil {
+		call.waiters++
+		c.lock.Unlock()
+		return call, false
+	}
+	call := &replValueReadCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.lock.Unlock()
+	return call, true
+}
+
+// finish records the results of the leader's read for the waiters. The
+// value is copied if there are any, since the leader's caller owns it.
+func (c *replValueReadCalls) finish(key replValueCacheKey, call *replValueReadCall, timestampMicro int64, value []byte, err error) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	delete(c.calls, key)
+	waiters := call.waiters
+	c.lock.Unlock()
+	if waiters > 0 {
+		call.timestampMicro = timestampMicro
+		call.value = append([]byte(nil), value...)
+		call.err = err
+	}
+	close(call.done)
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// newestTimestamp returns the newest timestampMicro, including that of any
+// deletion marker, held by the replicas responsible for the key, and how many
+// of those replicas have a value for the key. Every replica is asked
+// regardless of the ReadStrategy, and an error is returned unless enough of
+// them respond that a Write would have reached a quorum.
+func (rs *ReplValueStore) newestTimestamp(ctx context.Context, keyA, keyB uint64) (int64, int, error) {
+	type rettype struct {
+		timestampMicro int64
+		exists         bool
+		err            ReplValueStoreError
+	}
+	stores, err := rs.storesFor(ctx, keyA)
+	if err != nil {
+		return 0, 0, err
+	}
+	ec := make(chan *rettype, len(stores))
+	for _, s := range stores {
+		s := s
+		s.workers.run(func() {
+			ret := &rettype{}
+			var err error
+			select {
+			case <-s.tickets(ctx):
+				sctx, done := rs.startReplica(ctx, "Lookup", s)
+				ret.timestampMicro, _, err = s.store.Lookup(sctx, keyA, keyB)
+				done(err)
+				s.tickets(ctx) <- struct{}{}
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			if err != nil && !store.IsNotFound(err) {
+				ret.err = rs.storeError(s, err)
+			} else {
+				ret.exists = err == nil
+				s.record(nil)
+			}
+			ec <- ret
+		})
+	}
+	var timestampMicro int64
+	var existing int
+	var errs ReplValueStoreErrorSlice
+	for _ = range stores {
+		ret := <-ec
+		if ret.err != nil {
+			errs = append(errs, ret.err)
+			continue
+		}
+		if ret.timestampMicro > timestampMicro {
+			timestampMicro = ret.timestampMicro
+		}
+		if ret.exists {
+			existing++
+		}
+	}
+	if len(errs) >= (len(stores)+1)/2 {
+		return timestampMicro, existing, errs
+	}
+	for _, err := range errs {
+		rs.logDebug("replValueStore: error during newest timestamp lookup: %s", err)
+	}
+	return timestampMicro, existing, nil
+}
+
+// CompareAndWrite writes the value with newTimestampMicro only if no
+// reachable replica has a value, or deletion marker, newer than
+// expectedTimestampMicro; otherwise a *ConflictError is returned. This gives
+// optimistic concurrency to callers that read a value, modify it, and write
+// it back.
+//
+// The check and the write are separate requests to the backend stores, so two
+// callers racing with the same expectedTimestampMicro can both succeed; the
+// one with the newer newTimestampMicro wins as with any Write. Using a
+// newTimestampMicro unique to each caller, such as from a clock with an added
+// client identifier, keeps that race narrow.
+func (rs *ReplValueStore) CompareAndWrite(ctx context.Context, keyA, keyB uint64, expectedTimestampMicro, newTimestampMicro int64, value []byte) (int64, error) {
+	if err := rs.writesBlocked(); err != nil {
+		return 0, err
+	}
+	if newTimestampMicro <= expectedTimestampMicro {
+		return 0, fmt.Errorf("new timestamp %d is not newer than expected timestamp %d", newTimestampMicro, expectedTimestampMicro)
+	}
+	timestampMicro, _, err := rs.newestTimestamp(ctx, keyA, keyB)
+	if err != nil {
+		return timestampMicro, err
+	}
+	if timestampMicro > expectedTimestampMicro {
+		return timestampMicro, &ConflictError{ExpectedTimestampMicro: expectedTimestampMicro, TimestampMicro: timestampMicro}
+	}
+	return rs.Write(ctx, keyA, keyB, newTimestampMicro, value)
+}
+
+// Create writes the value only if the key has no value yet, returning
+// ErrExists otherwise. A key that has been deleted counts as having no value,
+// as long as timestampMicro is newer than the deletion. Enough replicas must
+// confirm the key has no value that a Write would reach a quorum, and any
+// reachable replica having a value means the key exists.
+//
+// As with CompareAndWrite, the check and the write are separate requests to
+// the backend stores, so two callers racing to Create the same key with
+// different timestamps can both succeed; the newer timestamp wins.
+func (rs *ReplValueStore) Create(ctx context.Context, keyA, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	if err := rs.writesBlocked(); err != nil {
+		return 0, err
+	}
+	oldTimestampMicro, existing, err := rs.newestTimestamp(ctx, keyA, keyB)
+	if err != nil {
+		return oldTimestampMicro, err
+	}
+	if existing > 0 {
+		return oldTimestampMicro, ErrExists
+	}
+	if oldTimestampMicro >= timestampMicro {
+		return oldTimestampMicro, &ConflictError{ExpectedTimestampMicro: timestampMicro, TimestampMicro: oldTimestampMicro}
+	}
+	return rs.Write(ctx, keyA, keyB, timestampMicro, value)
+}
+
+// Update reads the value for the key, gives it to update, and writes back the
+// value update returns with CompareAndWrite, starting over, after a short
+// random backoff, should another write have got there in between, up to a
+// limit after which the *ConflictError is returned. The value given to
+// update is nil if the key has no value, and an error from update is
+// returned as is, with nothing written. With the ExpiringValues config
+// option, the value keeps its expiry.
+//
+// The value is written with timestampMicro, or, should that not be newer
+// than the value read, one microsecond past the value read so that the
+// update still lands; the timestamp written with is returned. As with
+// CompareAndWrite, two callers racing to update the same value with the
+// same timestamp can both succeed, with one update lost; timestamps unique
+// to each caller keep that from happening.
+func (rs *ReplValueStore) Update(ctx context.Context, keyA, keyB uint64, timestampMicro int64, update func(value []byte) ([]byte, error)) (int64, error) {
+	var newTimestampMicro int64
+	attempted := false
+	err := updateRetryPolicy.do(ctx, func() error {
+		if attempted {
+			// The value read last time may have come from the read cache.
+			rs.uncache(replValueCacheKey{keyA: keyA, keyB: keyB})
+		}
+		attempted = true
+		var oldTimestampMicro int64
+		var value []byte
+		var ttl time.Duration
+		var err error
+		if rs.expiringValues {
+			oldTimestampMicro, value, ttl, err = rs.ReadTTL(ctx, keyA, keyB, nil)
+		} else {
+			oldTimestampMicro, value, err = rs.Read(ctx, keyA, keyB, nil)
+		}
+		if err != nil && !store.IsNotFound(err) {
+			return err
+		}
+		if value, err = update(value); err != nil {
+			return err
+		}
+		newTimestampMicro = timestampMicro
+		if newTimestampMicro <= oldTimestampMicro {
+			newTimestampMicro = oldTimestampMicro + 1
+		}
+		if ttl > 0 {
+			_, err = rs.CompareAndWriteTTL(ctx, keyA, keyB, oldTimestampMicro, newTimestampMicro, value, ttl)
+		} else {
+			_, err = rs.CompareAndWrite(ctx, keyA, keyB, oldTimestampMicro, newTimestampMicro, value)
+		}
+		return err
+	})
+	return newTimestampMicro, err
+}
+
+// Append adds data to the end of the value for the key, or writes data as
+// the value if the key has none, as with Update, returning the timestamp
+// written with.
+func (rs *ReplValueStore) Append(ctx context.Context, keyA, keyB uint64, timestampMicro int64, data []byte) (int64, error) {
+	return rs.Update(ctx, keyA, keyB, timestampMicro, func(value []byte) ([]byte, error) {
+		return append(value, data...), nil
+	})
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// Increment adds delta to the counter stored at the key, starting from 0 if
+// the key has no value, and returns the counter's new value. It is a read,
+// modify, and write as with Update, so increments contending for the same
+// counter back off and retry rather than overwrite each other; distinct
+// timestamps for each caller, as Update describes, keep any from being lost.
+func (rs *ReplValueStore) Increment(ctx context.Context, keyA, keyB uint64, timestampMicro int64, delta int64) (int64, error) {
+	var count int64
+	_, err := rs.Update(ctx, keyA, keyB, timestampMicro, func(value []byte) ([]byte, error) {
+		var err error
+		if count, err = decodeCounter(value); err != nil {
+			return nil, err
+		}
+		count += delta
+		return encodeCounter(count), nil
+	})
+	return count, err
+}
+
+// Decrement subtracts delta from the counter stored at the key; see
+// Increment.
+func (rs *ReplValueStore) Decrement(ctx context.Context, keyA, keyB uint64, timestampMicro int64, delta int64) (int64, error) {
+	return rs.Increment(ctx, keyA, keyB, timestampMicro, -delta)
+}
+
+// ReadCounter returns the counter stored at the key, or 0 if the key has no
+// value.
+func (rs *ReplValueStore) ReadCounter(ctx context.Context, keyA, keyB uint64) (int64, error) {
+	_, value, err := rs.Read(ctx, keyA, keyB, nil)
+	if store.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounter(value)
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/gholt/ring"
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+const (
+	replValueStoreStateUnknown int32 = iota
+	replValueStoreStateConnected
+	replValueStoreStateFailing
+)
+
+// record notes the outcome of a request to the backend store for Health and
+// OnBackendStateChange; not found counts as a success as the store was
+// reachable.
+func (s *replValueStoreAndTicketChan) record(err error) {
+	now := time.Now().UnixNano()
+	if err == nil || store.IsNotFound(err) {
+		atomic.StoreInt64(&s.lastSuccess, now)
+		if atomic.SwapInt32(&s.state, replValueStoreStateConnected) != replValueStoreStateConnected && s.stateChange != nil {
+			s.stateChange("connected", nil)
+		}
+		return
+	}
+	if err == context.Canceled {
+		return
+	}
+	if atomic.SwapInt32(&s.state, replValueStoreStateFailing) != replValueStoreStateFailing && s.stateChange != nil {
+		s.stateChange("failing", err)
+	}
+	s.lastErrorLock.Lock()
+	s.lastError = err.Error()
+	s.lastErrorTime = now
+	s.lastErrorLock.Unlock()
+}
+
+func (s *replValueStoreAndTicketChan) health() ReplStoreBackendHealth {
+	h := ReplStoreBackendHealth{
+		Addr:         s.addr,
+		TicketsInUse: s.ticketsInUse(),
+	}
+	lastSuccess := atomic.LoadInt64(&s.lastSuccess)
+	s.lastErrorLock.Lock()
+	lastError := s.lastError
+	lastErrorTime := s.lastErrorTime
+	s.lastErrorLock.Unlock()
+	if lastSuccess != 0 {
+		h.LastSuccess = time.Unix(0, lastSuccess)
+	}
+	if lastErrorTime != 0 {
+		h.LastError = lastError
+		h.LastErrorTime = time.Unix(0, lastErrorTime)
+	}
+	if es, ok := s.store.(errorValueStore); ok {
+		h.State = "error"
+		h.LastError = string(es)
+	} else if lastErrorTime > lastSuccess {
+		h.State = "failing"
+	} else if lastSuccess != 0 {
+		h.State = "connected"
+	} else {
+		h.State = "unconnected"
+	}
+	return h
+}
+
+// readRank orders stores for orderForRead: connected stores first, then those
+// not yet used, then failing stores, and stores that could not even be
+// connected to last.
+func (s *replValueStoreAndTicketChan) readRank() int {
+	if _, ok := s.store.(errorValueStore); ok {
+		return 3
+	}
+	switch atomic.LoadInt32(&s.state) {
+	case replValueStoreStateConnected:
+		return 0
+	case replValueStoreStateFailing:
+		return 2
+	}
+	return 1
+}
+
+type replValueStoresByReadRank struct {
+	stores    []*replValueStoreAndTicketChan
+	ranks     []int
+	remotes   []bool
+	latencies []int64
+}
+
+func (ss *replValueStoresByReadRank) Len() int {
+	return len(ss.stores)
+}
+
+func (ss *replValueStoresByReadRank) Swap(i, j int) {
+	ss.stores[i], ss.stores[j] = ss.stores[j], ss.stores[i]
+	ss.ranks[i], ss.ranks[j] = ss.ranks[j], ss.ranks[i]
+	ss.remotes[i], ss.remotes[j] = ss.remotes[j], ss.remotes[i]
+	ss.latencies[i], ss.latencies[j] = ss.latencies[j], ss.latencies[i]
+}
+
+func (ss *replValueStoresByReadRank) Less(i, j int) bool {
+	if ss.ranks[i] != ss.ranks[j] {
+		return ss.ranks[i] < ss.ranks[j]
+	}
+	if ss.remotes[i] != ss.remotes[j] {
+		return ss.remotes[j]
+	}
+	return ss.latencies[i] < ss.latencies[j]
+}
+
+// orderForRead returns the stores in the order reads should prefer them:
+// healthiest first, then those in the LocalTier, and then, if the read does
+// not need every replica, lowest latency first. The ring's order is kept
+// otherwise. The number of the stores the read should be sent to, before any
+// fail, is also returned; 0 means all of them.
+func (rs *ReplValueStore) orderForRead(ctx context.Context, stores []*replValueStoreAndTicketChan) ([]*replValueStoreAndTicketChan, int) {
+	ss := &replValueStoresByReadRank{
+		stores:    make([]*replValueStoreAndTicketChan, len(stores)),
+		ranks:     make([]int, len(stores)),
+		remotes:   make([]bool, len(stores)),
+		latencies: make([]int64, len(stores)),
+	}
+	copy(ss.stores, stores)
+	limit := rs.readReplicas
+	if rs.localTier != "" {
+		locals := 0
+		rs.ringLock.RLock()
+		for i, s := range ss.stores {
+			if _, ok := rs.localAddrs[s.addr]; ok {
+				locals++
+			} else {
+				ss.remotes[i] = true
+			}
+		}
+		rs.ringLock.RUnlock()
+		if limit == 0 && locals < len(stores) {
+			limit = locals
+		}
+	}
+	byLatency := ReadStrategyFrom(ctx, rs.readStrategy) != ReadAll || limit > 0
+	for i, s := range ss.stores {
+		ss.ranks[i] = s.readRank()
+		if byLatency {
+			ss.latencies[i] = atomic.LoadInt64(&s.latency)
+		}
+	}
+	sort.Stable(ss)
+	return ss.stores, limit
+}
+
+// localAddrsFor returns the addresses of the nodes in the ring that are in
+// the LocalTier, if set.
+func (rs *ReplValueStore) localAddrsFor(r ring.Ring) map[string]struct{} {
+	if rs.localTier == "" || r == nil {
+		return nil
+	}
+	addrs := make(map[string]struct{})
+	for _, n := range r.Nodes() {
+		if n.Tier(rs.localTierLevel) == rs.localTier {
+			addrs[n.Address(rs.addressIndex)] = struct{}{}
+		}
+	}
+	return addrs
+}
+
+// Health reports the current ring and the state of each backend store in it.
+// It does not make any requests itself, so it is cheap enough to call for
+// every probe; the backend states reflect the requests made so far.
+func (rs *ReplValueStore) Health(ctx context.Context) *ReplStoreHealth {
+	h := &ReplStoreHealth{}
+	rs.ringLock.RLock()
+	r := rs.ring
+	rs.ringLock.RUnlock()
+	if r == nil {
+		return h
+	}
+	h.Ready = true
+	h.RingVersion = r.Version()
+	h.RingAge = time.Since(time.Unix(0, r.Version()))
+	nodes := r.Nodes()
+	seen := make(map[string]struct{}, len(nodes))
+	rs.storesLock.RLock()
+	for _, n := range nodes {
+		addr := n.Address(rs.addressIndex)
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = struct{}{}
+		if s := rs.stores[addr]; s != nil {
+			h.Backends = append(h.Backends, s.health())
+		} else {
+			h.Backends = append(h.Backends, ReplStoreBackendHealth{Addr: addr, State: "unconnected"})
+		}
+	}
+	rs.storesLock.RUnlock()
+	sort.Sort(replStoreBackendHealthByAddr(h.Backends))
+	return h
+}
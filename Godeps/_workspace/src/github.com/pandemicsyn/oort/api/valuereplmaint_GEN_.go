@@ -0,0 +1,77 @@
+package api
+
+import (
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// forEachStore calls f concurrently for each backend store the client
+// currently has, returning a ReplValueStoreErrorSlice of any errors. If
+// progress is not nil, it is called as each store finishes. Stores that have
+// not finished by the time the ctx is done are reported with the ctx's error.
+func (rs *ReplValueStore) forEachStore(ctx context.Context, f func(context.Context, store.ValueStore) error, progress func(addr string, err error, done, total int)) error {
+	var stores []*replValueStoreAndTicketChan
+	rs.storesLock.RLock()
+	for _, s := range rs.stores {
+		if s != nil {
+			stores = append(stores, s)
+		}
+	}
+	rs.storesLock.RUnlock()
+	type rettype struct {
+		s   *replValueStoreAndTicketChan
+		err error
+	}
+	ec := make(chan *rettype, len(stores))
+	for _, s := range stores {
+		s := s
+		s.workers.run(func() {
+			ec <- &rettype{s: s, err: f(ctx, s.store)}
+		})
+	}
+	pending := make(map[*replValueStoreAndTicketChan]struct{}, len(stores))
+	for _, s := range stores {
+		pending[s] = struct{}{}
+	}
+	var errs ReplValueStoreErrorSlice
+	for len(pending) > 0 {
+		select {
+		case ret := <-ec:
+			delete(pending, ret.s)
+			if ret.err != nil {
+				errs = append(errs, &replValueStoreError{store: ret.s.store, err: ret.err})
+			}
+			if progress != nil {
+				progress(ret.s.addr, ret.err, len(stores)-len(pending), len(stores))
+			}
+		case <-ctx.Done():
+			for s := range pending {
+				errs = append(errs, &replValueStoreError{store: s.store, err: ctx.Err()})
+			}
+			return errs
+		}
+	}
+	if errs == nil {
+		return nil
+	}
+	return errs
+}
+
+// AuditPass starts an audit pass on each backend store concurrently, calling
+// the AuditPassProgress func, if set, as each finishes. Any errors are
+// returned as a ReplValueStoreErrorSlice.
+func (rs *ReplValueStore) AuditPass(ctx context.Context) error {
+	return rs.forEachStore(ctx, func(ctx context.Context, s store.ValueStore) error {
+		return s.AuditPass(ctx)
+	}, rs.auditPassProgress)
+}
+
+// Flush calls Flush on each backend store concurrently, so callers can ensure
+// a durability point, such as before a snapshot. Any errors, including for
+// stores that had not finished by the time the ctx is done, are returned as a
+// ReplValueStoreErrorSlice.
+func (rs *ReplValueStore) Flush(ctx context.Context) error {
+	return rs.forEachStore(ctx, func(ctx context.Context, s store.ValueStore) error {
+		return s.Flush(ctx)
+	}, nil)
+}
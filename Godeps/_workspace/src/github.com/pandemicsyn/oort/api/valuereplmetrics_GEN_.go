@@ -0,0 +1,140 @@
+package api
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gholt/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// replValueStoreMetrics is the prometheus.Collector returned by
+// ReplValueStore.Collector.
+type replValueStoreMetrics struct {
+	// These counts are first to keep them 64-bit aligned for atomic use;
+	// they are reported by Stats.
+	requestCount  uint64
+	notFoundCount uint64
+	errorCount    uint64
+
+	rs            *ReplValueStore
+	requests      *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	backendErrors *prometheus.CounterVec
+	ringUpdates   prometheus.Counter
+	ticketsInUse  *prometheus.Desc
+	shadowOps     *prometheus.CounterVec
+	shadowLatency prometheus.Histogram
+	denied        *prometheus.CounterVec
+}
+
+func newReplValueStoreMetrics(rs *ReplValueStore) *replValueStoreMetrics {
+	return &replValueStoreMetrics{
+		rs: rs,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ReplValueStore",
+			Name:      "Requests",
+			Help:      "Number of requests by operation and result (ok, notfound, error).",
+		}, []string{"op", "result"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "ReplValueStore",
+			Name:      "RequestSeconds",
+			Help:      "Request latency by operation.",
+		}, []string{"op"}),
+		backendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ReplValueStore",
+			Name:      "BackendErrors",
+			Help:      "Number of errors, other than not found, returned by each backend store.",
+		}, []string{"addr"}),
+		ringUpdates: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "ReplValueStore",
+			Name:      "RingUpdates",
+			Help:      "Number of rings set, whether from the ring service or SetRing.",
+		}),
+		ticketsInUse: prometheus.NewDesc(
+			prometheus.BuildFQName("ReplValueStore", "", "TicketsInUse"),
+			"Number of concurrent request tickets in use for each backend store; saturated when equal to ConcurrentRequestsPerStore.",
+			[]string{"addr"},
+			nil,
+		),
+		shadowOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ReplValueStore",
+			Name:      "ShadowOps",
+			Help:      "Number of writes and deletes mirrored to the ShadowStore by result (ok, error, dropped).",
+		}, []string{"result"}),
+		shadowLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "ReplValueStore",
+			Name:      "ShadowSeconds",
+			Help:      "Latency of writes and deletes mirrored to the ShadowStore.",
+		}),
+		denied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ReplValueStore",
+			Name:      "Denied",
+			Help:      "Number of requests denied by the Authorizer by operation.",
+		}, []string{"op"}),
+	}
+}
+
+func (m *replValueStoreMetrics) request(op string, start time.Time, err error) {
+	result := "ok"
+	atomic.AddUint64(&m.requestCount, 1)
+	if store.IsNotFound(err) {
+		result = "notfound"
+		atomic.AddUint64(&m.notFoundCount, 1)
+	} else if err != nil {
+		result = "error"
+		atomic.AddUint64(&m.errorCount, 1)
+	}
+	m.requests.WithLabelValues(op, result).Inc()
+	m.latency.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+func (m *replValueStoreMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.latency.Describe(ch)
+	m.backendErrors.Describe(ch)
+	m.ringUpdates.Describe(ch)
+	m.shadowOps.Describe(ch)
+	m.shadowLatency.Describe(ch)
+	m.denied.Describe(ch)
+	ch <- m.ticketsInUse
+}
+
+func (m *replValueStoreMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.latency.Collect(ch)
+	m.backendErrors.Collect(ch)
+	m.ringUpdates.Collect(ch)
+	m.shadowOps.Collect(ch)
+	m.shadowLatency.Collect(ch)
+	m.denied.Collect(ch)
+	m.rs.storesLock.RLock()
+	for addr, s := range m.rs.stores {
+		if s == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.ticketsInUse, prometheus.GaugeValue, float64(s.ticketsInUse()), addr)
+	}
+	m.rs.storesLock.RUnlock()
+}
+
+// Collector returns a prometheus.Collector exposing request counts and
+// latencies, backend store errors, ticket usage, and ring updates for the
+// ReplValueStore. It is up to the caller to register it, such as with
+// prometheus.MustRegister(rs.Collector()).
+func (rs *ReplValueStore) Collector() prometheus.Collector {
+	return rs.metrics
+}
+
+// storeError wraps an error returned by a backend store, counting it against
+// that store unless it is just a not found.
+func (rs *ReplValueStore) storeError(s *replValueStoreAndTicketChan, err error) ReplValueStoreError {
+	s.record(err)
+	if isConnectionError(err) {
+		rs.connectionFailed(s, err)
+	}
+	if !store.IsNotFound(err) {
+		rs.metrics.backendErrors.WithLabelValues(s.addr).Inc()
+	}
+	return &replValueStoreError{store: s.store, err: err}
+}
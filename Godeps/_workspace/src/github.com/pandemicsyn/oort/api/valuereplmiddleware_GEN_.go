@@ -0,0 +1,148 @@
+package api
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ValueRequest is a Lookup, Read, Write, or Delete passing through the
+// ValueMiddleware chain.
+type ValueRequest struct {
+	// Op is "Lookup", "Read", "Write", or "Delete".
+	Op   string
+	KeyA uint64
+	KeyB uint64
+	// TimestampMicro is that given to Write or Delete.
+	TimestampMicro int64
+	// Value is the value given to Write, or the buffer given to Read for the
+	// value read to be appended to.
+	Value []byte
+}
+
+// ValueResponse is the outcome of a ValueRequest, being the values the
+// operation returns.
+type ValueResponse struct {
+	// TimestampMicro is that of the value found by Lookup or Read, or the
+	// previous timestamp returned by Write or Delete.
+	TimestampMicro int64
+	// Length is the length returned by Lookup.
+	Length uint32
+	// Value is the value returned by Read.
+	Value []byte
+	Err   error
+}
+
+// ValueHandler carries out a ValueRequest.
+type ValueHandler func(ctx context.Context, req ValueRequest) ValueResponse
+
+// ValueMiddleware wraps the handling of each Lookup, Read, Write, and
+// Delete, as gRPC interceptors do for RPCs, such as for logging, metrics,
+// access checks, or caching; see the Middleware config setting. It returns a
+// ValueHandler that may inspect or change the request and ctx before
+// calling next, or not call next at all, and may inspect or change the
+// response next returns. Each item of a WriteBatch or WriteAll passes
+// through the chain as a Write of its own; the writes the store makes itself,
+// such as repairs, hinted handoffs, and WriteAll's roll backs, do not.
+//
+// The store's own metrics, AuditSink, Authorizer, and Tracer are middleware
+// too, run in that order ahead of those configured, so configured
+// middleware see only authorized requests and their time counts in the
+// metrics and traces.
+type ValueMiddleware func(next ValueHandler) ValueHandler
+
+// chain returns the handler for requests: the built in middleware, those
+// configured, and then the store itself.
+func (rs *ReplValueStore) chain(middleware []ValueMiddleware) ValueHandler {
+	h := rs.handle
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	for _, m := range []ValueMiddleware{rs.tracingMiddleware, rs.authorizeMiddleware, rs.auditMiddleware, rs.metricsMiddleware} {
+		h = m(h)
+	}
+	return h
+}
+
+func (rs *ReplValueStore) handle(ctx context.Context, req ValueRequest) ValueResponse {
+	var resp ValueResponse
+	switch req.Op {
+	case "Lookup":
+		resp.TimestampMicro, resp.Length, resp.Err = rs.handleLookup(ctx, req.KeyA, req.KeyB)
+	case "Read":
+		resp.TimestampMicro, resp.Value, resp.Err = rs.handleRead(ctx, req.KeyA, req.KeyB, req.Value)
+	case "Write":
+		resp.TimestampMicro, resp.Err = rs.handleWrite(ctx, req.KeyA, req.KeyB, req.TimestampMicro, req.Value)
+	case "Delete":
+		resp.TimestampMicro, resp.Err = rs.handleDelete(ctx, req.KeyA, req.KeyB, req.TimestampMicro)
+	default:
+		panic("replValueStore: unknown op " + req.Op)
+	}
+	return resp
+}
+
+func (rs *ReplValueStore) metricsMiddleware(next ValueHandler) ValueHandler {
+	return func(ctx context.Context, req ValueRequest) ValueResponse {
+		start := time.Now()
+		resp := next(ctx, req)
+		rs.metrics.request(req.Op, start, resp.Err)
+		return resp
+	}
+}
+
+func (rs *ReplValueStore) auditMiddleware(next ValueHandler) ValueHandler {
+	return func(ctx context.Context, req ValueRequest) ValueResponse {
+		if rs.auditSink == nil || (req.Op != "Write" && req.Op != "Delete") {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		resp := next(ctx, req)
+		rs.audit(ctx, req.Op, start, req.KeyA, req.KeyB, req.TimestampMicro, len(req.Value), resp.Err)
+		return resp
+	}
+}
+
+func (rs *ReplValueStore) authorizeMiddleware(next ValueHandler) ValueHandler {
+	return func(ctx context.Context, req ValueRequest) ValueResponse {
+		if err := rs.authorize(ctx, req.Op, req.KeyA, req.KeyB); err != nil {
+			return ValueResponse{Err: err}
+		}
+		return next(ctx, req)
+	}
+}
+
+func (rs *ReplValueStore) tracingMiddleware(next ValueHandler) ValueHandler {
+	return func(ctx context.Context, req ValueRequest) ValueResponse {
+		if rs.tracer == nil {
+			return next(ctx, req)
+		}
+		ctx, span := rs.tracer.StartSpan(ctx, "ReplValueStore."+req.Op)
+		resp := next(withSpan(ctx, span), req)
+		span.End(resp.Err)
+		return resp
+	}
+}
+
+func (rs *ReplValueStore) Lookup(ctx context.Context, keyA, keyB uint64) (int64, uint32, error) {
+	resp := rs.handler(ctx, ValueRequest{Op: "Lookup", KeyA: keyA, KeyB: keyB})
+	return resp.TimestampMicro, resp.Length, resp.Err
+}
+
+func (rs *ReplValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
+	resp := rs.handler(ctx, ValueRequest{Op: "Read", KeyA: keyA, KeyB: keyB, Value: value})
+	if resp.Value == nil {
+		// Such as from a middleware returning an error.
+		return resp.TimestampMicro, value, resp.Err
+	}
+	return resp.TimestampMicro, resp.Value, resp.Err
+}
+
+func (rs *ReplValueStore) Write(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	resp := rs.handler(ctx, ValueRequest{Op: "Write", KeyA: keyA, KeyB: keyB, TimestampMicro: timestampMicro, Value: value})
+	return resp.TimestampMicro, resp.Err
+}
+
+func (rs *ReplValueStore) Delete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
+	resp := rs.handler(ctx, ValueRequest{Op: "Delete", KeyA: keyA, KeyB: keyB, TimestampMicro: timestampMicro})
+	return resp.TimestampMicro, resp.Err
+}
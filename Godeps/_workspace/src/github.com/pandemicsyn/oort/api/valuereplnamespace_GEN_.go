@@ -0,0 +1,210 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ValueNamespaceConfig defines the settings for a ValueNamespace.
+type ValueNamespaceConfig struct {
+	// Name identifies the namespace, such as the team or application using
+	// it, in errors.
+	Name string
+	// Salt is mixed into the hash of every key, as with NewKeyNamespace, so
+	// that namespaces never see each other's keys. Default: Name
+	Salt string
+	// ValueCap is the largest value the namespace may write; it cannot raise
+	// the store's own ValueCap. Default: 0, the store's ValueCap.
+	ValueCap int
+	// ByteQuota is how many bytes of values the namespace may hold. Usage is
+	// tracked by this client alone, starting from 0 or whatever SetUsage
+	// gives, and so is only as accurate as that is. Default: 0, no quota.
+	ByteQuota int64
+	// OpsPerSecond and BytesPerSecond limit the namespace's requests, reads
+	// and writes together, in addition to any limits on the store itself.
+	// Default: 0, no limits.
+	OpsPerSecond   int
+	BytesPerSecond int
+}
+
+// ValueNamespace is a view of a ReplValueStore for one of several teams or
+// applications sharing it; see ReplValueStore.Namespace.
+type ValueNamespace struct {
+	rs         *ReplValueStore
+	name       string
+	keys       KeyNamespace
+	valueCap   int
+	byteQuota  int64
+	opsLimit   *tokenBucket
+	bytesLimit *tokenBucket
+	usageLock  sync.Mutex
+	usage      int64
+}
+
+// Namespace returns a view of the store whose keys are derived with the
+// namespace's own salt and whose requests are held to its value cap, quota,
+// and rate limits. Keys are given as bytes and hashed within the namespace,
+// so a namespace cannot address another's values.
+func (rs *ReplValueStore) Namespace(cfg *ValueNamespaceConfig) *ValueNamespace {
+	var c ValueNamespaceConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	salt := c.Salt
+	if salt == "" {
+		salt = c.Name
+	}
+	valueCap := rs.valueCap
+	if c.ValueCap > 0 && c.ValueCap < valueCap {
+		valueCap = c.ValueCap
+	}
+	return &ValueNamespace{
+		rs:         rs,
+		name:       c.Name,
+		keys:       NewKeyNamespace(salt),
+		valueCap:   valueCap,
+		byteQuota:  c.ByteQuota,
+		opsLimit:   newTokenBucket(c.OpsPerSecond),
+		bytesLimit: newTokenBucket(c.BytesPerSecond),
+	}
+}
+
+// Name returns the namespace's name.
+func (ns *ValueNamespace) Name() string {
+	return ns.name
+}
+
+// Keys returns the KeyNamespace the namespace derives its keys with, for
+// calling the store directly where the namespace has no equivalent.
+func (ns *ValueNamespace) Keys() KeyNamespace {
+	return ns.keys
+}
+
+// Usage returns how many bytes of values the namespace holds, as tracked by
+// this client.
+func (ns *ValueNamespace) Usage() int64 {
+	ns.usageLock.Lock()
+	defer ns.usageLock.Unlock()
+	return ns.usage
+}
+
+// SetUsage sets the namespace's usage, such as from a count kept elsewhere
+// when the client starts.
+func (ns *ValueNamespace) SetUsage(usage int64) {
+	ns.usageLock.Lock()
+	ns.usage = usage
+	ns.usageLock.Unlock()
+}
+
+// reserve adds delta to the usage, returning ErrQuotaExceeded instead if
+// that would take it past the quota.
+func (ns *ValueNamespace) reserve(delta int64) error {
+	ns.usageLock.Lock()
+	defer ns.usageLock.Unlock()
+	if delta > 0 && ns.byteQuota > 0 && ns.usage+delta > ns.byteQuota {
+		return &quotaExceededError{namespace: ns.name, usage: ns.usage, delta: delta, quota: ns.byteQuota}
+	}
+	ns.usage += delta
+	if ns.usage < 0 {
+		ns.usage = 0
+	}
+	return nil
+}
+
+// release takes delta back off the usage, whatever the quota.
+func (ns *ValueNamespace) release(delta int64) {
+	ns.usageLock.Lock()
+	ns.usage -= delta
+	if ns.usage < 0 {
+		ns.usage = 0
+	}
+	ns.usageLock.Unlock()
+}
+
+func (ns *ValueNamespace) take(ctx context.Context, n int) error {
+	if err := ns.opsLimit.take(ctx, 1); err != nil {
+		return err
+	}
+	return ns.bytesLimit.take(ctx, n)
+}
+
+// length returns the length of the value stored, or 0 if there is none; it
+// is only looked up when there is a quota to track.
+func (ns *ValueNamespace) length(ctx context.Context, keyA, keyB uint64) (int64, error) {
+	if ns.byteQuota <= 0 {
+		return 0, nil
+	}
+	_, length, err := ns.rs.Lookup(ctx, keyA, keyB)
+	if store.IsNotFound(err) {
+		return 0, nil
+	}
+	return int64(length), err
+}
+
+// Lookup is ReplValueStore.Lookup for a key within the namespace.
+func (ns *ValueNamespace) Lookup(ctx context.Context, key []byte) (int64, uint32, error) {
+	if err := ns.take(ctx, 0); err != nil {
+		return 0, 0, err
+	}
+	keyA, keyB := ns.keys.Hash(key)
+	return ns.rs.Lookup(ctx, keyA, keyB)
+}
+
+// Read is ReplValueStore.Read for a key within the namespace.
+func (ns *ValueNamespace) Read(ctx context.Context, key []byte, value []byte) (int64, []byte, error) {
+	if err := ns.opsLimit.take(ctx, 1); err != nil {
+		return 0, value, err
+	}
+	keyA, keyB := ns.keys.Hash(key)
+	timestampMicro, rvalue, err := ns.rs.Read(ctx, keyA, keyB, value)
+	ns.bytesLimit.take(ctx, len(rvalue)-len(value))
+	return timestampMicro, rvalue, err
+}
+
+// Write is ReplValueStore.Write for a key within the namespace. It returns
+// ErrValueTooLarge for a value over the namespace's ValueCap and
+// ErrQuotaExceeded if the value would take the namespace past its
+// ByteQuota; overwriting a value counts only the difference in length.
+func (ns *ValueNamespace) Write(ctx context.Context, key []byte, timestampMicro int64, value []byte) (int64, error) {
+	if len(value) > ns.valueCap {
+		return 0, &valueTooLargeError{length: len(value), valueCap: ns.valueCap}
+	}
+	if err := ns.take(ctx, len(value)); err != nil {
+		return 0, err
+	}
+	keyA, keyB := ns.keys.Hash(key)
+	old, err := ns.length(ctx, keyA, keyB)
+	if err != nil {
+		return 0, err
+	}
+	delta := int64(len(value)) - old
+	if err := ns.reserve(delta); err != nil {
+		return 0, err
+	}
+	oldTimestampMicro, err := ns.rs.Write(ctx, keyA, keyB, timestampMicro, value)
+	if err != nil || oldTimestampMicro >= timestampMicro {
+		// Not written, or superseded by a newer value already there.
+		ns.release(delta)
+	}
+	return oldTimestampMicro, err
+}
+
+// Delete is ReplValueStore.Delete for a key within the namespace; the
+// value's length is returned to the namespace's ByteQuota.
+func (ns *ValueNamespace) Delete(ctx context.Context, key []byte, timestampMicro int64) (int64, error) {
+	if err := ns.take(ctx, 0); err != nil {
+		return 0, err
+	}
+	keyA, keyB := ns.keys.Hash(key)
+	old, err := ns.length(ctx, keyA, keyB)
+	if err != nil {
+		return 0, err
+	}
+	oldTimestampMicro, err := ns.rs.Delete(ctx, keyA, keyB, timestampMicro)
+	if err == nil && oldTimestampMicro < timestampMicro {
+		ns.release(old)
+	}
+	return oldTimestampMicro, err
+}
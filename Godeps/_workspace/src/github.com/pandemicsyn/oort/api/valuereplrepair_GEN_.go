@@ -0,0 +1,161 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// repairKey queues the key for the background repair of its replicas, if the
+// repair queue is enabled and has room. Lookups and Reads queue keys when
+// replicas disagree on the newest timestamp, and Writes and Deletes when
+// some replicas could not be reached.
+func (rs *ReplValueStore) repairKey(key replValueCacheKey) {
+	if rs.repairQueueSize < 1 {
+		return
+	}
+	rs.repairLock.Lock()
+	if _, ok := rs.repairPending[key]; ok {
+		rs.repairLock.Unlock()
+		return
+	}
+	if len(rs.repairQueue) >= rs.repairQueueSize {
+		rs.repairLock.Unlock()
+		rs.logDebug("replValueStore: repair queue full; dropping %x %x", key.keyA, key.keyB)
+		return
+	}
+	rs.repairPending[key] = struct{}{}
+	rs.repairQueue = append(rs.repairQueue, key)
+	if !rs.repairing {
+		rs.repairing = true
+		go rs.repairer()
+	}
+	rs.repairLock.Unlock()
+}
+
+// repairQueueDepth returns the number of keys waiting to be repaired.
+func (rs *ReplValueStore) repairQueueDepth() int {
+	rs.repairLock.Lock()
+	depth := len(rs.repairQueue)
+	rs.repairLock.Unlock()
+	return depth
+}
+
+// repairer runs until the repair queue is empty, repairing at most RepairRate
+// keys per second.
+func (rs *ReplValueStore) repairer() {
+	ticker := time.NewTicker(time.Second / time.Duration(rs.repairRate))
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		rs.repairLock.Lock()
+		if len(rs.repairQueue) == 0 {
+			rs.repairing = false
+			rs.repairLock.Unlock()
+			return
+		}
+		key := rs.repairQueue[0]
+		rs.repairQueue = rs.repairQueue[1:]
+		delete(rs.repairPending, key)
+		rs.repairLock.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rs.failedConnectRetryDelay)*time.Second)
+		if err := rs.repair(ctx, key); err != nil {
+			rs.logDebug("replValueStore: error repairing %x %x: %s", key.keyA, key.keyB, err)
+		}
+		cancel()
+	}
+}
+
+// replValueReplicaRead is one replica's answer to readEachReplica.
+type replValueReplicaRead struct {
+	s              *replValueStoreAndTicketChan
+	timestampMicro int64
+	value          []byte
+	err            error
+}
+
+// readEachReplica reads the key from every replica, without merging,
+// returning the answers in the order the replicas are in the ring.
+func (rs *ReplValueStore) readEachReplica(ctx context.Context, key replValueCacheKey) ([]*replValueReplicaRead, error) {
+	stores, err := rs.storesFor(ctx, key.keyA)
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]*replValueReplicaRead, len(stores))
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		i, s := i, s
+		wg.Add(1)
+		s.workers.run(func() {
+			defer wg.Done()
+			ret := &replValueReplicaRead{s: s}
+			select {
+			case <-s.tickets(ctx):
+				sctx, done := rs.startReplica(ctx, "Read", s)
+				ret.timestampMicro, ret.value, ret.err = s.store.Read(sctx, key.keyA, key.keyB, nil)
+				if ret.err == nil {
+					ret.err = rs.codec.verify(ret.value)
+				}
+				done(ret.err)
+				s.tickets(ctx) <- struct{}{}
+			case <-ctx.Done():
+				ret.err = ctx.Err()
+			}
+			rets[i] = ret
+		})
+	}
+	wg.Wait()
+	return rets, nil
+}
+
+// repair reads the key from every replica and writes the newest value, or
+// deletion marker, to each replica that is behind.
+func (rs *ReplValueStore) repair(ctx context.Context, key replValueCacheKey) error {
+	reads, err := rs.readEachReplica(ctx, key)
+	if err != nil {
+		return err
+	}
+	var newest *replValueReplicaRead
+	rets := make([]*replValueReplicaRead, 0, len(reads))
+	for _, ret := range reads {
+		if ret.err != nil && !store.IsNotFound(ret.err) {
+			// Can't know what this replica has, so leave it be.
+			continue
+		}
+		rets = append(rets, ret)
+		if newest == nil || ret.timestampMicro > newest.timestampMicro {
+			newest = ret
+		}
+	}
+	if newest == nil || newest.timestampMicro == 0 {
+		return nil
+	}
+	for _, ret := range rets {
+		if ret.timestampMicro >= newest.timestampMicro {
+			continue
+		}
+		s := ret.s
+		select {
+		case <-s.tickets(ctx):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if newest.err != nil {
+			sctx, done := rs.startReplica(ctx, "Delete", s)
+			_, err = s.store.Delete(sctx, key.keyA, key.keyB, newest.timestampMicro)
+			done(err)
+		} else {
+			sctx, done := rs.startReplica(ctx, "Write", s)
+			_, err = s.store.Write(sctx, key.keyA, key.keyB, newest.timestampMicro, newest.value)
+			done(err)
+		}
+		s.tickets(ctx) <- struct{}{}
+		if err != nil {
+			return rs.storeError(s, err)
+		}
+		s.record(nil)
+	}
+	return nil
+}
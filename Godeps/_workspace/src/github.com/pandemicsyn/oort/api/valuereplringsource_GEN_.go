@@ -0,0 +1,57 @@
+package api
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gholt/ring"
+)
+
+// replValueRingUpdater is the RingUpdater the ReplValueStore gives its
+// RingSource.
+type replValueRingUpdater struct {
+	rs *ReplValueStore
+}
+
+func (u *replValueRingUpdater) Update(r ring.Ring) error {
+	if r == nil || r.Version() == u.rs.RingVersion() {
+		return nil
+	}
+	// This will cache the ring if ringCachePath is not empty.
+	if err := u.rs.applyRing(r); err != nil {
+		return err
+	}
+	if atomic.LoadInt64(&u.rs.ringContact) != 0 {
+		u.rs.touchRingContact(time.Now())
+	}
+	u.rs.logDebug("replValueStore: got new ring %d", r.Version())
+	return nil
+}
+
+func (u *replValueRingUpdater) Reachable(reachable bool) {
+	rs := u.rs
+	if reachable {
+		atomic.StoreInt32(&rs.ringReachable, 1)
+		rs.touchRingContact(time.Now())
+		return
+	}
+	if atomic.SwapInt32(&rs.ringReachable, 0) == 1 {
+		rs.touchRingContact(time.Now())
+	} else if atomic.LoadInt64(&rs.ringContact) == 0 {
+		// Never reached yet, so a ring loaded from RingCachePath is only as
+		// fresh as when it was received.
+		if receivedAt := rs.RingCacheInfo().ReceivedAt; !receivedAt.IsZero() {
+			rs.touchRingContact(receivedAt)
+		} else {
+			rs.touchRingContact(time.Now())
+		}
+	}
+}
+
+func (u *replValueRingUpdater) LogError(format string, args ...interface{}) {
+	u.rs.logError("replValueStore: "+format, args...)
+}
+
+func (u *replValueRingUpdater) LogDebug(format string, args ...interface{}) {
+	u.rs.logDebug("replValueStore: "+format, args...)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"io"
+
+	"github.com/pandemicsyn/oort/api/proto"
+	pb "github.com/pandemicsyn/oort/api/valueproto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ReplValueStoreServer serves the ValueStore gRPC service of
+// valueproto from a ReplValueStore, so it can run as a gateway or sidecar
+// giving applications in any language the ring aware replication of this
+// client through the protocol a single oort node speaks. Even a Go
+// application can point a plain NewValueStore at it.
+//
+// Errors are returned in each response's Err field, translated as the oort
+// servers do, so not found and disabled errors keep their meaning.
+type ReplValueStoreServer struct {
+	rs *ReplValueStore
+}
+
+// NewReplValueStoreServer returns a ReplValueStoreServer for rs, which
+// should already be started.
+func NewReplValueStoreServer(rs *ReplValueStore) *ReplValueStoreServer {
+	return &ReplValueStoreServer{rs: rs}
+}
+
+// Register registers the ValueStore service with g.
+func (s *ReplValueStoreServer) Register(g *grpc.Server) {
+	pb.RegisterValueStoreServer(g, s)
+}
+
+func (s *ReplValueStoreServer) translateError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return proto.TranslateError(err)
+}
+
+func (s *ReplValueStoreServer) write(ctx context.Context, req *pb.WriteRequest) *pb.WriteResponse {
+	resp := &pb.WriteResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, err = s.rs.Write(ctx, req.KeyA, req.KeyB, req.TimestampMicro, req.Value)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplValueStoreServer) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteResponse, error) {
+	return s.write(ctx, req), nil
+}
+
+func (s *ReplValueStoreServer) StreamWrite(stream pb.ValueStore_StreamWriteServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.write(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplValueStoreServer) lookup(ctx context.Context, req *pb.LookupRequest) *pb.LookupResponse {
+	resp := &pb.LookupResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, resp.Length, err = s.rs.Lookup(ctx, req.KeyA, req.KeyB)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplValueStoreServer) Lookup(ctx context.Context, req *pb.LookupRequest) (*pb.LookupResponse, error) {
+	return s.lookup(ctx, req), nil
+}
+
+func (s *ReplValueStoreServer) StreamLookup(stream pb.ValueStore_StreamLookupServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.lookup(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplValueStoreServer) read(ctx context.Context, req *pb.ReadRequest) *pb.ReadResponse {
+	resp := &pb.ReadResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, resp.Value, err = s.rs.Read(ctx, req.KeyA, req.KeyB, nil)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplValueStoreServer) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadResponse, error) {
+	return s.read(ctx, req), nil
+}
+
+func (s *ReplValueStoreServer) StreamRead(stream pb.ValueStore_StreamReadServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.read(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ReplValueStoreServer) delete(ctx context.Context, req *pb.DeleteRequest) *pb.DeleteResponse {
+	resp := &pb.DeleteResponse{Rpcid: req.Rpcid}
+	var err error
+	resp.TimestampMicro, err = s.rs.Delete(ctx, req.KeyA, req.KeyB, req.TimestampMicro)
+	resp.Err = s.translateError(err)
+	return resp
+}
+
+func (s *ReplValueStoreServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	return s.delete(ctx, req), nil
+}
+
+func (s *ReplValueStoreServer) StreamDelete(stream pb.ValueStore_StreamDeleteServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.delete(stream.Context(), req)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// replValueShadowOp is a Write, or a Delete if value is nil, to be mirrored
+// to the ShadowStore.
+type replValueShadowOp struct {
+	keyA           uint64
+	keyB           uint64
+	timestampMicro int64
+	value          []byte
+}
+
+// shadow queues the op to be mirrored to the ShadowStore, dropping it if the
+// queue is full so the primary store is never slowed down, or if Shutdown has
+// stopped the mirroring.
+func (rs *ReplValueStore) shadow(op *replValueShadowOp) {
+	if rs.shadowQueue == nil {
+		return
+	}
+	select {
+	case <-rs.shadowDone:
+		rs.metrics.shadowOps.WithLabelValues("dropped").Inc()
+		return
+	default:
+	}
+	select {
+	case rs.shadowQueue <- op:
+	default:
+		rs.metrics.shadowOps.WithLabelValues("dropped").Inc()
+	}
+}
+
+// stopShadowers stops the shadowers, waiting for any op in progress to
+// finish, returning ctx.Err() if the ctx is done first. Ops still queued are
+// counted as dropped.
+func (rs *ReplValueStore) stopShadowers(ctx context.Context) error {
+	if rs.shadowQueue == nil {
+		return nil
+	}
+	rs.shadowStopOnce.Do(func() {
+		close(rs.shadowDone)
+	})
+	stopped := make(chan struct{})
+	go func() {
+		rs.shadowWG.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for {
+		select {
+		case <-rs.shadowQueue:
+			rs.metrics.shadowOps.WithLabelValues("dropped").Inc()
+		default:
+			return nil
+		}
+	}
+}
+
+func (rs *ReplValueStore) shadower() {
+	defer rs.shadowWG.Done()
+	for {
+		var op *replValueShadowOp
+		select {
+		case op = <-rs.shadowQueue:
+		case <-rs.shadowDone:
+			return
+		}
+		start := time.Now()
+		ctx := context.Background()
+		var cancel context.CancelFunc
+		if rs.requestTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, rs.requestTimeout)
+		}
+		var err error
+		if op.value == nil {
+			_, err = rs.shadowStore.Delete(ctx, op.keyA, op.keyB, op.timestampMicro)
+		} else {
+			_, err = rs.shadowStore.Write(ctx, op.keyA, op.keyB, op.timestampMicro, op.value)
+		}
+		if cancel != nil {
+			cancel()
+		}
+		rs.metrics.shadowLatency.Observe(time.Since(start).Seconds())
+		if err != nil {
+			rs.metrics.shadowOps.WithLabelValues("error").Inc()
+			rs.logDebug("replValueStore: error mirroring to shadow store %x %x: %s", op.keyA, op.keyB, err)
+		} else {
+			rs.metrics.shadowOps.WithLabelValues("ok").Inc()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// splitChunkSize is how much of a split value each chunk holds, leaving room
+// for the checksum every chunk is given.
+func (rs *ReplValueStore) splitChunkSize() int {
+	return rs.valueCap - checksumFrameOverhead
+}
+
+// writeSplit is write for a value, already encoded, longer than ValueCap
+// with SplitLargeValues set. The value is split into chunks, each stored as
+// with WriteStream under a key derived from the one given and each with its
+// own checksum, and then a manifest describing the chunks is encoded, its
+// frame marked with frameSplitManifest, and written to the key given.
+// Splitting after encoding means the value is compressed and encrypted as a
+// whole.
+func (rs *ReplValueStore) writeSplit(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	size := rs.splitChunkSize()
+	m := &streamManifest{chunkSize: uint32(size), chunkCount: uint32((len(value) + size - 1) / size), length: uint64(len(value))}
+	keys := rs.streamChunkKeys(keyA, keyB, m.chunkCount)
+	batch := make([]ValueWriteItem, 0, rs.concurrentRequestsPerStore)
+	for i, k := range keys {
+		end := (i + 1) * size
+		if end > len(value) {
+			end = len(value)
+		}
+		batch = append(batch, ValueWriteItem{KeyA: k.KeyA, KeyB: k.KeyB, TimestampMicro: timestampMicro, Value: checksumFrame(value[i*size : end])})
+		if len(batch) == cap(batch) || i == len(keys)-1 {
+			for _, res := range rs.writeBatch(ctx, batch) {
+				if res.Err != nil {
+					return 0, res.Err
+				}
+			}
+			batch = batch[:0]
+		}
+	}
+	manifest, err := rs.codec.encode(withFrameFlags(ctx, frameSplitManifest), m.encode())
+	if err != nil {
+		return 0, err
+	}
+	return rs.write(ctx, keyA, keyB, timestampMicro, manifest)
+}
+
+// joinSplit returns the value, as Read would, reassembled from its chunks,
+// given the decoded manifest read in its place, one whose frame was marked
+// with frameSplitManifest. The chunks must have the manifest's
+// timestampMicro, so a chunk overwritten since is not mistaken for part of
+// the value.
+func (rs *ReplValueStore) joinSplit(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, manifest []byte) ([]byte, error) {
+	m := decodeStreamManifest(manifest)
+	if m == nil {
+		return nil, &corruptValueError{reason: fmt.Sprintf("split manifest of %d bytes", len(manifest))}
+	}
+	keys := rs.streamChunkKeys(keyA, keyB, m.chunkCount)
+	chunks := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for start := 0; start < len(keys); start += rs.concurrentRequestsPerStore {
+		end := start + rs.concurrentRequestsPerStore
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				k := &keys[i]
+				chunkTimestampMicro, raw, err := rs.read(ctx, k.KeyA, k.KeyB, nil)
+				if err == nil && chunkTimestampMicro != timestampMicro {
+					err = &corruptValueError{reason: fmt.Sprintf("split chunk %d has timestamp %d rather than %d", i, chunkTimestampMicro, timestampMicro)}
+				}
+				if err == nil {
+					_, _, chunks[i], err = parseFrame(raw)
+				}
+				errs[i] = err
+			}(i)
+		}
+		wg.Wait()
+		for i := start; i < end; i++ {
+			if errs[i] != nil {
+				if store.IsNotFound(errs[i]) {
+					return nil, &corruptValueError{reason: fmt.Sprintf("split chunk %d missing", i)}
+				}
+				return nil, errs[i]
+			}
+		}
+	}
+	joined := make([]byte, 0, m.length)
+	for _, chunk := range chunks {
+		joined = append(joined, chunk...)
+	}
+	value, h, err := rs.codec.decode(ctx, joined)
+	if err == nil {
+		err = rs.unexpired(keyA, keyB, timestampMicro, h.expiresMicro)
+	}
+	return value, err
+}
+
+// deleteSplitChunks deletes the chunks of the value for the key given, if it
+// was split and is older than timestampMicro, ahead of the manifest being
+// deleted. The value cannot always be read, in which case its chunks are
+// left for the backend stores to hold on to.
+func (rs *ReplValueStore) deleteSplitChunks(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) error {
+	oldTimestampMicro, raw, err := rs.read(ctx, keyA, keyB, nil)
+	if err != nil || oldTimestampMicro >= timestampMicro {
+		return nil
+	}
+	value, h, err := rs.codec.decode(ctx, raw)
+	if err != nil || h.flags&frameSplitManifest == 0 {
+		return nil
+	}
+	m := decodeStreamManifest(value)
+	if m == nil {
+		return nil
+	}
+	for i, k := range rs.streamChunkKeys(keyA, keyB, m.chunkCount) {
+		if _, err := rs.delete(ctx, k.KeyA, k.KeyB, timestampMicro); err != nil {
+			return fmt.Errorf("error deleting split chunk %d: %s", i, err)
+		}
+	}
+	return nil
+}
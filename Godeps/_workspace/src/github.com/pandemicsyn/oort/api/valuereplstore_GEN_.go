@@ -2,11 +2,9 @@ package api
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,50 +20,250 @@ import (
 )
 
 type ReplValueStore struct {
-	logError                   func(string, ...interface{})
-	logDebug                   func(string, ...interface{})
-	logDebugOn                 bool
-	addressIndex               int
-	valueCap                   int
-	concurrentRequestsPerStore int
-	failedConnectRetryDelay    int
-	ftlsConfig                 *ftls.Config
-	grpcOpts                   []grpc.DialOption
-
-	ringLock           sync.RWMutex
-	ring               ring.Ring
+	// ringContact is first to keep it 64-bit aligned for atomic use; it is
+	// the UnixNano of the last contact with the ring service; see ringStale.
+	ringContact int64
+	// writesDisabled is next to keep it aligned for atomic use; see
+	// DisableWrites.
+	writesDisabled int32
+	// ringReachable is 1 while the RingSource reports it can reach its
+	// rings.
+	ringReachable                int32
+	ringStaleAfter               time.Duration
+	logError                     func(string, ...interface{})
+	logDebug                     func(string, ...interface{})
+	logDebugOn                   bool
+	addressIndex                 int
+	replicaSelector              ReplicaSelector
+	valueCap                     int
+	streamChunkSize              int
+	splitLargeValues             bool
+	concurrentRequestsPerStore   int
+	highPriorityRequestsPerStore int
+	connectionsPerStore          int
+	failedConnectRetryDelay      int
+	backoff                      *reconnectBackoff
+	storeDrainTimeout            int
+	retryPolicy                  *RetryPolicy
+	codec                        *valueCodec
+	expiringValues               bool
+	deleteExpired                bool
+	readOpsLimit                 *tokenBucket
+	readBytesLimit               *tokenBucket
+	writeOpsLimit                *tokenBucket
+	writeBytesLimit              *tokenBucket
+	tracer                       Tracer
+	authorizer                   Authorizer
+	auditSink                    AuditSink
+	auditSigningKey              []byte
+	handler                      ValueHandler
+	auditPassProgress            func(addr string, err error, done, total int)
+	validateRing                 func(oldRing, newRing ring.Ring) error
+	stateChanges                 chan ReplStoreBackendStateChange
+	ringChanges                  chan ReplStoreRingChange
+	requestTimeout               time.Duration
+	shadowStore                  store.ValueStore
+	shadowQueue                  chan *replValueShadowOp
+	shadowDone                   chan struct{}
+	shadowStopOnce               sync.Once
+	shadowWG                     sync.WaitGroup
+	readCache                    *replValueCache
+	notFoundCache                *replValueCache
+	readCalls                    *replValueReadCalls
+	watchers                     watchRegistry
+	readStrategy                 ReadStrategy
+	readHedgeDelay               time.Duration
+	readPartialMargin            time.Duration
+	writeAck                     WriteAck
+	readReplicas                 int
+	localTier                    string
+	localTierLevel               int
+	ftlsConfig                   *ftls.Config
+	grpcOpts                     []grpc.DialOption
+
+	ringLock sync.RWMutex
+	ring     ring.Ring
+	// localAddrs are the addresses of the nodes in the ring in the
+	// localTier; guarded by ringLock.
+	localAddrs         map[string]struct{}
 	ringCachePath      string
-	ringServer         string
-	ringServerGRPCOpts []grpc.DialOption
-	ringServerExitChan chan struct{}
-	ringClientID       string
+	startupWaitForRing time.Duration
+	// ringInfo describes the ring; it is guarded by ringLock.
+	ringInfo   RingCacheInfo
+	ringSource RingSource
+	// newBackendStore creates the store for a backend address.
+	newBackendStore      func(addr string) (store.ValueStore, error)
+	wrapStore            func(addr string, s store.ValueStore) store.ValueStore
+	ringServer           string
+	ringServerSRV        *srvResolver
+	ringServerGRPCOpts   []grpc.DialOption
+	ringServerFTLSConfig *ftls.Config
+	ringServerCancel     context.CancelFunc
+	ringServerDoneChan   chan struct{}
 
 	storesLock sync.RWMutex
 	stores     map[string]*replValueStoreAndTicketChan
+
+	metrics *replValueStoreMetrics
+
+	hintedHandoffMaxBytes int
+	hintedHandoffPath     string
+	hintsLock             sync.Mutex
+	hints                 map[string][]*replValueHint
+	hintCount             int
+	hintBytes             int
+	hintsFile             *os.File
+	hintsReplaying        bool
+
+	repairQueueSize int
+	repairRate      int
+	repairLock      sync.Mutex
+	repairQueue     []replValueCacheKey
+	repairPending   map[replValueCacheKey]struct{}
+	repairing       bool
 }
 
 type replValueStoreAndTicketChan struct {
-	store      store.ValueStore
-	ticketChan chan struct{}
+	// lastSuccess and latency are first to keep them 64-bit aligned for
+	// atomic use.
+	lastSuccess int64
+	latency     int64
+	addr        string
+	store       store.ValueStore
+	ticketChan  chan struct{}
+	// highTicketChan holds the tickets for PriorityHigh requests.
+	highTicketChan chan struct{}
+	// workers runs the requests to this store.
+	workers workerPool
+	// state is the last state sent to stateChange; see record.
+	state       int32
+	stateChange func(state string, err error)
+
+	// These are only for Health; see record.
+	lastErrorLock sync.Mutex
+	lastError     string
+	lastErrorTime int64
 }
 
 func NewReplValueStore(c *ReplValueStoreConfig) *ReplValueStore {
 	cfg := resolveReplValueStoreConfig(c)
 	rs := &ReplValueStore{
-		logError:                   cfg.LogError,
-		logDebug:                   cfg.LogDebug,
-		logDebugOn:                 cfg.LogDebug != nil,
-		addressIndex:               cfg.AddressIndex,
-		valueCap:                   int(cfg.ValueCap),
-		concurrentRequestsPerStore: cfg.ConcurrentRequestsPerStore,
-		failedConnectRetryDelay:    cfg.FailedConnectRetryDelay,
-		ftlsConfig:                 cfg.StoreFTLSConfig,
-		grpcOpts:                   cfg.GRPCOpts,
-		stores:                     make(map[string]*replValueStoreAndTicketChan),
-		ringServer:                 cfg.RingServer,
-		ringServerGRPCOpts:         cfg.RingServerGRPCOpts,
-		ringCachePath:              cfg.RingCachePath,
-		ringClientID:               cfg.RingClientID,
+		logError:                     cfg.LogError,
+		logDebug:                     cfg.LogDebug,
+		logDebugOn:                   cfg.LogDebug != nil,
+		addressIndex:                 cfg.AddressIndex,
+		replicaSelector:              cfg.ReplicaSelector,
+		valueCap:                     int(cfg.ValueCap),
+		streamChunkSize:              int(cfg.StreamChunkSize),
+		splitLargeValues:             cfg.SplitLargeValues,
+		concurrentRequestsPerStore:   cfg.ConcurrentRequestsPerStore,
+		highPriorityRequestsPerStore: cfg.HighPriorityRequestsPerStore,
+		connectionsPerStore:          cfg.ConnectionsPerStore,
+		failedConnectRetryDelay:      cfg.FailedConnectRetryDelay,
+		backoff:                      newReconnectBackoff(cfg.ReconnectBackoffInitial, cfg.ReconnectBackoffMax),
+		storeDrainTimeout:            cfg.StoreDrainTimeout,
+		retryPolicy:                  cfg.RetryPolicy,
+		expiringValues:               cfg.ExpiringValues,
+		deleteExpired:                cfg.DeleteExpired,
+		codec:                        newValueCodec(cfg.EncodeValue, cfg.DecodeValue, cfg.Compressor, cfg.CompressMinSize, cfg.KeyProvider, cfg.Checksum, cfg.ExpiringValues || cfg.SplitLargeValues || cfg.FramedValues, cfg.LegacyRawValues),
+		readOpsLimit:                 newTokenBucket(cfg.ReadOpsPerSecond),
+		readBytesLimit:               newTokenBucket(cfg.ReadBytesPerSecond),
+		writeOpsLimit:                newTokenBucket(cfg.WriteOpsPerSecond),
+		writeBytesLimit:              newTokenBucket(cfg.WriteBytesPerSecond),
+		tracer:                       cfg.Tracer,
+		authorizer:                   cfg.Authorizer,
+		auditSink:                    cfg.AuditSink,
+		auditSigningKey:              cfg.AuditSigningKey,
+		auditPassProgress:            cfg.AuditPassProgress,
+		ringStaleAfter:               cfg.RingStaleAfter,
+		startupWaitForRing:           cfg.StartupWaitForRing,
+		validateRing:                 cfg.ValidateRing,
+		requestTimeout:               cfg.DefaultRequestTimeout,
+		shadowStore:                  cfg.ShadowStore,
+		readCache:                    newReplValueCache(cfg.ReadCacheSize, cfg.ReadCacheTTL),
+		notFoundCache:                newReplValueCache(cfg.NotFoundCacheSize, cfg.NotFoundCacheTTL),
+		readCalls:                    newReplValueReadCalls(cfg.CoalesceReads),
+		readStrategy:                 cfg.ReadStrategy,
+		readHedgeDelay:               cfg.ReadHedgeDelay,
+		readPartialMargin:            cfg.ReadPartialMargin,
+		writeAck:                     cfg.WriteAck,
+		readReplicas:                 cfg.ReadReplicas,
+		localTier:                    cfg.LocalTier,
+		localTierLevel:               cfg.LocalTierLevel,
+		ftlsConfig:                   cfg.StoreFTLSConfig,
+		grpcOpts:                     cfg.GRPCOpts,
+		stores:                       make(map[string]*replValueStoreAndTicketChan),
+		ringServer:                   cfg.RingServer,
+		ringServerGRPCOpts:           cfg.RingServerGRPCOpts,
+		ringServerFTLSConfig:         cfg.RingServerFTLSConfig,
+		ringCachePath:                cfg.RingCachePath,
+		ringSource:                   cfg.RingSource,
+		wrapStore:                    cfg.WrapStore,
+		hintedHandoffMaxBytes:        cfg.HintedHandoffMaxBytes,
+		hintedHandoffPath:            cfg.HintedHandoffPath,
+		hints:                        make(map[string][]*replValueHint),
+		repairQueueSize:              cfg.RepairQueueSize,
+		repairRate:                   cfg.RepairRate,
+		repairPending:                make(map[replValueCacheKey]struct{}),
+	}
+	rs.metrics = newReplValueStoreMetrics(rs)
+	rs.handler = rs.chain(cfg.Middleware)
+	rs.newBackendStore = func(addr string) (store.ValueStore, error) {
+		return NewValueStorePool(addr, rs.connectionsPerStore, rs.concurrentRequestsPerStore+rs.highPriorityRequestsPerStore, rs.ftlsConfig, rs.grpcOpts...)
+	}
+	if rs.ringSource == nil {
+		pollInterval := time.Duration(cfg.RingFilePollInterval) * time.Second
+		if cfg.RingFile != "" {
+			rs.ringSource = &RingFileSource{Path: cfg.RingFile, PollInterval: pollInterval}
+		} else if cfg.RingURL != "" {
+			rs.ringSource = &RingURLSource{URL: cfg.RingURL, Client: cfg.RingURLClient, PollInterval: pollInterval}
+		} else {
+			src := &SyndicateRingSource{Dial: rs.dialRingServer, ClientID: cfg.RingClientID}
+			if cfg.RingServerRecheck > 0 && cfg.RingServer == "" {
+				src.Recheck = rs.ringServerListed
+				src.RecheckInterval = cfg.RingServerRecheck
+			}
+			rs.ringSource = src
+		}
+	}
+	if cfg.OnBackendStateChange != nil {
+		rs.stateChanges = make(chan ReplStoreBackendStateChange, 1024)
+		go func(f func(ReplStoreBackendStateChange), c chan ReplStoreBackendStateChange) {
+			for change := range c {
+				f(change)
+			}
+		}(cfg.OnBackendStateChange, rs.stateChanges)
+	}
+	if cfg.OnRingChange != nil {
+		rs.ringChanges = make(chan ReplStoreRingChange, 64)
+		go func(f func(ReplStoreRingChange), c chan ReplStoreRingChange) {
+			for change := range c {
+				f(change)
+			}
+		}(cfg.OnRingChange, rs.ringChanges)
+	}
+	if rs.shadowStore != nil {
+		rs.shadowQueue = make(chan *replValueShadowOp, cfg.ShadowQueueSize)
+		rs.shadowDone = make(chan struct{})
+		rs.shadowWG.Add(cfg.ShadowConcurrency)
+		for i := 0; i < cfg.ShadowConcurrency; i++ {
+			go rs.shadower()
+		}
+	}
+	if cfg.KeepAlive > 0 {
+		// Given first so a dialer in the configured options still wins.
+		rs.grpcOpts = append([]grpc.DialOption{keepAliveDialer(cfg.KeepAlive)}, rs.grpcOpts...)
+		rs.ringServerGRPCOpts = append([]grpc.DialOption{keepAliveDialer(cfg.KeepAlive)}, rs.ringServerGRPCOpts...)
+	}
+	if cfg.DefaultConnectTimeout > 0 {
+		rs.grpcOpts = append(append([]grpc.DialOption{}, rs.grpcOpts...), grpc.WithTimeout(cfg.DefaultConnectTimeout))
+	}
+	if cfg.PerRPCCredentials != nil {
+		rs.grpcOpts = append(append([]grpc.DialOption{}, rs.grpcOpts...), grpc.WithPerRPCCredentials(cfg.PerRPCCredentials))
+		rs.ringServerGRPCOpts = append(append([]grpc.DialOption{}, rs.ringServerGRPCOpts...), grpc.WithPerRPCCredentials(cfg.PerRPCCredentials))
+	}
+	if cfg.RingServerSRV != "" {
+		rs.ringServerSRV = &srvResolver{name: cfg.RingServerSRV}
 	}
 	if rs.logError == nil {
 		rs.logError = flog.Default.ErrorPrintf
@@ -74,19 +272,51 @@ func NewReplValueStore(c *ReplValueStoreConfig) *ReplValueStore {
 		rs.logDebug = func(string, ...interface{}) {}
 	}
 	if rs.ringCachePath != "" {
-		if fp, err := os.Open(rs.ringCachePath); err != nil {
-			rs.logDebug("replValueStore: error loading cached ring %q: %s", rs.ringCachePath, err)
-		} else if r, err := ring.LoadRing(fp); err != nil {
-			fp.Close()
+		r, info, err := loadRingCache(rs.ringCachePath)
+		if err != nil {
+			// Corrupt, or missing should the client have stopped part way
+			// through caching a new ring; either way the previous ring, if
+			// any, is better than none.
+			if !os.IsNotExist(err) {
+				rs.logError("replValueStore: error loading cached ring %q, trying the previous ring: %s", rs.ringCachePath, err)
+			}
+			if bakR, bakInfo, bakErr := loadRingCache(rs.ringCachePath + ".bak"); bakErr == nil {
+				r, info, err = bakR, bakInfo, nil
+			}
+		}
+		if err != nil {
 			rs.logDebug("replValueStore: error loading cached ring %q: %s", rs.ringCachePath, err)
+		} else if cfg.RingCacheMaxAge > 0 && time.Since(info.ReceivedAt) > cfg.RingCacheMaxAge {
+			rs.logError("replValueStore: not using cached ring %q: received %s ago", rs.ringCachePath, time.Since(info.ReceivedAt))
 		} else {
-			fp.Close()
 			rs.ring = r
+			rs.ringInfo = info
+			rs.localAddrs = rs.localAddrsFor(r)
 		}
 	}
+	if rs.ring == nil && len(cfg.FallbackNodes) > 0 {
+		go rs.fallBack(newFallbackRing(cfg.FallbackNodes, cfg.FallbackReplicas, rs.addressIndex), cfg.FallbackDelay)
+	}
+	if rs.hintedHandoffPath != "" {
+		rs.loadHints()
+	}
 	return rs
 }
 
+// fallBack uses the fallback ring given if no ring has arrived after the
+// delay; see FallbackNodes.
+func (rs *ReplValueStore) fallBack(r ring.Ring, delay time.Duration) {
+	time.Sleep(delay)
+	rs.ringLock.Lock()
+	if rs.ring == nil {
+		rs.logError("replValueStore: no ring after %s; routing by hash to %d fallback nodes", delay, r.NodeCount())
+		rs.ring = r
+		rs.ringInfo = RingCacheInfo{Version: r.Version(), ReceivedAt: time.Now()}
+		rs.localAddrs = rs.localAddrsFor(r)
+	}
+	rs.ringLock.Unlock()
+}
+
 func (rs *ReplValueStore) Ring(ctx context.Context) ring.Ring {
 	var r ring.Ring
 	rs.ringLock.RLock()
@@ -105,30 +335,118 @@ func (rs *ReplValueStore) Ring(ctx context.Context) ring.Ring {
 	return r
 }
 
+// ReplicasFor returns the backend stores responsible for keys with the keyA
+// given under the current ring, in the order the ReplicaSelector gives, for
+// logging and debugging placement. It waits for a ring as Ring does,
+// returning ErrNoRing if the ctx is done first.
+func (rs *ReplValueStore) ReplicasFor(ctx context.Context, keyA uint64) ([]ReplicaNode, error) {
+	r := rs.Ring(ctx)
+	if r == nil {
+		return nil, ErrNoRing
+	}
+	return replicaNodes(r, keyA, rs.replicaSelector.Select(r, keyA), rs.addressIndex), nil
+}
+
+// PartitionMap returns the placement of every partition under the current
+// ring, as ReplicasFor would give for each. It waits for a ring as Ring
+// does, returning ErrNoRing if the ctx is done first.
+func (rs *ReplValueStore) PartitionMap(ctx context.Context) (*PartitionMap, error) {
+	r := rs.Ring(ctx)
+	if r == nil {
+		return nil, ErrNoRing
+	}
+	return newPartitionMap(r, rs.replicaSelector, rs.addressIndex), nil
+}
+
+// RingVersion returns the version of the ring in use, or 0 if there is no
+// ring yet.
+func (rs *ReplValueStore) RingVersion() int64 {
+	rs.ringLock.RLock()
+	defer rs.ringLock.RUnlock()
+	if rs.ring == nil {
+		return 0
+	}
+	return rs.ring.Version()
+}
+
+// RingCacheInfo returns the version of the ring in use, when it was received,
+// and whether it was loaded from RingCachePath, such as for deciding whether
+// a ring cached before a restart is too stale to trust. The zero value is
+// returned if there is no ring yet.
+func (rs *ReplValueStore) RingCacheInfo() RingCacheInfo {
+	rs.ringLock.RLock()
+	defer rs.ringLock.RUnlock()
+	return rs.ringInfo
+}
+
+// RefreshRing asks the ring service for its current ring with a single call,
+// rather than waiting on the ring stream, and sets it if it is newer than
+// the ring in use. It is for forcing convergence after a planned change; the
+// version of the ring in use afterwards is returned.
+func (rs *ReplValueStore) RefreshRing(ctx context.Context) (int64, error) {
+	conn, ringServer, err := rs.dialRingServer()
+	if err != nil {
+		return rs.RingVersion(), err
+	}
+	defer conn.Close()
+	res, err := synpb.NewSyndicateClient(conn).GetRing(ctx, &synpb.EmptyMsg{})
+	if err != nil {
+		return rs.RingVersion(), fmt.Errorf("error getting ring from ring service %q: %s", ringServer, err)
+	}
+	r, err := ring.LoadRing(bytes.NewBuffer(res.Ring))
+	if err != nil {
+		return rs.RingVersion(), fmt.Errorf("error with ring from ring service %q: %s", ringServer, err)
+	}
+	if r.Version() > rs.RingVersion() {
+		if err := rs.applyRing(r); err != nil {
+			return rs.RingVersion(), err
+		}
+	}
+	return rs.RingVersion(), nil
+}
+
+// applyRing sets a ring received from the RingSource or RefreshRing, unless
+// ValidateRing rejects it.
+func (rs *ReplValueStore) applyRing(r ring.Ring) error {
+	if rs.validateRing != nil {
+		rs.ringLock.RLock()
+		current := rs.ring
+		rs.ringLock.RUnlock()
+		if current != nil {
+			if err := rs.validateRing(current, r); err != nil {
+				return &ringRejectedError{version: r.Version(), err: err}
+			}
+		}
+	}
+	rs.SetRing(r)
+	return nil
+}
+
 func (rs *ReplValueStore) SetRing(r ring.Ring) {
 	if r == nil {
 		return
 	}
 	rs.ringLock.Lock()
+	receivedAt := time.Now()
 	if rs.ringCachePath != "" {
-		dir, name := path.Split(rs.ringCachePath)
-		_ = os.MkdirAll(dir, 0755)
-		fp, err := ioutil.TempFile(dir, name)
-		if err != nil {
+		if err := writeRingCache(rs.ringCachePath, r, receivedAt); err != nil {
 			rs.logDebug("replValueStore: error caching ring %q: %s", rs.ringCachePath, err)
-		} else if err := r.Persist(fp); err != nil {
-			fp.Close()
-			os.Remove(fp.Name())
-			rs.logDebug("replValueStore: error caching ring %q: %s", rs.ringCachePath, err)
-		} else {
-			fp.Close()
-			if err := os.Rename(fp.Name(), rs.ringCachePath); err != nil {
-				os.Remove(fp.Name())
-				rs.logDebug("replValueStore: error caching ring %q: %s", rs.ringCachePath, err)
-			}
+		}
+	}
+	_, span := startSpan(rs.tracer, context.Background(), "ReplValueStore.SetRing")
+	span.SetAttribute("ringVersion", r.Version())
+	if rs.ringChanges != nil {
+		change := newReplStoreRingChange(rs.ring, r, rs.addressIndex)
+		select {
+		case rs.ringChanges <- change:
+		default:
+			rs.logDebug("replValueStore: dropping ring change to %d", change.NewVersion)
 		}
 	}
 	rs.ring = r
+	rs.ringInfo = RingCacheInfo{Version: r.Version(), ReceivedAt: receivedAt}
+	rs.localAddrs = rs.localAddrsFor(r)
+	rs.metrics.ringUpdates.Inc()
 	var currentAddrs map[string]struct{}
 	if r != nil {
 		nodes := r.Nodes()
@@ -153,16 +471,171 @@ func (rs *ReplValueStore) SetRing(r ring.Ring) {
 			rs.stores[a] = nil
 		}
 		rs.storesLock.Unlock()
-		for i, s := range shutdownStores {
-			if err := s.store.Shutdown(context.Background()); err != nil {
-				rs.logDebug("replValueStore: error during shutdown of store %s: %s", shutdownAddrs[i], err)
+		for _, s := range shutdownStores {
+			if s != nil {
+				go rs.drainStore(s, true)
 			}
 		}
 	}
 	rs.ringLock.Unlock()
+	span.End(nil)
+}
+
+// tickets returns the channel of request tickets for the Priority of the ctx;
+// a ticket must be received before issuing a request to the store and sent
+// back once the request is done.
+func (s *replValueStoreAndTicketChan) tickets(ctx context.Context) chan struct{} {
+	if PriorityFrom(ctx) == PriorityHigh {
+		return s.highTicketChan
+	}
+	return s.ticketChan
+}
+
+func (s *replValueStoreAndTicketChan) ticketsInUse() int {
+	return cap(s.ticketChan) - len(s.ticketChan) + cap(s.highTicketChan) - len(s.highTicketChan)
+}
+
+// drainStore waits, up to StoreDrainTimeout seconds, for the requests in
+// flight to a store no longer in use to return their tickets and then shuts
+// the store down; removed indicates the store has left the ring. The store
+// has already been removed from rs.stores so no new requests will be routed
+// to it.
+func (rs *ReplValueStore) drainStore(s *replValueStoreAndTicketChan, removed bool) {
+	rs.logDebug("replValueStore: draining store %s", s.addr)
+	deadline := time.Now().Add(time.Duration(rs.storeDrainTimeout) * time.Second)
+	for s.ticketsInUse() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if inUse := s.ticketsInUse(); inUse > 0 {
+		rs.logDebug("replValueStore: shutting down store %s with %d requests still in flight", s.addr, inUse)
+	}
+	if err := s.store.Shutdown(context.Background()); err != nil {
+		rs.logDebug("replValueStore: error during shutdown of store %s: %s", s.addr, err)
+	}
+	if removed {
+		s.stateChange("removed", nil)
+	}
+}
+
+func (rs *ReplValueStore) newStoreAndTicketChan(addr string) *replValueStoreAndTicketChan {
+	tc := make(chan struct{}, rs.concurrentRequestsPerStore)
+	for i := cap(tc); i > 0; i-- {
+		tc <- struct{}{}
+	}
+	htc := make(chan struct{}, rs.highPriorityRequestsPerStore)
+	for i := cap(htc); i > 0; i-- {
+		htc <- struct{}{}
+	}
+	return &replValueStoreAndTicketChan{addr: addr, ticketChan: tc, highTicketChan: htc, workers: newWorkerPool(), stateChange: rs.stateChangeFunc(addr)}
+}
+
+// clearErrorStore waits for the delay and then, if the addr still has an
+// error store, clears it so the next request will reconnect.
+func (rs *ReplValueStore) clearErrorStore(addr string, delay time.Duration) {
+	time.Sleep(delay)
+	rs.storesLock.Lock()
+	s := rs.stores[addr]
+	if s != nil {
+		if _, ok := s.store.(errorValueStore); ok {
+			rs.stores[addr] = nil
+			s.stateChange("unconnected", nil)
+		}
+	}
+	rs.storesLock.Unlock()
+}
+
+// connectionFailed swaps the store, whose connection has failed, for an error
+// store until its reconnect backoff has passed, so requests fail fast rather
+// than each trying to reconnect to a backend that is down.
+func (rs *ReplValueStore) connectionFailed(s *replValueStoreAndTicketChan, err error) {
+	rs.storesLock.Lock()
+	if rs.stores[s.addr] != s {
+		// Already swapped out, or removed from the ring.
+		rs.storesLock.Unlock()
+		return
+	}
+	delay := rs.backoff.fail(s.addr)
+	es := rs.newStoreAndTicketChan(s.addr)
+	es.store = errorValueStore(fmt.Sprintf("connection to %s failed, retrying in %s: %s", s.addr, delay, err))
+	rs.stores[s.addr] = es
+	rs.storesLock.Unlock()
+	es.stateChange("error", err)
+	go rs.clearErrorStore(s.addr, delay)
+	go rs.drainStore(s, false)
+}
+
+// stateChangeFunc returns the func a store for the addr uses to report its
+// state changes to OnBackendStateChange; it also resets the addr's reconnect
+// backoff once it has connected.
+func (rs *ReplValueStore) stateChangeFunc(addr string) func(string, error) {
+	return func(state string, err error) {
+		if state == "connected" {
+			rs.backoff.reset(addr)
+		}
+		if rs.stateChanges == nil {
+			return
+		}
+		select {
+		case rs.stateChanges <- ReplStoreBackendStateChange{Addr: addr, State: state, Err: err, Time: time.Now()}:
+		default:
+			rs.logDebug("replValueStore: dropping %s state change for %s", state, addr)
+		}
+	}
+}
+
+// startReplica prepares the ctx for a request to a single backend store,
+// applying the DefaultRequestTimeout if the ctx has no deadline of its own and
+// starting the request's span. The func returned must be called with the
+// request's error once it completes, and records the request's latency.
+func (rs *ReplValueStore) startReplica(ctx context.Context, op string, s *replValueStoreAndTicketChan) (context.Context, func(error)) {
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); !ok {
+		if timeout := RequestTimeoutFrom(ctx, rs.requestTimeout); timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+	}
+	ctx, span := startSpan(rs.tracer, ctx, "ReplValueStore."+op+".replica")
+	span.SetAttribute("addr", s.addr)
+	start := time.Now()
+	return ctx, func(err error) {
+		if err != context.Canceled {
+			s.recordLatency(time.Since(start))
+		}
+		span.End(err)
+		if cancel != nil {
+			cancel()
+		}
+	}
+}
+
+// newReadFanOut starts a readFanOut using the ReadStrategy for the ctx.
+func (rs *ReplValueStore) newReadFanOut(ctx context.Context, count int, limit int, launch func(i int)) *readFanOut {
+	strategy := ReadStrategyFrom(ctx, rs.readStrategy)
+	delay := rs.readHedgeDelay
+	if delay == 0 && strategy == ReadHedged {
+		delay = defaultReadHedgeDelay
+	}
+	return newReadFanOut(strategy, delay, count, limit, launch)
 }
 
 func (rs *ReplValueStore) storesFor(ctx context.Context, keyA uint64) ([]*replValueStoreAndTicketChan, error) {
+	ctx, span := startSpan(rs.tracer, ctx, "ReplValueStore.storesFor")
+	span.SetAttribute("keyA", keyA)
+	ss, err := rs.storesForKey(ctx, keyA)
+	span.End(err)
+	return ss, err
+}
+
+// readStoresFor is storesFor for reads, which may be pinned to a single
+// replica with WithReplica.
+func (rs *ReplValueStore) readStoresFor(ctx context.Context, keyA uint64) ([]*replValueStoreAndTicketChan, error) {
+	if addr := ReplicaFrom(ctx); addr != "" {
+		return rs.storesForAddrs(ctx, []string{addr})
+	}
+	return rs.storesFor(ctx, keyA)
+}
+
+func (rs *ReplValueStore) storesForKey(ctx context.Context, keyA uint64) ([]*replValueStoreAndTicketChan, error) {
 	r := rs.Ring(ctx)
 	select {
 	case <-ctx.Done():
@@ -170,14 +643,15 @@ func (rs *ReplValueStore) storesFor(ctx context.Context, keyA uint64) ([]*replVa
 	default:
 	}
 	if r == nil {
-		return nil, noRingErr
-	}
-	ns := r.ResponsibleNodes(uint32(keyA >> (64 - r.PartitionBitCount())))
-	as := make([]string, len(ns))
-	for i, n := range ns {
-		as[i] = n.Address(rs.addressIndex)
+		return nil, ErrNoRing
 	}
-	ss := make([]*replValueStoreAndTicketChan, len(ns))
+	return rs.storesForAddrs(ctx, rs.replicaSelector.Select(r, keyA))
+}
+
+// storesForAddrs returns the stores for the addresses given, creating any
+// not yet connected to.
+func (rs *ReplValueStore) storesForAddrs(ctx context.Context, as []string) ([]*replValueStoreAndTicketChan, error) {
+	ss := make([]*replValueStoreAndTicketChan, len(as))
 	var someNil bool
 	rs.storesLock.RLock()
 	for i := len(ss) - 1; i >= 0; i-- {
@@ -205,27 +679,15 @@ func (rs *ReplValueStore) storesFor(ctx context.Context, keyA uint64) ([]*replVa
 				ss[i] = rs.stores[as[i]]
 				if ss[i] == nil {
 					var err error
-					tc := make(chan struct{}, rs.concurrentRequestsPerStore)
-					for i := cap(tc); i > 0; i-- {
-						tc <- struct{}{}
-					}
-					ss[i] = &replValueStoreAndTicketChan{ticketChan: tc}
-					ss[i].store, err = NewValueStore(as[i], rs.concurrentRequestsPerStore, rs.ftlsConfig, rs.grpcOpts...)
+					ss[i] = rs.newStoreAndTicketChan(as[i])
+					ss[i].store, err = rs.newBackendStore(as[i])
 					if err != nil {
-						ss[i].store = errorValueStore(fmt.Sprintf("could not create store for %s: %s", as[i], err))
-						// Launch goroutine to clear out the error store after
-						// some time so a retry will occur.
-						go func(addr string) {
-							time.Sleep(time.Duration(rs.failedConnectRetryDelay) * time.Second)
-							rs.storesLock.Lock()
-							s := rs.stores[addr]
-							if s != nil {
-								if _, ok := s.store.(errorValueStore); ok {
-									rs.stores[addr] = nil
-								}
-							}
-							rs.storesLock.Unlock()
-						}(as[i])
+						delay := rs.backoff.fail(as[i])
+						ss[i].store = errorValueStore(fmt.Sprintf("could not create store for %s, retrying in %s: %s", as[i], delay, err))
+						ss[i].stateChange("error", err)
+						go rs.clearErrorStore(as[i], delay)
+					} else if rs.wrapStore != nil {
+						ss[i].store = rs.wrapStore(as[i], ss[i].store)
 					}
 					rs.stores[as[i]] = ss[i]
 					select {
@@ -242,124 +704,89 @@ func (rs *ReplValueStore) storesFor(ctx context.Context, keyA uint64) ([]*replVa
 	return ss, nil
 }
 
-func (rs *ReplValueStore) ringServerConnector(exitChan chan struct{}) {
-	sleeperTicks := 2
-	sleeperTicker := time.NewTicker(time.Second)
-	sleeper := func() {
-		for i := sleeperTicks; i > 0; i-- {
-			select {
-			case <-exitChan:
-				break
-			case <-sleeperTicker.C:
-			}
+// dialRingServer resolves the ring service and connects to it, returning the
+// connection and the address it is for.
+func (rs *ReplValueStore) dialRingServer() (*grpc.ClientConn, string, error) {
+	ringServer := rs.ringServer
+	if ringServer == "" && rs.ringServerSRV != nil {
+		var err error
+		ringServer, err = rs.ringServerSRV.target()
+		if err != nil {
+			return nil, "", fmt.Errorf("error resolving ring service %q: %s", rs.ringServerSRV.name, err)
 		}
-		if sleeperTicks < 60 {
-			sleeperTicks *= 2
+	} else if ringServer == "" {
+		var err error
+		ringServer, err = oort.GetRingServer("value")
+		if err != nil {
+			return nil, "", fmt.Errorf("error resolving ring service: %s", err)
 		}
 	}
-	for {
-		select {
-		case <-exitChan:
-			break
-		default:
+	ringServerGRPCOpts := rs.ringServerGRPCOpts
+	if rs.ringServerFTLSConfig != nil {
+		creds, err := ftls.NewGRPCClientDialOpt(rs.ringServerFTLSConfig)
+		if err != nil {
+			return nil, ringServer, fmt.Errorf("error setting up tls for ring service %q: %s", ringServer, err)
 		}
-		ringServer := rs.ringServer
-		if ringServer == "" {
-			var err error
+		ringServerGRPCOpts = make([]grpc.DialOption, len(rs.ringServerGRPCOpts), len(rs.ringServerGRPCOpts)+1)
+		copy(ringServerGRPCOpts, rs.ringServerGRPCOpts)
+		ringServerGRPCOpts = append(ringServerGRPCOpts, creds)
+	}
+	conn, err := grpc.Dial(ringServer, ringServerGRPCOpts...)
+	if err != nil {
+		return nil, ringServer, fmt.Errorf("error connecting to ring service %q: %s", ringServer, err)
+	}
+	return conn, ringServer, nil
+}
 
-			ringServer, err = oort.GetRingServer("value")
-			if err != nil {
-				rs.logError("replValueStore: error resolving ring service: %s", err)
-				sleeper()
-				continue
-			}
+// ringServerListed resolves the ring service again and returns false if it no
+// longer lists addr. A failed lookup returns true, as the connection in use
+// may well still work.
+func (rs *ReplValueStore) ringServerListed(addr string) bool {
+	name := ""
+	if rs.ringServerSRV != nil {
+		name = rs.ringServerSRV.name
+	} else {
+		if current, err := oort.GetRingServer("value"); err != nil || current == addr {
+			return true
 		}
-		conn, err := grpc.Dial(ringServer, rs.ringServerGRPCOpts...)
-		if err != nil {
-			rs.logError("replValueStore: error connecting to ring service %q: %s", ringServer, err)
-			sleeper()
-			continue
+		var err error
+		if name, err = oort.GenServiceID("value", "syndicate", "tcp"); err != nil {
+			return true
 		}
-		stream, err := synpb.NewSyndicateClient(conn).GetRingStream(context.Background(), &synpb.SubscriberID{Id: rs.ringClientID})
-		if err != nil {
-			rs.logError("replValueStore: error creating stream with ring service %q: %s", ringServer, err)
-			sleeper()
-			continue
-		}
-		connDoneChan := make(chan struct{})
-		somethingICanTakeAnAddressOf := int32(0)
-		activity := &somethingICanTakeAnAddressOf
-		// This goroutine will detect when the exitChan is closed so it can
-		// close the conn so that the blocking stream.Recv will get an error
-		// and everything will unwind properly.
-		// However, if the conn errors out on its own and exitChan isn't
-		// closed, we're going to loop back around and try a new conn, but we
-		// need to clear out this goroutine, which is what the connDoneChan is
-		// for.
-		// One last thing is that if nothing happens for fifteen minutes, we
-		// can assume the conn has gone stale and close it, causing a loop
-		// around to try a new conn.
-		// It would be so much easier if Recv could use a timeout Context...
-		go func(c *grpc.ClientConn, a *int32, cdc chan struct{}) {
-			for {
-				select {
-				case <-exitChan:
-				case <-cdc:
-				case <-time.After(15 * time.Minute):
-					// I'm comfortable with time.After here since it's just
-					// once per fifteen minutes or new conn.
-					v := atomic.LoadInt32(a)
-					if v != 0 {
-						atomic.AddInt32(a, -v)
-						continue
-					}
-				}
-				break
-			}
-			c.Close()
-		}(conn, activity, connDoneChan)
-		for {
-			select {
-			case <-exitChan:
-				break
-			default:
-			}
-			res, err := stream.Recv()
-			if err != nil {
-				rs.logDebug("replValueStore: error with stream to ring service %q: %s", ringServer, err)
-				break
-			}
-			atomic.AddInt32(activity, 1)
-			if res != nil {
-				if r, err := ring.LoadRing(bytes.NewBuffer(res.Ring)); err != nil {
-					rs.logDebug("replValueStore: error with ring received from stream to ring service %q: %s", ringServer, err)
-				} else {
-					// This will cache the ring if ringCachePath is not empty.
-					rs.SetRing(r)
-					// Resets the exponential sleeper since we had success.
-					sleeperTicks = 2
-					rs.logDebug("replValueStore: got new ring from stream to ring service %q: %d", ringServer, res.Version)
-				}
-			}
-		}
-		close(connDoneChan)
-		sleeper()
 	}
+	addrs, err := lookupSRVTargets(name)
+	return err != nil || containsAddr(addrs, addr)
 }
 
 // Startup is not required to use the ReplValueStore; it will automatically
 // connect to backend stores as needed. However, if you'd like to use the ring
 // service to receive ring updates and have the ReplValueStore automatically
 // update itself accordingly, Startup will launch a connector to that service.
-// Otherwise, you will need to call SetRing yourself to inform the
-// ReplValueStore of which backends to connect to.
+// If RingSource, RingFile, or RingURL was configured, Startup will instead
+// run that source. Otherwise, you will need to call SetRing yourself to
+// inform the ReplValueStore of which backends to connect to.
+//
+// The connector runs until Shutdown is called or the ctx given is done, so
+// pass a ctx without a deadline unless you want the connector limited. With
+// StartupWaitForRing set, Startup also waits for a ring before returning.
 func (rs *ReplValueStore) Startup(ctx context.Context) error {
 	rs.ringLock.Lock()
-	if rs.ringServerExitChan == nil {
-		rs.ringServerExitChan = make(chan struct{})
-		go rs.ringServerConnector(rs.ringServerExitChan)
+	if rs.ringServerCancel == nil {
+		ctx, rs.ringServerCancel = context.WithCancel(ctx)
+		rs.ringServerDoneChan = make(chan struct{})
+		go func(doneChan chan struct{}) {
+			defer close(doneChan)
+			rs.ringSource.Run(ctx, &replValueRingUpdater{rs: rs})
+		}(rs.ringServerDoneChan)
 	}
 	rs.ringLock.Unlock()
+	if rs.startupWaitForRing > 0 {
+		wctx, cancel := context.WithTimeout(ctx, rs.startupWaitForRing)
+		defer cancel()
+		if rs.Ring(wctx) == nil {
+			return ErrNoRing
+		}
+	}
 	return nil
 }
 
@@ -367,11 +794,27 @@ func (rs *ReplValueStore) Startup(ctx context.Context) error {
 // running ring service connector. Note that the ReplValueStore can still be
 // used after Shutdown, it will just start reconnecting to backends again. To
 // relaunch the ring service connector, you will need to call Startup.
+//
+// Shutdown will wait for the ring service connector to exit, returning
+// ctx.Err() if the ctx is done first.
+//
+// Shutdown also stops the mirroring of writes to the ShadowStore, for good;
+// writes still queued for it are dropped, as are any made afterward.
 func (rs *ReplValueStore) Shutdown(ctx context.Context) error {
 	rs.ringLock.Lock()
-	if rs.ringServerExitChan != nil {
-		close(rs.ringServerExitChan)
-		rs.ringServerExitChan = nil
+	if rs.ringServerCancel != nil {
+		rs.ringServerCancel()
+		rs.ringServerCancel = nil
+		doneChan := rs.ringServerDoneChan
+		rs.ringServerDoneChan = nil
+		// The connector may be in SetRing waiting on the ringLock.
+		rs.ringLock.Unlock()
+		select {
+		case <-doneChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		rs.ringLock.Lock()
 	}
 	rs.storesLock.Lock()
 	for addr, stc := range rs.stores {
@@ -388,67 +831,209 @@ func (rs *ReplValueStore) Shutdown(ctx context.Context) error {
 	}
 	rs.storesLock.Unlock()
 	rs.ringLock.Unlock()
-	return nil
+	rs.persistHints()
+	return rs.stopShadowers(ctx)
 }
 
+// EnableWrites reverses DisableWrites.
 func (rs *ReplValueStore) EnableWrites(ctx context.Context) error {
+	atomic.StoreInt32(&rs.writesDisabled, 0)
 	return nil
 }
 
+// DisableWrites makes further Writes and Deletes through this client fail
+// immediately with ErrWritesDisabled until EnableWrites is called, such as
+// for maintenance windows or failover drills. The backend stores themselves
+// are unaffected, and queued hinted handoffs and repairs continue.
 func (rs *ReplValueStore) DisableWrites(ctx context.Context) error {
-	return errors.New("cannot disable writes with this client at this time")
+	atomic.StoreInt32(&rs.writesDisabled, 1)
+	return nil
+}
+
+func (rs *ReplValueStore) writesAllowed() bool {
+	return atomic.LoadInt32(&rs.writesDisabled) == 0
 }
 
-func (rs *ReplValueStore) Flush(ctx context.Context) error {
+// writesBlocked returns ErrWritesDisabled or ErrRingStale if writes should
+// not be attempted, nil otherwise.
+func (rs *ReplValueStore) writesBlocked() error {
+	if !rs.writesAllowed() {
+		return ErrWritesDisabled
+	}
+	if rs.ringStale() {
+		return ErrRingStale
+	}
 	return nil
 }
 
-func (rs *ReplValueStore) AuditPass(ctx context.Context) error {
-	return errors.New("audit passes not available with this client at this time")
+// ringStale returns true if RingStaleAfter is set and the ring service has
+// been unreachable for longer than that.
+func (rs *ReplValueStore) ringStale() bool {
+	if rs.ringStaleAfter <= 0 || atomic.LoadInt32(&rs.ringReachable) == 1 {
+		return false
+	}
+	contact := atomic.LoadInt64(&rs.ringContact)
+	return contact != 0 && time.Since(time.Unix(0, contact)) > rs.ringStaleAfter
+}
+
+func (rs *ReplValueStore) touchRingContact(t time.Time) {
+	atomic.StoreInt64(&rs.ringContact, t.UnixNano())
 }
 
-func (rs *ReplValueStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
-	return noStats, nil
+// authorize asks the Authorizer, if any, whether the op may proceed.
+func (rs *ReplValueStore) authorize(ctx context.Context, op string, keyA, keyB uint64) error {
+	if rs.authorizer == nil {
+		return nil
+	}
+	if err := rs.authorizer(ctx, op, keyA, keyB); err != nil {
+		rs.metrics.denied.WithLabelValues(op).Inc()
+		return &permissionDeniedError{op: op, err: err}
+	}
+	return nil
+}
+
+// audit gives the AuditSink, if any, the record of a mutation started at
+// start that ended with err.
+func (rs *ReplValueStore) audit(ctx context.Context, op string, start time.Time, keyA, keyB uint64, timestampMicro int64, length int, err error) {
+	if rs.auditSink == nil {
+		return
+	}
+	rec := &AuditRecord{
+		Time:           start,
+		Principal:      PrincipalFrom(ctx),
+		Store:          "value",
+		Op:             op,
+		KeyA:           keyA,
+		KeyB:           keyB,
+		TimestampMicro: timestampMicro,
+		Length:         length,
+		Result:         "ok",
+		Latency:        time.Since(start),
+	}
+	if err != nil {
+		rec.Result = "error"
+		if _, ok := err.(*permissionDeniedError); ok {
+			rec.Result = "denied"
+		}
+		rec.Error = err.Error()
+	}
+	if rs.auditSigningKey != nil {
+		if err := rec.sign(rs.auditSigningKey); err != nil {
+			rs.logError("replValueStore: error signing audit record for %s %x %x: %s", op, keyA, keyB, err)
+		}
+	}
+	if err := rs.auditSink.Audit(rec); err != nil {
+		rs.logError("replValueStore: error auditing %s %x %x: %s", op, keyA, keyB, err)
+	}
 }
 
 func (rs *ReplValueStore) ValueCap(ctx context.Context) (uint32, error) {
 	return uint32(rs.valueCap), nil
 }
 
-func (rs *ReplValueStore) Lookup(ctx context.Context, keyA, keyB uint64) (int64, uint32, error) {
+func (rs *ReplValueStore) handleLookup(ctx context.Context, keyA, keyB uint64) (int64, uint32, error) {
+	span := spanFrom(ctx)
+	cacheKey := replValueCacheKey{keyA: keyA, keyB: keyB}
+	notFoundCache := rs.notFoundCache
+	if ReplicaFrom(ctx) != "" {
+		notFoundCache = nil
+	}
+	if timestampMicro, _, ok := notFoundCache.get(cacheKey, nil); ok {
+		span.SetAttribute("cached", true)
+		return timestampMicro, 0, ErrNotFound
+	}
+	var timestampMicro int64
+	var length uint32
+	err := RetryPolicyFrom(ctx, rs.retryPolicy).do(ctx, func() error {
+		if err := rs.readOpsLimit.take(ctx, 1); err != nil {
+			return err
+		}
+		var err error
+		if rs.expiringValues {
+			var value []byte
+			timestampMicro, value, err = rs.read(ctx, keyA, keyB, nil)
+			if err == nil {
+				length = uint32(len(value))
+				var h frameHeader
+				if _, h, err = rs.codec.decode(ctx, value); err == nil {
+					err = rs.unexpired(keyA, keyB, timestampMicro, h.expiresMicro)
+				}
+			}
+			putReadBuffer(value)
+			return err
+		}
+		timestampMicro, length, err = rs.lookup(ctx, keyA, keyB)
+		return err
+	})
+	if store.IsNotFound(err) {
+		notFoundCache.put(cacheKey, timestampMicro, nil)
+	}
+	return timestampMicro, length, err
+}
+
+func (rs *ReplValueStore) lookup(ctx context.Context, keyA, keyB uint64) (int64, uint32, error) {
 	type rettype struct {
 		timestampMicro int64
 		length         uint32
 		err            ReplValueStoreError
 	}
-	ec := make(chan *rettype)
-	stores, err := rs.storesFor(ctx, keyA)
+	stores, err := rs.readStoresFor(ctx, keyA)
 	if err != nil {
 		return 0, 0, err
 	}
-	for _, s := range stores {
-		go func(s *replValueStoreAndTicketChan) {
+	stores, limit := rs.orderForRead(ctx, stores)
+	// ec is buffered so that the remaining goroutines can finish if the
+	// Lookup returns early.
+	ec := make(chan *rettype, len(stores))
+	launch := func(i int) {
+		s := stores[i]
+		s.workers.run(func() {
 			ret := &rettype{}
 			var err error
 			select {
-			case <-s.ticketChan:
-				ret.timestampMicro, ret.length, err = s.store.Lookup(ctx, keyA, keyB)
-				s.ticketChan <- struct{}{}
+			case <-s.tickets(ctx):
+				sctx, done := rs.startReplica(ctx, "Lookup", s)
+				ret.timestampMicro, ret.length, err = s.store.Lookup(sctx, keyA, keyB)
+				done(err)
+				s.tickets(ctx) <- struct{}{}
 			case <-ctx.Done():
 				err = ctx.Err()
 			}
 			if err != nil {
-				ret.err = &replValueStoreError{store: s.store, err: err}
+				ret.err = rs.storeError(s, err)
+			} else {
+				s.record(nil)
 			}
 			ec <- ret
-		}(s)
+		})
 	}
+	f := rs.newReadFanOut(ctx, len(stores), limit, launch)
+	defer f.stop()
 	var timestampMicro int64
 	var length uint32
 	var hadNotFoundErr bool
 	var errs ReplValueStoreErrorSlice
-	for _ = range stores {
-		ret := <-ec
+	var responded, diverged bool
+	var respondedTimestampMicro int64
+	for received := 0; received < f.launched || f.c != nil; received++ {
+		var ret *rettype
+		select {
+		case ret = <-ec:
+		case <-f.c:
+			f.fire()
+			received--
+			continue
+		}
+		if f.respond(ret.err == nil) {
+			return ret.timestampMicro, ret.length, nil
+		}
+		if ret.err == nil || store.IsNotFound(ret.err.Err()) {
+			if responded && ret.timestampMicro != respondedTimestampMicro {
+				diverged = true
+			}
+			responded = true
+			respondedTimestampMicro = ret.timestampMicro
+		}
 		if ret.timestampMicro > timestampMicro || timestampMicro == 0 {
 			timestampMicro = ret.timestampMicro
 			length = ret.length
@@ -458,6 +1043,9 @@ func (rs *ReplValueStore) Lookup(ctx context.Context, keyA, keyB uint64) (int64,
 			errs = append(errs, ret.err)
 		}
 	}
+	if diverged {
+		rs.repairKey(replValueCacheKey{keyA: keyA, keyB: keyB})
+	}
 	if hadNotFoundErr {
 		nferrs := make(ReplValueStoreErrorNotFound, len(errs))
 		for i, v := range errs {
@@ -465,7 +1053,7 @@ func (rs *ReplValueStore) Lookup(ctx context.Context, keyA, keyB uint64) (int64,
 		}
 		return timestampMicro, length, nferrs
 	}
-	if len(errs) < len(stores) {
+	if len(errs) < f.launched {
 		for _, err := range errs {
 			rs.logDebug("replValueStore: error during lookup: %s", err)
 		}
@@ -477,56 +1065,239 @@ func (rs *ReplValueStore) Lookup(ctx context.Context, keyA, keyB uint64) (int64,
 	return timestampMicro, length, errs
 }
 
-func (rs *ReplValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
+func (rs *ReplValueStore) handleRead(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
+	span := spanFrom(ctx)
+	cacheKey := replValueCacheKey{keyA: keyA, keyB: keyB}
+	readCache, notFoundCache, readCalls := rs.readCache, rs.notFoundCache, rs.readCalls
+	if ReplicaFrom(ctx) != "" {
+		// A read pinned to a replica must neither use nor fill the caches,
+		// nor share another read's results.
+		readCache, notFoundCache, readCalls = nil, nil, nil
+	}
+	if timestampMicro, rvalue, ok := readCache.get(cacheKey, value); ok {
+		span.SetAttribute("cached", true)
+		return timestampMicro, rvalue, nil
+	}
+	if timestampMicro, _, ok := notFoundCache.get(cacheKey, nil); ok {
+		span.SetAttribute("cached", true)
+		return timestampMicro, value, ErrNotFound
+	}
+	call, leader := readCalls.join(cacheKey)
+	if !leader {
+		span.SetAttribute("coalesced", true)
+		var timestampMicro int64
+		var err error
+		select {
+		case <-call.done:
+			timestampMicro, err = call.timestampMicro, call.err
+			value = append(value, call.value...)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		return timestampMicro, value, err
+	}
+	var timestampMicro int64
+	var rvalue, raw []byte
+	// Without decoding to do, the value read can go straight into the
+	// caller's value; otherwise it is read into a pooled buffer and only the
+	// decoded value is appended to the caller's.
+	direct := rs.codec == nil
+	err := RetryPolicyFrom(ctx, rs.retryPolicy).do(ctx, func() error {
+		if err := rs.readOpsLimit.take(ctx, 1); err != nil {
+			return err
+		}
+		if direct {
+			var err error
+			timestampMicro, rvalue, err = rs.read(ctx, keyA, keyB, value)
+			if err == nil {
+				rs.readBytesLimit.take(ctx, len(rvalue)-len(value))
+			}
+			return err
+		}
+		putReadBuffer(raw)
+		var err error
+		timestampMicro, raw, err = rs.read(ctx, keyA, keyB, nil)
+		rvalue = raw
+		// A partial read still has a value to decode.
+		var partial error
+		if _, ok := err.(*ReplValueStoreErrorPartialRead); ok {
+			partial, err = err, nil
+		}
+		if err == nil {
+			rs.readBytesLimit.take(ctx, len(rvalue))
+			var h frameHeader
+			if rvalue, h, err = rs.codec.decode(ctx, rvalue); err == nil {
+				if h.flags&frameSplitManifest != 0 {
+					rvalue, err = rs.joinSplit(ctx, keyA, keyB, timestampMicro, rvalue)
+				} else {
+					err = rs.unexpired(keyA, keyB, timestampMicro, h.expiresMicro)
+				}
+			}
+		}
+		if err == nil {
+			err = partial
+		}
+		return err
+	})
+	if store.IsNotFound(err) {
+		notFoundCache.put(cacheKey, timestampMicro, nil)
+	}
+	if direct {
+		if err == nil {
+			readCache.put(cacheKey, timestampMicro, rvalue[len(value):])
+		}
+		if len(rvalue) > len(value) {
+			readCalls.finish(cacheKey, call, timestampMicro, rvalue[len(value):], err)
+		} else {
+			readCalls.finish(cacheKey, call, timestampMicro, nil, err)
+		}
+	} else {
+		if err == nil {
+			readCache.put(cacheKey, timestampMicro, rvalue)
+		}
+		readCalls.finish(cacheKey, call, timestampMicro, rvalue, err)
+	}
+	if direct && rvalue == nil {
+		rvalue = value
+	} else if !direct && value != nil {
+		rvalue = append(value, rvalue...)
+		putReadBuffer(raw)
+	}
+	return timestampMicro, rvalue, err
+}
+
+// read receives each replica's value into a pooled buffer, returning the
+// buffers of those not chosen to the pool. If value is nil the chosen buffer
+// is returned and is then the caller's to keep or to pass to putReadBuffer;
+// otherwise it is appended to value and returned to the pool.
+func (rs *ReplValueStore) read(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
 	type rettype struct {
 		timestampMicro int64
 		value          []byte
 		err            ReplValueStoreError
 	}
-	ec := make(chan *rettype)
-	stores, err := rs.storesFor(ctx, keyA)
+	stores, err := rs.readStoresFor(ctx, keyA)
 	if err != nil {
 		rs.logDebug("replValueStore Read %x %x: error from storesFor: %s", keyA, keyB, err)
 		return 0, nil, err
 	}
-	for _, s := range stores {
-		go func(s *replValueStoreAndTicketChan) {
+	stores, limit := rs.orderForRead(ctx, stores)
+	// ec is buffered so that, with ReadFastest, the remaining goroutines can
+	// finish after the Read has returned.
+	ec := make(chan *rettype, len(stores))
+	launch := func(i int) {
+		s := stores[i]
+		s.workers.run(func() {
 			ret := &rettype{}
 			var err error
 			select {
-			case <-s.ticketChan:
-				ret.timestampMicro, ret.value, err = s.store.Read(ctx, keyA, keyB, nil)
-				s.ticketChan <- struct{}{}
+			case <-s.tickets(ctx):
+				sctx, done := rs.startReplica(ctx, "Read", s)
+				buf := getReadBuffer()
+				ret.timestampMicro, ret.value, err = s.store.Read(sctx, keyA, keyB, buf)
+				if err == nil {
+					if err = rs.codec.verify(ret.value); err != nil {
+						putReadBuffer(ret.value)
+						ret.timestampMicro, ret.value = 0, nil
+					}
+				} else {
+					// Stores hand back the buffer given with an error.
+					putReadBuffer(buf)
+					ret.value = nil
+				}
+				done(err)
+				s.tickets(ctx) <- struct{}{}
 			case <-ctx.Done():
 				err = ctx.Err()
 			}
 			if err != nil {
-				ret.err = &replValueStoreError{store: s.store, err: err}
+				ret.err = rs.storeError(s, err)
+			} else {
+				s.record(nil)
 			}
 			ec <- ret
-		}(s)
+		})
+	}
+	f := rs.newReadFanOut(ctx, len(stores), limit, launch)
+	defer f.stop()
+	var partialC <-chan time.Time
+	if deadline, ok := ctx.Deadline(); ok && rs.readPartialMargin > 0 {
+		partialTimer := time.NewTimer(deadline.Sub(time.Now()) - rs.readPartialMargin)
+		defer partialTimer.Stop()
+		partialC = partialTimer.C
 	}
 	var timestampMicro int64
 	var rvalue []byte
 	var hadNotFoundErr bool
 	var errs ReplValueStoreErrorSlice
-	for _ = range stores {
-		ret := <-ec
+	var responded, diverged bool
+	var respondedTimestampMicro int64
+	var succeeded int
+	for received := 0; received < f.launched || f.c != nil; received++ {
+		var ret *rettype
+		select {
+		case ret = <-ec:
+		case <-f.c:
+			f.fire()
+			received--
+			continue
+		case <-partialC:
+			partialC = nil
+			if succeeded == 0 || hadNotFoundErr {
+				received--
+				continue
+			}
+			if value != nil {
+				raw := rvalue
+				rvalue = append(value, raw...)
+				putReadBuffer(raw)
+			}
+			rs.logDebug("replValueStore Read %x %x: returning partial: %d %d of %d", keyA, keyB, timestampMicro, received, len(stores))
+			return timestampMicro, rvalue, &ReplValueStoreErrorPartialRead{ResponseCount: received, ReplicaCount: len(stores), Errs: errs}
+		}
+		if ret.err == nil {
+			succeeded++
+		}
+		if f.respond(ret.err == nil) {
+			putReadBuffer(rvalue)
+			rvalue = ret.value
+			if value != nil && rvalue != nil {
+				rvalue = append(value, ret.value...)
+				putReadBuffer(ret.value)
+			}
+			rs.logDebug("replValueStore Read %x %x: returning early: %d %d", keyA, keyB, ret.timestampMicro, len(rvalue))
+			return ret.timestampMicro, rvalue, nil
+		}
+		if ret.err == nil || store.IsNotFound(ret.err.Err()) {
+			if responded && ret.timestampMicro != respondedTimestampMicro {
+				diverged = true
+			}
+			responded = true
+			respondedTimestampMicro = ret.timestampMicro
+		}
 		if ret.timestampMicro > timestampMicro || timestampMicro == 0 {
 			timestampMicro = ret.timestampMicro
+			putReadBuffer(rvalue)
 			rvalue = ret.value
 			hadNotFoundErr = ret.err != nil && store.IsNotFound(ret.err.Err())
+		} else {
+			putReadBuffer(ret.value)
 		}
 		if ret.err != nil {
 			errs = append(errs, ret.err)
 		}
 	}
 	if value != nil && rvalue != nil {
-		rvalue = append(value, rvalue...)
+		raw := rvalue
+		rvalue = append(value, raw...)
+		putReadBuffer(raw)
 	}
 	for _, err := range errs {
 		rs.logDebug("replValueStore Read %x %x: error during read: %s", keyA, keyB, err)
 	}
+	if diverged {
+		rs.repairKey(replValueCacheKey{keyA: keyA, keyB: keyB})
+	}
 	if hadNotFoundErr {
 		nferrs := make(ReplValueStoreErrorNotFound, len(errs))
 		for i, v := range errs {
@@ -535,7 +1306,7 @@ func (rs *ReplValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, va
 		rs.logDebug("replValueStore Read %x %x: returning at point1: %d %d %v", keyA, keyB, timestampMicro, len(rvalue), nferrs)
 		return timestampMicro, rvalue, nferrs
 	}
-	if len(errs) < len(stores) {
+	if len(errs) < f.launched {
 		errs = nil
 	}
 	if errs == nil {
@@ -546,119 +1317,172 @@ func (rs *ReplValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, va
 	return timestampMicro, rvalue, errs
 }
 
-func (rs *ReplValueStore) Write(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
-	if len(value) == 0 {
-		panic(fmt.Sprintf("REMOVEME ReplValueStore asked to Write a zlv"))
-	}
-	if len(value) > rs.valueCap {
-		return 0, fmt.Errorf("value length of %d > %d", len(value), rs.valueCap)
-	}
-	type rettype struct {
-		oldTimestampMicro int64
-		err               ReplValueStoreError
+func (rs *ReplValueStore) handleWrite(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	if err := rs.writesBlocked(); err != nil {
+		return 0, err
 	}
-	ec := make(chan *rettype)
-	stores, err := rs.storesFor(ctx, keyA)
+	shadowOp := &replValueShadowOp{keyA: keyA, keyB: keyB, timestampMicro: timestampMicro, value: value}
+	value, err := rs.codec.encode(ctx, value)
 	if err != nil {
 		return 0, err
 	}
-	for _, s := range stores {
-		go func(s *replValueStoreAndTicketChan) {
-			ret := &rettype{}
-			var err error
-			select {
-			case <-s.ticketChan:
-				if len(value) == 0 {
-					panic(fmt.Sprintf("REMOVEME inside ReplValueStore asked to Write a zlv"))
-				}
-				ret.oldTimestampMicro, err = s.store.Write(ctx, keyA, keyB, timestampMicro, value)
-				s.ticketChan <- struct{}{}
-			case <-ctx.Done():
-				err = ctx.Err()
-			}
-			if err != nil {
-				ret.err = &replValueStoreError{store: s.store, err: err}
-			}
-			ec <- ret
-		}(s)
+	oldTimestampMicro, err := rs.writeEncoded(ctx, keyA, keyB, timestampMicro, value)
+	rs.uncache(replValueCacheKey{keyA: keyA, keyB: keyB})
+	if err == nil {
+		rs.shadow(shadowOp)
+		rs.watchers.wake(keyA, keyB)
+	}
+	return oldTimestampMicro, err
+}
+
+// writeEncoded writes the value given, already encoded, splitting it if
+// SplitLargeValues calls for it and retrying under the RetryPolicy, with each
+// attempt taking from the write limits.
+func (rs *ReplValueStore) writeEncoded(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	write := rs.write
+	if rs.splitLargeValues && len(value) > rs.valueCap {
+		write = rs.writeSplit
 	}
 	var oldTimestampMicro int64
-	var errs ReplValueStoreErrorSlice
-	for _ = range stores {
-		ret := <-ec
-		if ret.err != nil {
-			errs = append(errs, ret.err)
-		} else if ret.oldTimestampMicro > oldTimestampMicro {
-			oldTimestampMicro = ret.oldTimestampMicro
+	err := RetryPolicyFrom(ctx, rs.retryPolicy).do(ctx, func() error {
+		if err := rs.writeOpsLimit.take(ctx, 1); err != nil {
+			return err
 		}
-	}
-	if len(errs) < (len(stores)+1)/2 {
-		for _, err := range errs {
-			rs.logDebug("replValueStore: error during write: %s", err)
+		if err := rs.writeBytesLimit.take(ctx, len(value)); err != nil {
+			return err
 		}
-		errs = nil
+		var err error
+		oldTimestampMicro, err = write(ctx, keyA, keyB, timestampMicro, value)
+		return err
+	})
+	return oldTimestampMicro, err
+}
+
+func (rs *ReplValueStore) write(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	if len(value) == 0 {
+		return 0, fmt.Errorf("zero length value")
 	}
-	if errs == nil {
-		return oldTimestampMicro, nil
+	if len(value) > rs.valueCap {
+		return 0, &valueTooLargeError{length: len(value), valueCap: rs.valueCap}
 	}
-	return oldTimestampMicro, errs
+	hint := &replValueHint{KeyA: keyA, KeyB: keyB, TimestampMicro: timestampMicro, Value: value}
+	return rs.writeReplicas(ctx, "Write", hint, func(ctx context.Context, s store.ValueStore) (int64, error) {
+		return s.Write(ctx, keyA, keyB, timestampMicro, value)
+	})
 }
 
-func (rs *ReplValueStore) Delete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
-	type rettype struct {
-		oldTimestampMicro int64
-		err               ReplValueStoreError
-	}
-	ec := make(chan *rettype)
-	stores, err := rs.storesFor(ctx, keyA)
+// writeReplicas sends a write or delete to each replica responsible for the
+// hint's key with call, returning the newest old timestamp reported and the
+// writeResult. Each replica that fails is given a copy of the hint, addressed
+// to it, for hinted handoff.
+func (rs *ReplValueStore) writeReplicas(ctx context.Context, op string, hint *replValueHint, call func(ctx context.Context, s store.ValueStore) (int64, error)) (int64, error) {
+	stores, err := rs.storesFor(ctx, hint.KeyA)
 	if err != nil {
 		return 0, err
 	}
-	for _, s := range stores {
-		go func(s *replValueStoreAndTicketChan) {
-			ret := &rettype{}
-			var err error
+	o := fanOutWrite(len(stores), func(i int, reply func(replicaWrite)) {
+		s := stores[i]
+		s.workers.run(func() {
+			var w replicaWrite
 			select {
-			case <-s.ticketChan:
-				ret.oldTimestampMicro, err = s.store.Delete(ctx, keyA, keyB, timestampMicro)
-				s.ticketChan <- struct{}{}
+			case <-s.tickets(ctx):
+				sctx, done := rs.startReplica(ctx, op, s)
+				w.oldTimestampMicro, w.err = call(sctx, s.store)
+				done(w.err)
+				s.tickets(ctx) <- struct{}{}
 			case <-ctx.Done():
-				err = ctx.Err()
+				w.err = ctx.Err()
 			}
-			if err != nil {
-				ret.err = &replValueStoreError{store: s.store, err: err}
+			if w.err != nil {
+				w.err = rs.storeError(s, w.err)
+				h := *hint
+				h.Addr = s.addr
+				rs.addHint(ctx, &h)
+			} else {
+				s.record(nil)
 			}
-			ec <- ret
-		}(s)
+			reply(w)
+		})
+	})
+	if o.partial() {
+		rs.repairKey(replValueCacheKey{keyA: hint.KeyA, keyB: hint.KeyB})
 	}
-	var oldTimestampMicro int64
-	var errs ReplValueStoreErrorSlice
-	for _ = range stores {
-		ret := <-ec
-		if ret.err != nil {
-			errs = append(errs, ret.err)
-		} else if ret.oldTimestampMicro > oldTimestampMicro {
-			oldTimestampMicro = ret.oldTimestampMicro
+	return o.oldTimestampMicro, rs.writeResult(ctx, strings.ToLower(op), o)
+}
+
+// writeResult returns the error for the outcome of a write or delete: nil if
+// enough replicas succeeded for the WriteAck in effect, otherwise a
+// *ReplValueStoreErrorPartialWrite, or a ReplValueStoreErrorSlice if all
+// failed.
+func (rs *ReplValueStore) writeResult(ctx context.Context, op string, o *writeOutcome) error {
+	if o.acked(rs.writeAcksRequired(ctx, o.replicas)) {
+		for _, err := range o.errs {
+			rs.logDebug("replValueStore: error during %s: %s", op, err)
 		}
+		return nil
 	}
-	if len(errs) < (len(stores)+1)/2 {
-		for _, err := range errs {
-			rs.logDebug("replValueStore: error during delete: %s", err)
+	errs := make(ReplValueStoreErrorSlice, len(o.errs))
+	for i, err := range o.errs {
+		errs[i] = err.(ReplValueStoreError)
+	}
+	if o.partial() {
+		return &ReplValueStoreErrorPartialWrite{SuccessCount: o.replicas - len(errs), ReplicaCount: o.replicas, Errs: errs}
+	}
+	return errs
+}
+
+// writeAcksRequired returns how many of the replicas must acknowledge a write
+// or delete made with the ctx.
+func (rs *ReplValueStore) writeAcksRequired(ctx context.Context, replicas int) int {
+	return WriteAckFrom(ctx, rs.writeAck).required(replicas, rs.hintedHandoffMaxBytes > 0)
+}
+
+func (rs *ReplValueStore) handleDelete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
+	if err := rs.writesBlocked(); err != nil {
+		return 0, err
+	}
+	if rs.splitLargeValues {
+		if err := rs.deleteSplitChunks(ctx, keyA, keyB, timestampMicro); err != nil {
+			return 0, err
 		}
-		errs = nil
 	}
-	if errs == nil {
-		return oldTimestampMicro, nil
+	var oldTimestampMicro int64
+	err := RetryPolicyFrom(ctx, rs.retryPolicy).do(ctx, func() error {
+		if err := rs.writeOpsLimit.take(ctx, 1); err != nil {
+			return err
+		}
+		var err error
+		oldTimestampMicro, err = rs.delete(ctx, keyA, keyB, timestampMicro)
+		return err
+	})
+	rs.uncache(replValueCacheKey{keyA: keyA, keyB: keyB})
+	if err == nil {
+		rs.shadow(&replValueShadowOp{keyA: keyA, keyB: keyB, timestampMicro: timestampMicro})
+		rs.watchers.wake(keyA, keyB)
 	}
-	return oldTimestampMicro, errs
+	return oldTimestampMicro, err
 }
 
+func (rs *ReplValueStore) delete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
+	hint := &replValueHint{KeyA: keyA, KeyB: keyB, TimestampMicro: timestampMicro}
+	return rs.writeReplicas(ctx, "Delete", hint, func(ctx context.Context, s store.ValueStore) (int64, error) {
+		return s.Delete(ctx, keyA, keyB, timestampMicro)
+	})
+}
+
+// ReplValueStoreError is an error from a single backend store. With
+// errors.Is, it matches ErrNotFound and ErrTimeout as appropriate, and it
+// unwraps to the error the store returned.
 type ReplValueStoreError interface {
 	error
 	Store() store.ValueStore
 	Err() error
 }
 
+// ReplValueStoreErrorSlice is returned when none of the replicas could
+// complete a request, or a quorum could not for a write. It matches
+// ErrAllReplicasFailed with errors.Is and unwraps to the ReplValueStoreError
+// for each store.
 type ReplValueStoreErrorSlice []ReplValueStoreError
 
 func (es ReplValueStoreErrorSlice) Error() string {
@@ -670,6 +1494,24 @@ func (es ReplValueStoreErrorSlice) Error() string {
 	return fmt.Sprintf("%d errors, first is: %s", len(es), es[0])
 }
 
+func (es ReplValueStoreErrorSlice) Is(target error) bool {
+	return target == ErrAllReplicasFailed
+}
+
+func (es ReplValueStoreErrorSlice) Unwrap() []error {
+	return replValueStoreErrors(es)
+}
+
+func replValueStoreErrors(es []ReplValueStoreError) []error {
+	errs := make([]error, len(es))
+	for i, e := range es {
+		errs[i] = e
+	}
+	return errs
+}
+
+// ReplValueStoreErrorNotFound is returned when the newest response for a key
+// was not found. It matches ErrNotFound with errors.Is.
 type ReplValueStoreErrorNotFound ReplValueStoreErrorSlice
 
 func (e ReplValueStoreErrorNotFound) Error() string {
@@ -685,6 +1527,62 @@ func (e ReplValueStoreErrorNotFound) ErrNotFound() string {
 	return e.Error()
 }
 
+func (e ReplValueStoreErrorNotFound) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e ReplValueStoreErrorNotFound) Unwrap() []error {
+	return replValueStoreErrors(e)
+}
+
+// ReplValueStoreErrorPartialRead is returned, along with the newest value
+// received, when a Read stopped waiting on replicas because its deadline was
+// near; see ReadPartialMargin. It matches ErrPartialRead with errors.Is.
+type ReplValueStoreErrorPartialRead struct {
+	// ResponseCount is the number of replicas that had responded.
+	ResponseCount int
+	// ReplicaCount is the number of replicas responsible for the key.
+	ReplicaCount int
+	// Errs are the errors from the replicas that responded with one.
+	Errs ReplValueStoreErrorSlice
+}
+
+func (e *ReplValueStoreErrorPartialRead) Error() string {
+	return fmt.Sprintf("partial read of %d of %d replicas", e.ResponseCount, e.ReplicaCount)
+}
+
+func (e *ReplValueStoreErrorPartialRead) Is(target error) bool {
+	return target == ErrPartialRead
+}
+
+func (e *ReplValueStoreErrorPartialRead) Unwrap() []error {
+	return replValueStoreErrors(e.Errs)
+}
+
+// ReplValueStoreErrorPartialWrite is returned when a write or delete reached
+// some of the replicas but not a quorum of them, so callers can decide
+// whether to retry or escalate. It matches ErrPartialWrite with errors.Is.
+type ReplValueStoreErrorPartialWrite struct {
+	// SuccessCount is the number of replicas the write reached.
+	SuccessCount int
+	// ReplicaCount is the number of replicas responsible for the key.
+	ReplicaCount int
+	// Errs are the errors from the replicas the write did not reach.
+	Errs ReplValueStoreErrorSlice
+}
+
+func (e *ReplValueStoreErrorPartialWrite) Error() string {
+	return fmt.Sprintf("partial write to %d of %d replicas: %s", e.SuccessCount, e.ReplicaCount, e.Errs)
+}
+
+func (e *ReplValueStoreErrorPartialWrite) Is(target error) bool {
+	return target == ErrPartialWrite
+}
+
+func (e *ReplValueStoreErrorPartialWrite) Unwrap() []error {
+	return replValueStoreErrors(e.Errs)
+}
+
 type replValueStoreError struct {
 	store store.ValueStore
 	err   error
@@ -704,3 +1602,17 @@ func (e *replValueStoreError) Store() store.ValueStore {
 func (e *replValueStoreError) Err() error {
 	return e.err
 }
+
+func (e *replValueStoreError) Unwrap() error {
+	return e.err
+}
+
+func (e *replValueStoreError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return store.IsNotFound(e.err)
+	case ErrTimeout:
+		return isTimeout(e.err)
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+func (rs *ReplValueStore) streamChunkKeys(keyA, keyB uint64, count uint32) []ValueKeyPair {
+	keys := make([]ValueKeyPair, count)
+	for i := range keys {
+		keys[i].KeyA, keys[i].KeyB = streamChunkKey(keyA, keyB, 0, 0, uint32(i))
+	}
+	return keys
+}
+
+// WriteStream stores everything read from r as a single value, even one
+// larger than ValueCap. The data is split into StreamChunkSize chunks, each
+// stored under a key derived from the one given, and then a small manifest
+// describing the chunks is written to the key given, marked as such in its
+// frame header; so values must be framed, as described for the FramedValues
+// config option. Everything is written with the same timestampMicro and the
+// old timestampMicro of the manifest key is returned.
+//
+// Note that chunks from a previous, longer stream written to the same key are
+// not removed; use DeleteStream first if that matters.
+func (rs *ReplValueStore) WriteStream(ctx context.Context, keyA, keyB uint64, timestampMicro int64, r io.Reader) (int64, error) {
+	if rs.codec == nil {
+		return 0, fmt.Errorf("WriteStream requires values to be framed; see the FramedValues config option")
+	}
+	m := &streamManifest{chunkSize: uint32(rs.streamChunkSize)}
+	batch := make([]ValueWriteItem, 0, rs.concurrentRequestsPerStore)
+	flush := func() error {
+		for _, res := range rs.WriteBatch(ctx, batch) {
+			if res.Err != nil {
+				return res.Err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		buf := make([]byte, rs.streamChunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			item := ValueWriteItem{TimestampMicro: timestampMicro, Value: buf[:n]}
+			item.KeyA, item.KeyB = streamChunkKey(keyA, keyB, 0, 0, m.chunkCount)
+			batch = append(batch, item)
+			m.chunkCount++
+			m.length += uint64(n)
+			if len(batch) == cap(batch) {
+				if err := flush(); err != nil {
+					return 0, err
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return 0, err
+		}
+	}
+	return rs.Write(withFrameFlags(ctx, frameStreamManifest), keyA, keyB, timestampMicro, m.encode())
+}
+
+// ReadStream writes the value for the key given to w, reassembling it from
+// its chunks if it was stored with WriteStream; a value stored with a plain
+// Write is written to w as is. The timestampMicro of the value is returned.
+// As with WriteStream, values must be framed. The value for the key given is
+// always read from the replicas, as the read cache does not keep whether it
+// is a manifest.
+func (rs *ReplValueStore) ReadStream(ctx context.Context, keyA, keyB uint64, w io.Writer) (int64, error) {
+	if rs.codec == nil {
+		return 0, fmt.Errorf("ReadStream requires values to be framed; see the FramedValues config option")
+	}
+	if err := rs.authorize(ctx, "Read", keyA, keyB); err != nil {
+		return 0, err
+	}
+	timestampMicro, value, h, err := rs.readDecoded(ctx, keyA, keyB, nil)
+	if err != nil {
+		return timestampMicro, err
+	}
+	if h.flags&frameStreamManifest == 0 {
+		_, err = w.Write(value)
+		return timestampMicro, err
+	}
+	m := decodeStreamManifest(value)
+	if m == nil {
+		return timestampMicro, &corruptValueError{reason: fmt.Sprintf("stream manifest of %d bytes", len(value))}
+	}
+	keys := rs.streamChunkKeys(keyA, keyB, m.chunkCount)
+	for len(keys) > 0 {
+		window := keys
+		if len(window) > rs.concurrentRequestsPerStore {
+			window = window[:rs.concurrentRequestsPerStore]
+		}
+		keys = keys[len(window):]
+		for i, res := range rs.ReadMulti(ctx, window) {
+			if res.Err != nil {
+				return timestampMicro, res.Err
+			}
+			if res.TimestampMicro != timestampMicro {
+				return timestampMicro, fmt.Errorf("stream chunk %d has timestamp %d rather than %d", int(m.chunkCount)-len(keys)-len(window)+i, res.TimestampMicro, timestampMicro)
+			}
+			if _, err = w.Write(res.Value); err != nil {
+				return timestampMicro, err
+			}
+		}
+	}
+	return timestampMicro, nil
+}
+
+// DeleteStream deletes the value for the key given, including all its chunks
+// if it was stored with WriteStream. The old timestampMicro of the key given
+// is returned. As with WriteStream, values must be framed.
+func (rs *ReplValueStore) DeleteStream(ctx context.Context, keyA, keyB uint64, timestampMicro int64) (int64, error) {
+	if rs.codec == nil {
+		return 0, fmt.Errorf("DeleteStream requires values to be framed; see the FramedValues config option")
+	}
+	err := rs.authorize(ctx, "Read", keyA, keyB)
+	var value []byte
+	var h frameHeader
+	if err == nil {
+		_, value, h, err = rs.readDecoded(ctx, keyA, keyB, nil)
+	}
+	if err == nil && h.flags&frameStreamManifest != 0 {
+		if m := decodeStreamManifest(value); m != nil {
+			for i, k := range rs.streamChunkKeys(keyA, keyB, m.chunkCount) {
+				if _, err := rs.Delete(ctx, k.KeyA, k.KeyB, timestampMicro); err != nil {
+					return 0, fmt.Errorf("error deleting stream chunk %d: %s", i, err)
+				}
+			}
+		}
+	}
+	return rs.Delete(ctx, keyA, keyB, timestampMicro)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// WriteTTL is Write but the value expires once the ttl has passed, after
+// which Read and Lookup treat it as not found. The
+// ExpiringValues config option must be set for it to be used; see there for
+// details.
+func (rs *ReplValueStore) WriteTTL(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte, ttl time.Duration) (int64, error) {
+	if !rs.expiringValues {
+		return 0, fmt.Errorf("WriteTTL requires the ExpiringValues config option")
+	}
+	return rs.Write(withExpiry(ctx, nowMicro()+int64(ttl/time.Microsecond)), keyA, keyB, timestampMicro, value)
+}
+
+// CompareAndWriteTTL is CompareAndWrite but the value expires as with
+// WriteTTL.
+func (rs *ReplValueStore) CompareAndWriteTTL(ctx context.Context, keyA uint64, keyB uint64, expectedTimestampMicro, newTimestampMicro int64, value []byte, ttl time.Duration) (int64, error) {
+	if !rs.expiringValues {
+		return 0, fmt.Errorf("CompareAndWriteTTL requires the ExpiringValues config option")
+	}
+	return rs.CompareAndWrite(withExpiry(ctx, nowMicro()+int64(ttl/time.Microsecond)), keyA, keyB, expectedTimestampMicro, newTimestampMicro, value)
+}
+
+// ReadTTL is Read but also returns how long the value has until it expires,
+// or 0 if it was written without a TTL. It always reads from the replicas, as
+// values cached with ReadCacheSize no longer carry their expiry.
+func (rs *ReplValueStore) ReadTTL(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, time.Duration, error) {
+	if !rs.expiringValues {
+		return 0, value, 0, fmt.Errorf("ReadTTL requires the ExpiringValues config option")
+	}
+	timestampMicro, rvalue, h, err := rs.readDecoded(ctx, keyA, keyB, value)
+	if _, ok := err.(*ReplValueStoreErrorPartialRead); err != nil && !ok {
+		return timestampMicro, value, 0, err
+	}
+	var ttl time.Duration
+	if h.expiresMicro != 0 {
+		ttl = time.Duration(h.expiresMicro-nowMicro()) * time.Microsecond
+	}
+	return timestampMicro, rvalue, ttl, err
+}
+
+// readDecoded reads the value for the key given from the replicas and
+// decodes it as Read would, appending it to the value given, but also
+// returns the header the value was framed with, which the read cache does
+// not keep. As with Read, a partial read still returns the value.
+func (rs *ReplValueStore) readDecoded(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, frameHeader, error) {
+	timestampMicro, raw, err := rs.read(ctx, keyA, keyB, nil)
+	defer putReadBuffer(raw)
+	var partial error
+	if _, ok := err.(*ReplValueStoreErrorPartialRead); ok {
+		partial, err = err, nil
+	}
+	if err != nil {
+		return timestampMicro, value, frameHeader{}, err
+	}
+	decoded, h, err := rs.codec.decode(ctx, raw)
+	if err == nil && h.flags&frameSplitManifest != 0 {
+		decoded, err = rs.joinSplit(ctx, keyA, keyB, timestampMicro, decoded)
+	} else if err == nil {
+		err = rs.unexpired(keyA, keyB, timestampMicro, h.expiresMicro)
+	}
+	if err != nil {
+		return timestampMicro, value, h, err
+	}
+	return timestampMicro, append(value, decoded...), h, partial
+}
+
+// unexpired returns ErrNotFound if a value expiring at expiresMicro, as
+// read from its frame header, has expired and, with DeleteExpired, deletes it
+// in the background. A value with no expiry, expiresMicro 0, never expires.
+func (rs *ReplValueStore) unexpired(keyA uint64, keyB uint64, timestampMicro int64, expiresMicro int64) error {
+	if expiresMicro == 0 || expiresMicro > nowMicro() {
+		return nil
+	}
+	if rs.deleteExpired {
+		// The delete is timestamped with the expiry so any write made after
+		// the value expired still wins.
+		deleteTimestampMicro := expiresMicro
+		if deleteTimestampMicro <= timestampMicro {
+			deleteTimestampMicro = timestampMicro + 1
+		}
+		go func() {
+			if _, err := rs.Delete(context.Background(), keyA, keyB, deleteTimestampMicro); err != nil {
+				rs.logDebug("replValueStore: error deleting expired %x %x: %s", keyA, keyB, err)
+			}
+		}()
+	}
+	return ErrNotFound
+}
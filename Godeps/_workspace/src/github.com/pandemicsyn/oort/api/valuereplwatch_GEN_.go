@@ -0,0 +1,70 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ValueWatchEvent is a change to a key seen by Watch.
+type ValueWatchEvent struct {
+	ValueKeyPair
+	// TimestampMicro is that of the new value or deletion marker.
+	TimestampMicro int64
+	// Deleted is set if the key was deleted rather than written.
+	Deleted bool
+}
+
+// ValueWatchOptions defines the settings for Watch; nil
+// gives the defaults.
+type ValueWatchOptions struct {
+	// PollInterval is how often the replicas are checked for changes;
+	// default is 1s.
+	PollInterval time.Duration
+}
+
+func (opts *ValueWatchOptions) pollInterval() time.Duration {
+	if opts == nil || opts.PollInterval <= 0 {
+		return defaultWatchPollInterval
+	}
+	return opts.PollInterval
+}
+
+// Watch calls fn for each write or delete of the key until fn returns false
+// or the ctx is done, for caches and indexers to stay in sync. The backend
+// stores offer no subscription, so the replicas are polled for the key's
+// timestamp every PollInterval; writes and deletes made through this client
+// are seen at once. Changes between polls coalesce into one event for the
+// newest, and polls that fail are retried at the next interval. Watch
+// returns nil if fn stopped it, or the ctx's error.
+func (rs *ReplValueStore) Watch(ctx context.Context, keyA, keyB uint64, opts *ValueWatchOptions, fn func(ev ValueWatchEvent) bool) error {
+	wake, unwatch := rs.watchers.add(keyA, keyB)
+	defer unwatch()
+	interval := opts.pollInterval()
+	last, _, err := rs.lookup(ctx, keyA, keyB)
+	for err != nil && !store.IsNotFound(err) {
+		if !waitWatch(ctx, wake, interval) {
+			return ctx.Err()
+		}
+		last, _, err = rs.lookup(ctx, keyA, keyB)
+	}
+	for waitWatch(ctx, wake, interval) {
+		timestampMicro, _, err := rs.lookup(ctx, keyA, keyB)
+		if err != nil && !store.IsNotFound(err) {
+			continue
+		}
+		if timestampMicro <= last {
+			continue
+		}
+		last = timestampMicro
+		if !fn(ValueWatchEvent{
+			ValueKeyPair:   ValueKeyPair{keyA, keyB},
+			TimestampMicro: timestampMicro,
+			Deleted:        err != nil,
+		}) {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+// ScriptedValueStore is a store.ValueStore giving each data call the next
+// response queued for its op with Push, or the default response once the
+// queue is empty. Every data call is recorded, for Calls. The zero value
+// answers everything with an empty success.
+type ScriptedValueStore struct {
+	lock      sync.Mutex
+	responses map[string][]ScriptedResponse
+	dflt      ScriptedResponse
+	calls     []ScriptedCall
+}
+
+// Push queues responses for the op, one of "Lookup", "Read", "Write",
+// "Delete".
+func (s *ScriptedValueStore) Push(op string, responses ...ScriptedResponse) {
+	s.lock.Lock()
+	if s.responses == nil {
+		s.responses = make(map[string][]ScriptedResponse)
+	}
+	s.responses[op] = append(s.responses[op], responses...)
+	s.lock.Unlock()
+}
+
+// SetDefault sets the response given when an op's queue is empty.
+func (s *ScriptedValueStore) SetDefault(r ScriptedResponse) {
+	s.lock.Lock()
+	s.dflt = r
+	s.lock.Unlock()
+}
+
+// Calls returns the data calls made so far, oldest first.
+func (s *ScriptedValueStore) Calls() []ScriptedCall {
+	s.lock.Lock()
+	calls := append([]ScriptedCall(nil), s.calls...)
+	s.lock.Unlock()
+	return calls
+}
+
+// next records the call and returns the response for it.
+func (s *ScriptedValueStore) next(call ScriptedCall) ScriptedResponse {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls = append(s.calls, call)
+	if rs := s.responses[call.Op]; len(rs) > 0 {
+		s.responses[call.Op] = rs[1:]
+		return rs[0]
+	}
+	return s.dflt
+}
+
+func (s *ScriptedValueStore) Startup(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedValueStore) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedValueStore) EnableWrites(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedValueStore) DisableWrites(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedValueStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedValueStore) AuditPass(ctx context.Context) error {
+	return nil
+}
+
+func (s *ScriptedValueStore) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	s.lock.Lock()
+	stats := scriptedValueStoreStats(len(s.calls))
+	s.lock.Unlock()
+	return stats, nil
+}
+
+type scriptedValueStoreStats int
+
+func (s scriptedValueStoreStats) String() string {
+	return fmt.Sprintf("calls %d", int(s))
+}
+
+func (s *ScriptedValueStore) ValueCap(ctx context.Context) (uint32, error) {
+	return math.MaxUint32, nil
+}
+
+func (s *ScriptedValueStore) Lookup(ctx context.Context, keyA uint64, keyB uint64) (int64, uint32, error) {
+	r := s.next(ScriptedCall{Op: "Lookup", KeyA: keyA, KeyB: keyB})
+	if err := r.wait(ctx); err != nil {
+		return 0, 0, err
+	}
+	return r.TimestampMicro, r.length(), r.Err
+}
+
+func (s *ScriptedValueStore) Read(ctx context.Context, keyA uint64, keyB uint64, value []byte) (int64, []byte, error) {
+	r := s.next(ScriptedCall{Op: "Read", KeyA: keyA, KeyB: keyB})
+	if err := r.wait(ctx); err != nil {
+		return 0, value, err
+	}
+	if r.Err != nil {
+		return r.TimestampMicro, value, r.Err
+	}
+	return r.TimestampMicro, append(value, r.Value...), nil
+}
+
+func (s *ScriptedValueStore) Write(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	r := s.next(ScriptedCall{Op: "Write", KeyA: keyA, KeyB: keyB, TimestampMicro: timestampMicro, Value: append([]byte(nil), value...)})
+	if err := r.wait(ctx); err != nil {
+		return 0, err
+	}
+	return r.TimestampMicro, r.Err
+}
+
+func (s *ScriptedValueStore) Delete(ctx context.Context, keyA uint64, keyB uint64, timestampMicro int64) (int64, error) {
+	r := s.next(ScriptedCall{Op: "Delete", KeyA: keyA, KeyB: keyB, TimestampMicro: timestampMicro})
+	if err := r.wait(ctx); err != nil {
+		return 0, err
+	}
+	return r.TimestampMicro, r.Err
+}
+
+// NewScriptedReplValueStore returns a ReplValueStore routing to the given
+// number of ScriptedValueStores, each a replica of every key, for unit
+// testing how replica responses are combined without a cluster. As with
+// NewMemReplValueStore, c's RingSource is ignored and c may be nil.
+func NewScriptedReplValueStore(replicas int, c *ReplValueStoreConfig) (*ReplValueStore, []*ScriptedValueStore) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	sss := make([]*ScriptedValueStore, replicas)
+	ss := make([]store.ValueStore, replicas)
+	for i := range sss {
+		sss[i] = &ScriptedValueStore{}
+		ss[i] = sss[i]
+	}
+	return newLocalReplValueStore(ss, c), sss
+}
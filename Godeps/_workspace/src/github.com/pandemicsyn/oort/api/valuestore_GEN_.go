@@ -41,6 +41,12 @@ type valueStore struct {
 
 // NewValueStore creates a ValueStore connection via grpc to the given
 // address.
+//
+// Requests are pipelined: each request type is multiplexed, tagged with an
+// Rpcid, over a single long lived bidirectional Stream RPC per connection
+// rather than each paying for a unary call. Up to concurrency requests of
+// each type may be in flight at once; see NewValueStorePool to spread them
+// over more than one connection.
 func NewValueStore(addr string, concurrency int, ftlsConfig *ftls.Config, opts ...grpc.DialOption) (store.ValueStore, error) {
 	stor := &valueStore{
 		addr:             addr,
@@ -576,7 +582,7 @@ func (stor *valueStore) Read(ctx context.Context, keyA, keyB uint64, value []byt
 	}
 
 	timestampMicro = res.res.TimestampMicro
-	rvalue = append(rvalue, res.res.Value...)
+	rvalue = append(value, res.res.Value...)
 
 	if res.res.Err == "" {
 		err = nil
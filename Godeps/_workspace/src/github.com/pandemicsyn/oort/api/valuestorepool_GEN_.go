@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gholt/store"
+	"github.com/pandemicsyn/ftls"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// valueStorePool spreads requests round robin across several connections to
+// the same backend store address, so a single HTTP/2 connection does not
+// become the bottleneck under high throughput.
+type valueStorePool struct {
+	// next is first to keep it 64-bit aligned for atomic use.
+	next   uint64
+	stores []store.ValueStore
+}
+
+// NewValueStorePool creates a ValueStore with the given number of
+// connections via grpc to the address, each able to carry the concurrency
+// given.
+func NewValueStorePool(addr string, connections int, concurrency int, ftlsConfig *ftls.Config, opts ...grpc.DialOption) (store.ValueStore, error) {
+	if connections < 2 {
+		return NewValueStore(addr, concurrency, ftlsConfig, opts...)
+	}
+	pool := &valueStorePool{stores: make([]store.ValueStore, connections)}
+	for i := range pool.stores {
+		var err error
+		if pool.stores[i], err = NewValueStore(addr, concurrency, ftlsConfig, opts...); err != nil {
+			for _, s := range pool.stores[:i] {
+				if c, ok := s.(interface{ Close() }); ok {
+					c.Close()
+				}
+			}
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+func (pool *valueStorePool) pick() store.ValueStore {
+	return pool.stores[atomic.AddUint64(&pool.next, 1)%uint64(len(pool.stores))]
+}
+
+// all calls f for each connection, returning the first error.
+func (pool *valueStorePool) all(f func(s store.ValueStore) error) error {
+	var rerr error
+	for _, s := range pool.stores {
+		if err := f(s); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	return rerr
+}
+
+func (pool *valueStorePool) Startup(ctx context.Context) error {
+	return pool.all(func(s store.ValueStore) error { return s.Startup(ctx) })
+}
+
+func (pool *valueStorePool) Shutdown(ctx context.Context) error {
+	return pool.all(func(s store.ValueStore) error { return s.Shutdown(ctx) })
+}
+
+// Close closes each connection; see valueStore.Close.
+func (pool *valueStorePool) Close() {
+	for _, s := range pool.stores {
+		if c, ok := s.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+// The store level requests go to just one connection as they all reach the
+// same backend store.
+
+func (pool *valueStorePool) EnableWrites(ctx context.Context) error {
+	return pool.stores[0].EnableWrites(ctx)
+}
+
+func (pool *valueStorePool) DisableWrites(ctx context.Context) error {
+	return pool.stores[0].DisableWrites(ctx)
+}
+
+func (pool *valueStorePool) Flush(ctx context.Context) error {
+	return pool.stores[0].Flush(ctx)
+}
+
+func (pool *valueStorePool) AuditPass(ctx context.Context) error {
+	return pool.stores[0].AuditPass(ctx)
+}
+
+func (pool *valueStorePool) Stats(ctx context.Context, debug bool) (fmt.Stringer, error) {
+	return pool.stores[0].Stats(ctx, debug)
+}
+
+func (pool *valueStorePool) ValueCap(ctx context.Context) (uint32, error) {
+	return pool.stores[0].ValueCap(ctx)
+}
+
+func (pool *valueStorePool) Lookup(ctx context.Context, keyA, keyB uint64) (int64, uint32, error) {
+	return pool.pick().Lookup(ctx, keyA, keyB)
+}
+
+func (pool *valueStorePool) Read(ctx context.Context, keyA, keyB uint64, value []byte) (int64, []byte, error) {
+	return pool.pick().Read(ctx, keyA, keyB, value)
+}
+
+func (pool *valueStorePool) Write(ctx context.Context, keyA, keyB uint64, timestampMicro int64, value []byte) (int64, error) {
+	return pool.pick().Write(ctx, keyA, keyB, timestampMicro, value)
+}
+
+func (pool *valueStorePool) Delete(ctx context.Context, keyA, keyB uint64, timestampMicro int64) (int64, error) {
+	return pool.pick().Delete(ctx, keyA, keyB, timestampMicro)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// defaultWatchPollInterval is how often Watch polls when no PollInterval is
+// given.
+const defaultWatchPollInterval = time.Second
+
+// watchRegistry wakes the Watches on a keyA, keyB pair when it is written or
+// deleted through the same client, so they need not wait for their next
+// poll to see the change. For groups the pair is the parent key, so group
+// watches are woken by any member's change. The zero value is ready to use.
+type watchRegistry struct {
+	lock    sync.Mutex
+	watches map[[2]uint64]map[chan struct{}]struct{}
+}
+
+// add registers a wake channel for the key pair, returning it and a func to
+// unregister it. The channel is buffered so wakes between polls coalesce.
+func (w *watchRegistry) add(keyA, keyB uint64) (chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	k := [2]uint64{keyA, keyB}
+	w.lock.Lock()
+	if w.watches == nil {
+		w.watches = make(map[[2]uint64]map[chan struct{}]struct{})
+	}
+	if w.watches[k] == nil {
+		w.watches[k] = make(map[chan struct{}]struct{})
+	}
+	w.watches[k][c] = struct{}{}
+	w.lock.Unlock()
+	return c, func() {
+		w.lock.Lock()
+		delete(w.watches[k], c)
+		if len(w.watches[k]) == 0 {
+			delete(w.watches, k)
+		}
+		w.lock.Unlock()
+	}
+}
+
+// wake wakes each Watch registered for the key pair.
+func (w *watchRegistry) wake(keyA, keyB uint64) {
+	w.lock.Lock()
+	for c := range w.watches[[2]uint64{keyA, keyB}] {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+	w.lock.Unlock()
+}
+
+// waitWatch waits for the next poll of a watch, or an earlier wake from a
+// local change, returning false once the ctx is done.
+func waitWatch(ctx context.Context, wake <-chan struct{}, interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-wake:
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
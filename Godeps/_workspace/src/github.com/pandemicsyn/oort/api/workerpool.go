@@ -0,0 +1,45 @@
+package api
+
+import "time"
+
+// workerIdleTimeout is how long an idle worker waits for more work before
+// exiting, so the pool shrinks back after a burst of requests.
+const workerIdleTimeout = 10 * time.Second
+
+// workerPool runs the per replica halves of requests on reused goroutines
+// rather than starting a new goroutine for each replica of each request. The
+// pool grows to the peak concurrency of requests to the backend store and
+// idle workers exit after workerIdleTimeout. A zero workerPool still works;
+// it just starts a new goroutine each time.
+type workerPool struct {
+	work chan func()
+}
+
+func newWorkerPool() workerPool {
+	return workerPool{work: make(chan func())}
+}
+
+// run hands fn to an idle worker, starting a new worker if none are idle.
+func (p workerPool) run(fn func()) {
+	select {
+	case p.work <- fn:
+	default:
+		go p.worker(fn)
+	}
+}
+
+func (p workerPool) worker(fn func()) {
+	timer := time.NewTimer(workerIdleTimeout)
+	for {
+		fn()
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(workerIdleTimeout)
+		select {
+		case fn = <-p.work:
+		case <-timer.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import "golang.org/x/net/context"
+
+// WriteAck defines how many replicas must acknowledge a write or delete for
+// it to succeed; see the WriteAck config setting and WithWriteAck.
+type WriteAck int
+
+const (
+	// WriteAckQuorum requires a majority of the replicas, more than half,
+	// to acknowledge. This is the default.
+	WriteAckQuorum WriteAck = iota
+	// WriteAckAny succeeds even if no replica acknowledges, as long as
+	// hinted handoff is enabled to carry the write to them later; without
+	// hinted handoff it is the same as WriteAckOne.
+	WriteAckAny
+	// WriteAckOne requires just one replica to acknowledge.
+	WriteAckOne
+	// WriteAckAll requires every replica to acknowledge.
+	WriteAckAll
+)
+
+func (a WriteAck) String() string {
+	switch a {
+	case WriteAckQuorum:
+		return "WriteAckQuorum"
+	case WriteAckAny:
+		return "WriteAckAny"
+	case WriteAckOne:
+		return "WriteAckOne"
+	case WriteAckAll:
+		return "WriteAckAll"
+	}
+	return "WriteAck?"
+}
+
+// required returns the number of acknowledgments needed from the replicas
+// given; hinted is whether failed writes are kept for hinted handoff.
+func (a WriteAck) required(replicas int, hinted bool) int {
+	switch a {
+	case WriteAckAny:
+		if hinted {
+			return 0
+		}
+		return 1
+	case WriteAckOne:
+		return 1
+	case WriteAckAll:
+		return replicas
+	}
+	return replicas/2 + 1
+}
+
+type writeAckKey struct{}
+
+// WithWriteAck returns a copy of the ctx that will cause writes and deletes
+// made with it to use the WriteAck given rather than the store's configured
+// one.
+func WithWriteAck(ctx context.Context, a WriteAck) context.Context {
+	return context.WithValue(ctx, writeAckKey{}, a)
+}
+
+// WriteAckFrom returns the WriteAck set on the ctx with WithWriteAck, or def
+// if none was set.
+func WriteAckFrom(ctx context.Context, def WriteAck) WriteAck {
+	if a, ok := ctx.Value(writeAckKey{}).(WriteAck); ok {
+		return a
+	}
+	return def
+}
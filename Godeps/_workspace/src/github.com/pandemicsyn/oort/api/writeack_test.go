@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestWriteAck(t *testing.T) {
+	for _, tc := range []struct {
+		ack         WriteAck
+		hinted      bool
+		maxFailures int
+	}{
+		{WriteAckQuorum, false, 1},
+		{WriteAckOne, false, 2},
+		{WriteAckAll, false, 0},
+		{WriteAckAny, false, 2},
+		{WriteAckAny, true, 3},
+	} {
+		for failures := 0; failures <= 3; failures++ {
+			cfg := &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{WriteAck: tc.ack}}
+			if tc.hinted {
+				cfg.HintedHandoffMaxBytes = 1 << 20
+			}
+			rs, sss := NewScriptedReplValueStore(3, cfg)
+			ctx := context.Background()
+			for _, ss := range sss[:failures] {
+				ss.Push("Write", ScriptedResponse{Err: errUnavailable})
+				ss.Push("Delete", ScriptedResponse{Err: errUnavailable})
+			}
+			_, werr := rs.Write(ctx, 1, 2, 5, []byte("a"))
+			_, derr := rs.Delete(ctx, 1, 2, 6)
+			for _, err := range []error{werr, derr} {
+				if failures <= tc.maxFailures {
+					if err != nil {
+						t.Fatalf("%s hinted=%t: expected %d failures to succeed, got %v", tc.ack, tc.hinted, failures, err)
+					}
+				} else if failures < 3 && !errors.Is(err, ErrPartialWrite) {
+					t.Fatalf("%s hinted=%t: expected %d failures to be a partial write, got %v", tc.ack, tc.hinted, failures, err)
+				} else if !errors.Is(err, errUnavailable) {
+					t.Fatalf("%s hinted=%t: expected %d failures to fail, got %v", tc.ack, tc.hinted, failures, err)
+				}
+			}
+		}
+	}
+}
+
+func TestWithWriteAck(t *testing.T) {
+	rs, sss := NewScriptedReplValueStore(3, &ReplValueStoreConfig{ReplStoreConfig: ReplStoreConfig{WriteAck: WriteAckAll}})
+	ctx := context.Background()
+	for _, ss := range sss[:2] {
+		ss.Push("Write", ScriptedResponse{Err: errUnavailable}, ScriptedResponse{Err: errUnavailable})
+	}
+	if _, err := rs.Write(ctx, 1, 2, 5, []byte("a")); !errors.Is(err, ErrPartialWrite) {
+		t.Fatalf("expected a partial write, got %v", err)
+	}
+	if _, err := rs.Write(WithWriteAck(ctx, WriteAckOne), 1, 2, 6, []byte("b")); err != nil {
+		t.Fatalf("expected one acknowledgment to be enough, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+// replicaWrite is one replica's response to a write or delete.
+type replicaWrite struct {
+	oldTimestampMicro int64
+	err               error
+}
+
+// writeOutcome gathers the responses of the replicas a write or delete was
+// sent to and applies the rules, shared by the Repl stores, for what they
+// add up to; the Repl stores supply only what depends on their store type.
+type writeOutcome struct {
+	// replicas is the number of replicas the write was sent to.
+	replicas int
+	// oldTimestampMicro is the newest old timestamp reported by a replica
+	// that succeeded.
+	oldTimestampMicro int64
+	// errs holds the error from each replica that failed, in the order
+	// they responded.
+	errs []error
+}
+
+// fanOutWrite calls send for each of the replicas, by index, and waits for
+// each to be given its response through reply. send must not block on the
+// write itself; it is expected to hand it to the replica's workers.
+func fanOutWrite(replicas int, send func(i int, reply func(replicaWrite))) *writeOutcome {
+	rc := make(chan replicaWrite)
+	reply := func(w replicaWrite) {
+		rc <- w
+	}
+	for i := 0; i < replicas; i++ {
+		send(i, reply)
+	}
+	o := &writeOutcome{replicas: replicas}
+	for i := 0; i < replicas; i++ {
+		w := <-rc
+		if w.err != nil {
+			o.errs = append(o.errs, w.err)
+		} else if w.oldTimestampMicro > o.oldTimestampMicro {
+			o.oldTimestampMicro = w.oldTimestampMicro
+		}
+	}
+	return o
+}
+
+// acked returns true if at least required replicas succeeded.
+func (o *writeOutcome) acked(required int) bool {
+	return o.replicas-len(o.errs) >= required
+}
+
+// partial returns true if some replicas failed but not all, leaving the
+// key's replicas in need of repair.
+func (o *writeOutcome) partial() bool {
+	return len(o.errs) > 0 && len(o.errs) < o.replicas
+}
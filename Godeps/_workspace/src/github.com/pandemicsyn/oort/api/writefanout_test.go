@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFanOutWrite(t *testing.T) {
+	boom := errors.New("boom")
+	for _, test := range []struct {
+		olds     []int64
+		failed   []bool
+		old      int64
+		quorum   bool
+		partial  bool
+		failures int
+	}{
+		{olds: []int64{1, 3, 2}, failed: []bool{false, false, false}, old: 3, quorum: true},
+		// A failed replica's old timestamp is not reported.
+		{olds: []int64{1, 3, 2}, failed: []bool{false, true, false}, old: 2, quorum: true, partial: true, failures: 1},
+		{olds: []int64{1, 3, 2}, failed: []bool{true, true, false}, old: 2, partial: true, failures: 2},
+		{olds: []int64{1, 3, 2}, failed: []bool{true, true, true}, failures: 3},
+	} {
+		o := fanOutWrite(len(test.olds), func(i int, reply func(replicaWrite)) {
+			w := replicaWrite{oldTimestampMicro: test.olds[i]}
+			if test.failed[i] {
+				w.err = boom
+			}
+			go reply(w)
+		})
+		if o.replicas != 3 || o.oldTimestampMicro != test.old || len(o.errs) != test.failures {
+			t.Fatalf("%v: expected old %d and %d errors, got %+v", test.failed, test.old, test.failures, o)
+		}
+		if o.acked(2) != test.quorum || o.partial() != test.partial {
+			t.Fatalf("%v: expected quorum %v and partial %v, got %v and %v", test.failed, test.quorum, test.partial, o.acked(2), o.partial())
+		}
+		if !o.acked(0) {
+			t.Fatalf("%v: expected no acks required to be met", test.failed)
+		}
+	}
+}
@@ -328,10 +328,12 @@ func (c *Client) getValueClient() error {
 		c.vstore, err = api.NewValueStore(c.vdirect, 10, tlsConfig, opts...)
 	} else {
 		c.vstore = api.NewReplValueStore(&api.ReplValueStoreConfig{
-			AddressIndex:       2,
-			StoreFTLSConfig:    tlsConfig,
-			GRPCOpts:           opts,
-			RingServerGRPCOpts: []grpc.DialOption{rOpts},
+			ReplStoreConfig: api.ReplStoreConfig{
+				AddressIndex:       2,
+				StoreFTLSConfig:    tlsConfig,
+				GRPCOpts:           opts,
+				RingServerGRPCOpts: []grpc.DialOption{rOpts},
+			},
 		})
 		if err := c.vstore.Startup(context.Background()); err != nil {
 			return fmt.Errorf("Unable to start value store client: %s", err)
@@ -364,10 +366,12 @@ func (c *Client) getGroupClient() error {
 		c.gstore, err = api.NewGroupStore(c.gdirect, 10, tlsConfig, opts...)
 	} else {
 		c.gstore = api.NewReplGroupStore(&api.ReplGroupStoreConfig{
-			AddressIndex:       2,
-			StoreFTLSConfig:    tlsConfig,
-			GRPCOpts:           opts,
-			RingServerGRPCOpts: []grpc.DialOption{rOpts},
+			ReplStoreConfig: api.ReplStoreConfig{
+				AddressIndex:       2,
+				StoreFTLSConfig:    tlsConfig,
+				GRPCOpts:           opts,
+				RingServerGRPCOpts: []grpc.DialOption{rOpts},
+			},
 		})
 		if err := c.gstore.Startup(context.Background()); err != nil {
 			return fmt.Errorf("Unable to start group store client: %s", err)
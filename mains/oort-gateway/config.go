@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	path                       string
+	listenAddr                 string
+	httpAddr                   string
+	oortValueSyndicate         string
+	oortGroupSyndicate         string
+	plaintext                  bool
+	insecureSkipVerify         bool
+	skipMutualTLS              bool
+	concurrentRequestsPerStore int
+	startupWaitForRing         time.Duration
+	authToken                  string
+	debug                      bool
+}
+
+func resolveConfig(c *config) *config {
+	cfg := &config{}
+	if c != nil {
+		*cfg = *c
+	}
+	if env := os.Getenv("OORT_GATEWAY_PATH"); env != "" {
+		cfg.path = env
+	}
+	if cfg.path == "" {
+		cfg.path = "/var/lib/oort-gateway"
+	}
+	if env := os.Getenv("OORT_GATEWAY_LISTEN_ADDR"); env != "" {
+		cfg.listenAddr = env
+	}
+	if cfg.listenAddr == "" {
+		cfg.listenAddr = ":8446"
+	}
+	if env := os.Getenv("OORT_GATEWAY_HTTP_ADDR"); env != "" {
+		cfg.httpAddr = env
+	}
+	// cfg.httpAddr == "" means no HTTP interface.
+	if env := os.Getenv("OORT_GATEWAY_OORT_VALUE_SYNDICATE"); env != "" {
+		cfg.oortValueSyndicate = env
+	}
+	// cfg.oortValueSyndicate == "" means default SRV resolution.
+	if env := os.Getenv("OORT_GATEWAY_OORT_GROUP_SYNDICATE"); env != "" {
+		cfg.oortGroupSyndicate = env
+	}
+	// cfg.oortGroupSyndicate == "" means default SRV resolution.
+	if env := os.Getenv("OORT_GATEWAY_PLAINTEXT"); env == "true" {
+		cfg.plaintext = true
+	}
+	if env := os.Getenv("OORT_GATEWAY_INSECURE_SKIP_VERIFY"); env == "true" {
+		cfg.insecureSkipVerify = true
+	}
+	if env := os.Getenv("OORT_GATEWAY_SKIP_MUTUAL_TLS"); env == "true" {
+		cfg.skipMutualTLS = true
+	}
+	if env := os.Getenv("OORT_GATEWAY_CONCURRENT_REQUESTS_PER_STORE"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			cfg.concurrentRequestsPerStore = val
+		}
+	}
+	if env := os.Getenv("OORT_GATEWAY_STARTUP_WAIT_FOR_RING"); env != "" {
+		if val, err := time.ParseDuration(env); err == nil {
+			cfg.startupWaitForRing = val
+		}
+	}
+	if env := os.Getenv("OORT_GATEWAY_AUTH_TOKEN"); env != "" {
+		cfg.authToken = env
+	}
+	// cfg.authToken == "" means no per request credentials are sent.
+	if env := os.Getenv("OORT_GATEWAY_DEBUG"); env == "true" {
+		cfg.debug = true
+	}
+	return cfg
+}
@@ -0,0 +1,140 @@
+// oort-gateway serves the oort value and group store gRPC services, backed
+// by the replicated api client, so applications in any language can use the
+// ring aware replication logic through a sidecar rather than reimplementing
+// it. Clients speak the same valueproto and groupproto services as a single
+// oort node. It serves TLS with server.crt and server.key from its path, or
+// plaintext with OORT_GATEWAY_PLAINTEXT=true for a sidecar reachable only
+// over loopback. Setting OORT_GATEWAY_HTTP_ADDR also serves the api package's
+// HTTP/JSON interface there, for scripting and debugging.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/pandemicsyn/ftls"
+	"github.com/pandemicsyn/oort/api"
+)
+
+var (
+	printVersionInfo = flag.Bool("version", false, "print version/build info")
+)
+
+var oortGatewayVersion string
+var buildDate string
+var goVersion string
+
+func main() {
+	flag.Parse()
+	if *printVersionInfo {
+		fmt.Println("oort-gateway version:", oortGatewayVersion)
+		fmt.Println("build date:", buildDate)
+		fmt.Println("go version:", goVersion)
+		return
+	}
+
+	cfg := resolveConfig(nil)
+	var logDebug func(formt string, args ...interface{})
+	if cfg.debug {
+		logDebug = func(formt string, args ...interface{}) {
+			log.Printf("DEBUG: "+formt, args...)
+		}
+	}
+
+	var opts []grpc.ServerOption
+	if !cfg.plaintext {
+		creds, err := credentials.NewServerTLSFromFile(path.Join(cfg.path, "server.crt"), path.Join(cfg.path, "server.key"))
+		if err != nil {
+			log.Fatalln("Couldn't load cert from file:", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s := grpc.NewServer(opts...)
+
+	tlsConfig := &ftls.Config{
+		MutualTLS:          !cfg.skipMutualTLS,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CertFile:           path.Join(cfg.path, "client.crt"),
+		KeyFile:            path.Join(cfg.path, "client.key"),
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	}
+	rOpts, err := ftls.NewGRPCClientDialOpt(&ftls.Config{
+		MutualTLS:          false,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	})
+	if err != nil {
+		log.Fatalln("Cannot setup store tls config for synd client:", err)
+	}
+
+	clientID, _ := os.Hostname()
+	if clientID != "" {
+		clientID += "/oort-gateway"
+	}
+
+	// Sent to the backends and ring servers, such as for an authenticating
+	// proxy in front of the cluster.
+	var perRPCCredentials credentials.Credentials
+	if cfg.authToken != "" {
+		perRPCCredentials = api.BearerToken(cfg.authToken)
+	}
+
+	vstore := api.NewReplValueStore(&api.ReplValueStoreConfig{
+		ReplStoreConfig: api.ReplStoreConfig{
+			LogDebug:                   logDebug,
+			AddressIndex:               2,
+			StoreFTLSConfig:            tlsConfig,
+			RingServer:                 cfg.oortValueSyndicate,
+			RingCachePath:              path.Join(cfg.path, "ring/valuestore.ring"),
+			RingServerGRPCOpts:         []grpc.DialOption{rOpts},
+			RingClientID:               clientID,
+			ConcurrentRequestsPerStore: cfg.concurrentRequestsPerStore,
+			StartupWaitForRing:         cfg.startupWaitForRing,
+			PerRPCCredentials:          perRPCCredentials,
+		},
+	})
+	if err := vstore.Startup(context.Background()); err != nil {
+		log.Fatalln("Cannot start valuestore connector:", err)
+	}
+
+	gstore := api.NewReplGroupStore(&api.ReplGroupStoreConfig{
+		ReplStoreConfig: api.ReplStoreConfig{
+			LogDebug:                   logDebug,
+			AddressIndex:               2,
+			StoreFTLSConfig:            tlsConfig,
+			RingServer:                 cfg.oortGroupSyndicate,
+			RingCachePath:              path.Join(cfg.path, "ring/groupstore.ring"),
+			RingServerGRPCOpts:         []grpc.DialOption{rOpts},
+			RingClientID:               clientID,
+			ConcurrentRequestsPerStore: cfg.concurrentRequestsPerStore,
+			StartupWaitForRing:         cfg.startupWaitForRing,
+			PerRPCCredentials:          perRPCCredentials,
+		},
+	})
+	if err := gstore.Startup(context.Background()); err != nil {
+		log.Fatalln("Cannot start groupstore connector:", err)
+	}
+
+	if cfg.httpAddr != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(cfg.httpAddr, api.NewHTTPHandler(vstore, gstore)))
+		}()
+	}
+	api.NewReplValueStoreServer(vstore).Register(s)
+	api.NewReplGroupStoreServer(gstore).Register(s)
+	l, err := net.Listen("tcp", cfg.listenAddr)
+	if err != nil {
+		log.Fatalln("Failed to bind oort-gateway:", err)
+	}
+	log.Printf("Starting oort-gateway on %s...\n", cfg.listenAddr)
+	log.Fatal(s.Serve(l))
+}
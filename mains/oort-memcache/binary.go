@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+const (
+	binaryHeaderLen     = 24
+	binaryMagicResponse = 0x81
+)
+
+// Binary protocol opcodes supported.
+const (
+	opGet     = 0x00
+	opSet     = 0x01
+	opAdd     = 0x02
+	opReplace = 0x03
+	opDelete  = 0x04
+	opQuit    = 0x07
+	opGetQ    = 0x09
+	opNoop    = 0x0a
+	opVersion = 0x0b
+	opGetK    = 0x0c
+	opGetKQ   = 0x0d
+	opTouch   = 0x1c
+)
+
+// Binary protocol response statuses.
+const (
+	statusOK             = 0x00
+	statusKeyNotFound    = 0x01
+	statusKeyExists      = 0x02
+	statusValueTooLarge  = 0x03
+	statusInvalidArgs    = 0x04
+	statusItemNotStored  = 0x05
+	statusUnknownCommand = 0x81
+	statusInternalError  = 0x84
+)
+
+type binaryRequest struct {
+	opcode byte
+	opaque uint32
+	cas    uint64
+	extras []byte
+	key    []byte
+	value  []byte
+	// tooLarge is set, and the body skipped, if the value is over
+	// maxItemSize.
+	tooLarge bool
+}
+
+func readBinaryRequest(r *bufio.Reader) (*binaryRequest, error) {
+	var hdr [binaryHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != binaryMagicRequest {
+		return nil, errors.New("bad request magic")
+	}
+	keyLen := int(binary.BigEndian.Uint16(hdr[2:]))
+	extrasLen := int(hdr[4])
+	bodyLen := int64(binary.BigEndian.Uint32(hdr[8:]))
+	req := &binaryRequest{
+		opcode: hdr[1],
+		opaque: binary.BigEndian.Uint32(hdr[12:]),
+		cas:    binary.BigEndian.Uint64(hdr[16:]),
+	}
+	if int64(keyLen+extrasLen) > bodyLen {
+		return nil, errors.New("bad request lengths")
+	}
+	if bodyLen > maxItemSize+int64(keyLen+extrasLen) {
+		// The body is skipped so the connection can carry on.
+		req.tooLarge = true
+		_, err := io.CopyN(ioutil.Discard, r, bodyLen)
+		return req, err
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	req.extras = body[:extrasLen]
+	req.key = body[extrasLen : extrasLen+keyLen]
+	req.value = body[extrasLen+keyLen:]
+	return req, nil
+}
+
+func writeBinaryResponse(w *bufio.Writer, req *binaryRequest, status uint16, cas uint64, extras, key, value []byte) {
+	var hdr [binaryHeaderLen]byte
+	hdr[0] = binaryMagicResponse
+	hdr[1] = req.opcode
+	binary.BigEndian.PutUint16(hdr[2:], uint16(len(key)))
+	hdr[4] = byte(len(extras))
+	binary.BigEndian.PutUint16(hdr[6:], status)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(hdr[12:], req.opaque)
+	binary.BigEndian.PutUint64(hdr[16:], cas)
+	w.Write(hdr[:])
+	w.Write(extras)
+	w.Write(key)
+	w.Write(value)
+}
+
+// writeBinaryError replies with the status given and its message as the
+// value, as memcached does.
+func writeBinaryError(w *bufio.Writer, req *binaryRequest, status uint16, msg string) {
+	writeBinaryResponse(w, req, status, 0, nil, nil, []byte(msg))
+}
+
+// handleBinary serves binary protocol requests until the client quits or
+// the connection fails. Replies to pipelined requests are sent together.
+func (s *cacheServer) handleBinary(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		req, err := readBinaryRequest(r)
+		if err != nil {
+			return err
+		}
+		quit := s.execBinary(w, req)
+		if quit || r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// execBinary runs one binary request and writes its reply, returning true if
+// the connection should then be closed.
+func (s *cacheServer) execBinary(w *bufio.Writer, req *binaryRequest) bool {
+	ctx := context.Background()
+	if req.tooLarge {
+		writeBinaryError(w, req, statusValueTooLarge, "Too large.")
+		return false
+	}
+	switch req.opcode {
+	case opGet, opGetQ, opGetK, opGetKQ:
+		if len(req.key) == 0 || len(req.extras) != 0 {
+			writeBinaryError(w, req, statusInvalidArgs, "Invalid arguments")
+			break
+		}
+		it, err := s.get(ctx, req.key)
+		quiet := req.opcode == opGetQ || req.opcode == opGetKQ
+		var key []byte
+		if req.opcode == opGetK || req.opcode == opGetKQ {
+			key = req.key
+		}
+		switch {
+		case errors.Is(err, api.ErrNotFound):
+			if !quiet {
+				writeBinaryResponse(w, req, statusKeyNotFound, 0, nil, key, []byte("Not found"))
+			}
+		case err != nil:
+			writeBinaryError(w, req, statusInternalError, err.Error())
+		default:
+			var extras [4]byte
+			binary.BigEndian.PutUint32(extras[:], it.flags)
+			writeBinaryResponse(w, req, statusOK, it.cas, extras[:], key, it.data)
+		}
+	case opSet, opAdd, opReplace:
+		if len(req.key) == 0 || len(req.extras) != 8 || (req.opcode == opAdd && req.cas != 0) {
+			writeBinaryError(w, req, statusInvalidArgs, "Invalid arguments")
+			break
+		}
+		mode := map[byte]storeMode{opSet: modeSet, opAdd: modeAdd, opReplace: modeReplace}[req.opcode]
+		// A cas given with set or replace makes it a compare and swap.
+		if req.cas != 0 {
+			mode = modeCAS
+		}
+		it := &item{flags: binary.BigEndian.Uint32(req.extras), data: req.value, cas: req.cas}
+		exptime := int64(binary.BigEndian.Uint32(req.extras[4:]))
+		cas, err := s.store(ctx, mode, req.key, it, exptime)
+		switch {
+		case err == errNotStored:
+			writeBinaryError(w, req, statusItemNotStored, "Not stored.")
+		case err == errExists:
+			writeBinaryError(w, req, statusKeyExists, "Data exists for key.")
+		case errors.Is(err, api.ErrNotFound):
+			writeBinaryError(w, req, statusKeyNotFound, "Not found")
+		case err != nil:
+			writeBinaryError(w, req, statusInternalError, err.Error())
+		default:
+			writeBinaryResponse(w, req, statusOK, cas, nil, nil, nil)
+		}
+	case opDelete:
+		if len(req.key) == 0 || len(req.extras) != 0 || len(req.value) != 0 {
+			writeBinaryError(w, req, statusInvalidArgs, "Invalid arguments")
+			break
+		}
+		err := s.delete(ctx, req.key)
+		switch {
+		case errors.Is(err, api.ErrNotFound):
+			writeBinaryError(w, req, statusKeyNotFound, "Not found")
+		case err != nil:
+			writeBinaryError(w, req, statusInternalError, err.Error())
+		default:
+			writeBinaryResponse(w, req, statusOK, 0, nil, nil, nil)
+		}
+	case opTouch:
+		if len(req.key) == 0 || len(req.extras) != 4 {
+			writeBinaryError(w, req, statusInvalidArgs, "Invalid arguments")
+			break
+		}
+		err := s.touch(ctx, req.key, int64(binary.BigEndian.Uint32(req.extras)))
+		switch {
+		case errors.Is(err, api.ErrNotFound), err == errExists:
+			writeBinaryError(w, req, statusKeyNotFound, "Not found")
+		case err != nil:
+			writeBinaryError(w, req, statusInternalError, err.Error())
+		default:
+			writeBinaryResponse(w, req, statusOK, 0, nil, nil, nil)
+		}
+	case opNoop:
+		writeBinaryResponse(w, req, statusOK, 0, nil, nil, nil)
+	case opVersion:
+		writeBinaryResponse(w, req, statusOK, 0, nil, nil, []byte(oortMemcacheVersion))
+	case opQuit:
+		writeBinaryResponse(w, req, statusOK, 0, nil, nil, nil)
+		return true
+	default:
+		writeBinaryError(w, req, statusUnknownCommand, "Unknown command")
+	}
+	return false
+}
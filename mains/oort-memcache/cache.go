@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+// Items are stored as their 4 byte flags followed by their data, which also
+// keeps empty items from being zero length values the stores cannot hold.
+const flagsLen = 4
+
+// maxRelativeExptime is the largest exptime taken as seconds from now;
+// larger ones are Unix times, as with memcached.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+var (
+	errNotStored = errors.New("not stored")
+	errExists    = errors.New("exists")
+)
+
+type item struct {
+	flags uint32
+	data  []byte
+	// cas is the timestamp the item was written with.
+	cas uint64
+}
+
+// storeMode is how a store call treats an existing item.
+type storeMode int
+
+const (
+	modeSet storeMode = iota
+	modeAdd
+	modeReplace
+	modeCAS
+)
+
+type cacheServer struct {
+	vstore *api.ReplValueStore
+	// lastTimestampMicro keeps write timestamps increasing, so two writes to
+	// a key within the same microsecond are still ordered.
+	lastTimestampMicro int64
+}
+
+func newCacheServer(vstore *api.ReplValueStore) *cacheServer {
+	return &cacheServer{vstore: vstore}
+}
+
+// timestampMicro returns a timestamp newer than any given before and than
+// after, so it can replace a value written at after.
+func (s *cacheServer) timestampMicro(after int64) int64 {
+	for {
+		last := atomic.LoadInt64(&s.lastTimestampMicro)
+		t := time.Now().UnixNano() / 1000
+		if t <= last {
+			t = last + 1
+		}
+		if t <= after {
+			t = after + 1
+		}
+		if atomic.CompareAndSwapInt64(&s.lastTimestampMicro, last, t) {
+			return t
+		}
+	}
+}
+
+// ttl converts a memcached exptime to a TTL; 0 means no expiry and expired
+// is true if the item would already have expired.
+func ttl(exptime int64) (d time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= maxRelativeExptime:
+		return time.Duration(exptime) * time.Second, false
+	}
+	d = time.Unix(exptime, 0).Sub(time.Now())
+	return d, d <= 0
+}
+
+func (s *cacheServer) get(ctx context.Context, key []byte) (*item, error) {
+	keyA, keyB := api.KeyHash(key)
+	timestampMicro, value, err := s.vstore.Read(ctx, keyA, keyB, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < flagsLen {
+		return nil, errors.New("stored value is not a memcached item")
+	}
+	return &item{flags: binary.BigEndian.Uint32(value), data: value[flagsLen:], cas: uint64(timestampMicro)}, nil
+}
+
+// store writes the item as the mode directs, returning errNotStored for an
+// add of an existing key or a replace of a missing one, errExists for a cas
+// that does not match, and api.ErrNotFound for a cas of a missing key. The
+// new cas is returned.
+//
+// Other than set, each mode looks the key up and then writes with
+// CompareAndWrite against the timestamp found. Lookup treats expired items
+// as not found, where Create would not, so an add over an expired item
+// succeeds as it should.
+func (s *cacheServer) store(ctx context.Context, mode storeMode, key []byte, it *item, exptime int64) (uint64, error) {
+	keyA, keyB := api.KeyHash(key)
+	d, expired := ttl(exptime)
+	var existing int64
+	if mode != modeSet {
+		timestampMicro, _, err := s.vstore.Lookup(ctx, keyA, keyB)
+		found := err == nil
+		if errors.Is(err, api.ErrNotFound) {
+			err = nil
+		}
+		switch {
+		case err != nil:
+			return 0, err
+		case mode == modeAdd && found, mode == modeReplace && !found:
+			return 0, errNotStored
+		case mode == modeCAS && !found:
+			return 0, api.ErrNotFound
+		case mode == modeCAS && uint64(timestampMicro) != it.cas:
+			return 0, errExists
+		}
+		existing = timestampMicro
+	}
+	timestampMicro := s.timestampMicro(existing)
+	if expired {
+		// Storing an already expired item just removes any that was there.
+		if mode == modeAdd {
+			return 0, nil
+		}
+		_, err := s.vstore.Delete(ctx, keyA, keyB, timestampMicro)
+		return 0, err
+	}
+	value := make([]byte, flagsLen+len(it.data))
+	binary.BigEndian.PutUint32(value, it.flags)
+	copy(value[flagsLen:], it.data)
+	var err error
+	switch {
+	case mode == modeSet && d == 0:
+		_, err = s.vstore.Write(ctx, keyA, keyB, timestampMicro, value)
+	case mode == modeSet:
+		_, err = s.vstore.WriteTTL(ctx, keyA, keyB, timestampMicro, value, d)
+	case d == 0:
+		_, err = s.vstore.CompareAndWrite(ctx, keyA, keyB, existing, timestampMicro, value)
+	default:
+		_, err = s.vstore.CompareAndWriteTTL(ctx, keyA, keyB, existing, timestampMicro, value, d)
+	}
+	var cerr *api.ConflictError
+	switch {
+	case errors.As(err, &cerr) && mode == modeCAS:
+		return 0, errExists
+	case errors.As(err, &cerr):
+		return 0, errNotStored
+	case err != nil:
+		return 0, err
+	}
+	return uint64(timestampMicro), nil
+}
+
+func (s *cacheServer) delete(ctx context.Context, key []byte) error {
+	keyA, keyB := api.KeyHash(key)
+	if _, _, err := s.vstore.Lookup(ctx, keyA, keyB); err != nil {
+		return err
+	}
+	_, err := s.vstore.Delete(ctx, keyA, keyB, s.timestampMicro(0))
+	return err
+}
+
+// touch gives an existing item a new exptime, which means writing it again.
+func (s *cacheServer) touch(ctx context.Context, key []byte, exptime int64) error {
+	it, err := s.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = s.store(ctx, modeCAS, key, it, exptime)
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+type config struct {
+	path                       string
+	listenAddr                 string
+	oortValueSyndicate         string
+	insecureSkipVerify         bool
+	skipMutualTLS              bool
+	concurrentRequestsPerStore int
+	debug                      bool
+}
+
+func resolveConfig(c *config) *config {
+	cfg := &config{}
+	if c != nil {
+		*cfg = *c
+	}
+	if env := os.Getenv("OORT_MEMCACHE_PATH"); env != "" {
+		cfg.path = env
+	}
+	if cfg.path == "" {
+		cfg.path = "/var/lib/oort-memcache"
+	}
+	if env := os.Getenv("OORT_MEMCACHE_LISTEN_ADDR"); env != "" {
+		cfg.listenAddr = env
+	}
+	if cfg.listenAddr == "" {
+		cfg.listenAddr = ":11211"
+	}
+	if env := os.Getenv("OORT_MEMCACHE_OORT_VALUE_SYNDICATE"); env != "" {
+		cfg.oortValueSyndicate = env
+	}
+	// cfg.oortValueSyndicate == "" means default SRV resolution.
+	if env := os.Getenv("OORT_MEMCACHE_INSECURE_SKIP_VERIFY"); env == "true" {
+		cfg.insecureSkipVerify = true
+	}
+	if env := os.Getenv("OORT_MEMCACHE_SKIP_MUTUAL_TLS"); env == "true" {
+		cfg.skipMutualTLS = true
+	}
+	if env := os.Getenv("OORT_MEMCACHE_CONCURRENT_REQUESTS_PER_STORE"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			cfg.concurrentRequestsPerStore = val
+		}
+	}
+	if env := os.Getenv("OORT_MEMCACHE_DEBUG"); env == "true" {
+		cfg.debug = true
+	}
+	return cfg
+}
@@ -0,0 +1,93 @@
+// oort-memcache speaks the memcached text and binary protocols, storing items
+// in an oort value store for drop-in caching workloads. It supports get,
+// gets, set, add, replace, cas, delete, and touch, with flags and
+// expiration; keys are hashed with api.KeyHash. Connections are not
+// authenticated, so it should only be reachable by trusted clients.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/pandemicsyn/ftls"
+	"github.com/pandemicsyn/oort/api"
+)
+
+var (
+	printVersionInfo = flag.Bool("version", false, "print version/build info")
+)
+
+var oortMemcacheVersion string
+var buildDate string
+var goVersion string
+
+func main() {
+	flag.Parse()
+	if *printVersionInfo {
+		fmt.Println("oort-memcache version:", oortMemcacheVersion)
+		fmt.Println("build date:", buildDate)
+		fmt.Println("go version:", goVersion)
+		return
+	}
+
+	cfg := resolveConfig(nil)
+	var logDebug func(formt string, args ...interface{})
+	if cfg.debug {
+		logDebug = func(formt string, args ...interface{}) {
+			log.Printf("DEBUG: "+formt, args...)
+		}
+	}
+
+	tlsConfig := &ftls.Config{
+		MutualTLS:          !cfg.skipMutualTLS,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CertFile:           path.Join(cfg.path, "client.crt"),
+		KeyFile:            path.Join(cfg.path, "client.key"),
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	}
+	rOpts, err := ftls.NewGRPCClientDialOpt(&ftls.Config{
+		MutualTLS:          false,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	})
+	if err != nil {
+		log.Fatalln("Cannot setup value store tls config for synd client:", err)
+	}
+
+	clientID, _ := os.Hostname()
+	if clientID != "" {
+		clientID += "/oort-memcache"
+	}
+
+	vstore := api.NewReplValueStore(&api.ReplValueStoreConfig{
+		ReplStoreConfig: api.ReplStoreConfig{
+			LogDebug:                   logDebug,
+			AddressIndex:               2,
+			StoreFTLSConfig:            tlsConfig,
+			RingServer:                 cfg.oortValueSyndicate,
+			RingCachePath:              path.Join(cfg.path, "ring/valuestore.ring"),
+			RingServerGRPCOpts:         []grpc.DialOption{rOpts},
+			RingClientID:               clientID,
+			ConcurrentRequestsPerStore: cfg.concurrentRequestsPerStore,
+			ExpiringValues:             true,
+			DeleteExpired:              true,
+		},
+	})
+	if err := vstore.Startup(context.Background()); err != nil {
+		log.Fatalln("Cannot start valuestore connector:", err)
+	}
+
+	l, err := net.Listen("tcp", cfg.listenAddr)
+	if err != nil {
+		log.Fatalln("Failed to bind oort-memcache:", err)
+	}
+	log.Printf("Starting oort-memcache on %s...\n", cfg.listenAddr)
+	log.Fatal(newCacheServer(vstore).serve(l))
+}
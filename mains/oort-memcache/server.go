@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+)
+
+// maxItemSize is the largest item data accepted, as with memcached's
+// default.
+const maxItemSize = 1024 * 1024
+
+// binaryMagicRequest starts every binary protocol request; no text command
+// starts with it, so the first byte of a connection tells the two apart.
+const binaryMagicRequest = 0x80
+
+func (s *cacheServer) serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *cacheServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	b, err := r.Peek(1)
+	if err != nil {
+		return
+	}
+	if b[0] == binaryMagicRequest {
+		err = s.handleBinary(r, w)
+	} else {
+		err = s.handleText(r, w)
+	}
+	if err != nil && err != io.EOF {
+		log.Printf("error serving %s: %s", conn.RemoteAddr(), err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func startCacheServer(t *testing.T) (net.Conn, func()) {
+	vstore, _ := api.NewMemReplValueStore(3, &api.ReplValueStoreConfig{ReplStoreConfig: api.ReplStoreConfig{ExpiringValues: true}})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go newCacheServer(vstore).serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		l.Close()
+	}
+}
+
+func TestTextCommands(t *testing.T) {
+	conn, done := startCacheServer(t)
+	defer done()
+	r := bufio.NewReader(conn)
+	var cas string
+	for _, c := range []struct {
+		send   string
+		expect []string
+	}{
+		{"get k\r\n", []string{"END"}},
+		{"set k 7 0 5\r\nhello\r\n", []string{"STORED"}},
+		{"get k missing\r\n", []string{"VALUE k 7 5", "hello", "END"}},
+		{"add k 0 0 1\r\nx\r\n", []string{"NOT_STORED"}},
+		{"replace missing 0 0 1\r\nx\r\n", []string{"NOT_STORED"}},
+		{"replace k 3 0 0\r\n\r\n", []string{"STORED"}},
+		{"gets k\r\n", nil},
+		{"cas k 0 0 1 1\r\nx\r\n", []string{"EXISTS"}},
+		{"cas k 0 0 1 CAS\r\ny\r\n", []string{"STORED"}},
+		{"get k\r\n", []string{"VALUE k 0 1", "y", "END"}},
+		{"cas missing 0 0 1 1\r\nx\r\n", []string{"NOT_FOUND"}},
+		{"set quiet 0 0 1 noreply\r\nq\r\nget quiet\r\n", []string{"VALUE quiet 0 1", "q", "END"}},
+		{"touch k 100\r\n", []string{"TOUCHED"}},
+		{"touch missing 100\r\n", []string{"NOT_FOUND"}},
+		{"set gone 0 -1 1\r\nz\r\n", []string{"STORED"}},
+		{"get gone\r\n", []string{"END"}},
+		{"delete k\r\n", []string{"DELETED"}},
+		{"delete k\r\n", []string{"NOT_FOUND"}},
+		{"add k 0 0 1\r\na\r\n", []string{"STORED"}},
+		{"nope\r\n", []string{"ERROR"}},
+	} {
+		send := strings.Replace(c.send, "CAS", cas, 1)
+		if _, err := conn.Write([]byte(send)); err != nil {
+			t.Fatal(err)
+		}
+		if c.expect == nil {
+			// gets: keep the cas for the following commands.
+			line, _ := readTextLine(r)
+			fields := strings.Fields(string(line))
+			if len(fields) != 5 || fields[2] != "3" || fields[3] != "0" {
+				t.Fatalf("%q: got %q", send, line)
+			}
+			cas = fields[4]
+			readTextLine(r)
+			readTextLine(r)
+			continue
+		}
+		for _, expect := range c.expect {
+			line, err := readTextLine(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(line) != expect {
+				t.Fatalf("%q: expected %q; got %q", send, expect, line)
+			}
+		}
+	}
+}
+
+func binaryRequestBytes(opcode byte, cas uint64, extras, key, value []byte) []byte {
+	b := make([]byte, binaryHeaderLen, binaryHeaderLen+len(extras)+len(key)+len(value))
+	b[0] = binaryMagicRequest
+	b[1] = opcode
+	binary.BigEndian.PutUint16(b[2:], uint16(len(key)))
+	b[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(b[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(b[12:], uint32(opcode)+1000)
+	binary.BigEndian.PutUint64(b[16:], cas)
+	b = append(b, extras...)
+	b = append(b, key...)
+	return append(b, value...)
+}
+
+type binaryResponse struct {
+	opcode byte
+	status uint16
+	opaque uint32
+	cas    uint64
+	extras []byte
+	key    []byte
+	value  []byte
+}
+
+func readBinaryResponse(t *testing.T, r io.Reader) *binaryResponse {
+	var hdr [binaryHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	if hdr[0] != binaryMagicResponse {
+		t.Fatalf("bad magic %x", hdr[0])
+	}
+	body := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		t.Fatal(err)
+	}
+	keyLen := int(binary.BigEndian.Uint16(hdr[2:]))
+	extrasLen := int(hdr[4])
+	return &binaryResponse{
+		opcode: hdr[1],
+		status: binary.BigEndian.Uint16(hdr[6:]),
+		opaque: binary.BigEndian.Uint32(hdr[12:]),
+		cas:    binary.BigEndian.Uint64(hdr[16:]),
+		extras: body[:extrasLen],
+		key:    body[extrasLen : extrasLen+keyLen],
+		value:  body[extrasLen+keyLen:],
+	}
+}
+
+func TestBinaryCommands(t *testing.T) {
+	conn, done := startCacheServer(t)
+	defer done()
+	r := bufio.NewReader(conn)
+	do := func(opcode byte, cas uint64, extras, key, value []byte, status uint16) *binaryResponse {
+		if _, err := conn.Write(binaryRequestBytes(opcode, cas, extras, key, value)); err != nil {
+			t.Fatal(err)
+		}
+		resp := readBinaryResponse(t, r)
+		if resp.opcode != opcode || resp.opaque != uint32(opcode)+1000 {
+			t.Fatalf("opcode %x: got response for opcode %x opaque %d", opcode, resp.opcode, resp.opaque)
+		}
+		if resp.status != status {
+			t.Fatalf("opcode %x: expected status %x; got %x %q", opcode, status, resp.status, resp.value)
+		}
+		return resp
+	}
+	setExtras := []byte{0, 0, 0, 9, 0, 0, 0, 0}
+	do(opGet, 0, nil, []byte("k"), nil, statusKeyNotFound)
+	set := do(opSet, 0, setExtras, []byte("k"), []byte("hello"), statusOK)
+	resp := do(opGetK, 0, nil, []byte("k"), nil, statusOK)
+	if binary.BigEndian.Uint32(resp.extras) != 9 || string(resp.key) != "k" || string(resp.value) != "hello" || resp.cas != set.cas {
+		t.Fatalf("unexpected get response %#v", resp)
+	}
+	do(opAdd, 0, setExtras, []byte("k"), []byte("x"), statusItemNotStored)
+	do(opReplace, 0, setExtras, []byte("missing"), []byte("x"), statusItemNotStored)
+	do(opSet, set.cas+1, setExtras, []byte("k"), []byte("x"), statusKeyExists)
+	do(opSet, set.cas, setExtras, []byte("k"), []byte("x"), statusOK)
+	do(opTouch, 0, []byte{0, 0, 0, 100}, []byte("k"), nil, statusOK)
+	// A quiet get that misses sends nothing, so the noop reply comes next.
+	if _, err := conn.Write(binaryRequestBytes(opGetQ, 0, nil, []byte("missing"), nil)); err != nil {
+		t.Fatal(err)
+	}
+	do(opNoop, 0, nil, nil, nil, statusOK)
+	do(opDelete, 0, nil, []byte("k"), nil, statusOK)
+	do(opDelete, 0, nil, []byte("k"), nil, statusKeyNotFound)
+	do(opSet, 0, setExtras, []byte("big"), bytes.Repeat([]byte("x"), maxItemSize+1), statusValueTooLarge)
+	do(0x55, 0, nil, nil, nil, statusUnknownCommand)
+	do(opQuit, 0, nil, nil, nil, statusOK)
+}
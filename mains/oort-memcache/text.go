@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+// maxTextLine bounds a text command line; memcached keys are at most 250
+// bytes, so real commands are far shorter.
+const maxTextLine = 4096
+
+var errLineTooLong = errors.New("line too long")
+
+// readTextLine returns the next line without its \r\n or \n.
+func readTextLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull || len(line) > maxTextLine {
+		return nil, errLineTooLong
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	return append([]byte(nil), line...), nil
+}
+
+// handleText serves text protocol commands until the client quits or the
+// connection fails. Replies to pipelined commands are sent together.
+func (s *cacheServer) handleText(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		line, err := readTextLine(r)
+		if err == errLineTooLong {
+			fmt.Fprint(w, "CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			fmt.Fprint(w, "ERROR\r\n")
+			continue
+		}
+		quit, err := s.execText(r, w, fields)
+		if err != nil {
+			return err
+		}
+		if quit || r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// execText runs one text command, reading any data block it has from r, and
+// writes its reply; quit is true if the connection should then be closed.
+func (s *cacheServer) execText(r *bufio.Reader, w *bufio.Writer, fields [][]byte) (quit bool, err error) {
+	ctx := context.Background()
+	cmd := string(fields[0])
+	args := fields[1:]
+	noreply := len(args) > 0 && string(args[len(args)-1]) == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+	reply := func(format string, a ...interface{}) {
+		if !noreply {
+			fmt.Fprintf(w, format+"\r\n", a...)
+		}
+	}
+	serverError := func(err error) {
+		reply("SERVER_ERROR %s", err)
+	}
+	switch cmd {
+	case "get", "gets":
+		if len(args) == 0 {
+			fmt.Fprint(w, "ERROR\r\n")
+			break
+		}
+		for _, key := range args {
+			it, err := s.get(ctx, key)
+			if errors.Is(err, api.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				serverError(err)
+				return false, nil
+			}
+			if cmd == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.data), it.cas)
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, it.flags, len(it.data))
+			}
+			w.Write(it.data)
+			w.WriteString("\r\n")
+		}
+		fmt.Fprint(w, "END\r\n")
+	case "set", "add", "replace", "cas":
+		return false, s.textStore(ctx, r, w, cmd, args, reply)
+	case "delete":
+		if len(args) != 1 {
+			fmt.Fprint(w, "ERROR\r\n")
+			break
+		}
+		err := s.delete(ctx, args[0])
+		switch {
+		case errors.Is(err, api.ErrNotFound):
+			reply("NOT_FOUND")
+		case err != nil:
+			serverError(err)
+		default:
+			reply("DELETED")
+		}
+	case "touch":
+		if len(args) != 2 {
+			fmt.Fprint(w, "ERROR\r\n")
+			break
+		}
+		exptime, perr := strconv.ParseInt(string(args[1]), 10, 64)
+		if perr != nil {
+			reply("CLIENT_ERROR bad command line format")
+			break
+		}
+		err := s.touch(ctx, args[0], exptime)
+		switch {
+		case errors.Is(err, api.ErrNotFound), err == errExists:
+			reply("NOT_FOUND")
+		case err != nil:
+			serverError(err)
+		default:
+			reply("TOUCHED")
+		}
+	case "version":
+		fmt.Fprintf(w, "VERSION oort-memcache %s\r\n", oortMemcacheVersion)
+	case "quit":
+		return true, nil
+	default:
+		fmt.Fprint(w, "ERROR\r\n")
+	}
+	return false, nil
+}
+
+// textStore handles <cmd> <key> <flags> <exptime> <bytes> [<cas>], reading
+// the data block that follows the command line.
+func (s *cacheServer) textStore(ctx context.Context, r *bufio.Reader, w *bufio.Writer, cmd string, args [][]byte, reply func(string, ...interface{})) error {
+	nargs := 4
+	if cmd == "cas" {
+		nargs = 5
+	}
+	if len(args) != nargs {
+		fmt.Fprint(w, "ERROR\r\n")
+		return nil
+	}
+	flags, err1 := strconv.ParseUint(string(args[1]), 10, 32)
+	exptime, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	size, err3 := strconv.ParseInt(string(args[3]), 10, 32)
+	var cas uint64
+	var err4 error
+	if cmd == "cas" {
+		cas, err4 = strconv.ParseUint(string(args[4]), 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || size < 0 {
+		// Without a valid size the data block cannot be skipped, so the
+		// connection is closed as memcached does.
+		fmt.Fprint(w, "CLIENT_ERROR bad command line format\r\n")
+		w.Flush()
+		return errors.New("bad command line format")
+	}
+	data := make([]byte, size+2)
+	if size > maxItemSize {
+		data = data[:2]
+		if _, err := io.CopyN(ioutil.Discard, r, size); err != nil {
+			return err
+		}
+	}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		fmt.Fprint(w, "CLIENT_ERROR bad data chunk\r\n")
+		return nil
+	}
+	if size > maxItemSize {
+		fmt.Fprint(w, "SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	mode := map[string]storeMode{"set": modeSet, "add": modeAdd, "replace": modeReplace, "cas": modeCAS}[cmd]
+	_, err := s.store(ctx, mode, args[0], &item{flags: uint32(flags), data: data[:size], cas: cas}, exptime)
+	switch {
+	case err == errNotStored:
+		reply("NOT_STORED")
+	case err == errExists:
+		reply("EXISTS")
+	case errors.Is(err, api.ErrNotFound):
+		reply("NOT_FOUND")
+	case err != nil:
+		reply("SERVER_ERROR %s", err)
+	default:
+		reply("STORED")
+	}
+	return nil
+}
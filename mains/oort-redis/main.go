@@ -0,0 +1,92 @@
+// oort-redis speaks enough of the Redis protocol, RESP, for clients to GET,
+// SET (with EX or PX), DEL, check EXISTS, and read the TTL of keys held in an
+// oort value store. Keys are hashed with api.KeyHashString. Connections are
+// not authenticated, so it should only be reachable by trusted clients.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/pandemicsyn/ftls"
+	"github.com/pandemicsyn/oort/api"
+)
+
+var (
+	printVersionInfo = flag.Bool("version", false, "print version/build info")
+)
+
+var oortRedisVersion string
+var buildDate string
+var goVersion string
+
+func main() {
+	flag.Parse()
+	if *printVersionInfo {
+		fmt.Println("oort-redis version:", oortRedisVersion)
+		fmt.Println("build date:", buildDate)
+		fmt.Println("go version:", goVersion)
+		return
+	}
+
+	cfg := resolveConfig(nil)
+	var logDebug func(formt string, args ...interface{})
+	if cfg.debug {
+		logDebug = func(formt string, args ...interface{}) {
+			log.Printf("DEBUG: "+formt, args...)
+		}
+	}
+
+	tlsConfig := &ftls.Config{
+		MutualTLS:          !cfg.skipMutualTLS,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CertFile:           path.Join(cfg.path, "client.crt"),
+		KeyFile:            path.Join(cfg.path, "client.key"),
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	}
+	rOpts, err := ftls.NewGRPCClientDialOpt(&ftls.Config{
+		MutualTLS:          false,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	})
+	if err != nil {
+		log.Fatalln("Cannot setup value store tls config for synd client:", err)
+	}
+
+	clientID, _ := os.Hostname()
+	if clientID != "" {
+		clientID += "/oort-redis"
+	}
+
+	vstore := api.NewReplValueStore(&api.ReplValueStoreConfig{
+		ReplStoreConfig: api.ReplStoreConfig{
+			LogDebug:                   logDebug,
+			AddressIndex:               2,
+			StoreFTLSConfig:            tlsConfig,
+			RingServer:                 cfg.oortValueSyndicate,
+			RingCachePath:              path.Join(cfg.path, "ring/valuestore.ring"),
+			RingServerGRPCOpts:         []grpc.DialOption{rOpts},
+			RingClientID:               clientID,
+			ConcurrentRequestsPerStore: cfg.concurrentRequestsPerStore,
+			ExpiringValues:             true,
+			DeleteExpired:              true,
+		},
+	})
+	if err := vstore.Startup(context.Background()); err != nil {
+		log.Fatalln("Cannot start valuestore connector:", err)
+	}
+
+	l, err := net.Listen("tcp", cfg.listenAddr)
+	if err != nil {
+		log.Fatalln("Failed to bind oort-redis:", err)
+	}
+	log.Printf("Starting oort-redis on %s...\n", cfg.listenAddr)
+	log.Fatal(newRedisServer(vstore).serve(l))
+}
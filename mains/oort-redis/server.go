@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+type redisServer struct {
+	vstore *api.ReplValueStore
+	// lastTimestampMicro keeps write timestamps increasing, so two writes to
+	// a key within the same microsecond are still ordered.
+	lastTimestampMicro int64
+}
+
+func newRedisServer(vstore *api.ReplValueStore) *redisServer {
+	return &redisServer{vstore: vstore}
+}
+
+func (s *redisServer) serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *redisServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err == errProtocol {
+				writeError(w, "ERR Protocol error")
+				w.Flush()
+			} else if err != io.EOF {
+				log.Printf("error reading from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.exec(w, args)
+		// Replies to pipelined commands are sent together.
+		if quit || r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+func (s *redisServer) timestampMicro() int64 {
+	for {
+		last := atomic.LoadInt64(&s.lastTimestampMicro)
+		t := time.Now().UnixNano() / 1000
+		if t <= last {
+			t = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&s.lastTimestampMicro, last, t) {
+			return t
+		}
+	}
+}
+
+func wrongArgs(w *bufio.Writer, cmd string) {
+	writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
+
+// exec runs the command and writes its reply, returning true if the
+// connection should then be closed.
+func (s *redisServer) exec(w *bufio.Writer, args [][]byte) bool {
+	ctx := context.Background()
+	cmd := strings.ToUpper(string(args[0]))
+	args = args[1:]
+	switch cmd {
+	case "PING":
+		if len(args) > 0 {
+			writeBulk(w, args[0])
+		} else {
+			writeSimple(w, "PONG")
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			wrongArgs(w, cmd)
+			break
+		}
+		writeBulk(w, args[0])
+	case "QUIT":
+		writeSimple(w, "OK")
+		return true
+	case "COMMAND":
+		writeArrayHeader(w, 0)
+	case "GET":
+		if len(args) != 1 {
+			wrongArgs(w, cmd)
+			break
+		}
+		keyA, keyB := api.KeyHash(args[0])
+		_, value, err := s.vstore.Read(ctx, keyA, keyB, nil)
+		if errors.Is(err, api.ErrNotFound) {
+			writeBulk(w, nil)
+		} else if err != nil {
+			writeError(w, "ERR "+err.Error())
+		} else {
+			writeBulk(w, value)
+		}
+	case "SET":
+		s.set(ctx, w, args)
+	case "DEL", "EXISTS":
+		if len(args) < 1 {
+			wrongArgs(w, cmd)
+			break
+		}
+		var n int64
+		for _, key := range args {
+			keyA, keyB := api.KeyHash(key)
+			_, _, err := s.vstore.Lookup(ctx, keyA, keyB)
+			if errors.Is(err, api.ErrNotFound) {
+				continue
+			}
+			if err == nil && cmd == "DEL" {
+				_, err = s.vstore.Delete(ctx, keyA, keyB, s.timestampMicro())
+			}
+			if err != nil {
+				writeError(w, "ERR "+err.Error())
+				return false
+			}
+			n++
+		}
+		writeInt(w, n)
+	case "TTL", "PTTL":
+		if len(args) != 1 {
+			wrongArgs(w, cmd)
+			break
+		}
+		keyA, keyB := api.KeyHash(args[0])
+		_, _, ttl, err := s.vstore.ReadTTL(ctx, keyA, keyB, nil)
+		switch {
+		case errors.Is(err, api.ErrNotFound):
+			writeInt(w, -2)
+		case err != nil:
+			writeError(w, "ERR "+err.Error())
+		case ttl == 0:
+			writeInt(w, -1)
+		case cmd == "PTTL":
+			writeInt(w, int64(ttl/time.Millisecond))
+		default:
+			writeInt(w, int64((ttl+time.Second/2)/time.Second))
+		}
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(cmd)))
+	}
+	return false
+}
+
+// set handles SET key value [EX seconds|PX milliseconds].
+func (s *redisServer) set(ctx context.Context, w *bufio.Writer, args [][]byte) {
+	if len(args) < 2 {
+		wrongArgs(w, "SET")
+		return
+	}
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if (opt != "EX" && opt != "PX") || i+1 >= len(args) || ttl != 0 {
+			writeError(w, "ERR syntax error")
+			return
+		}
+		i++
+		n, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, "ERR invalid expire time in 'set' command")
+			return
+		}
+		if opt == "EX" {
+			ttl = time.Duration(n) * time.Second
+		} else {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+	}
+	// The stores cannot hold a zero length value.
+	if len(args[1]) == 0 {
+		writeError(w, "ERR empty values are not supported")
+		return
+	}
+	keyA, keyB := api.KeyHash(args[0])
+	var err error
+	if ttl > 0 {
+		_, err = s.vstore.WriteTTL(ctx, keyA, keyB, s.timestampMicro(), args[1], ttl)
+	} else {
+		_, err = s.vstore.Write(ctx, keyA, keyB, s.timestampMicro(), args[1])
+	}
+	if err != nil {
+		writeError(w, "ERR "+err.Error())
+		return
+	}
+	writeSimple(w, "OK")
+}
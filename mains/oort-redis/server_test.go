@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func TestRedisCommands(t *testing.T) {
+	vstore, _ := api.NewMemReplValueStore(3, &api.ReplValueStoreConfig{ReplStoreConfig: api.ReplStoreConfig{ExpiringValues: true}})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go newRedisServer(vstore).serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for _, c := range []struct {
+		send   string
+		expect []string
+	}{
+		{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nhello\r\n", []string{"+OK"}},
+		{"GET k\r\n", []string{"$5", "hello"}},
+		{"TTL k\r\n", []string{":-1"}},
+		{"SET t v EX 100\r\n", []string{"+OK"}},
+		{"TTL t\r\n", []string{":100"}},
+		{"EXISTS k t missing\r\n", []string{":2"}},
+		{"DEL k missing\r\n", []string{":1"}},
+		{"GET k\r\n", []string{"$-1"}},
+		{"TTL k\r\n", []string{":-2"}},
+		{"NOPE\r\n", []string{"-ERR unknown command 'nope'"}},
+	} {
+		if _, err := conn.Write([]byte(c.send)); err != nil {
+			t.Fatal(err)
+		}
+		for _, expect := range c.expect {
+			line, err := readLine(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(line) != expect {
+				t.Fatalf("%q: expected %q; got %q", c.send, expect, line)
+			}
+		}
+	}
+}
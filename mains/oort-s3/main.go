@@ -0,0 +1,87 @@
+// oort-s3 serves a minimal S3 API backed by an oort group store, so existing
+// S3 tooling can keep objects in an oort cluster. Requests must use path
+// style addressing, http://host/bucket/key, and are not authenticated, so it
+// should only be reachable by trusted clients.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/pandemicsyn/ftls"
+	"github.com/pandemicsyn/oort/api"
+)
+
+var (
+	printVersionInfo = flag.Bool("version", false, "print version/build info")
+)
+
+var oortS3Version string
+var buildDate string
+var goVersion string
+
+func main() {
+	flag.Parse()
+	if *printVersionInfo {
+		fmt.Println("oort-s3 version:", oortS3Version)
+		fmt.Println("build date:", buildDate)
+		fmt.Println("go version:", goVersion)
+		return
+	}
+
+	cfg := resolveConfig(nil)
+	var logDebug func(formt string, args ...interface{})
+	if cfg.debug {
+		logDebug = func(formt string, args ...interface{}) {
+			log.Printf("DEBUG: "+formt, args...)
+		}
+	}
+
+	tlsConfig := &ftls.Config{
+		MutualTLS:          !cfg.skipMutualTLS,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CertFile:           path.Join(cfg.path, "client.crt"),
+		KeyFile:            path.Join(cfg.path, "client.key"),
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	}
+	rOpts, err := ftls.NewGRPCClientDialOpt(&ftls.Config{
+		MutualTLS:          false,
+		InsecureSkipVerify: cfg.insecureSkipVerify,
+		CAFile:             path.Join(cfg.path, "ca.pem"),
+	})
+	if err != nil {
+		log.Fatalln("Cannot setup group store tls config for synd client:", err)
+	}
+
+	clientID, _ := os.Hostname()
+	if clientID != "" {
+		clientID += "/oort-s3"
+	}
+
+	gstore := api.NewReplGroupStore(&api.ReplGroupStoreConfig{
+		ReplStoreConfig: api.ReplStoreConfig{
+			LogDebug:                   logDebug,
+			AddressIndex:               2,
+			StoreFTLSConfig:            tlsConfig,
+			RingServer:                 cfg.oortGroupSyndicate,
+			RingCachePath:              path.Join(cfg.path, "ring/groupstore.ring"),
+			RingServerGRPCOpts:         []grpc.DialOption{rOpts},
+			RingClientID:               clientID,
+			ConcurrentRequestsPerStore: cfg.concurrentRequestsPerStore,
+			FramedValues:               true,
+		},
+	})
+	if err := gstore.Startup(context.Background()); err != nil {
+		log.Fatalln("Cannot start groupstore connector:", err)
+	}
+
+	log.Printf("Starting oort-s3 on %s...\n", cfg.listenAddr)
+	log.Fatal(http.ListenAndServe(cfg.listenAddr, newS3Server(gstore)))
+}
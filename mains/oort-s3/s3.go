@@ -0,0 +1,455 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+// uploadsBucket is the bucket multipart uploads in progress are kept in; the
+// upload itself under its ID, and each part under the ID and part number.
+const uploadsBucket = ".oort-s3-multipart"
+
+// Object metadata keys for the settings kept with each object, which cannot
+// collide with the lowercase names of x-amz-meta- headers.
+const (
+	metaContentType = "Content-Type"
+	metaBucket      = "Bucket"
+	metaKey         = "Key"
+)
+
+type s3Server struct {
+	gstore  *api.ReplGroupStore
+	uploads *api.ObjectStore
+}
+
+func newS3Server(gstore *api.ReplGroupStore) *s3Server {
+	return &s3Server{gstore: gstore, uploads: api.NewObjectStore(gstore, uploadsBucket)}
+}
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Buckets []string `xml:"Buckets>Bucket>Name"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	Marker                string `xml:",omitempty"`
+	NextMarker            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []listObject
+	CommonPrefixes        []commonPrefix
+}
+
+type listObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completeMultipartUpload struct {
+	Parts []completePart `xml:"Part"`
+}
+
+type completePart struct {
+	PartNumber int
+	ETag       string
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.TrimPrefix(r.URL.Path, "/")
+	var key string
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket, key = bucket[:i], bucket[i+1:]
+	}
+	q := r.URL.Query()
+	switch {
+	case bucket == "":
+		if r.Method != "GET" {
+			writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "")
+			return
+		}
+		// Buckets are created implicitly and there is no way to enumerate
+		// them.
+		writeXML(w, http.StatusOK, &listAllMyBucketsResult{})
+	case bucket == uploadsBucket:
+		writeError(w, r, http.StatusForbidden, "AccessDenied", "reserved bucket")
+	case key == "":
+		switch r.Method {
+		case "PUT", "HEAD":
+			w.WriteHeader(http.StatusOK)
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		case "GET":
+			s.listObjects(w, r, bucket)
+		default:
+			writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "")
+		}
+	case r.Method == "POST" && hasParam(q, "uploads"):
+		s.initiateUpload(w, r, bucket, key)
+	case r.Method == "POST" && q.Get("uploadId") != "":
+		s.completeUpload(w, r, bucket, key, q.Get("uploadId"))
+	case r.Method == "PUT" && q.Get("uploadId") != "":
+		s.putPart(w, r, q.Get("uploadId"), q.Get("partNumber"))
+	case r.Method == "DELETE" && q.Get("uploadId") != "":
+		s.abortUpload(w, r, q.Get("uploadId"))
+	case r.Method == "PUT":
+		s.putObject(w, r, bucket, key)
+	case r.Method == "GET" || r.Method == "HEAD":
+		s.getObject(w, r, bucket, key)
+	case r.Method == "DELETE":
+		if _, err := api.NewObjectStore(s.gstore, bucket).Delete(context.Background(), key); err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "")
+	}
+}
+
+func hasParam(q map[string][]string, name string) bool {
+	_, ok := q[name]
+	return ok
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error writing response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeXML(w, status, &s3Error{Code: code, Message: message, Resource: r.URL.Path})
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, api.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", err.Error())
+		return
+	}
+	log.Printf("error with %s %s: %s", r.Method, r.URL.Path, err)
+	writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+}
+
+func etag(info *api.ObjectInfo) string {
+	return `"` + info.MD5 + `"`
+}
+
+func lastModified(info *api.ObjectInfo) time.Time {
+	return time.Unix(0, info.TimestampMicro*1000).UTC()
+}
+
+// requestMeta returns the metadata to store with an object from the
+// request's headers.
+func requestMeta(r *http.Request) map[string]string {
+	meta := map[string]string{}
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-meta-") && len(values) > 0 {
+			meta[name[len("x-amz-meta-"):]] = values[0]
+		}
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		meta[metaContentType] = ct
+	}
+	return meta
+}
+
+func (s *s3Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	info, err := api.NewObjectStore(s.gstore, bucket).Put(context.Background(), key, r.Body, requestMeta(r))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(info))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	o := api.NewObjectStore(s.gstore, bucket)
+	ctx := context.Background()
+	info, err := o.Head(ctx, key)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	h := w.Header()
+	for name, value := range info.Meta {
+		switch name {
+		case metaContentType:
+			h.Set("Content-Type", value)
+		default:
+			h.Set("x-amz-meta-"+name, value)
+		}
+	}
+	h.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	h.Set("ETag", etag(info))
+	h.Set("Last-Modified", lastModified(info).Format(http.TimeFormat))
+	if r.Method == "HEAD" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// Once the body has started the status cannot change, so an error now
+	// can only be logged; the client sees a short body.
+	if _, err := o.Get(ctx, key, w); err != nil {
+		log.Printf("error with %s %s: %s", r.Method, r.URL.Path, err)
+	}
+}
+
+// listObjects serves both versions of the list objects call. The keys are
+// listed in hashed order rather than sorted, and the continuation token, or
+// marker, is an opaque cursor; clients that send the last key listed as the
+// marker, rather than the NextMarker given, are not supported.
+func (s *s3Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	res := &listBucketResult{Name: bucket, Prefix: q.Get("prefix"), Delimiter: q.Get("delimiter"), MaxKeys: 1000}
+	if mk := q.Get("max-keys"); mk != "" {
+		n, err := strconv.Atoi(mk)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+			return
+		}
+		res.MaxKeys = n
+	}
+	cursor := q.Get("marker")
+	if v2 {
+		cursor = q.Get("continuation-token")
+		res.ContinuationToken = cursor
+	} else {
+		res.Marker = cursor
+	}
+	prefixes := map[string]bool{}
+	var next string
+	err := api.NewObjectStore(s.gstore, bucket).List(context.Background(), res.Prefix, cursor, func(info *api.ObjectInfo, c string) bool {
+		if res.KeyCount >= res.MaxKeys {
+			res.IsTruncated = true
+			return false
+		}
+		if res.Delimiter != "" {
+			if i := strings.Index(info.Key[len(res.Prefix):], res.Delimiter); i >= 0 {
+				p := info.Key[:len(res.Prefix)+i+len(res.Delimiter)]
+				if !prefixes[p] {
+					prefixes[p] = true
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: p})
+					res.KeyCount++
+				}
+				next = c
+				return true
+			}
+		}
+		res.Contents = append(res.Contents, listObject{
+			Key:          info.Key,
+			LastModified: lastModified(info).Format(time.RFC3339),
+			ETag:         etag(info),
+			Size:         info.Size,
+			StorageClass: "STANDARD",
+		})
+		res.KeyCount++
+		next = c
+		return true
+	})
+	if err != nil {
+		if errors.Is(err, api.ErrInvalidCursor) {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+		writeStoreError(w, r, err)
+		return
+	}
+	if res.IsTruncated {
+		if v2 {
+			res.NextContinuationToken = next
+		} else {
+			res.NextMarker = next
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *s3Server) initiateUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	id := hex.EncodeToString(b)
+	meta := requestMeta(r)
+	meta[metaBucket] = bucket
+	meta[metaKey] = key
+	if _, err := s.uploads.Put(context.Background(), id, strings.NewReader(""), meta); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadId: id})
+}
+
+// upload returns the ObjectInfo the upload was initiated with, having
+// written an error response if there is no such upload.
+func (s *s3Server) upload(w http.ResponseWriter, r *http.Request, id string) *api.ObjectInfo {
+	info, err := s.uploads.Head(context.Background(), id)
+	if errors.Is(err, api.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", id)
+		return nil
+	}
+	if err != nil {
+		writeStoreError(w, r, err)
+		return nil
+	}
+	return info
+}
+
+func partKey(id string, partNumber int) string {
+	return fmt.Sprintf("%s/%05d", id, partNumber)
+}
+
+func (s *s3Server) putPart(w http.ResponseWriter, r *http.Request, id, partNumber string) {
+	n, err := strconv.Atoi(partNumber)
+	if err != nil || n < 1 || n > 10000 {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid partNumber")
+		return
+	}
+	if s.upload(w, r, id) == nil {
+		return
+	}
+	info, err := s.uploads.Put(context.Background(), partKey(id, n), r.Body, nil)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(info))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *s3Server) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key, id string) {
+	ctx := context.Background()
+	upload := s.upload(w, r, id)
+	if upload == nil {
+		return
+	}
+	if upload.Meta[metaBucket] != bucket || upload.Meta[metaKey] != key {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", id)
+		return
+	}
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "")
+		return
+	}
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, r, http.StatusBadRequest, "InvalidPartOrder", "")
+			return
+		}
+		info, err := s.uploads.Head(ctx, partKey(id, p.PartNumber))
+		if err != nil || strings.Trim(p.ETag, `"`) != info.MD5 {
+			writeError(w, r, http.StatusBadRequest, "InvalidPart", strconv.Itoa(p.PartNumber))
+			return
+		}
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		for _, p := range req.Parts {
+			if _, err := s.uploads.Get(ctx, partKey(id, p.PartNumber), pw); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	meta := upload.Meta
+	delete(meta, metaBucket)
+	delete(meta, metaKey)
+	info, err := api.NewObjectStore(s.gstore, bucket).Put(ctx, key, pr, meta)
+	// Unblocks the goroutine above if Put stopped reading early.
+	pr.CloseWithError(errors.New("upload ended"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if err := s.removeUpload(id); err != nil {
+		log.Printf("error removing completed upload %s: %s", id, err)
+	}
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: etag(info)})
+}
+
+func (s *s3Server) abortUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if s.upload(w, r, id) == nil {
+		return
+	}
+	if err := s.removeUpload(id); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeUpload deletes the upload's parts and then the upload itself.
+func (s *s3Server) removeUpload(id string) error {
+	ctx := context.Background()
+	var parts []string
+	if err := s.uploads.List(ctx, id+"/", "", func(info *api.ObjectInfo, cursor string) bool {
+		parts = append(parts, info.Key)
+		return true
+	}); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := s.uploads.Delete(ctx, p); err != nil {
+			return err
+		}
+	}
+	_, err := s.uploads.Delete(ctx, id)
+	return err
+}
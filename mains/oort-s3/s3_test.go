@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method == "PUT" {
+		req.Header.Set("x-amz-meta-color", "blue")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestS3Objects(t *testing.T) {
+	gstore, _ := api.NewMemReplGroupStore(3, &api.ReplGroupStoreConfig{ReplStoreConfig: api.ReplStoreConfig{StreamChunkSize: 4, FramedValues: true}})
+	srv := httptest.NewServer(newS3Server(gstore))
+	defer srv.Close()
+	if resp, _ := do(t, srv, "PUT", "/b/dir/a", "hello world"); resp.StatusCode != 200 || resp.Header.Get("ETag") == "" {
+		t.Fatalf("unexpected put response: %v", resp.Status)
+	}
+	resp, body := do(t, srv, "GET", "/b/dir/a", "")
+	if resp.StatusCode != 200 || body != "hello world" || resp.Header.Get("x-amz-meta-color") != "blue" {
+		t.Fatalf("unexpected get: %v %q", resp.Status, body)
+	}
+	do(t, srv, "PUT", "/b/top", "x")
+	resp, body = do(t, srv, "GET", "/b?list-type=2&delimiter=/", "")
+	var list listBucketResult
+	if err := xml.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Contents) != 1 || list.Contents[0].Key != "top" || len(list.CommonPrefixes) != 1 || list.CommonPrefixes[0].Prefix != "dir/" {
+		t.Fatalf("unexpected list: %s", body)
+	}
+	if resp, _ := do(t, srv, "DELETE", "/b/dir/a", ""); resp.StatusCode != 204 {
+		t.Fatalf("unexpected delete response: %v", resp.Status)
+	}
+	if resp, _ := do(t, srv, "GET", "/b/dir/a", ""); resp.StatusCode != 404 {
+		t.Fatalf("expected 404 after delete; got %v", resp.Status)
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	gstore, _ := api.NewMemReplGroupStore(3, &api.ReplGroupStoreConfig{ReplStoreConfig: api.ReplStoreConfig{FramedValues: true}})
+	srv := httptest.NewServer(newS3Server(gstore))
+	defer srv.Close()
+	_, body := do(t, srv, "POST", "/b/big?uploads", "")
+	var initiated initiateMultipartUploadResult
+	if err := xml.Unmarshal([]byte(body), &initiated); err != nil || initiated.UploadId == "" {
+		t.Fatalf("unexpected initiate: %s %v", body, err)
+	}
+	id := initiated.UploadId
+	resp1, _ := do(t, srv, "PUT", "/b/big?partNumber=1&uploadId="+id, "part one ")
+	resp2, _ := do(t, srv, "PUT", "/b/big?partNumber=2&uploadId="+id, "part two")
+	complete := "<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>" + resp1.Header.Get("ETag") + "</ETag></Part><Part><PartNumber>2</PartNumber><ETag>" + resp2.Header.Get("ETag") + "</ETag></Part></CompleteMultipartUpload>"
+	if resp, body := do(t, srv, "POST", "/b/big?uploadId="+id, complete); resp.StatusCode != 200 {
+		t.Fatalf("unexpected complete: %v %s", resp.Status, body)
+	}
+	if resp, body := do(t, srv, "GET", "/b/big", ""); resp.StatusCode != 200 || body != "part one part two" {
+		t.Fatalf("unexpected get: %v %q", resp.Status, body)
+	}
+	if resp, _ := do(t, srv, "PUT", "/b/big?partNumber=3&uploadId="+id, "late"); resp.StatusCode != 404 {
+		t.Fatalf("expected the completed upload to be gone; got %v", resp.Status)
+	}
+}
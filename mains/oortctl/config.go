@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config is read from the TOML file given with -config, or OORTCTL_CONFIG,
+// with any flags given on the command line taking precedence.
+type config struct {
+	// Path holds ca.pem, client.crt, and client.key, and the ring caches.
+	Path               string
+	ValueSyndicate     string
+	GroupSyndicate     string
+	InsecureSkipVerify bool
+	SkipMutualTLS      bool
+}
+
+var (
+	configFile         = flag.String("config", "", "TOML config file; defaults to $OORTCTL_CONFIG")
+	cfgPath            = flag.String("path", "/etc/oort/oortctl", "directory of ca.pem, client.crt, client.key, and the ring caches")
+	valueSyndicate     = flag.String("value-syndicate", "", "value store ring server address; empty for default SRV resolution")
+	groupSyndicate     = flag.String("group-syndicate", "", "group store ring server address; empty for default SRV resolution")
+	insecureSkipVerify = flag.Bool("insecure", false, "skip verifying server certificates")
+	skipMutualTLS      = flag.Bool("skip-mutual-tls", false, "do not present a client certificate")
+)
+
+func resolveConfig() (*config, error) {
+	cfg := &config{Path: *cfgPath}
+	name := *configFile
+	if name == "" {
+		name = os.Getenv("OORTCTL_CONFIG")
+	}
+	if name != "" {
+		if _, err := toml.DecodeFile(name, cfg); err != nil {
+			return nil, err
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "path":
+			cfg.Path = *cfgPath
+		case "value-syndicate":
+			cfg.ValueSyndicate = *valueSyndicate
+		case "group-syndicate":
+			cfg.GroupSyndicate = *groupSyndicate
+		case "insecure":
+			cfg.InsecureSkipVerify = *insecureSkipVerify
+		case "skip-mutual-tls":
+			cfg.SkipMutualTLS = *skipMutualTLS
+		}
+	})
+	return cfg, nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gholt/ring"
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+	"github.com/pandemicsyn/oort/api/bench"
+)
+
+const usage = `usage: oortctl [flags] <command> [args]
+
+Value store commands, or group store commands with -g:
+
+    get <key>                  get <group> <child>
+    put <key> <value>          put <group> <child> <value>
+    delete <key>               delete <group> <child>
+    lookup <key>               lookup <group> <child>
+                               list <group>
+
+A value of - is read from standard input. Keys are hashed with api.KeyHash
+unless -raw-keys is given, in which case each is keyA:keyB in decimal, or
+hex with a 0x prefix. With -replica, reads go to that backend address alone
+rather than the replicas the ring gives, to see what each one holds.
+
+Cluster commands, for the value store or with -g the group store:
+
+    ring                       print the ring's version, settings, and nodes
+    replicas <key>             print the partition and replicas for the key,
+                               or with -g for the group
+    partitions                 print every partition's replicas, and how
+                               many partitions each node holds, as JSON
+    health                     contact the store and print its health as JSON;
+                               exits non-zero unless every backend is connected
+    verify [<key>...]          read every replica of each key, reporting
+                               where they diverge; see -fix and -keys-file.
+                               With -g, verify <group> [<child>] checks one
+                               child or every child of the group. With
+                               -raw-keys, keyA:from-to checks a range.
+    bench                      generate load, reporting throughput and
+                               latency percentiles; see the bench flags
+`
+
+var errUsage = errors.New("bad usage")
+
+// ctl runs oortctl commands against stores opened on first use, so commands
+// for one store do not need the other's ring.
+type ctl struct {
+	out            io.Writer
+	in             io.Reader
+	group          bool
+	rawKeys        bool
+	replica        string
+	verifyFix      bool
+	verifyKeysFile string
+	benchConfig    bench.Config
+	benchGroups    int
+	newValueStore  func() (*api.ReplValueStore, error)
+	newGroupStore  func() (*api.ReplGroupStore, error)
+	vs             *api.ReplValueStore
+	gs             *api.ReplGroupStore
+}
+
+func (c *ctl) valueStore() (*api.ReplValueStore, error) {
+	if c.vs == nil {
+		vs, err := c.newValueStore()
+		if err != nil {
+			return nil, err
+		}
+		c.vs = vs
+	}
+	return c.vs, nil
+}
+
+func (c *ctl) groupStore() (*api.ReplGroupStore, error) {
+	if c.gs == nil {
+		gs, err := c.newGroupStore()
+		if err != nil {
+			return nil, err
+		}
+		c.gs = gs
+	}
+	return c.gs, nil
+}
+
+func (c *ctl) key(s string) (uint64, uint64, error) {
+	if !c.rawKeys {
+		keyA, keyB := api.KeyHashString(s)
+		return keyA, keyB, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("raw key %q is not keyA:keyB", s)
+	}
+	keyA, err := strconv.ParseUint(parts[0], 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("raw key %q: %s", s, err)
+	}
+	keyB, err := strconv.ParseUint(parts[1], 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("raw key %q: %s", s, err)
+	}
+	return keyA, keyB, nil
+}
+
+// keys parses the n keys of a value or group command from args, the first
+// of which is the command name, returning any arguments left after them.
+func (c *ctl) keys(args []string, n int) ([]uint64, []string, error) {
+	if len(args) < n+1 {
+		return nil, nil, errUsage
+	}
+	var keys []uint64
+	for _, arg := range args[1 : n+1] {
+		keyA, keyB, err := c.key(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, keyA, keyB)
+	}
+	return keys, args[n+1:], nil
+}
+
+func (c *ctl) value(arg string) ([]byte, error) {
+	if arg == "-" {
+		return ioutil.ReadAll(c.in)
+	}
+	return []byte(arg), nil
+}
+
+func nowMicro() int64 {
+	return time.Now().UnixNano() / 1000
+}
+
+func (c *ctl) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "ring":
+		return c.ring(ctx)
+	case "replicas":
+		return c.replicas(ctx, args[1:])
+	case "partitions":
+		return c.partitions(ctx)
+	case "health":
+		return c.health(ctx)
+	case "bench":
+		return c.bench(ctx)
+	case "verify":
+		return c.verify(ctx, args[1:])
+	}
+	if c.replica != "" {
+		ctx = api.WithReplica(ctx, c.replica)
+	}
+	if c.group {
+		return c.runGroup(ctx, args)
+	}
+	return c.runValue(ctx, args)
+}
+
+func (c *ctl) runValue(ctx context.Context, args []string) error {
+	keys, rest, err := c.keys(args, 1)
+	if err != nil {
+		return err
+	}
+	vs, err := c.valueStore()
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "get" && len(rest) == 0:
+		_, value, err := vs.Read(ctx, keys[0], keys[1], nil)
+		if err != nil {
+			return err
+		}
+		_, err = c.out.Write(value)
+		return err
+	case args[0] == "put" && len(rest) == 1:
+		value, err := c.value(rest[0])
+		if err != nil {
+			return err
+		}
+		_, err = vs.Write(ctx, keys[0], keys[1], nowMicro(), value)
+		return err
+	case args[0] == "delete" && len(rest) == 0:
+		_, err := vs.Delete(ctx, keys[0], keys[1], nowMicro())
+		return err
+	case args[0] == "lookup" && len(rest) == 0:
+		timestampMicro, length, err := vs.Lookup(ctx, keys[0], keys[1])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.out, "timestampMicro %d length %d\n", timestampMicro, length)
+		return err
+	}
+	return errUsage
+}
+
+func (c *ctl) runGroup(ctx context.Context, args []string) error {
+	if args[0] == "list" {
+		keys, rest, err := c.keys(args, 1)
+		if err != nil || len(rest) != 0 {
+			return errUsage
+		}
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		items, err := gs.LookupGroup(ctx, keys[0], keys[1])
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if _, err := fmt.Fprintf(c.out, "%d:%d timestampMicro %d length %d\n", item.ChildKeyA, item.ChildKeyB, item.TimestampMicro, item.Length); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	keys, rest, err := c.keys(args, 2)
+	if err != nil {
+		return err
+	}
+	gs, err := c.groupStore()
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "get" && len(rest) == 0:
+		_, value, err := gs.Read(ctx, keys[0], keys[1], keys[2], keys[3], nil)
+		if err != nil {
+			return err
+		}
+		_, err = c.out.Write(value)
+		return err
+	case args[0] == "put" && len(rest) == 1:
+		value, err := c.value(rest[0])
+		if err != nil {
+			return err
+		}
+		_, err = gs.Write(ctx, keys[0], keys[1], keys[2], keys[3], nowMicro(), value)
+		return err
+	case args[0] == "delete" && len(rest) == 0:
+		_, err := gs.Delete(ctx, keys[0], keys[1], keys[2], keys[3], nowMicro())
+		return err
+	case args[0] == "lookup" && len(rest) == 0:
+		timestampMicro, length, err := gs.Lookup(ctx, keys[0], keys[1], keys[2], keys[3])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.out, "timestampMicro %d length %d\n", timestampMicro, length)
+		return err
+	}
+	return errUsage
+}
+
+func (c *ctl) ring(ctx context.Context) error {
+	var r ring.Ring
+	if c.group {
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		r = gs.Ring(ctx)
+	} else {
+		vs, err := c.valueStore()
+		if err != nil {
+			return err
+		}
+		r = vs.Ring(ctx)
+	}
+	if r == nil {
+		return errors.New("no ring available")
+	}
+	fmt.Fprintf(c.out, "version %d (%s)\n", r.Version(), time.Unix(0, r.Version()).UTC().Format(time.RFC3339))
+	fmt.Fprintf(c.out, "partition bits %d, replicas %d, nodes %d\n", r.PartitionBitCount(), r.ReplicaCount(), r.NodeCount())
+	nodes := r.Nodes()
+	sort.Sort(nodesByID(nodes))
+	for _, n := range nodes {
+		fmt.Fprintf(c.out, "node %016x active %t capacity %d tiers %s addresses %s\n", n.ID(), n.Active(), n.Capacity(), strings.Join(n.Tiers(), ","), strings.Join(n.Addresses(), ","))
+	}
+	return nil
+}
+
+func (c *ctl) replicas(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	keyA, _, err := c.key(args[0])
+	if err != nil {
+		return err
+	}
+	var rns []api.ReplicaNode
+	if c.group {
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		if rns, err = gs.ReplicasFor(ctx, keyA); err != nil {
+			return err
+		}
+	} else {
+		vs, err := c.valueStore()
+		if err != nil {
+			return err
+		}
+		if rns, err = vs.ReplicasFor(ctx, keyA); err != nil {
+			return err
+		}
+	}
+	for _, rn := range rns {
+		fmt.Fprintf(c.out, "partition %d node %016x address %s\n", rn.Partition, rn.NodeID, rn.Addr)
+	}
+	return nil
+}
+
+func (c *ctl) partitions(ctx context.Context) error {
+	var m *api.PartitionMap
+	if c.group {
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		if m, err = gs.PartitionMap(ctx); err != nil {
+			return err
+		}
+	} else {
+		vs, err := c.valueStore()
+		if err != nil {
+			return err
+		}
+		if m, err = vs.PartitionMap(ctx); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s\n", b)
+	return nil
+}
+
+type nodesByID ring.NodeSlice
+
+func (ns nodesByID) Len() int           { return len(ns) }
+func (ns nodesByID) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
+func (ns nodesByID) Less(i, j int) bool { return ns[i].ID() < ns[j].ID() }
+
+// health looks up a random key, which contacts that key's replicas, before
+// reporting health, so a fresh process has something to report on them.
+func (c *ctl) health(ctx context.Context) error {
+	var h *api.ReplStoreHealth
+	keyA, keyB := uint64(rand.Int63()), uint64(rand.Int63())
+	if c.group {
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		gs.Lookup(ctx, keyA, keyB, 0, 0)
+		h = gs.Health(ctx)
+	} else {
+		vs, err := c.valueStore()
+		if err != nil {
+			return err
+		}
+		vs.Lookup(ctx, keyA, keyB)
+		h = vs.Health(ctx)
+	}
+	b, err := json.MarshalIndent(h, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s\n", b)
+	if !h.Ready {
+		return errors.New("not ready")
+	}
+	for _, b := range h.Backends {
+		if b.State == "failing" || b.State == "error" {
+			return fmt.Errorf("backend %s is %s", b.Addr, b.State)
+		}
+	}
+	return nil
+}
+
+// bench runs the benchmark set by benchConfig, printing the result.
+func (c *ctl) bench(ctx context.Context) error {
+	var target bench.Target
+	if c.group {
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		target = bench.GroupTarget(gs, c.benchGroups)
+	} else {
+		vs, err := c.valueStore()
+		if err != nil {
+			return err
+		}
+		target = bench.ValueTarget(vs)
+	}
+	res, err := bench.Run(ctx, target, &c.benchConfig)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(c.out, res)
+	return err
+}
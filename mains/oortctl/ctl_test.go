@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+	"github.com/pandemicsyn/oort/api/bench"
+)
+
+func TestCtl(t *testing.T) {
+	vs, _ := api.NewMemReplValueStore(3, nil)
+	gs, _ := api.NewMemReplGroupStore(3, nil)
+	var out bytes.Buffer
+	c := &ctl{out: &out, in: strings.NewReader("from stdin"), vs: vs, gs: gs, benchConfig: bench.Config{Requests: 50, ReadRatio: 0.5}}
+	ctx := context.Background()
+	run := func(group bool, args ...string) string {
+		out.Reset()
+		c.group = group
+		if err := c.run(ctx, args); err != nil {
+			t.Fatalf("%v: %s", args, err)
+		}
+		return out.String()
+	}
+	run(false, "put", "k", "v")
+	if s := run(false, "get", "k"); s != "v" {
+		t.Fatalf("expected v; got %q", s)
+	}
+	run(false, "put", "k", "-")
+	if s := run(false, "get", "k"); s != "from stdin" {
+		t.Fatalf("expected the value from stdin; got %q", s)
+	}
+	if s := run(false, "lookup", "k"); !strings.HasSuffix(s, "length 10\n") {
+		t.Fatalf("unexpected lookup %q", s)
+	}
+	run(false, "delete", "k")
+	if err := c.run(ctx, []string{"get", "k"}); !store.IsNotFound(err) {
+		t.Fatalf("expected not found; got %v", err)
+	}
+	run(true, "put", "g", "c", "gv")
+	if s := run(true, "get", "g", "c"); s != "gv" {
+		t.Fatalf("expected gv; got %q", s)
+	}
+	if s := run(true, "list", "g"); strings.Count(s, "\n") != 1 {
+		t.Fatalf("unexpected list %q", s)
+	}
+	c.rawKeys = true
+	run(false, "put", "1:0x2", "raw")
+	if _, v, err := vs.Read(ctx, 1, 2, nil); err != nil || string(v) != "raw" {
+		t.Fatalf("raw key write not found: %q %v", v, err)
+	}
+	c.rawKeys = false
+	c.replica = "nowhere:1"
+	if err := c.run(ctx, []string{"get", "k"}); err == nil {
+		t.Fatal("expected an error reading from an unknown replica")
+	}
+	c.replica = ""
+	if s := run(true, "replicas", "g"); strings.Count(s, "\n") != 3 {
+		t.Fatalf("unexpected replicas %q", s)
+	}
+	if s := run(false, "partitions"); !strings.Contains(s, `"primaries"`) {
+		t.Fatalf("unexpected partitions %q", s)
+	}
+	if s := run(false, "ring"); !strings.Contains(s, "replicas 3, nodes 3") {
+		t.Fatalf("unexpected ring %q", s)
+	}
+	if s := run(true, "health"); !strings.Contains(s, `"ready": true`) {
+		t.Fatalf("unexpected health %q", s)
+	}
+	if s := run(false, "bench"); !strings.HasPrefix(s, "50 requests") || !strings.Contains(s, "\nread ") {
+		t.Fatalf("unexpected bench %q", s)
+	}
+	if err := c.run(ctx, []string{"get"}); err != errUsage {
+		t.Fatalf("expected errUsage; got %v", err)
+	}
+}
+
+func TestCtlVerify(t *testing.T) {
+	vs, vms := api.NewMemReplValueStore(3, nil)
+	gs, gms := api.NewMemReplGroupStore(3, nil)
+	var out bytes.Buffer
+	c := &ctl{out: &out, vs: vs, gs: gs, rawKeys: true}
+	ctx := context.Background()
+	vms[0].Write(ctx, 1, 5, 10, []byte("v"))
+	if err := c.run(ctx, []string{"verify", "1:1-10"}); err == nil || !strings.Contains(out.String(), "checked 10, divergent 1, fixed 0") {
+		t.Fatalf("unexpected verify %v %q", err, out.String())
+	}
+	out.Reset()
+	c.verifyFix = true
+	if err := c.run(ctx, []string{"verify", "1:5"}); err != nil || !strings.Contains(out.String(), "checked 1, divergent 1, fixed 1") {
+		t.Fatalf("unexpected verify %v %q", err, out.String())
+	}
+	out.Reset()
+	c.group = true
+	gms[2].Write(ctx, 1, 2, 3, 4, 10, []byte("v"))
+	if err := c.run(ctx, []string{"verify", "1:2"}); err != nil || !strings.Contains(out.String(), "1:2 3:4:\n") {
+		t.Fatalf("unexpected verify %v %q", err, out.String())
+	}
+}
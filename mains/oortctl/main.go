@@ -0,0 +1,163 @@
+// oortctl runs single operations against an oort cluster through the
+// replicated value and group store clients: getting, putting, and deleting
+// keys, dumping ring information, checking health, and benchmarking. Run
+// oortctl -h for its commands. Settings come from flags or a TOML config
+// file; see config.go.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/pandemicsyn/ftls"
+	"github.com/pandemicsyn/oort/api"
+	"github.com/pandemicsyn/oort/api/bench"
+)
+
+var (
+	printVersionInfo = flag.Bool("version", false, "print version/build info")
+	groupMode        = flag.Bool("g", false, "use the group store")
+	rawKeys          = flag.Bool("raw-keys", false, "take keys as keyA:keyB rather than hashing them")
+	replica          = flag.String("replica", "", "get, lookup, list: read only from the backend at this address")
+	verifyFix        = flag.Bool("fix", false, "verify: repair replicas missing keys or behind")
+	verifyKeysFile   = flag.String("keys-file", "", "verify: file of keys to check, one per line")
+	benchRequests    = flag.Int("n", 10000, "bench: number of requests, if -duration is not given")
+	benchDuration    = flag.Duration("duration", 0, "bench: how long to run for")
+	benchWorkers     = flag.Int("c", 16, "bench: concurrent requests")
+	benchKeys        = flag.Int("keys", 10000, "bench: number of distinct keys")
+	benchDist        = flag.String("dist", "uniform", "bench: key distribution; uniform, zipf, or sequential")
+	benchSize        = flag.Int("size", 128, "bench: value size in bytes")
+	benchSizeMax     = flag.Int("size-max", 0, "bench: if above -size, values are sized at random up to this")
+	benchReadRatio   = flag.Float64("read-ratio", 0, "bench: fraction of requests that are reads")
+	benchDeleteRatio = flag.Float64("delete-ratio", 0, "bench: fraction of requests that are deletes")
+	benchPrefill     = flag.Bool("prefill", false, "bench: write every key before the run")
+	benchGroups      = flag.Int("groups", 100, "bench: number of groups to spread keys across with -g")
+)
+
+var oortctlVersion string
+var buildDate string
+var goVersion string
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage, "\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *printVersionInfo {
+		fmt.Println("oortctl version:", oortctlVersion)
+		fmt.Println("build date:", buildDate)
+		fmt.Println("go version:", goVersion)
+		return
+	}
+	cfg, err := resolveConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config:", err)
+		os.Exit(2)
+	}
+
+	tlsConfig := &ftls.Config{
+		MutualTLS:          !cfg.SkipMutualTLS,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		CertFile:           path.Join(cfg.Path, "client.crt"),
+		KeyFile:            path.Join(cfg.Path, "client.key"),
+		CAFile:             path.Join(cfg.Path, "ca.pem"),
+	}
+	ringTLSConfig := &ftls.Config{
+		MutualTLS:          false,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		CAFile:             path.Join(cfg.Path, "ca.pem"),
+	}
+	clientID, _ := os.Hostname()
+	if clientID != "" {
+		clientID += "/oortctl"
+	}
+	ctx := context.Background()
+	dists := map[string]bench.Distribution{"uniform": bench.Uniform, "zipf": bench.Zipf, "sequential": bench.Sequential}
+	dist, ok := dists[*benchDist]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown -dist", *benchDist)
+		os.Exit(2)
+	}
+
+	c := &ctl{
+		out:            os.Stdout,
+		in:             os.Stdin,
+		group:          *groupMode,
+		rawKeys:        *rawKeys,
+		replica:        *replica,
+		verifyFix:      *verifyFix,
+		verifyKeysFile: *verifyKeysFile,
+		benchConfig: bench.Config{
+			Duration:     *benchDuration,
+			Requests:     *benchRequests,
+			Concurrency:  *benchWorkers,
+			Keys:         *benchKeys,
+			Distribution: dist,
+			ValueSize:    *benchSize,
+			ValueSizeMax: *benchSizeMax,
+			ReadRatio:    *benchReadRatio,
+			DeleteRatio:  *benchDeleteRatio,
+			Prefill:      *benchPrefill,
+		},
+		benchGroups: *benchGroups,
+		newValueStore: func() (*api.ReplValueStore, error) {
+			rOpts, err := ftls.NewGRPCClientDialOpt(ringTLSConfig)
+			if err != nil {
+				return nil, err
+			}
+			vs := api.NewReplValueStore(&api.ReplValueStoreConfig{
+				ReplStoreConfig: api.ReplStoreConfig{
+					AddressIndex:       2,
+					StoreFTLSConfig:    tlsConfig,
+					RingServer:         cfg.ValueSyndicate,
+					RingCachePath:      path.Join(cfg.Path, "ring/valuestore.ring"),
+					RingServerGRPCOpts: []grpc.DialOption{rOpts},
+					RingClientID:       clientID,
+				},
+			})
+			return vs, vs.Startup(ctx)
+		},
+		newGroupStore: func() (*api.ReplGroupStore, error) {
+			rOpts, err := ftls.NewGRPCClientDialOpt(ringTLSConfig)
+			if err != nil {
+				return nil, err
+			}
+			gs := api.NewReplGroupStore(&api.ReplGroupStoreConfig{
+				ReplStoreConfig: api.ReplStoreConfig{
+					AddressIndex:       2,
+					StoreFTLSConfig:    tlsConfig,
+					RingServer:         cfg.GroupSyndicate,
+					RingCachePath:      path.Join(cfg.Path, "ring/groupstore.ring"),
+					RingServerGRPCOpts: []grpc.DialOption{rOpts},
+					RingClientID:       clientID,
+				},
+			})
+			return gs, gs.Startup(ctx)
+		},
+	}
+	err = c.run(ctx, flag.Args())
+	if c.vs != nil {
+		c.vs.Shutdown(ctx)
+	}
+	if c.gs != nil {
+		c.gs.Shutdown(ctx)
+	}
+	switch {
+	case err == errUsage:
+		flag.Usage()
+		os.Exit(2)
+	case store.IsNotFound(err):
+		fmt.Fprintln(os.Stderr, "not found")
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/pandemicsyn/oort/api"
+)
+
+// maxVerifyRange bounds a raw key range given to verify, so a typo does not
+// start a scan of billions of keys.
+const maxVerifyRange = 10000000
+
+// verifyTargets returns the keys verify should check: those in args, or
+// else those listed one per line in verifyKeysFile. In group mode each is a
+// group key optionally followed by a child key; a group alone means every
+// child in it.
+func (c *ctl) verifyTargets(args []string) ([][]string, error) {
+	var targets [][]string
+	if c.verifyKeysFile == "" {
+		if len(args) == 0 {
+			return nil, errUsage
+		}
+		if c.group {
+			if len(args) > 2 {
+				return nil, errUsage
+			}
+			return [][]string{args}, nil
+		}
+		for _, arg := range args {
+			targets = append(targets, []string{arg})
+		}
+		return targets, nil
+	}
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	f, err := os.Open(c.verifyKeysFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 || (len(fields) == 2 && !c.group) {
+			return nil, fmt.Errorf("%s: bad line %q", c.verifyKeysFile, scanner.Text())
+		}
+		targets = append(targets, fields)
+	}
+	return targets, scanner.Err()
+}
+
+// expandRawRange expands a raw keyA:from-to key into each key in the range,
+// or returns just the key given if it is not a range.
+func (c *ctl) expandRawRange(s string) ([]string, error) {
+	i := strings.Index(s, ":")
+	j := strings.LastIndex(s, "-")
+	if !c.rawKeys || i < 0 || j < i {
+		return []string{s}, nil
+	}
+	from, err := strconv.ParseUint(s[i+1:j], 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("raw key range %q: %s", s, err)
+	}
+	to, err := strconv.ParseUint(s[j+1:], 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("raw key range %q: %s", s, err)
+	}
+	if to < from || to-from >= maxVerifyRange {
+		return nil, fmt.Errorf("raw key range %q is empty or over %d keys", s, maxVerifyRange)
+	}
+	var keys []string
+	for k := from; ; k++ {
+		keys = append(keys, fmt.Sprintf("%s:%d", s[:i], k))
+		if k == to {
+			break
+		}
+	}
+	return keys, nil
+}
+
+// verify checks each key's replicas agree, printing the problems of those
+// that do not and, with verifyFix, repairing the replicas behind.
+func (c *ctl) verify(ctx context.Context, args []string) error {
+	targets, err := c.verifyTargets(args)
+	if err != nil {
+		return err
+	}
+	var checked, divergent, fixed int
+	report := func(name string, problems []string, wasFixed bool) {
+		checked++
+		if len(problems) == 0 {
+			return
+		}
+		divergent++
+		if wasFixed {
+			fixed++
+		}
+		fmt.Fprintf(c.out, "%s:\n", name)
+		for _, p := range problems {
+			fmt.Fprintf(c.out, "    %s\n", p)
+		}
+		if wasFixed {
+			fmt.Fprintf(c.out, "    fixed\n")
+		}
+	}
+	if c.group {
+		gs, err := c.groupStore()
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			keyA, keyB, err := c.key(target[0])
+			if err != nil {
+				return err
+			}
+			var results []*api.GroupVerifyResult
+			if len(target) == 2 {
+				childKeyA, childKeyB, err := c.key(target[1])
+				if err != nil {
+					return err
+				}
+				res, err := gs.Verify(ctx, keyA, keyB, childKeyA, childKeyB, c.verifyFix)
+				if err != nil {
+					return err
+				}
+				results = append(results, res)
+			} else if results, err = gs.VerifyGroup(ctx, keyA, keyB, c.verifyFix); err != nil {
+				return err
+			}
+			for _, res := range results {
+				report(fmt.Sprintf("%s %d:%d", target[0], res.ChildKeyA, res.ChildKeyB), res.Problems, res.Fixed)
+			}
+		}
+	} else {
+		vs, err := c.valueStore()
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			names, err := c.expandRawRange(target[0])
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				keyA, keyB, err := c.key(name)
+				if err != nil {
+					return err
+				}
+				res, err := vs.Verify(ctx, keyA, keyB, c.verifyFix)
+				if err != nil {
+					return err
+				}
+				report(name, res.Problems, res.Fixed)
+			}
+		}
+	}
+	fmt.Fprintf(c.out, "checked %d, divergent %d, fixed %d\n", checked, divergent, fixed)
+	if divergent > fixed {
+		return errors.New("replicas diverge")
+	}
+	return nil
+}